@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Thresholds for the adaptive capacity controller: it grows when at least
+// adaptGrowMissRatio of lookups miss while entries are being evicted young,
+// and shrinks when at least adaptShrinkHitRatio hit and the coldest
+// 1/adaptTailFraction of entries, at most adaptTailMax of them, saw no reads
+// during the interval. Each step moves the capacity by an eighth.
+const (
+	adaptGrowMissRatio  = 0.2
+	adaptShrinkHitRatio = 0.95
+	adaptTailFraction   = 10
+	adaptTailMax        = 1024
+	adaptHistory        = 64
+)
+
+// CapacityAdjustment records one change made by the adaptive controller.
+type CapacityAdjustment struct {
+	At       time.Time `json:"at"`
+	From     int       `json:"from"`
+	To       int       `json:"to"`
+	HitRatio float64   `json:"hit_ratio"`
+}
+
+type adaptiveCapacity struct {
+	min, max int
+	interval time.Duration
+	disabled atomic.Bool
+
+	// young counts evictions of entries younger than interval; it is only
+	// written under the cache's write lock.
+	young int64
+
+	mu          sync.Mutex
+	windowStart time.Time
+	hits        int64
+	misses      int64
+	history     []CapacityAdjustment
+	adjustments int64
+}
+
+// WithAdaptiveCapacity lets the cache tune its own capacity between min and
+// max, checking the hit ratio every interval. It grows the cache while misses
+// are frequent and entries are evicted within an interval of being added,
+// and shrinks it while nearly every lookup hits and the coldest entries go
+// unread. Adjustments go through Resize and are listed by
+// CapacityAdjustments. The interval is timed by the cache's clock if it is a
+// TickingClock.
+func WithAdaptiveCapacity(min, max int, interval time.Duration) Option {
+	return func(c *SecureLRUCache) error {
+		if min < 1 || max < min {
+			return fmt.Errorf("adaptive capacity needs 1 <= min <= max")
+		}
+		if interval <= 0 {
+			return fmt.Errorf("adaptive capacity interval must be positive")
+		}
+		c.adaptive = &adaptiveCapacity{min: min, max: max, interval: interval}
+		return nil
+	}
+}
+
+// DisableAdaptation stops the adaptive controller from changing the
+// capacity again. The capacity stays where the controller left it.
+func (c *SecureLRUCache) DisableAdaptation() {
+	if c.adaptive != nil {
+		c.adaptive.disabled.Store(true)
+	}
+}
+
+// CapacityAdjustments returns the controller's most recent adjustments,
+// oldest first, and how many it has made in total.
+func (c *SecureLRUCache) CapacityAdjustments() ([]CapacityAdjustment, int64) {
+	a := c.adaptive
+	if a == nil {
+		return nil, 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]CapacityAdjustment(nil), a.history...), a.adjustments
+}
+
+func (c *SecureLRUCache) startAdaptiveCapacity() {
+	c.adaptive.windowStart = c.clock.Now()
+	ticks, stop := newTicker(c.clock, c.adaptive.interval)
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		defer stop()
+		for {
+			select {
+			case <-ticks:
+				c.adapt()
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// adapt closes the current interval and resizes the cache if its hit ratio
+// calls for it.
+func (c *SecureLRUCache) adapt() {
+	a := c.adaptive
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := c.clock.Now()
+	hits, misses := c.stats.hits.Load(), c.stats.misses.Load()
+	if hits < a.hits || misses < a.misses {
+		// ResetStats ran during the interval.
+		a.hits, a.misses = 0, 0
+	}
+	windowHits, windowMisses := hits-a.hits, misses-a.misses
+	windowStart := a.windowStart
+	a.hits, a.misses, a.windowStart = hits, misses, now
+
+	c.mu.Lock()
+	young := a.young
+	a.young = 0
+	capacity := c.capacity
+	tailIdle := c.tailIdleSince(windowStart)
+	c.unlock()
+
+	if a.disabled.Load() || windowHits+windowMisses == 0 {
+		return
+	}
+	hitRatio := float64(windowHits) / float64(windowHits+windowMisses)
+	step := max(1, capacity/8)
+
+	target := capacity
+	switch {
+	case 1-hitRatio >= adaptGrowMissRatio && young > 0:
+		target = min(a.max, capacity+step)
+	case hitRatio >= adaptShrinkHitRatio && tailIdle:
+		target = max(a.min, capacity-step)
+	}
+	if target == capacity {
+		return
+	}
+	if err := c.Resize(target); err != nil {
+		return
+	}
+
+	a.adjustments++
+	a.history = append(a.history, CapacityAdjustment{At: now, From: capacity, To: target, HitRatio: hitRatio})
+	if len(a.history) > adaptHistory {
+		a.history = a.history[len(a.history)-adaptHistory:]
+	}
+}
+
+// tailIdleSince reports whether none of the coldest entries has been read
+// since t. Only policies implementing CandidatePolicy can list their coldest
+// entries without a walk over the whole cache; for the others just the next
+// victim is checked. It must be called with the lock held.
+func (c *SecureLRUCache) tailIdleSince(t time.Time) bool {
+	since := t.UnixNano()
+	p, ok := c.policy.(CandidatePolicy)
+	if !ok {
+		node := c.policy.Victim()
+		return node != nil && node.accessedAt.Load() < since
+	}
+
+	n := min(max(1, len(c.cache)/adaptTailFraction), adaptTailMax)
+	idle, seen := true, 0
+	p.Candidates(func(node *Node) bool {
+		seen++
+		if node.accessedAt.Load() >= since {
+			idle = false
+		}
+		return idle && seen < n
+	})
+	return idle && seen > 0
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// waitForAdjustments waits for the controller, which runs on its own
+// goroutine, to have made n adjustments.
+func waitForAdjustments(t *testing.T, c *SecureLRUCache, n int64) []CapacityAdjustment {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		history, total := c.CapacityAdjustments()
+		if total >= n {
+			return history
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d adjustments after 5s, want %d", total, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAdaptiveCapacityGrowsOnYoungEvictions(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 16, WithAdaptiveCapacity(8, 64, time.Minute), WithClock(clock))
+	for k := range 200 {
+		c.Get(k)
+		c.Put(k, k)
+	}
+	clock.Advance(time.Minute)
+
+	history := waitForAdjustments(t, c, 1)
+	if got := history[0]; got.From != 16 || got.To != 18 {
+		t.Errorf("adjustment %+v, want 16 to 18", got)
+	}
+	if c.Capacity() != 18 {
+		t.Errorf("Capacity = %d, want 18", c.Capacity())
+	}
+}
+
+func TestAdaptiveCapacityShrinksWithIdleTail(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 100, WithAdaptiveCapacity(50, 100, time.Minute), WithClock(clock))
+	for k := range 100 {
+		c.Put(k, k)
+	}
+	// Only the newest entries are read, so the tail stays idle.
+	clock.Advance(time.Second)
+	for range 10 {
+		for k := 90; k < 100; k++ {
+			c.Get(k)
+		}
+	}
+	clock.Advance(time.Minute)
+
+	history := waitForAdjustments(t, c, 1)
+	if got := history[0]; got.From != 100 || got.To != 88 || got.HitRatio != 1 {
+		t.Errorf("adjustment %+v, want 100 to 88 at a hit ratio of 1", got)
+	}
+}
+
+func TestTailIdleSince(t *testing.T) {
+	for name, policy := range map[string]func() Policy{
+		"fifo, walks candidates": FIFO,
+		"lruk, checks victim":    func() Policy { return LRUK(2) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			clock := newFakeClock()
+			c := newTestCache(t, 100, WithPolicy(policy()), WithClock(clock))
+			for k := range 100 {
+				c.Put(k, k)
+			}
+			start := clock.Now()
+			idle := func() bool {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				return c.tailIdleSince(start)
+			}
+			if !idle() {
+				t.Fatal("tail reads as busy with no reads at all")
+			}
+
+			clock.Advance(time.Second)
+			c.Get(99)
+			if !idle() {
+				t.Fatal("a read of the newest entry made the tail busy")
+			}
+			// FIFO's coldest ten are 0 to 9 whatever is read; LRU-K's
+			// next victim is the oldest entry read only once.
+			c.Get(0)
+			if name == "fifo, walks candidates" {
+				if idle() {
+					t.Fatal("the oldest entry was read but the tail reads as idle")
+				}
+				return
+			}
+			if victim := c.policy.Victim(); victim.key != 1 || !idle() {
+				t.Fatalf("victim %d, idle %v: want the unread key 1 to leave the tail idle", victim.key, idle())
+			}
+		})
+	}
+}
+
+// countingCandidates counts the nodes a CandidatePolicy walk visits.
+type countingCandidates struct {
+	Policy
+	visited int
+}
+
+func (p *countingCandidates) Candidates(f func(node *Node) bool) {
+	p.Policy.(CandidatePolicy).Candidates(func(node *Node) bool {
+		p.visited++
+		return f(node)
+	})
+}
+
+func TestTailIdleSinceWalkIsBounded(t *testing.T) {
+	p := &countingCandidates{Policy: LRU()}
+	c, err := NewSecureLRUCache(50000, WithPolicy(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for k := range 50000 {
+		c.Put(k, k)
+	}
+	c.mu.Lock()
+	idle := c.tailIdleSince(time.Now().Add(time.Hour))
+	c.mu.Unlock()
+	if !idle {
+		t.Fatal("tail not idle")
+	}
+	if p.visited != adaptTailMax {
+		t.Errorf("visited %d nodes, want %d", p.visited, adaptTailMax)
+	}
+}
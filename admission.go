@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// errAdmissionRejected is returned by set when the admission filter keeps a
+// new key out of a full cache. Put and GetOrLoad treat it as success.
+var errAdmissionRejected = errors.New("admission rejected")
+
+// WithTinyLFU puts a TinyLFU admission filter in front of the eviction
+// policy. Every Get and Put of a key is counted in a count-min sketch of
+// sketchCounters counters per row, and when the cache is full a new key is
+// only admitted if it has been seen more often than the entry it would
+// evict; otherwise the Put is dropped. Overwrites of keys that are already
+// cached always succeed. The counters are halved periodically so that old
+// popularity fades.
+func WithTinyLFU(sketchCounters int) Option {
+	return func(c *SecureLRUCache) error {
+		if sketchCounters < 16 {
+			return fmt.Errorf("sketch must have at least 16 counters")
+		}
+		c.admission = newFrequencySketch(sketchCounters)
+		return nil
+	}
+}
+
+const (
+	sketchDepth   = 4
+	sketchMaxFreq = 15
+)
+
+var sketchSeeds = [sketchDepth]uint64{
+	0x9e3779b97f4a7c15, 0xbf58476d1ce4e5b9, 0x94d049bb133111eb, 0xc2b2ae3d27d4eb4f,
+}
+
+// frequencySketch is a count-min sketch of small saturating counters. It has
+// its own lock because Get records into it under the cache's read lock.
+type frequencySketch struct {
+	mu        sync.Mutex
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newFrequencySketch(counters int) *frequencySketch {
+	width := 1
+	for width < counters {
+		width <<= 1
+	}
+	s := &frequencySketch{mask: uint64(width - 1), resetAt: 10 * width}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *frequencySketch) index(key, row int) uint64 {
+	h := uint64(key) ^ sketchSeeds[row]
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h & s.mask
+}
+
+func (s *frequencySketch) increment(key int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for row := range s.rows {
+		i := s.index(key, row)
+		if s.rows[row][i] < sketchMaxFreq {
+			s.rows[row][i]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		for row := range s.rows {
+			for i := range s.rows[row] {
+				s.rows[row][i] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *frequencySketch) estimate(key int) uint8 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	freq := uint8(sketchMaxFreq)
+	for row := range s.rows {
+		freq = min(freq, s.rows[row][s.index(key, row)])
+	}
+	return freq
+}
+
+// admit reports whether candidate should replace victim.
+func (s *frequencySketch) admit(candidate, victim int) bool {
+	return s.estimate(candidate) > s.estimate(victim)
+}
+
+// touch records an access to key in the admission sketch, if there is one.
+func (c *SecureLRUCache) touch(key int) {
+	if c.admission != nil {
+		c.admission.increment(key)
+	}
+}
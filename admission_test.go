@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestTinyLFUKeepsHotKeyOverColdOne(t *testing.T) {
+	c := newTestCache(t, 4, WithTinyLFU(64))
+	c.Put(1, 1)
+	for range 10 {
+		c.Get(1)
+	}
+	// Key 1 is now LRU's next victim, but the hottest key.
+	for k := 2; k <= 4; k++ {
+		c.Put(k, k)
+	}
+
+	if err := c.Put(99, 99); err != nil {
+		t.Fatalf("a rejected admission failed the Put: %v", err)
+	}
+	if !c.Contains(1) || c.Contains(99) {
+		t.Errorf("cold key 99 displaced hot key 1: keys %v", c.Keys())
+	}
+	if got := c.Stats().AdmissionRejections; got != 1 {
+		t.Errorf("AdmissionRejections = %d, want 1", got)
+	}
+	if err := c.Put(1, 10); err != nil || c.Size() != 4 {
+		t.Fatalf("overwrite of a cached key: %v, size %d", err, c.Size())
+	}
+
+	// Key 2, seen once, is the victim now; a key seen twice beats it.
+	c.Put(7, 7)
+	if c.Contains(7) {
+		t.Fatal("key 7 admitted on its first Put over an equally cold victim")
+	}
+	c.Put(7, 7)
+	if !c.Contains(7) || c.Contains(2) {
+		t.Errorf("key 7 seen twice was not admitted over key 2: keys %v", c.Keys())
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ageReservoir is how many residency times each ageTracker keeps to estimate
+// percentiles from.
+const ageReservoir = 256
+
+// AgeStats summarizes how long entries stayed in the cache. Percentiles are
+// estimated from a fixed-size uniform sample of the observations.
+type AgeStats struct {
+	Count int64         `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+}
+
+// ageTracker is a streaming summary of residency times with a reservoir
+// sample for percentiles, so its memory is bounded.
+type ageTracker struct {
+	mu      sync.Mutex
+	count   int64
+	sum     time.Duration
+	min     time.Duration
+	max     time.Duration
+	samples []time.Duration
+}
+
+func (t *ageTracker) add(age time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.count++
+	t.sum += age
+	if t.count == 1 || age < t.min {
+		t.min = age
+	}
+	if age > t.max {
+		t.max = age
+	}
+	if len(t.samples) < ageReservoir {
+		t.samples = append(t.samples, age)
+	} else if i := rand.Int64N(t.count); i < ageReservoir {
+		t.samples[i] = age
+	}
+}
+
+func (t *ageTracker) snapshot() AgeStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.count == 0 {
+		return AgeStats{}
+	}
+	sorted := slices.Clone(t.samples)
+	slices.Sort(sorted)
+	pct := func(p float64) time.Duration {
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+	return AgeStats{
+		Count: t.count,
+		Mean:  t.sum / time.Duration(t.count),
+		Min:   t.min,
+		Max:   t.max,
+		P50:   pct(0.50),
+		P90:   pct(0.90),
+		P99:   pct(0.99),
+	}
+}
+
+func (t *ageTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count, t.sum, t.min, t.max = 0, 0, 0, 0
+	t.samples = t.samples[:0]
+}
+
+// residency is how long node has been in the cache.
+func (c *SecureLRUCache) residency(node *Node) time.Duration {
+	return c.clock.Now().Sub(node.createdAt)
+}
+
+// DefaultAgeBuckets are bucket boundaries for AgeHistogram spanning a second
+// to a day.
+var DefaultAgeBuckets = []time.Duration{
+	time.Second, 10 * time.Second, time.Minute, 10 * time.Minute,
+	time.Hour, 6 * time.Hour, 24 * time.Hour,
+}
+
+// AgeHistogram counts live entries by the time since they were last read,
+// or since they were written if they have not been read. buckets are
+// ascending upper bounds: counts[i] holds entries idle for less than
+// buckets[i] and not less than buckets[i-1], and the extra last count holds
+// the rest. It walks every entry under the read lock, which blocks writers
+// for the whole walk; on large caches prefer AgeHistogramSampled.
+func (c *SecureLRUCache) AgeHistogram(buckets []time.Duration) []int {
+	return c.ageHistogram(buckets, -1)
+}
+
+// AgeHistogramSampled is AgeHistogram over at most n entries, taken in map
+// iteration order, so its cost is bounded however large the cache is. The
+// counts are of the sample and are not scaled up.
+func (c *SecureLRUCache) AgeHistogramSampled(buckets []time.Duration, n int) []int {
+	return c.ageHistogram(buckets, max(n, 0))
+}
+
+func (c *SecureLRUCache) ageHistogram(buckets []time.Duration, limit int) []int {
+	counts := make([]int, len(buckets)+1)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.clock.Now()
+	seen := 0
+	for _, node := range c.cache {
+		if seen == limit {
+			break
+		}
+		if !c.visible(node) {
+			continue
+		}
+		seen++
+
+		idle := now.Sub(lastUsed(node))
+		i, _ := slices.BinarySearchFunc(buckets, idle, func(b, idle time.Duration) int {
+			if b <= idle {
+				return -1
+			}
+			return 1
+		})
+		counts[i]++
+	}
+	return counts
+}
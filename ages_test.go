@@ -0,0 +1,35 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAgeHistogram(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 8, WithClock(clock))
+	buckets := []time.Duration{10 * time.Second, time.Minute}
+	c.Put(1, 1)
+	c.Put(2, 2)
+	c.PutWithTTL(4, 4, time.Second)
+	clock.Advance(2 * time.Minute)
+	c.Put(3, 3)
+	clock.Advance(20 * time.Second)
+	c.Get(2)
+	clock.Advance(10 * time.Second)
+	c.Put(5, 5)
+
+	// Idle for 150s, 10s (on a bound, so in the upper bucket), 30s and 0;
+	// key 4 has expired.
+	if got := c.AgeHistogram(buckets); !slices.Equal(got, []int{1, 2, 1}) {
+		t.Errorf("AgeHistogram = %v, want [1 2 1]", got)
+	}
+	got := c.AgeHistogramSampled(buckets, 2)
+	if len(got) != 3 || got[0]+got[1]+got[2] != 2 {
+		t.Errorf("AgeHistogramSampled(2) = %v, want 2 entries counted", got)
+	}
+	if got := c.AgeHistogram(nil); !slices.Equal(got, []int{4}) {
+		t.Errorf("AgeHistogram(nil) = %v, want every live entry in one count", got)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// auditQueue is how many audit records can wait for the sink before new ones
+// are dropped.
+const auditQueue = 4096
+
+// AuditRecord is one change to the cache, as WithAudit reports it. Op is
+// the EventOp name: put, update, remove, evicted, expired, resize or clear.
+// Key is zero for resize and clear, Reason is set for evictions, and
+// Capacity is the new capacity of a resize. Values are never recorded.
+type AuditRecord struct {
+	Op       string    `json:"op"`
+	Key      int       `json:"key"`
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Capacity int       `json:"capacity,omitempty"`
+}
+
+// AuditSink receives audit records, one call at a time and in order. A sink
+// that also has a Flush() error method is flushed whenever the queue runs
+// empty and on Close.
+type AuditSink interface {
+	Audit(rec AuditRecord) error
+}
+
+type auditFlusher interface {
+	Flush() error
+}
+
+type auditLog struct {
+	sink  AuditSink
+	queue chan AuditRecord
+	// actor is who the operation holding the write lock is made for.
+	actor string
+	// err is the first error from the sink, after which records are
+	// dropped. It is only touched by the writer goroutine until Close has
+	// waited for it.
+	err error
+}
+
+type auditActorKey struct{}
+
+// WithAuditActor returns a copy of ctx naming actor as the one making the
+// changes PutCtx and RemoveCtx are given it for.
+func WithAuditActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+func auditActor(ctx context.Context) string {
+	actor, _ := ctx.Value(auditActorKey{}).(string)
+	return actor
+}
+
+// WithAudit records every change to the cache in sink: each Put and update,
+// Remove, eviction, expiry, Resize and Clear, with the time by the cache's
+// clock. Changes made by PutCtx or RemoveCtx, and the evictions they cause,
+// carry the actor in their context's WithAuditActor. Records are queued and
+// passed to sink by a background goroutine, so the cache never waits on it;
+// when the queue is full records are dropped and counted in
+// Stats().DroppedAuditRecords. Close delivers what is queued and returns
+// the first error from the sink, after which it is given nothing more.
+func WithAudit(sink AuditSink) Option {
+	return func(c *SecureLRUCache) error {
+		if sink == nil {
+			return fmt.Errorf("audit sink must not be nil")
+		}
+		c.audit = &auditLog{sink: sink, queue: make(chan AuditRecord, auditQueue)}
+		return nil
+	}
+}
+
+// auditEvent queues the record of ev. The caller holds the write lock.
+func (c *SecureLRUCache) auditEvent(ev Event) {
+	rec := AuditRecord{Op: ev.Op.String(), Key: ev.Key, Time: c.clock.Now(), Actor: c.audit.actor}
+	switch ev.Op {
+	case EventEvicted:
+		rec.Reason = ev.Reason.String()
+	case EventResize:
+		rec.Capacity = ev.Value
+	}
+	select {
+	case c.audit.queue <- rec:
+	default:
+		c.stats.droppedAuditRecords.Add(1)
+	}
+}
+
+// actAs attributes the records made until the returned func is called to
+// actor. The caller holds the write lock throughout.
+func (c *SecureLRUCache) actAs(actor string) func() {
+	if c.audit == nil || actor == "" {
+		return func() {}
+	}
+	c.audit.actor = actor
+	return func() { c.audit.actor = "" }
+}
+
+func (c *SecureLRUCache) startAudit() {
+	a := c.audit
+	flusher, _ := a.sink.(auditFlusher)
+	flush := func() {
+		if flusher != nil && a.err == nil {
+			a.err = flusher.Flush()
+		}
+	}
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		for {
+			select {
+			case rec := <-a.queue:
+				a.write(rec)
+				if len(a.queue) == 0 {
+					flush()
+				}
+			case <-c.done:
+				for len(a.queue) > 0 {
+					a.write(<-a.queue)
+				}
+				flush()
+				return
+			}
+		}
+	}()
+}
+
+func (a *auditLog) write(rec AuditRecord) {
+	if a.err == nil {
+		a.err = a.sink.Audit(rec)
+	}
+}
+
+// PutCtx is Put made for the actor in ctx, if any, as WithAudit records it.
+func (c *SecureLRUCache) PutCtx(ctx context.Context, key, value int) error {
+	_, _, _, err := c.writeIfAs(auditActor(ctx), key, value, 1, c.defaultTTL, writeAlways)
+	return err
+}
+
+// RemoveCtx is Remove made for the actor in ctx, if any, as WithAudit
+// records it.
+func (c *SecureLRUCache) RemoveCtx(ctx context.Context, key int) bool {
+	c.mu.Lock()
+	defer c.unlock()
+	defer c.actAs(auditActor(ctx))()
+
+	c.invalidate(Invalidation{Key: key})
+	return c.removeKey(key)
+}
+
+// MemoryAuditSink keeps audit records in memory, for tests.
+type MemoryAuditSink struct {
+	mu      sync.Mutex
+	records []AuditRecord
+}
+
+func (s *MemoryAuditSink) Audit(rec AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, rec)
+	return nil
+}
+
+// Records returns the records received so far, oldest first.
+func (s *MemoryAuditSink) Records() []AuditRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.records)
+}
+
+// FileAuditSink appends audit records to a file as JSON lines.
+type FileAuditSink struct {
+	f   *os.File
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewFileAuditSink opens path for appending, creating it if need be. The
+// sink should be closed after the cache.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &FileAuditSink{f: f, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+func (s *FileAuditSink) Audit(rec AuditRecord) error { return s.enc.Encode(rec) }
+
+// Flush writes buffered records to the file and syncs it.
+func (s *FileAuditSink) Flush() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Close flushes and closes the file.
+func (s *FileAuditSink) Close() error {
+	return errors.Join(s.Flush(), s.f.Close())
+}
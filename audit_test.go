@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAuditRecordsScriptedWorkload(t *testing.T) {
+	clock := newFakeClock()
+	sink := &MemoryAuditSink{}
+	c, err := NewSecureLRUCache(2, WithClock(clock), WithAudit(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := WithAuditActor(context.Background(), "alice")
+	bob := WithAuditActor(context.Background(), "bob")
+	t0 := clock.Now()
+
+	c.PutCtx(alice, 1, 10)
+	c.PutCtx(alice, 2, 20)
+	clock.Advance(time.Second)
+	c.PutCtx(bob, 3, 30) // evicts 1
+	c.Put(3, 31)
+	c.RemoveCtx(alice, 2)
+	c.RemoveCtx(alice, 99) // not cached: nothing changes
+	c.Resize(5)
+	c.PutWithTTL(4, 40, time.Second)
+	clock.Advance(2 * time.Second)
+	c.Get(4)
+	c.Clear()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	t1, t3 := t0.Add(time.Second), t0.Add(3*time.Second)
+	want := []AuditRecord{
+		{Op: "put", Key: 1, Time: t0, Actor: "alice"},
+		{Op: "put", Key: 2, Time: t0, Actor: "alice"},
+		{Op: "evicted", Key: 1, Time: t1, Actor: "bob", Reason: "capacity"},
+		{Op: "put", Key: 3, Time: t1, Actor: "bob"},
+		{Op: "update", Key: 3, Time: t1},
+		{Op: "remove", Key: 2, Time: t1, Actor: "alice"},
+		{Op: "resize", Time: t1, Capacity: 5},
+		{Op: "put", Key: 4, Time: t1},
+		{Op: "expired", Key: 4, Time: t3},
+		{Op: "clear", Time: t3},
+	}
+	if got := sink.Records(); !reflect.DeepEqual(got, want) {
+		t.Errorf("audit records:\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileAuditSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := newFakeClock()
+	c, err := NewSecureLRUCache(4, WithClock(clock), WithAudit(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.PutCtx(WithAuditActor(context.Background(), "carol"), 7, 70)
+	c.Remove(7)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []AuditRecord
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var rec AuditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		got = append(got, rec)
+	}
+	want := []AuditRecord{
+		{Op: "put", Key: 7, Time: clock.Now(), Actor: "carol"},
+		{Op: "remove", Key: 7, Time: clock.Now()},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("file holds %v, want %v", got, want)
+	}
+}
+
+// blockingAuditSink holds up every record until release is closed.
+type blockingAuditSink struct {
+	MemoryAuditSink
+	release chan struct{}
+}
+
+func (s *blockingAuditSink) Audit(rec AuditRecord) error {
+	<-s.release
+	return s.MemoryAuditSink.Audit(rec)
+}
+
+func TestAuditDropsWhenTheSinkFallsBehind(t *testing.T) {
+	sink := &blockingAuditSink{release: make(chan struct{})}
+	c, err := NewSecureLRUCache(100000, WithAudit(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const puts = 2 * auditQueue
+	for k := range puts {
+		c.Put(k, k)
+	}
+	dropped := c.Stats().DroppedAuditRecords
+	if dropped == 0 {
+		t.Fatal("no records dropped by a stalled sink")
+	}
+	close(sink.release)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if delivered := int64(len(sink.Records())); delivered+dropped != puts {
+		t.Errorf("%d delivered and %d dropped of %d", delivered, dropped, puts)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import "fmt"
+
+// DumpChunked is Dump for large caches. It copies only the key order under
+// the read lock, then fills in the entries chunk keys at a time, taking the
+// lock once per chunk, and hands each chunk to fn as a partial CacheDump;
+// fn runs without the lock and may stop the dump by returning false. Writers
+// wait at most for one chunk rather than the whole walk.
+//
+// The chunks are not a single point-in-time view: each reflects the cache
+// when it was filled, entries removed since the order was copied are left
+// out, and entries added since are missing. Partials carry no policy state,
+// and their Size and TotalCost describe the chunk alone, so restoring the
+// concatenation rebuilds the order but not ARC's or SLRU's segments.
+func (c *SecureLRUCache) DumpChunked(chunk int, fn func(partial CacheDump) bool) error {
+	if chunk < 1 {
+		return fmt.Errorf("chunk size must be at least 1")
+	}
+	if err := c.snapshotAllowed(); err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	order := make([]int, 0, len(c.cache))
+	c.policy.Each(func(node *Node) bool {
+		order = append(order, node.key)
+		return true
+	})
+	c.mu.RUnlock()
+
+	for start := 0; start < len(order); start += chunk {
+		keys := order[start:min(start+chunk, len(order))]
+		if !fn(c.dumpKeys(keys)) {
+			break
+		}
+	}
+	return nil
+}
+
+// dumpKeys dumps the entries for keys that are still resident, in the order
+// given.
+func (c *SecureLRUCache) dumpKeys(keys []int) CacheDump {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	d := CacheDump{
+		Version:  dumpVersion,
+		Capacity: c.capacity,
+		Items:    make(map[int]int, len(keys)),
+		Order:    make([]int, 0, len(keys)),
+		MaxCost:  c.maxCost,
+	}
+	for _, key := range keys {
+		node, ok := c.cache[key]
+		if !ok {
+			continue
+		}
+		d.addNode(node)
+		if c.maxCost > 0 {
+			d.TotalCost += node.cost
+		}
+	}
+	d.Size = len(d.Order)
+	c.redact(&d)
+	return d
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"maps"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDumpChunkedMatchesDump(t *testing.T) {
+	c := newTestCache(t, 100, WithMaxCost(1000))
+	for k := range 120 {
+		c.PutWithCost(k, k*10, int64(1+k%3))
+	}
+	c.Get(50)
+	c.Remove(60)
+	want := c.Dump()
+
+	var order []int
+	items := make(map[int]int)
+	var totalCost int64
+	err := c.DumpChunked(7, func(d CacheDump) bool {
+		if len(d.Order) > 7 || d.Size != len(d.Order) {
+			t.Errorf("chunk of %d keys, size %d", len(d.Order), d.Size)
+		}
+		order = append(order, d.Order...)
+		maps.Copy(items, d.Items)
+		totalCost += d.TotalCost
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(order, want.Order) || !maps.Equal(items, want.Items) {
+		t.Errorf("chunks hold %v, Dump holds %v", order, want.Order)
+	}
+	if totalCost != want.TotalCost {
+		t.Errorf("chunk costs sum to %d, total is %d", totalCost, want.TotalCost)
+	}
+
+	chunks := 0
+	c.DumpChunked(10, func(CacheDump) bool {
+		chunks++
+		return chunks < 3
+	})
+	if chunks != 3 {
+		t.Errorf("fn returned false at chunk 3, called %d times", chunks)
+	}
+	if c.DumpChunked(0, func(CacheDump) bool { return true }) == nil {
+		t.Error("a chunk size of 0 was accepted")
+	}
+}
+
+func TestDumpChunkedSkipsRemovedEntries(t *testing.T) {
+	c := newTestCache(t, 10)
+	for k := range 10 {
+		c.Put(k, k)
+	}
+	var seen []int
+	c.DumpChunked(5, func(d CacheDump) bool {
+		if len(seen) == 0 {
+			c.Remove(2) // in the second chunk
+			c.Put(100, 100)
+		}
+		seen = append(seen, d.Order...)
+		return true
+	})
+	want := []int{9, 8, 7, 6, 5, 4, 3, 1, 0}
+	if !slices.Equal(seen, want) {
+		t.Errorf("dumped %v, want %v", seen, want)
+	}
+}
+
+func TestDumpChunkedBoundsWriteStalls(t *testing.T) {
+	if testing.Short() {
+		t.Skip("fills a cache of 200000 entries")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	const size = 200000
+	c, err := NewSecureLRUCache(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for k := range size {
+		c.Put(k, k)
+	}
+
+	stall := func(dump func()) time.Duration {
+		done := make(chan struct{})
+		var worst time.Duration
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; ; k++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				start := time.Now()
+				c.Put(k%size, k)
+				worst = max(worst, time.Since(start))
+			}
+		}()
+		dump()
+		close(done)
+		wg.Wait()
+		return worst
+	}
+
+	// A single run can be stalled by the scheduler or the collector as long
+	// as by the lock, above all on one CPU, so each keeps its best of five.
+	full, chunked := time.Duration(math.MaxInt64), time.Duration(math.MaxInt64)
+	for range 5 {
+		full = min(full, stall(func() { c.Dump() }))
+		chunked = min(chunked, stall(func() {
+			c.DumpChunked(1024, func(CacheDump) bool { return true })
+		}))
+	}
+	t.Logf("worst Put stall: %v under Dump, %v under DumpChunked", full, chunked)
+	if chunked >= full {
+		t.Errorf("worst Put stall under DumpChunked %v, no better than %v under Dump", chunked, full)
+	}
+}
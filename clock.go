@@ -0,0 +1,31 @@
+package main
+
+import "time"
+
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// TickingClock is a Clock that also drives the adaptive capacity controller,
+// so a test can step it through intervals. With a plain Clock the controller
+// ticks on real time.
+type TickingClock interface {
+	Clock
+	// NewTicker returns a channel that receives the time every d, and a
+	// func that stops it.
+	NewTicker(d time.Duration) (<-chan time.Time, func())
+}
+
+func newTicker(clock Clock, d time.Duration) (<-chan time.Time, func()) {
+	if tc, ok := clock.(TickingClock); ok {
+		return tc.NewTicker(d)
+	}
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// fakeClock is a TickingClock that only moves when a test advances it.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+type fakeTicker struct {
+	ch    chan time.Time
+	every time.Duration
+	next  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the clock on by d and fires the tickers that came due,
+// dropping ticks a slow receiver has not taken, as a time.Ticker does.
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	for _, t := range f.tickers {
+		for !t.next.After(f.now) {
+			select {
+			case t.ch <- f.now:
+			default:
+			}
+			t.next = t.next.Add(t.every)
+		}
+	}
+}
+
+func (f *fakeClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTicker{ch: make(chan time.Time, 1), every: d, next: f.now.Add(d)}
+	f.tickers = append(f.tickers, t)
+	return t.ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.tickers = slices.DeleteFunc(f.tickers, func(o *fakeTicker) bool { return o == t })
+	}
+}
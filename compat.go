@@ -0,0 +1,144 @@
+package main
+
+import "slices"
+
+// hashicorpLRU is the surface of hashicorp/golang-lru's Cache that CompatLRU
+// reproduces, with int keys and values.
+type hashicorpLRU interface {
+	Add(key, value int) (evicted bool)
+	Get(key int) (value int, ok bool)
+	Contains(key int) bool
+	Peek(key int) (value int, ok bool)
+	Remove(key int) (present bool)
+	RemoveOldest() (key, value int, ok bool)
+	Len() int
+	Purge()
+}
+
+var _ hashicorpLRU = (*CompatLRU)(nil)
+
+// CompatLRU is a SecureLRUCache behind the method set of
+// hashicorp/golang-lru's Cache, so code written against that package builds
+// unchanged once its lru.New and lru.NewWithEvict calls are pointed at
+// NewCompatLRU and NewCompatLRUWithEvict.
+type CompatLRU struct {
+	cache     *SecureLRUCache
+	onEvicted func(key, value int)
+}
+
+// NewCompatLRU returns an LRU cache of size entries.
+func NewCompatLRU(size int) (*CompatLRU, error) {
+	return NewCompatLRUWithEvict(size, nil)
+}
+
+// NewCompatLRUWithEvict is NewCompatLRU with a callback for every entry that
+// leaves the cache, whether evicted, removed or purged, as golang-lru calls
+// it. The callback runs after the cache lock is released.
+func NewCompatLRUWithEvict(size int, onEvicted func(key, value int)) (*CompatLRU, error) {
+	c, err := NewSecureLRUCache(size)
+	if err != nil {
+		return nil, err
+	}
+	return &CompatLRU{cache: c, onEvicted: onEvicted}, nil
+}
+
+// Cache returns the underlying cache, for what golang-lru has no call for.
+func (l *CompatLRU) Cache() *SecureLRUCache {
+	return l.cache
+}
+
+func (l *CompatLRU) evicted(entry Entry) {
+	if l.onEvicted != nil {
+		l.onEvicted(entry.Key, entry.Value)
+	}
+}
+
+// Add adds or updates key, reporting whether an entry was evicted for room.
+func (l *CompatLRU) Add(key, value int) (evicted bool) {
+	entry, evicted, err := l.cache.PutEvicted(key, value)
+	if err != nil {
+		return false
+	}
+	if evicted {
+		l.evicted(entry)
+	}
+	return evicted
+}
+
+func (l *CompatLRU) Get(key int) (value int, ok bool) {
+	return l.cache.Get(key)
+}
+
+func (l *CompatLRU) Contains(key int) bool {
+	return l.cache.Contains(key)
+}
+
+func (l *CompatLRU) Peek(key int) (value int, ok bool) {
+	return l.cache.Peek(key)
+}
+
+func (l *CompatLRU) Remove(key int) (present bool) {
+	if l.onEvicted == nil {
+		return l.cache.Remove(key)
+	}
+	entry, present := l.cache.take(key)
+	if present {
+		l.evicted(entry)
+	}
+	return present
+}
+
+func (l *CompatLRU) RemoveOldest() (key, value int, ok bool) {
+	entry, ok := l.cache.RemoveOldest()
+	if ok {
+		l.evicted(entry)
+	}
+	return entry.Key, entry.Value, ok
+}
+
+func (l *CompatLRU) Len() int {
+	return l.cache.Size()
+}
+
+func (l *CompatLRU) Purge() {
+	if l.onEvicted == nil {
+		l.cache.Clear()
+		return
+	}
+	for _, entry := range l.cache.drain() {
+		l.evicted(entry)
+	}
+}
+
+// take is Remove that also returns the entry removed.
+func (c *SecureLRUCache) take(key int) (Entry, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	node, exists := c.lookup(key)
+	if !exists || node.tombstone {
+		return Entry{}, false
+	}
+	entry := Entry{Key: key, Value: node.value}
+	c.invalidate(Invalidation{Key: key})
+	c.removeKey(key)
+	return entry, true
+}
+
+// drain is Clear that also returns the live entries cleared, oldest first.
+func (c *SecureLRUCache) drain() []Entry {
+	c.mu.Lock()
+	defer c.unlock()
+
+	var entries []Entry
+	c.policy.Each(func(node *Node) bool {
+		if c.visible(node) {
+			entries = append(entries, Entry{Key: node.key, Value: node.value})
+		}
+		return true
+	})
+	slices.Reverse(entries)
+	c.reset()
+	c.invalidate(Invalidation{All: true})
+	return entries
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// The tests below follow golang-lru's own: fill past capacity, check what
+// was evicted and in which order, and that Peek does not promote.
+
+func TestCompatLRU(t *testing.T) {
+	var evicted []Entry
+	l, err := NewCompatLRUWithEvict(128, func(key, value int) {
+		if key != value {
+			t.Errorf("evicted %d with value %d", key, value)
+		}
+		evicted = append(evicted, Entry{key, value})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Cache().Close()
+
+	for i := range 256 {
+		l.Add(i, i)
+	}
+	if l.Len() != 128 {
+		t.Fatalf("Len = %d, want 128", l.Len())
+	}
+	if len(evicted) != 128 {
+		t.Fatalf("%d evictions, want 128", len(evicted))
+	}
+	for i, e := range evicted {
+		if e.Key != i {
+			t.Fatalf("eviction %d was key %d", i, e.Key)
+		}
+	}
+	for i := range 128 {
+		if _, ok := l.Get(i); ok {
+			t.Errorf("evicted key %d still cached", i)
+		}
+	}
+	for i := 128; i < 256; i++ {
+		if v, ok := l.Get(i); !ok || v != i {
+			t.Errorf("Get(%d) = %d, %v", i, v, ok)
+		}
+	}
+	for i := 128; i < 192; i++ {
+		if !l.Remove(i) || l.Remove(i) {
+			t.Errorf("Remove(%d) did not report the entry once", i)
+		}
+	}
+	if len(evicted) != 192 {
+		t.Errorf("%d callbacks after 64 removals, want 192", len(evicted))
+	}
+
+	l.Purge()
+	if l.Len() != 0 {
+		t.Errorf("Len = %d after Purge", l.Len())
+	}
+	if len(evicted) != 256 {
+		t.Errorf("%d callbacks after Purge, want 256", len(evicted))
+	}
+	if last := evicted[192:]; last[0].Key != 192 || last[63].Key != 255 {
+		t.Errorf("Purge called back from %d to %d, want oldest first", last[0].Key, last[63].Key)
+	}
+}
+
+func TestCompatLRUAddReportsEviction(t *testing.T) {
+	l, err := NewCompatLRU(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Cache().Close()
+	if l.Add(1, 1) {
+		t.Error("first Add reported an eviction")
+	}
+	if l.Add(1, 2) {
+		t.Error("an update reported an eviction")
+	}
+	if !l.Add(2, 2) {
+		t.Error("Add into a full cache reported no eviction")
+	}
+}
+
+func TestCompatLRUContainsAndPeekDoNotPromote(t *testing.T) {
+	l, err := NewCompatLRU(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Cache().Close()
+	l.Add(1, 1)
+	l.Add(2, 2)
+	if !l.Contains(1) {
+		t.Error("Contains(1) = false")
+	}
+	if v, ok := l.Peek(1); !ok || v != 1 {
+		t.Errorf("Peek(1) = %d, %v", v, ok)
+	}
+	l.Add(3, 3)
+	if l.Contains(1) {
+		t.Error("Contains or Peek promoted key 1")
+	}
+}
+
+func TestCompatLRURemoveOldest(t *testing.T) {
+	var evicted []int
+	l, err := NewCompatLRUWithEvict(4, func(key, value int) { evicted = append(evicted, key) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Cache().Close()
+	for i := range 4 {
+		l.Add(i, i*10)
+	}
+	l.Get(0)
+	if k, v, ok := l.RemoveOldest(); !ok || k != 1 || v != 10 {
+		t.Errorf("RemoveOldest = %d, %d, %v, want 1, 10", k, v, ok)
+	}
+	if k, _, _ := l.RemoveOldest(); k != 2 {
+		t.Errorf("second RemoveOldest = %d, want 2", k)
+	}
+	if !slices.Equal(evicted, []int{1, 2}) {
+		t.Errorf("callbacks for %v", evicted)
+	}
+	l.Purge()
+	if _, _, ok := l.RemoveOldest(); ok {
+		t.Error("RemoveOldest of an empty cache reported an entry")
+	}
+}
+
+func TestRemoveOldestSkipsExpired(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 8, WithClock(clock))
+	c.PutWithTTL(1, 1, time.Second)
+	c.Put(2, 2)
+	c.Put(3, 3)
+	clock.Advance(time.Second)
+	if e, ok := c.RemoveOldest(); !ok || e != (Entry{2, 2}) {
+		t.Errorf("RemoveOldest = %v, %v, want the oldest live entry 2", e, ok)
+	}
+	st := c.Stats()
+	if st.Removals != 1 || st.Expirations != 1 || c.Size() != 1 {
+		t.Errorf("removals %d, expirations %d, size %d", st.Removals, st.Expirations, c.Size())
+	}
+}
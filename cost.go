@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// ErrEntryTooLarge is returned by Put and its variants for an entry that
+// exceeds a per-entry limit or the cache's whole budget. The entry is not
+// stored and nothing is evicted to make room for it.
+var ErrEntryTooLarge = errors.New("entry too large")
+
+// EntryCostError is returned when a single entry costs more than the cache
+// allows, either per entry or in total. It matches ErrEntryTooLarge.
+type EntryCostError struct {
+	Key   int
+	Cost  int64
+	Limit int64
+}
+
+func (e *EntryCostError) Error() string {
+	return fmt.Sprintf("entry %d costs %d, more than the limit of %d", e.Key, e.Cost, e.Limit)
+}
+
+func (e *EntryCostError) Is(target error) bool { return target == ErrEntryTooLarge }
+
+// WithMaxEntryCost refuses entries costing more than limit.
+func WithMaxEntryCost(limit int64) Option {
+	return func(c *SecureLRUCache) error {
+		if limit < 1 {
+			return fmt.Errorf("max entry cost must be at least 1")
+		}
+		c.maxEntryCost = limit
+		return nil
+	}
+}
+
+// WithMaxEntryBytes refuses entries whose estimated size exceeds limit bytes.
+func WithMaxEntryBytes(limit int64) Option {
+	return func(c *SecureLRUCache) error {
+		if limit < 1 {
+			return fmt.Errorf("max entry bytes must be at least 1")
+		}
+		c.maxEntryBytes = limit
+		return nil
+	}
+}
+
+func (c *SecureLRUCache) checkEntrySize(key int, cost, size int64) error {
+	if c.maxEntryCost > 0 && cost > c.maxEntryCost {
+		return &EntryCostError{Key: key, Cost: cost, Limit: c.maxEntryCost}
+	}
+	if c.maxCost > 0 && cost > c.maxCost {
+		return &EntryCostError{Key: key, Cost: cost, Limit: c.maxCost}
+	}
+	if c.maxEntryBytes > 0 && size > c.maxEntryBytes {
+		return fmt.Errorf("entry %d is %d bytes, over the limit of %d: %w", key, size, c.maxEntryBytes, ErrEntryTooLarge)
+	}
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return fmt.Errorf("entry %d is %d bytes, over the limit of %d: %w", key, size, c.maxBytes, ErrEntryTooLarge)
+	}
+	return nil
+}
+
+// WithMaxCost bounds the summed cost of all entries as well as their number.
+// Entries stored with Put cost 1; PutWithCost sets the cost explicitly.
+func WithMaxCost(maxCost int64) Option {
+	return func(c *SecureLRUCache) error {
+		if maxCost < 1 {
+			return fmt.Errorf("max cost must be at least 1")
+		}
+		c.maxCost = maxCost
+		return nil
+	}
+}
+
+// PutWithCost is Put for an entry of the given cost. The policy's victims are
+// evicted until the entry fits; an entry costing more than the max cost or
+// the max entry cost is rejected with an *EntryCostError.
+func (c *SecureLRUCache) PutWithCost(key, value int, cost int64) error {
+	if cost < 1 {
+		return fmt.Errorf("cost must be at least 1")
+	}
+	_, _, err := c.write(key, value, cost, c.defaultTTL)
+	return err
+}
+
+// ResizeCost changes the cost budget, evicting until the cache fits it.
+func (c *SecureLRUCache) ResizeCost(maxCost int64) error {
+	if maxCost < 1 {
+		return fmt.Errorf("max cost must be at least 1")
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	for c.totalCost > maxCost {
+		lru := c.victim()
+		if lru == nil {
+			break
+		}
+		c.evict(lru, ReasonResize)
+		c.releaseNode(lru)
+	}
+	c.maxCost = maxCost
+	return nil
+}
+
+func (c *SecureLRUCache) TotalCost() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.totalCost
+}
+
+// EntryBytes is the estimated footprint of one int/int entry: its node plus
+// its slot in the cache's map. A map slot holds the key and node pointer and
+// one control byte, and maps keep up to a seventh of their slots free, so the
+// slot is charged 8/7 of its size.
+const EntryBytes = int64(unsafe.Sizeof(Node{})) + mapSlotBytes*8/7
+
+const mapSlotBytes = int64(unsafe.Sizeof(0)) + int64(unsafe.Sizeof(&Node{})) + 1
+
+// Sizer lets a value report its own size in bytes to estimateSize.
+type Sizer interface {
+	Size() int64
+}
+
+// estimateSize is the number of bytes an entry is charged against the byte
+// budget: the fixed per-entry overhead plus the contents of strings, byte
+// slices and Sizers. For the int keys and values stored today it is always
+// EntryBytes.
+func estimateSize(key, value any) int64 {
+	return EntryBytes + payloadSize(key) + payloadSize(value)
+}
+
+func payloadSize(v any) int64 {
+	switch v := v.(type) {
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case Sizer:
+		return v.Size()
+	}
+	return 0
+}
+
+// WithMaxBytes bounds the estimated memory held by the entries, as reported
+// by MemoryBytes, on top of the entry count.
+func WithMaxBytes(n int64) Option {
+	return func(c *SecureLRUCache) error {
+		if n < EntryBytes {
+			return fmt.Errorf("max bytes must fit at least one entry (%d bytes)", EntryBytes)
+		}
+		c.maxBytes = n
+		return nil
+	}
+}
+
+// MemoryBytes is the estimated memory held by the cached entries.
+func (c *SecureLRUCache) MemoryBytes() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.totalBytes
+}
+
+// MemoryUsage is the estimated memory held by the cached entries, kept as a
+// running total so it costs nothing to read. It is the same figure as
+// MemoryBytes and CacheStats.MemoryBytes, and is zero for an empty cache.
+func (c *SecureLRUCache) MemoryUsage() int64 {
+	return c.MemoryBytes()
+}
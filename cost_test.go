@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestMemoryUsageTracksEntries(t *testing.T) {
+	c := newTestCache(t, 3)
+	check := func(when string, entries int64) {
+		t.Helper()
+		if got := c.MemoryUsage(); got != entries*EntryBytes || got != c.Stats().MemoryBytes {
+			t.Errorf("%s: MemoryUsage = %d, Stats().MemoryBytes = %d, want %d", when, got, c.Stats().MemoryBytes, entries*EntryBytes)
+		}
+	}
+	check("empty", 0)
+	for k := range 3 {
+		c.Put(k, k)
+	}
+	check("full", 3)
+	c.Put(1, 100)
+	check("after an overwrite", 3)
+	c.Put(5, 5)
+	check("after an eviction", 3)
+	c.Remove(5)
+	check("after a Remove", 2)
+	c.Clear()
+	check("after Clear", 0)
+}
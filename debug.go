@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+type debugResponse struct {
+	Capacity    int        `json:"capacity"`
+	Size        int        `json:"size"`
+	MemoryBytes int64      `json:"memory_bytes"`
+	Stats       CacheStats `json:"stats"`
+	// Top holds the first entries in policy order when ?top=N is given.
+	Top  []Entry    `json:"top,omitempty"`
+	Dump *CacheDump `json:"dump,omitempty"`
+}
+
+// DebugHandler serves the cache's stats as JSON. Entries are only included
+// on request, since they can be large and sensitive: ?top=N adds the N most
+// valuable entries in policy order (most recent first under LRU), and
+// ?dump=1 adds the full Dump. The cache's lock is released before the
+// response is encoded.
+func (c *SecureLRUCache) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		resp := debugResponse{Stats: c.Stats()}
+		resp.Capacity, resp.Size = resp.Stats.Capacity, resp.Stats.Size
+		resp.MemoryBytes = resp.Stats.MemoryBytes
+		if top := query.Get("top"); top != "" {
+			n, err := strconv.Atoi(top)
+			if err != nil || n < 1 {
+				http.Error(w, "top must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			resp.Top = c.topEntries(n)
+		}
+		if dump, _ := strconv.ParseBool(query.Get("dump")); dump {
+			d := c.Dump()
+			resp.Dump = &d
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// topEntries returns the first n live entries in policy order.
+func (c *SecureLRUCache) topEntries(n int) []Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make([]Entry, 0, min(n, len(c.cache)))
+	c.policy.Each(func(node *Node) bool {
+		if c.visible(node) {
+			entries = append(entries, Entry{Key: node.key, Value: node.value})
+		}
+		return len(entries) < n
+	})
+	return entries
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	c := newTestCache(t, 4)
+	for k := 1; k <= 3; k++ {
+		c.Put(k, k*10)
+	}
+	c.Get(1)
+	handler := c.DebugHandler()
+	get := func(method, target string) (*httptest.ResponseRecorder, debugResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		var resp debugResponse
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%s %s: %v", method, target, err)
+			}
+		}
+		return rec, resp
+	}
+
+	rec, resp := get("GET", "/")
+	if rec.Header().Get("Content-Type") != "application/json" || resp.Size != 3 || resp.Capacity != 4 || resp.Stats.Hits != 1 {
+		t.Errorf("GET / = %+v", resp)
+	}
+	if resp.Top != nil || resp.Dump != nil {
+		t.Error("entries included without being asked for")
+	}
+	if _, resp := get("GET", "/?top=2"); !slices.Equal(resp.Top, []Entry{{Key: 1, Value: 10}, {Key: 3, Value: 30}}) {
+		t.Errorf("?top=2 = %v, want the two most recent", resp.Top)
+	}
+	if _, resp := get("GET", "/?dump=1"); resp.Dump == nil || resp.Dump.Size != 3 || !slices.Equal(resp.Dump.Order, []int{1, 3, 2}) {
+		t.Errorf("?dump=1 = %+v", resp.Dump)
+	}
+	if rec, _ := get("GET", "/?top=x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("?top=x answered %d, want 400", rec.Code)
+	}
+	if rec, _ := get("POST", "/"); rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("POST answered %d with Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// An encrypted snapshot is the magic, a version byte and a random 96-bit
+// nonce, followed by the AES-GCM sealing of a gzipped binary snapshot, with
+// the magic and version as additional data.
+const (
+	encryptedMagic   = "LRUE"
+	encryptedVersion = 1
+)
+
+// ErrDecryptionFailed is returned for an encrypted snapshot that the key
+// cannot open: the key is wrong or the snapshot was altered.
+var ErrDecryptionFailed = errors.New("snapshot decryption failed")
+
+// newSnapshotAEAD returns AES-GCM for key, which must be 16, 24 or 32 bytes
+// long.
+func newSnapshotAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot key must be 16, 24 or 32 bytes, got %d", len(key))
+	}
+	return cipher.NewGCM(block)
+}
+
+// WithSnapshotEncryption makes SaveToFile, and so WithPersistence, write
+// snapshots as SaveEncrypted does, and LoadFromFile read them as
+// LoadEncrypted does. Key must be 16, 24 or 32 bytes, for AES-128, AES-192 or
+// AES-256. The write-ahead log is not encrypted.
+func WithSnapshotEncryption(key []byte) Option {
+	return func(c *SecureLRUCache) error {
+		aead, err := newSnapshotAEAD(key)
+		if err != nil {
+			return err
+		}
+		c.snapshotAEAD = aead
+		return nil
+	}
+}
+
+// SaveEncrypted writes a gzipped binary snapshot encrypted with AES-GCM
+// under key, which must be 16, 24 or 32 bytes. It returns the size written.
+// The snapshot is built in memory, since GCM authenticates it as a whole.
+func (c *SecureLRUCache) SaveEncrypted(w io.Writer, key []byte) (int64, error) {
+	aead, err := newSnapshotAEAD(key)
+	if err != nil {
+		return 0, err
+	}
+	return c.saveEncrypted(w, aead)
+}
+
+func (c *SecureLRUCache) saveEncrypted(w io.Writer, aead cipher.AEAD) (int64, error) {
+	var plain bytes.Buffer
+	if _, err := c.SaveCompressed(&plain, gzip.DefaultCompression); err != nil {
+		return 0, err
+	}
+	header := append([]byte(encryptedMagic), encryptedVersion)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, err
+	}
+	out := append(header, nonce...)
+	out = aead.Seal(out, nonce, plain.Bytes(), header)
+	n, err := w.Write(out)
+	return int64(n), err
+}
+
+// LoadEncrypted replaces the cache's contents with a snapshot written by
+// SaveEncrypted under key, as ReadFrom does. A wrong key or altered
+// snapshot returns an error matching ErrDecryptionFailed, and like any
+// snapshot that cannot be read leaves the cache as it was.
+func (c *SecureLRUCache) LoadEncrypted(r io.Reader, key []byte) (int64, error) {
+	aead, err := newSnapshotAEAD(key)
+	if err != nil {
+		return 0, err
+	}
+	return c.loadEncrypted(r, aead)
+}
+
+func (c *SecureLRUCache) loadEncrypted(r io.Reader, aead cipher.AEAD) (int64, error) {
+	data, err := io.ReadAll(r)
+	n := int64(len(data))
+	if err != nil {
+		return n, err
+	}
+	headerLen := len(encryptedMagic) + 1
+	if len(data) < headerLen+aead.NonceSize() || string(data[:len(encryptedMagic)]) != encryptedMagic {
+		return n, fmt.Errorf("%w: not an encrypted snapshot", ErrDecryptionFailed)
+	}
+	if version := data[len(encryptedMagic)]; version != encryptedVersion {
+		return n, fmt.Errorf("%w: encrypted snapshot version %d", ErrUnsupportedDumpVersion, version)
+	}
+	header, nonce := data[:headerLen], data[headerLen:headerLen+aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, data[headerLen+len(nonce):], header)
+	if err != nil {
+		return n, ErrDecryptionFailed
+	}
+	d, err := readSnapshot(bytes.NewReader(plain))
+	if err != nil {
+		return n, err
+	}
+	return n, c.restoreDump(d)
+}
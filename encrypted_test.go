@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var snapshotKey = bytes.Repeat([]byte{7}, 32)
+
+func encryptedSnapshot(t *testing.T) (*SecureLRUCache, []byte) {
+	t.Helper()
+	c := newTestCache(t, 64)
+	for k := range 50 {
+		c.Put(1000000+k, 424242+k)
+	}
+	var buf bytes.Buffer
+	n, err := c.SaveEncrypted(&buf, snapshotKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("SaveEncrypted returned %d for %d bytes", n, buf.Len())
+	}
+	return c, buf.Bytes()
+}
+
+func TestEncryptedSnapshotRoundTrip(t *testing.T) {
+	c, data := encryptedSnapshot(t)
+	restored := newTestCache(t, 64)
+	if _, err := restored.LoadEncrypted(bytes.NewReader(data), snapshotKey); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored.Dump(), c.Dump()) {
+		t.Errorf("restored %v, want %v", restored.Dump(), c.Dump())
+	}
+
+	// Neither the snapshot nor its compressed form shows through.
+	var plain, compressed bytes.Buffer
+	c.WriteTo(&plain)
+	c.SaveCompressed(&compressed, 6)
+	for name, b := range map[string][]byte{"snapshot": plain.Bytes(), "gzip": compressed.Bytes()} {
+		for i := 0; i+16 <= len(b); i += 16 {
+			if bytes.Contains(data, b[i:i+16]) {
+				t.Fatalf("bytes %d to %d of the %s appear in the output", i, i+16, name)
+			}
+		}
+	}
+}
+
+func TestEncryptedSnapshotRejectsWrongKeyAndTampering(t *testing.T) {
+	_, data := encryptedSnapshot(t)
+	target := newTestCache(t, 64)
+	target.Put(1, 1)
+	want := target.Dump()
+	load := func(data, key []byte) error {
+		_, err := target.LoadEncrypted(bytes.NewReader(data), key)
+		return err
+	}
+
+	if err := load(data, bytes.Repeat([]byte{8}, 32)); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("wrong key: %v", err)
+	}
+	// Every bit of the nonce, ciphertext and tag is covered.
+	for i := len(encryptedMagic) + 1; i < len(data); i++ {
+		tampered := bytes.Clone(data)
+		tampered[i] ^= 1 << (i % 8)
+		if err := load(tampered, snapshotKey); !errors.Is(err, ErrDecryptionFailed) {
+			t.Fatalf("byte %d flipped: %v", i, err)
+		}
+	}
+	if err := load(data[:len(data)-1], snapshotKey); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("truncated: %v", err)
+	}
+	if err := load([]byte("LRUC"), snapshotKey); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("plain snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(target.Dump(), want) {
+		t.Errorf("failed loads changed the cache to %v", target.Dump())
+	}
+}
+
+func TestSnapshotKeyLengths(t *testing.T) {
+	for _, n := range []int{16, 24, 32} {
+		if _, err := NewSecureLRUCache(4, WithSnapshotEncryption(make([]byte, n))); err != nil {
+			t.Errorf("%d-byte key: %v", n, err)
+		}
+	}
+	for _, n := range []int{0, 15, 20, 64} {
+		if _, err := NewSecureLRUCache(4, WithSnapshotEncryption(make([]byte, n))); err == nil {
+			t.Errorf("%d-byte key accepted", n)
+		}
+		c := newTestCache(t, 4)
+		if _, err := c.SaveEncrypted(&bytes.Buffer{}, make([]byte, n)); err == nil {
+			t.Errorf("SaveEncrypted with a %d-byte key succeeded", n)
+		}
+	}
+}
+
+func TestEncryptedPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snap")
+	c, err := NewSecureLRUCache(8, WithPersistence(path, 0), WithSnapshotEncryption(snapshotKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(1, 11)
+	c.Put(2, 22)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte(encryptedMagic)) {
+		t.Fatalf("file starts %q, want an encrypted snapshot", data[:4])
+	}
+
+	c = newTestCache(t, 8, WithPersistence(path, 0), WithSnapshotEncryption(snapshotKey))
+	if v, ok := c.Get(2); !ok || v != 22 {
+		t.Errorf("Get(2) = %d, %v after reload", v, ok)
+	}
+	if _, err := NewSecureLRUCache(8, WithPersistence(path, 0), WithSnapshotEncryption(make([]byte, 16))); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("other key: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import "sync"
+
+// streamQueue is how many events can wait for the Events dispatcher before
+// new ones are dropped.
+const streamQueue = 1024
+
+// eventStream fans every recorded event out to the Events subscribers. The
+// cache feeds queue under its write lock, so events reach the dispatcher in
+// the order they happened, and the dispatcher copes with slow subscribers
+// by dropping rather than waiting.
+type eventStream struct {
+	mu    sync.Mutex
+	subs  map[chan Event]struct{}
+	start sync.Once
+	queue chan Event
+	// active is the number of subscribers; it is read without mu by
+	// record, under the cache's write lock.
+	active int
+}
+
+// Events subscribes to every change to the cache: inserts, updates,
+// evictions, removals and expirations (with the key, the value and, for
+// entries leaving the cache, the reason), resizes (Value is the new
+// capacity) and clears. Delivery is asynchronous, in the order the changes
+// happened; when the subscriber's buffer or the shared queue is full events
+// are dropped and counted in Stats().DroppedEvents. The cancel func ends the
+// subscription and closes the channel, as does Close; after Close, Events
+// returns a closed channel.
+func (c *SecureLRUCache) Events(buffer int) (<-chan Event, func()) {
+	s := &c.stream
+	ch := make(chan Event, max(buffer, 0))
+
+	c.mu.Lock()
+	if c.closed {
+		c.unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	s.start.Do(func() {
+		s.queue = make(chan Event, streamQueue)
+		s.subs = make(map[chan Event]struct{})
+		c.workers.Add(1)
+		go c.dispatchStream()
+	})
+	s.mu.Lock()
+	s.subs[ch] = struct{}{}
+	s.mu.Unlock()
+	s.active++
+	c.unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			c.mu.Lock()
+			s.active--
+			c.unlock()
+
+			s.mu.Lock()
+			if _, ok := s.subs[ch]; ok {
+				delete(s.subs, ch)
+				close(ch)
+			}
+			s.mu.Unlock()
+		})
+	}
+	return ch, cancel
+}
+
+// publish hands ev to the dispatcher. The caller must hold the write lock.
+func (c *SecureLRUCache) publish(ev Event) {
+	select {
+	case c.stream.queue <- ev:
+	default:
+		c.stats.droppedEvents.Add(1)
+	}
+}
+
+func (c *SecureLRUCache) dispatchStream() {
+	defer c.workers.Done()
+	s := &c.stream
+	for {
+		select {
+		case ev := <-s.queue:
+			s.mu.Lock()
+			for ch := range s.subs {
+				select {
+				case ch <- ev:
+				default:
+					c.stats.droppedEvents.Add(1)
+				}
+			}
+			s.mu.Unlock()
+		case <-c.done:
+			s.mu.Lock()
+			for ch := range s.subs {
+				delete(s.subs, ch)
+				close(ch)
+			}
+			s.mu.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventsAfterCloseIsClosed(t *testing.T) {
+	c := newTestCache(t, 4)
+	c.Close()
+	events, cancel := c.Events(1)
+	defer cancel()
+	if _, ok := <-events; ok {
+		t.Fatal("Events after Close delivered an event")
+	}
+}
+
+func TestEventsRacingClose(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	for range 200 {
+		c, err := NewSecureLRUCache(4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		subs := make(chan (<-chan Event), 4)
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				events, _ := c.Events(1)
+				subs <- events
+			}()
+		}
+		c.Put(1, 1)
+		c.Close()
+		wg.Wait()
+		close(subs)
+
+		// Every subscription, whether it beat Close or not, ends closed.
+		for events := range subs {
+			timeout := time.After(time.Second)
+		drain:
+			for {
+				select {
+				case _, ok := <-events:
+					if !ok {
+						break drain
+					}
+				case <-timeout:
+					t.Fatal("a subscription was left open after Close")
+				}
+			}
+		}
+	}
+}
+
+func TestEventsDeliversInOrder(t *testing.T) {
+	c := newTestCache(t, 2)
+	events, cancel := c.Events(16)
+	defer cancel()
+	c.Put(1, 1)
+	c.Put(2, 2)
+	c.Put(3, 3) // evicts 1
+	c.Remove(2)
+
+	want := []Event{
+		{Op: EventPut, Key: 1, Value: 1},
+		{Op: EventPut, Key: 2, Value: 2},
+		{Op: EventEvicted, Key: 1, Value: 1, Reason: ReasonCapacity},
+		{Op: EventPut, Key: 3, Value: 3},
+		{Op: EventRemove, Key: 2, Value: 2, Reason: ReasonRemoved},
+	}
+	for i, w := range want {
+		select {
+		case ev := <-events:
+			if ev.Op != w.Op || ev.Key != w.Key || ev.Value != w.Value || ev.Reason != w.Reason {
+				t.Fatalf("event %d = %+v, want %+v", i, ev, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d never arrived", i)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import "fmt"
+
+// EvictReason says why an entry left the cache.
+type EvictReason int
+
+const (
+	// ReasonCapacity is an eviction to make room for a new entry.
+	ReasonCapacity EvictReason = iota + 1
+	// ReasonResize is an eviction by Resize, ResizeCost or a shrink.
+	ReasonResize
+	ReasonRemoved
+	ReasonExpired
+	ReasonCleared
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case ReasonCapacity:
+		return "capacity"
+	case ReasonResize:
+		return "resize"
+	case ReasonRemoved:
+		return "removed"
+	case ReasonExpired:
+		return "expired"
+	case ReasonCleared:
+		return "cleared"
+	case 0:
+		return "none"
+	default:
+		return "unknown"
+	}
+}
+
+const defaultEvictionSkips = 8
+
+// WithEvictionFilter consults keep before a Put or Resize evicts an entry;
+// when it returns false the next candidate is tried instead. Vetoed entries
+// keep their place in the policy. After maxSkips vetoes in a row (8 unless
+// WithMaxEvictionSkips says otherwise) the first candidate is evicted anyway
+// and counted as a forced eviction. Only policies implementing
+// CandidatePolicy, such as LRU, FIFO, MRU, LFU and SLRU, can offer further
+// candidates; under any other policy the first veto forces the eviction.
+//
+// keep runs under the cache's write lock: it must be cheap and must not call
+// back into the cache.
+func WithEvictionFilter(keep func(key, value int) bool) Option {
+	return func(c *SecureLRUCache) error {
+		if keep == nil {
+			return fmt.Errorf("eviction filter must not be nil")
+		}
+		c.evictFilter = keep
+		return nil
+	}
+}
+
+func WithMaxEvictionSkips(n int) Option {
+	return func(c *SecureLRUCache) error {
+		if n < 1 {
+			return fmt.Errorf("max eviction skips must be at least 1")
+		}
+		c.evictSkips = n
+		return nil
+	}
+}
+
+// victimFor returns the next entry to evict to make room for key. A keyed
+// choice may differ from the policy's candidate order, so the filter cannot
+// pass over it.
+func (c *SecureLRUCache) victimFor(key int) *Node {
+	if p, ok := c.policy.(KeyedVictimPolicy); ok {
+		c.applyPromotions()
+		return c.filterVictim(p.VictimFor(key), nil)
+	}
+	return c.victim()
+}
+
+// victim returns the next entry to evict.
+func (c *SecureLRUCache) victim() *Node {
+	c.applyPromotions()
+	candidates, _ := c.policy.(CandidatePolicy)
+	return c.filterVictim(c.policy.Victim(), candidates)
+}
+
+// filterVictim returns the first of candidates the eviction filter accepts,
+// starting from first, without changing the policy. With no candidates to
+// walk, or after maxSkips vetoes, it returns first.
+func (c *SecureLRUCache) filterVictim(first *Node, candidates CandidatePolicy) *Node {
+	if first == nil || c.evictFilter == nil || first.tombstone || c.evictFilter(first.key, first.value) {
+		return first
+	}
+
+	maxSkips := c.evictSkips
+	if maxSkips == 0 {
+		maxSkips = defaultEvictionSkips
+	}
+
+	var chosen *Node
+	if candidates != nil {
+		vetoes := 1
+		candidates.Candidates(func(node *Node) bool {
+			if node == first {
+				return true
+			}
+			if vetoes >= maxSkips {
+				return false
+			}
+			if node.tombstone || c.evictFilter(node.key, node.value) {
+				chosen = node
+				return false
+			}
+			vetoes++
+			return true
+		})
+	}
+
+	if chosen == nil {
+		chosen = first
+		c.stats.forcedEvictions.Add(1)
+	}
+	return chosen
+}
@@ -0,0 +1,112 @@
+package main
+
+import "testing"
+
+// keepZero is an eviction filter protecting key 0.
+func keepZero(key, _ int) bool { return key != 0 }
+
+func TestEvictionFilterPassesOverVetoedEntries(t *testing.T) {
+	policies := map[string]func() Policy{
+		"lru":  LRU,
+		"fifo": FIFO,
+		"mru":  MRU,
+		"lfu":  LFU,
+		"slru": SLRU,
+	}
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			c := newTestCache(t, 4, WithPolicy(policy()), WithEvictionFilter(keepZero))
+			// Make key 0 the first victim: the coldest entry, or under MRU
+			// the most recent.
+			order := []int{0, 1, 2, 3}
+			if name == "mru" {
+				order = []int{1, 2, 3, 0}
+			}
+			for _, k := range order {
+				c.Put(k, k)
+			}
+
+			for k := 4; k < 10; k++ {
+				if err := c.Put(k, k); err != nil {
+					t.Fatal(err)
+				}
+				if !c.Contains(0) {
+					t.Fatalf("Put(%d) evicted the vetoed key 0", k)
+				}
+				if name == "mru" {
+					continue
+				}
+				if got := c.policy.Victim(); got == nil || got.key != 0 {
+					t.Fatalf("after Put(%d) key 0 is no longer the next victim", k)
+				}
+			}
+			if name == "mru" {
+				if got := c.Keys(); len(got) != 4 || got[1] != 0 {
+					t.Errorf("Keys = %v, want key 0 kept second", got)
+				}
+			}
+			if got := c.Stats().ForcedEvictions; got != 0 {
+				t.Errorf("ForcedEvictions = %d, want 0", got)
+			}
+			if err := c.CheckInvariants(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestEvictionFilterForcesEvictionWithoutCandidates(t *testing.T) {
+	policies := map[string]func() Policy{
+		"arc":     ARC,
+		"clock":   CLOCK,
+		"sieve":   Sieve,
+		"lruk":    func() Policy { return LRUK(2) },
+		"sampled": func() Policy { return SampledLRU(4) },
+	}
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			keep := func(key, _ int) bool { return key%2 == 0 }
+			c := newTestCache(t, 4, WithPolicy(policy()), WithEvictionFilter(keep))
+			for k := 0; k < 20; k++ {
+				if err := c.Put(k, k); err != nil {
+					t.Fatal(err)
+				}
+			}
+			st := c.Stats()
+			if st.Evictions != 16 {
+				t.Errorf("Evictions = %d, want 16", st.Evictions)
+			}
+			if st.ForcedEvictions == 0 || st.ForcedEvictions > st.Evictions {
+				t.Errorf("ForcedEvictions = %d of %d evictions", st.ForcedEvictions, st.Evictions)
+			}
+			if err := c.CheckInvariants(); err != nil {
+				t.Error(err)
+			}
+			if p, ok := c.policy.(*arcPolicy); ok {
+				for key := range c.cache {
+					if _, ghost := p.ghosts[key]; ghost {
+						t.Errorf("resident key %d is also an ARC ghost", key)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEvictionFilterGivesUpAfterMaxSkips(t *testing.T) {
+	c := newTestCache(t, 4,
+		WithEvictionFilter(func(int, int) bool { return false }),
+		WithMaxEvictionSkips(2))
+	for k := 0; k < 5; k++ {
+		c.Put(k, k)
+	}
+	if c.Contains(0) {
+		t.Error("the coldest key survived although every key was vetoed")
+	}
+	if got := c.Keys(); len(got) != 4 || got[0] != 4 || got[3] != 1 {
+		t.Errorf("Keys = %v, want [4 3 2 1]", got)
+	}
+	if got := c.Stats().ForcedEvictions; got != 1 {
+		t.Errorf("ForcedEvictions = %d, want 1", got)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// ExpiringWithin returns the live entries whose TTL runs out within d of now
+// by the cache's clock, soonest first, for refreshing them ahead of time.
+// An entry is included when its deadline is after now and before now+d; one
+// whose deadline is now has already expired and is left out, as are entries
+// without a TTL. Entries are not promoted and expired ones are not
+// collected. There is no index by expiry, so this walks every entry under
+// the read lock.
+func (c *SecureLRUCache) ExpiringWithin(d time.Duration) []Entry {
+	var entries []Entry
+	c.RangeExpiringWithin(d, func(key, value int, _ time.Time) bool {
+		entries = append(entries, Entry{Key: key, Value: value})
+		return true
+	})
+	return entries
+}
+
+// RangeExpiringWithin calls f for each entry ExpiringWithin would return, in
+// the same order and with its deadline, until f returns false. As with Range,
+// f runs after the read lock is released.
+func (c *SecureLRUCache) RangeExpiringWithin(d time.Duration, f func(key, value int, expiresAt time.Time) bool) {
+	if d <= 0 {
+		return
+	}
+	type expiring struct {
+		key, value int
+		at         time.Time
+	}
+
+	c.mu.RLock()
+	end := c.clock.Now().Add(d)
+	var items []expiring
+	for _, node := range c.cache {
+		if !node.expiresAt.IsZero() && node.expiresAt.Before(end) && c.visible(node) {
+			items = append(items, expiring{node.key, node.value, node.expiresAt})
+		}
+	}
+	c.mu.RUnlock()
+
+	slices.SortFunc(items, func(a, b expiring) int {
+		if n := a.at.Compare(b.at); n != 0 {
+			return n
+		}
+		return cmp.Compare(a.key, b.key)
+	})
+	for _, item := range items {
+		if !f(item.key, item.value, item.at) {
+			return
+		}
+	}
+}
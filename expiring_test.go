@@ -0,0 +1,62 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExpiringWithin(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 16, WithClock(clock))
+	c.PutWithTTL(1, 10, 30*time.Second) // on the window's far edge
+	c.PutWithTTL(2, 20, 10*time.Second)
+	c.PutWithTTL(3, 30, 20*time.Second)
+	c.PutWithTTL(4, 40, 10*time.Second) // ties 2, listed after it by key
+	c.PutWithTTL(5, 50, time.Minute)
+	c.Put(6, 60) // no TTL
+	c.PutWithTTL(7, 70, time.Second)
+
+	clock.Advance(time.Second) // 7 expires now, uncollected
+	want := []Entry{{2, 20}, {4, 40}, {3, 30}}
+	if got := c.ExpiringWithin(29 * time.Second); !slices.Equal(got, want) {
+		t.Errorf("ExpiringWithin(29s) = %v, want %v", got, want)
+	}
+	if got := c.ExpiringWithin(29*time.Second + 1); len(got) != 4 || got[3] != (Entry{1, 10}) {
+		t.Errorf("ExpiringWithin just past 1's deadline = %v", got)
+	}
+	if got := c.ExpiringWithin(0); got != nil {
+		t.Errorf("ExpiringWithin(0) = %v", got)
+	}
+
+	if c.Size() != 7 {
+		t.Errorf("Size = %d: the expired entry was collected", c.Size())
+	}
+	if keys := c.Keys(); !slices.Equal(keys, []int{6, 5, 4, 3, 2, 1}) {
+		t.Errorf("Keys = %v: entries were promoted", keys)
+	}
+	if st := c.Stats(); st.Hits+st.Misses+st.Expirations != 0 {
+		t.Errorf("ExpiringWithin counted as reads: %+v", st)
+	}
+}
+
+func TestRangeExpiringWithin(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 16, WithClock(clock))
+	for k := 1; k <= 5; k++ {
+		c.PutWithTTL(k, k, time.Duration(6-k)*time.Second)
+	}
+	var keys []int
+	var deadlines []time.Time
+	c.RangeExpiringWithin(time.Hour, func(key, _ int, at time.Time) bool {
+		keys = append(keys, key)
+		deadlines = append(deadlines, at)
+		return len(keys) < 3
+	})
+	if !slices.Equal(keys, []int{5, 4, 3}) {
+		t.Errorf("keys %v, want [5 4 3]", keys)
+	}
+	if !deadlines[0].Equal(clock.Now().Add(time.Second)) {
+		t.Errorf("first deadline %v", deadlines[0])
+	}
+}
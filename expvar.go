@@ -0,0 +1,64 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+// expvarMu makes the check and the publish in PublishExpvar one step.
+var expvarMu sync.Mutex
+
+// expvarState is what PublishExpvar exposes.
+type expvarState struct {
+	Size       int   `json:"size"`
+	Capacity   int   `json:"capacity"`
+	Hits       int64 `json:"hits"`
+	Misses     int64 `json:"misses"`
+	Evictions  int64 `json:"evictions"`
+	RecentKeys []int `json:"recent_keys,omitempty"`
+}
+
+// PublishExpvar exposes the cache's size, capacity and counters under name
+// in expvar, along with up to recentKeys of its most valuable keys in policy
+// order (most recent first under LRU). Unlike expvar.Publish it returns an
+// error if name is already taken.
+func (c *SecureLRUCache) PublishExpvar(name string, recentKeys int) error {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("expvar %q is already published", name)
+	}
+	expvar.Publish(name, expvar.Func(func() any {
+		s := c.Stats()
+		return expvarState{
+			Size:       s.Size,
+			Capacity:   s.Capacity,
+			Hits:       s.Hits,
+			Misses:     s.Misses,
+			Evictions:  s.Evictions,
+			RecentKeys: c.topKeys(recentKeys),
+		}
+	}))
+	return nil
+}
+
+// topKeys is Keys cut short after n keys, so it only walks that far.
+func (c *SecureLRUCache) topKeys(n int) []int {
+	if n <= 0 {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := make([]int, 0, min(n, len(c.cache)))
+	c.policy.Each(func(node *Node) bool {
+		if c.visible(node) {
+			keys = append(keys, node.key)
+		}
+		return len(keys) < n
+	})
+	return keys
+}
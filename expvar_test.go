@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// expvarNames keeps the names distinct across runs, as expvar has no way to
+// unpublish one.
+var expvarNames atomic.Int64
+
+func TestPublishExpvar(t *testing.T) {
+	name := fmt.Sprintf("cache_test_%d", expvarNames.Add(1))
+	c := newTestCache(t, 4)
+	if err := c.PublishExpvar(name, 2); err != nil {
+		t.Fatal(err)
+	}
+	for k := range 5 {
+		c.Put(k, k)
+	}
+	c.Get(2)
+	c.Get(9)
+
+	var got expvarState
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := expvarState{Size: 4, Capacity: 4, Hits: 1, Misses: 1, Evictions: 1, RecentKeys: []int{2, 4}}
+	if got.Size != want.Size || got.Capacity != want.Capacity || got.Hits != want.Hits ||
+		got.Misses != want.Misses || got.Evictions != want.Evictions || !slices.Equal(got.RecentKeys, want.RecentKeys) {
+		t.Errorf("published %+v, want %+v", got, want)
+	}
+
+	if err := newTestCache(t, 4).PublishExpvar(name, 0); err == nil {
+		t.Error("a second cache was published under a taken name")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const defaultStringLimit = 16
+
+// WithStringLimit sets how many entries String and GoString list before
+// summarizing the rest; the default is 16.
+func WithStringLimit(n int) Option {
+	return func(c *SecureLRUCache) error {
+		if n < 1 {
+			return fmt.Errorf("string limit must be at least 1")
+		}
+		c.stringLimit = n
+		return nil
+	}
+}
+
+func policyName(p Policy) string {
+	switch p.(type) {
+	case *lruPolicy:
+		return "LRU"
+	case *fifoPolicy:
+		return "FIFO"
+	case *mruPolicy:
+		return "MRU"
+	case *lfuPolicy:
+		return "LFU"
+	case *sampledPolicy:
+		return "SampledLRU"
+	case *arcPolicy:
+		return "ARC"
+	case *slruPolicy:
+		return "SLRU"
+	case *clockPolicy:
+		return "CLOCK"
+	case *lrukPolicy:
+		return "LRUK"
+	case *sievePolicy:
+		return "SIEVE"
+	default:
+		return "Cache"
+	}
+}
+
+// String formats the cache as LRU(cap=3, size=2)[4:40 → 2:20], naming the
+// policy and listing live entries in policy order (most recent first under
+// LRU). After the string limit the remaining entries are only counted, as in
+// [4:40 → 2:20 … and 5 more].
+func (c *SecureLRUCache) String() string {
+	var b strings.Builder
+	name, capacity, size, entries, more := c.describe()
+	fmt.Fprintf(&b, "%s(cap=%d, size=%d)[", name, capacity, size)
+	for i, e := range entries {
+		if i > 0 {
+			b.WriteString(" → ")
+		}
+		fmt.Fprintf(&b, "%d:%d", e.Key, e.Value)
+	}
+	if more > 0 {
+		fmt.Fprintf(&b, " … and %d more", more)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// GoString makes %#v print the cache's shape and first entries rather than
+// its internals.
+func (c *SecureLRUCache) GoString() string {
+	var b strings.Builder
+	name, capacity, size, entries, more := c.describe()
+	fmt.Fprintf(&b, "&SecureLRUCache{Policy: %q, Capacity: %d, Size: %d, Entries: []Entry{", name, capacity, size)
+	for i, e := range entries {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "{Key: %d, Value: %d}", e.Key, e.Value)
+	}
+	b.WriteString("}")
+	if more > 0 {
+		fmt.Fprintf(&b, " /* and %d more */", more)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// describe gathers what String and GoString print under the read lock. more
+// is the number of live entries left out.
+func (c *SecureLRUCache) describe() (name string, capacity, size int, entries []Entry, more int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	limit := defaultStringLimit
+	if c.stringLimit > 0 {
+		limit = c.stringLimit
+	}
+	c.policy.Each(func(node *Node) bool {
+		if !c.visible(node) {
+			return true
+		}
+		if len(entries) < limit {
+			entries = append(entries, Entry{Key: node.key, Value: node.value})
+		} else {
+			more++
+		}
+		return true
+	})
+	return policyName(c.policy), c.capacity, len(c.cache), entries, more
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStringAndGoString(t *testing.T) {
+	c := newTestCache(t, 3)
+	c.Put(2, 20)
+	c.Put(4, 40)
+	if got, want := c.String(), "LRU(cap=3, size=2)[4:40 → 2:20]"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := fmt.Sprintf("%#v", c), `&SecureLRUCache{Policy: "LRU", Capacity: 3, Size: 2, Entries: []Entry{{Key: 4, Value: 40}, {Key: 2, Value: 20}}}`; got != want {
+		t.Errorf("%%#v = %s, want %s", got, want)
+	}
+
+	short := newTestCache(t, 8, WithPolicy(FIFO()), WithStringLimit(2))
+	for k := 1; k <= 5; k++ {
+		short.Put(k, k)
+	}
+	if got, want := fmt.Sprint(short), "FIFO(cap=8, size=5)[5:5 → 4:4 … and 3 more]"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := short.GoString(), `&SecureLRUCache{Policy: "FIFO", Capacity: 8, Size: 5, Entries: []Entry{{Key: 5, Value: 5}, {Key: 4, Value: 4}} /* and 3 more */}`; got != want {
+		t.Errorf("GoString() = %s, want %s", got, want)
+	}
+	if _, err := NewSecureLRUCache(4, WithStringLimit(0)); err == nil {
+		t.Error("string limit 0 accepted")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// memoryGetter is a fallback serving decimal values from a map and counting
+// the fetches that reach it.
+type memoryGetter struct {
+	data    map[string]int
+	fetches atomic.Int64
+}
+
+func (g *memoryGetter) Get(_ context.Context, key string, dest Sink) error {
+	g.fetches.Add(1)
+	v, ok := g.data[key]
+	if !ok {
+		return ErrNotFound
+	}
+	return dest.SetBytes([]byte(strconv.Itoa(v)))
+}
+
+func TestGetterAdapterReadsThroughOnce(t *testing.T) {
+	fallback := &memoryGetter{data: map[string]int{"answer": 42}}
+	a, err := NewGetterAdapter(newTestCache(t, 8), fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 3 {
+		var sink ByteSliceSink
+		if err := a.Get(context.Background(), "answer", &sink); err != nil {
+			t.Fatal(err)
+		}
+		if string(sink.Bytes) != "42" {
+			t.Fatalf("fetch %d read %q", i, sink.Bytes)
+		}
+	}
+	if got := fallback.fetches.Load(); got != 1 {
+		t.Errorf("fallback fetched %d times, want 1", got)
+	}
+	if a.Hits() != 2 || a.Misses() != 1 {
+		t.Errorf("hits %d, misses %d, want 2 and 1", a.Hits(), a.Misses())
+	}
+
+	var sink ByteSliceSink
+	if err := a.Get(context.Background(), "missing", &sink); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing key: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetterAdapterSharesConcurrentMisses(t *testing.T) {
+	release := make(chan struct{})
+	var fetches atomic.Int64
+	fallback := GetterFunc(func(_ context.Context, key string, dest Sink) error {
+		fetches.Add(1)
+		<-release
+		return dest.SetBytes([]byte("7"))
+	})
+	a, err := NewGetterAdapter(newTestCache(t, 8), fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var sink ByteSliceSink
+			if err := a.Get(context.Background(), "k", &sink); err != nil || string(sink.Bytes) != "7" {
+				t.Errorf("Get = %q, %v", sink.Bytes, err)
+			}
+		}()
+	}
+	for fetches.Load() == 0 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("fallback fetched %d times, want 1", got)
+	}
+}
+
+func TestGetterAdapterWithoutFallback(t *testing.T) {
+	c := newTestCache(t, 8)
+	a, err := NewGetterAdapter(c, nil, WithKeyCodec(func(key string) int { return len(key) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(3, 99)
+
+	var sink ByteSliceSink
+	if err := a.Get(context.Background(), "abc", &sink); err != nil || string(sink.Bytes) != "99" {
+		t.Errorf("Get(abc) = %q, %v, want the value cached under key 3", sink.Bytes, err)
+	}
+	if err := a.Get(context.Background(), "abcd", &sink); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(abcd) err = %v, want ErrNotFound", err)
+	}
+}
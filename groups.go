@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+)
+
+// groupQuotas caps how many entries each group of keys may hold.
+type groupQuotas struct {
+	of           func(key int) string
+	quotas       map[string]int
+	defaultQuota int
+	// sizes counts the entries of each group, tombstones and expired
+	// entries included, as len(c.cache) does.
+	sizes map[string]int
+}
+
+func (c *SecureLRUCache) groupQuotas() *groupQuotas {
+	if c.groups == nil {
+		c.groups = &groupQuotas{quotas: make(map[string]int), sizes: make(map[string]int)}
+	}
+	return c.groups
+}
+
+// WithGroups assigns every key to the group of(key) returns, so that groups
+// can be given quotas and removed together. of must be fast and always
+// return the same group for a key; it is called under the cache lock.
+func WithGroups(of func(key int) string) Option {
+	return func(c *SecureLRUCache) error {
+		if of == nil {
+			return fmt.Errorf("group function must not be nil")
+		}
+		c.groupQuotas().of = of
+		return nil
+	}
+}
+
+// WithGroupQuota limits group to maxEntries entries: a Put of a new key into
+// a group at its quota evicts the group's own next victim, in the policy's
+// order, instead of whatever the cache would evict. The cache still evicts
+// globally when it is full. It needs WithGroups.
+func WithGroupQuota(group string, maxEntries int) Option {
+	return func(c *SecureLRUCache) error {
+		if maxEntries < 1 {
+			return fmt.Errorf("group quota must be at least 1")
+		}
+		c.groupQuotas().quotas[group] = maxEntries
+		return nil
+	}
+}
+
+// WithDefaultGroupQuota is WithGroupQuota for every group without a quota
+// of its own.
+func WithDefaultGroupQuota(maxEntries int) Option {
+	return func(c *SecureLRUCache) error {
+		if maxEntries < 1 {
+			return fmt.Errorf("group quota must be at least 1")
+		}
+		c.groupQuotas().defaultQuota = maxEntries
+		return nil
+	}
+}
+
+func (c *SecureLRUCache) checkGroups() error {
+	if c.groups.of == nil {
+		return fmt.Errorf("group quotas need WithGroups")
+	}
+	return nil
+}
+
+// SetGroupQuota changes group's quota, or with 0 removes it, so that the
+// group falls back to the default quota, if any, or to global eviction. A
+// group over a lowered quota is brought down to it by its next inserts, not
+// at once.
+func (c *SecureLRUCache) SetGroupQuota(group string, maxEntries int) error {
+	if c.groups == nil {
+		return fmt.Errorf("group quotas need WithGroups")
+	}
+	if maxEntries < 0 {
+		return fmt.Errorf("group quota must not be negative")
+	}
+	c.mu.Lock()
+	defer c.unlock()
+
+	if maxEntries == 0 {
+		delete(c.groups.quotas, group)
+	} else {
+		c.groups.quotas[group] = maxEntries
+	}
+	return nil
+}
+
+// groupFull returns key's group and whether it is at its quota. The caller
+// holds the write lock.
+func (c *SecureLRUCache) groupFull(key int) (string, bool) {
+	if c.groups == nil {
+		return "", false
+	}
+	group := c.groups.of(key)
+	quota, ok := c.groups.quotas[group]
+	if !ok {
+		quota = c.groups.defaultQuota
+	}
+	return group, quota > 0 && c.groups.sizes[group] >= quota
+}
+
+// groupVictim returns the node of group the policy would evict first. The
+// caller holds the write lock.
+func (c *SecureLRUCache) groupVictim(group string) *Node {
+	var victim *Node
+	if p, ok := c.policy.(CandidatePolicy); ok {
+		p.Candidates(func(node *Node) bool {
+			if c.groups.of(node.key) == group {
+				victim = node
+				return false
+			}
+			return true
+		})
+		return victim
+	}
+	// Each lists the next victim last.
+	c.policy.Each(func(node *Node) bool {
+		if c.groups.of(node.key) == group {
+			victim = node
+		}
+		return true
+	})
+	return victim
+}
+
+// countGroup adds n to the size of node's group. The caller holds the write
+// lock.
+func (c *SecureLRUCache) countGroup(node *Node, n int) {
+	if c.groups == nil {
+		return
+	}
+	group := c.groups.of(node.key)
+	if c.groups.sizes[group] += n; c.groups.sizes[group] == 0 {
+		delete(c.groups.sizes, group)
+	}
+}
+
+// RemoveGroup removes every entry of group, as Remove would, and returns how
+// many live entries it removed.
+func (c *SecureLRUCache) RemoveGroup(group string) int {
+	if c.groups == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.unlock()
+
+	var keys []int
+	for key := range c.cache {
+		if c.groups.of(key) == group {
+			keys = append(keys, key)
+		}
+	}
+	n := 0
+	for _, key := range keys {
+		c.invalidate(Invalidation{Key: key})
+		if c.removeKey(key) {
+			n++
+		}
+	}
+	return n
+}
+
+// groupSizes copies the group sizes for Stats. The caller holds the lock.
+func (c *SecureLRUCache) groupSizes() map[string]int {
+	if c.groups == nil {
+		return nil
+	}
+	return maps.Clone(c.groups.sizes)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"maps"
+	"testing"
+	"time"
+)
+
+// tenantOf puts keys below 1000 in group "a" and the rest in "b".
+func tenantOf(key int) string {
+	if key < 1000 {
+		return "a"
+	}
+	return "b"
+}
+
+func TestGroupQuotaProtectsOtherGroups(t *testing.T) {
+	c := newTestCache(t, 20, WithGroups(tenantOf), WithGroupQuota("a", 5))
+	for k := 1000; k < 1010; k++ {
+		c.Put(k, k)
+	}
+	for k := range 100 {
+		evicted, ok, err := c.PutEvicted(k, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok && tenantOf(evicted.Key) != "a" {
+			t.Fatalf("Put(%d) evicted %d from group b", k, evicted.Key)
+		}
+	}
+	for k := 1000; k < 1010; k++ {
+		if !c.Contains(k) {
+			t.Errorf("group b lost key %d to the flood", k)
+		}
+	}
+	// Group a keeps its most recent keys.
+	for k := 95; k < 100; k++ {
+		if !c.Contains(k) {
+			t.Errorf("group a lost its recent key %d", k)
+		}
+	}
+	if got, want := c.Stats().Groups, map[string]int{"a": 5, "b": 10}; !maps.Equal(got, want) {
+		t.Errorf("Groups = %v, want %v", got, want)
+	}
+}
+
+func TestRemovingGroupQuotaRestoresGlobalEviction(t *testing.T) {
+	c := newTestCache(t, 20, WithGroups(tenantOf), WithGroupQuota("a", 5))
+	for k := 1000; k < 1010; k++ {
+		c.Put(k, k)
+	}
+	if err := c.SetGroupQuota("a", 0); err != nil {
+		t.Fatal(err)
+	}
+	for k := range 100 {
+		c.Put(k, k)
+	}
+	if got := c.Stats().Groups; !maps.Equal(got, map[string]int{"a": 20}) {
+		t.Errorf("Groups = %v, want group a to have taken the whole cache", got)
+	}
+	if err := c.SetGroupQuota("a", -1); err == nil {
+		t.Error("negative quota accepted")
+	}
+}
+
+func TestDefaultGroupQuota(t *testing.T) {
+	groupOf := func(key int) string { return string(rune('a' + key%3)) }
+	c := newTestCache(t, 30, WithGroups(groupOf), WithDefaultGroupQuota(2), WithGroupQuota("b", 4))
+	for k := range 30 {
+		c.Put(k, k)
+	}
+	if got, want := c.Stats().Groups, map[string]int{"a": 2, "b": 4, "c": 2}; !maps.Equal(got, want) {
+		t.Errorf("Groups = %v, want %v", got, want)
+	}
+}
+
+func TestGroupSizesStayConsistent(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 10, WithClock(clock), WithGroups(tenantOf), WithGroupQuota("a", 4))
+	want := func(step string, groups map[string]int) {
+		t.Helper()
+		if got := c.Stats().Groups; !maps.Equal(got, groups) {
+			t.Errorf("after %s: Groups = %v, want %v", step, got, groups)
+		}
+	}
+
+	for k := range 3 {
+		c.Put(k, k)
+		c.Put(1000+k, k)
+	}
+	c.Put(1, 10)
+	want("overwrite", map[string]int{"a": 3, "b": 3})
+	c.Remove(2)
+	c.Remove(2)
+	want("remove", map[string]int{"a": 2, "b": 3})
+
+	c.PutWithTTL(5, 5, time.Second)
+	clock.Advance(2 * time.Second)
+	c.Get(5)
+	want("expire", map[string]int{"a": 2, "b": 3})
+
+	if n := c.RemoveGroup("b"); n != 3 {
+		t.Errorf("RemoveGroup removed %d, want 3", n)
+	}
+	want("RemoveGroup", map[string]int{"a": 2})
+	if c.Size() != 2 {
+		t.Errorf("Size = %d, want 2", c.Size())
+	}
+
+	d := c.Dump()
+	c.Clear()
+	want("Clear", nil)
+	if err := c.Restore(d); err != nil {
+		t.Fatal(err)
+	}
+	want("Restore", map[string]int{"a": 2})
+}
+
+func TestGroupQuotaNeedsGroups(t *testing.T) {
+	if _, err := NewSecureLRUCache(10, WithGroupQuota("a", 1)); err == nil {
+		t.Error("quota without WithGroups accepted")
+	}
+	if _, err := NewSecureLRUCache(10, WithGroups(tenantOf), WithGroupQuota("a", 0)); err == nil {
+		t.Error("quota of 0 accepted")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import "fmt"
+
+// lifecycleHooks holds the WithOnAdd, WithOnUpdate and WithOnEvict callbacks
+// and the calls queued for them while the write lock is held.
+type lifecycleHooks struct {
+	onAdd    func(key, value int)
+	onUpdate func(key, old, new int)
+	onEvict  func(key, value int, reason EvictReason)
+	// silent keeps Restore, the initial data options and write-ahead log
+	// replay from calling the hooks.
+	silent  bool
+	pending []hookCall
+}
+
+// hookCall is a queued OnEvict call if reason is set, else OnUpdate or OnAdd.
+type hookCall struct {
+	key, old, value int
+	update          bool
+	reason          EvictReason
+}
+
+func (c *SecureLRUCache) lifecycle() *lifecycleHooks {
+	if c.hooks == nil {
+		c.hooks = &lifecycleHooks{}
+	}
+	return c.hooks
+}
+
+// WithOnAdd calls fn for every key written that had no live entry: by Put and
+// its variants, PutIfAbsent, GetOrPut and the loaders when they store a
+// value, and by Restore, the initial data options and write-ahead log replay
+// unless WithSilentRestore is given. Like WithOnUpdate, fn is called after
+// the write lock is released, in the order the writes happened, before the
+// method that made them returns, so it may call back into the cache.
+func WithOnAdd(fn func(key, value int)) Option {
+	return func(c *SecureLRUCache) error {
+		if fn == nil {
+			return fmt.Errorf("add hook must not be nil")
+		}
+		c.lifecycle().onAdd = fn
+		return nil
+	}
+}
+
+// WithOnUpdate calls fn with the old and new value whenever a write replaces
+// a live entry: by Put and its variants, Replace, a background refresh and
+// write-ahead log replay. Touch, which keeps the value, does not call it.
+func WithOnUpdate(fn func(key, old, new int)) Option {
+	return func(c *SecureLRUCache) error {
+		if fn == nil {
+			return fmt.Errorf("update hook must not be nil")
+		}
+		c.lifecycle().onUpdate = fn
+		return nil
+	}
+}
+
+// WithOnEvict calls fn for every entry that leaves the cache, with why: an
+// eviction to make room (ReasonCapacity) or by a shrink (ReasonResize), a
+// Remove, RemoveMany or other explicit removal (ReasonRemoved), an expiry
+// (ReasonExpired), or a Clear or Restore dropping it (ReasonCleared).
+// Overwriting a value is not an eviction. fn is called as WithOnAdd is,
+// except for ReasonCleared: the entries Clear and Restore drop are reported
+// on a goroutine of its own, the worker that recycles their nodes, after the
+// method returns and possibly alongside other calls to fn, and Close waits
+// for it. A closed cache, or one WithNoLock, reports them before Clear or
+// Restore returns.
+func WithOnEvict(fn func(key, value int, reason EvictReason)) Option {
+	return func(c *SecureLRUCache) error {
+		if fn == nil {
+			return fmt.Errorf("evict hook must not be nil")
+		}
+		c.lifecycle().onEvict = fn
+		return nil
+	}
+}
+
+// WithSilentRestore keeps the entries Restore, the initial data options and
+// write-ahead log replay install from reaching WithOnAdd and WithOnUpdate.
+func WithSilentRestore() Option {
+	return func(c *SecureLRUCache) error {
+		c.lifecycle().silent = true
+		return nil
+	}
+}
+
+// added queues the OnAdd call for key. The caller holds the write lock.
+func (c *SecureLRUCache) added(key, value int) {
+	if c.hooks != nil && c.hooks.onAdd != nil {
+		c.hooks.pending = append(c.hooks.pending, hookCall{key: key, value: value})
+	}
+}
+
+// updated queues the OnUpdate call for key. The caller holds the write lock.
+func (c *SecureLRUCache) updated(key, old, value int) {
+	if c.hooks != nil && c.hooks.onUpdate != nil {
+		c.hooks.pending = append(c.hooks.pending, hookCall{key: key, old: old, value: value, update: true})
+	}
+}
+
+// evicted queues the OnEvict call for an entry that left the cache. The
+// caller holds the write lock.
+func (c *SecureLRUCache) evicted(ev Event) {
+	if c.hooks != nil && c.hooks.onEvict != nil {
+		c.hooks.pending = append(c.hooks.pending, hookCall{key: ev.Key, value: ev.Value, reason: ev.Reason})
+	}
+}
+
+// restored is added for the entries a restore installs.
+func (c *SecureLRUCache) restored(key, value int) {
+	if c.hooks != nil && !c.hooks.silent {
+		c.added(key, value)
+	}
+}
+
+// replayed is added or updated for a write replayed from the write-ahead log.
+func (c *SecureLRUCache) replayed(key, old, value int, update bool) {
+	switch {
+	case c.hooks == nil || c.hooks.silent:
+	case update:
+		c.updated(key, old, value)
+	default:
+		c.added(key, value)
+	}
+}
+
+// takeHookCalls hands over the queued calls. The caller holds the write lock.
+func (c *SecureLRUCache) takeHookCalls() []hookCall {
+	if c.hooks == nil {
+		return nil
+	}
+	calls := c.hooks.pending
+	c.hooks.pending = nil
+	return calls
+}
+
+func (c *SecureLRUCache) runHooks(calls []hookCall) {
+	for _, call := range calls {
+		if call.reason != 0 {
+			c.hooks.onEvict(call.key, call.value, call.reason)
+		} else if call.update {
+			c.hooks.onUpdate(call.key, call.old, call.value)
+		} else {
+			c.hooks.onAdd(call.key, call.value)
+		}
+	}
+}
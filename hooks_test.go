@@ -0,0 +1,367 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// transcript records hook calls as "add k=v" and "update k old->new".
+type transcript struct {
+	lines []string
+}
+
+func (tr *transcript) options() []Option {
+	return []Option{
+		WithOnAdd(func(key, value int) {
+			tr.lines = append(tr.lines, fmt.Sprintf("add %d=%d", key, value))
+		}),
+		WithOnUpdate(func(key, old, new int) {
+			tr.lines = append(tr.lines, fmt.Sprintf("update %d %d->%d", key, old, new))
+		}),
+	}
+}
+
+func (tr *transcript) check(t *testing.T, want ...string) {
+	t.Helper()
+	if !slices.Equal(tr.lines, want) {
+		t.Errorf("hooks called:\n%q\nwant\n%q", tr.lines, want)
+	}
+	tr.lines = nil
+}
+
+func TestLifecycleHooksTranscript(t *testing.T) {
+	clock := newFakeClock()
+	tr := &transcript{}
+	c := newTestCache(t, 3, append(tr.options(), WithClock(clock))...)
+
+	c.Put(1, 10)
+	c.Put(1, 11)
+	c.PutIfAbsent(1, 12)
+	c.PutIfAbsent(2, 20)
+	c.GetOrPut(2, 21)
+	c.GetOrPut(3, 30)
+	c.Replace(3, 31)
+	c.Replace(9, 90)
+	c.Touch(3, time.Minute)
+	c.Remove(3)
+	c.PutWithTTL(4, 40, time.Second)
+	clock.Advance(2 * time.Second)
+	c.Put(4, 41) // expired, so an add
+	c.Put(5, 50) // evicts 1
+	c.GetOrLoad(6, func(key int) (int, error) { return key * 10, nil })
+	tr.check(t,
+		"add 1=10",
+		"update 1 10->11",
+		"add 2=20",
+		"add 3=30",
+		"update 3 30->31",
+		"add 4=40",
+		"add 4=41",
+		"add 5=50",
+		"add 6=60",
+	)
+
+	// Restoring into a cache with hooks adds each entry, oldest first.
+	d := c.Dump()
+	restored := newTestCache(t, 3, tr.options()...)
+	if err := restored.Restore(d); err != nil {
+		t.Fatal(err)
+	}
+	tr.check(t, "add 4=41", "add 5=50", "add 6=60")
+
+	silent := newTestCache(t, 3, append(tr.options(), WithSilentRestore())...)
+	if err := silent.Restore(d); err != nil {
+		t.Fatal(err)
+	}
+	silent.Put(6, 61)
+	tr.check(t, "update 6 60->61")
+}
+
+func TestLifecycleHooksOnWarmup(t *testing.T) {
+	tr := &transcript{}
+	initial := []Entry{{1, 10}, {2, 20}}
+	newTestCache(t, 4, append(tr.options(), WithInitialData(initial))...)
+	tr.check(t, "add 1=10", "add 2=20")
+	newTestCache(t, 4, append(tr.options(), WithInitialData(initial), WithSilentRestore())...)
+	tr.check(t)
+
+	path := filepath.Join(t.TempDir(), "wal")
+	w, err := NewSecureLRUCache(4, WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Put(1, 10)
+	w.Put(1, 11)
+	w.Put(2, 20)
+	w.Remove(2)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := NewSecureLRUCache(4, append(tr.options(), WithWAL(path))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replayed.Close()
+	tr.check(t, "add 1=10", "update 1 10->11", "add 2=20")
+}
+
+func TestLifecycleHooksMayCallBack(t *testing.T) {
+	var c *SecureLRUCache
+	var adds []int
+	c = newTestCache(t, 8, WithOnAdd(func(key, value int) {
+		adds = append(adds, key)
+		if key < 3 {
+			c.Put(key+1, value)
+		}
+	}), WithOnUpdate(func(key, old, new int) {
+		if v, ok := c.Peek(key); !ok || v != new {
+			t.Errorf("OnUpdate(%d) ran before the write: Peek = %d, %v", key, v, ok)
+		}
+	}))
+	c.Put(1, 1)
+	c.Put(2, 5)
+	if !slices.Equal(adds, []int{1, 2, 3}) {
+		t.Errorf("adds %v, want [1 2 3]", adds)
+	}
+	if c.Size() != 3 {
+		t.Errorf("Size = %d, want 3", c.Size())
+	}
+}
+
+func TestLifecycleHooksRejectNil(t *testing.T) {
+	for name, opt := range map[string]Option{"add": WithOnAdd(nil), "update": WithOnUpdate(nil), "evict": WithOnEvict(nil)} {
+		if _, err := NewSecureLRUCache(4, opt); err == nil {
+			t.Errorf("nil %s hook accepted", name)
+		}
+	}
+}
+
+// evictLog collects OnEvict calls, which Clear makes from another goroutine.
+type evictLog struct {
+	mu      sync.Mutex
+	entries []evictCall
+}
+
+type evictCall struct {
+	key, value int
+	reason     EvictReason
+}
+
+func (l *evictLog) option() Option {
+	return WithOnEvict(func(key, value int, reason EvictReason) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.entries = append(l.entries, evictCall{key, value, reason})
+	})
+}
+
+func (l *evictLog) take() []evictCall {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	calls := l.entries
+	l.entries = nil
+	return calls
+}
+
+func TestOnEvictReportsEveryPath(t *testing.T) {
+	clock := newFakeClock()
+	log := &evictLog{}
+	c := newTestCache(t, 3, log.option(), WithClock(clock))
+
+	c.Put(1, 10)
+	c.Put(2, 20)
+	c.Put(3, 30)
+	c.Put(1, 11) // an overwrite, not an eviction
+	c.Put(4, 40)
+	c.Resize(2)
+	c.Remove(1)
+	c.Remove(1)
+	c.RemoveMany([]int{4, 9})
+	c.PutWithTTL(5, 50, time.Second)
+	clock.Advance(2 * time.Second)
+	c.Get(5)
+	want := []evictCall{
+		{2, 20, ReasonCapacity},
+		{3, 30, ReasonResize},
+		{1, 11, ReasonRemoved},
+		{4, 40, ReasonRemoved},
+		{5, 50, ReasonExpired},
+	}
+	if got := log.take(); !slices.Equal(got, want) {
+		t.Errorf("OnEvict calls %v, want %v", got, want)
+	}
+
+	c.Resize(4)
+	c.Put(6, 60)
+	c.PutWithTTL(7, 70, time.Second)
+	clock.Advance(2 * time.Second) // 7 expires unseen, so Clear does not report it
+	c.Put(8, 80)
+	c.Clear()
+	c.drains.Wait()
+	got := log.take()
+	slices.SortFunc(got, func(a, b evictCall) int { return a.key - b.key })
+	if want := []evictCall{{6, 60, ReasonCleared}, {8, 80, ReasonCleared}}; !slices.Equal(got, want) {
+		t.Errorf("Clear reported %v, want %v", got, want)
+	}
+}
+
+func TestOnEvictReportsClearedEntriesOnce(t *testing.T) {
+	const entries = 20000
+	log := &evictLog{}
+	c, err := NewSecureLRUCache(entries, log.option(), WithDenseStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range entries {
+		c.Put(k, k)
+	}
+	d := c.Dump()
+	c.Clear()
+	if err := c.Restore(d); err != nil {
+		t.Fatal(err)
+	}
+	c.Clear()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[int]int)
+	for _, call := range log.take() {
+		if call.reason != ReasonCleared || call.value != call.key {
+			t.Fatalf("call %+v, want a clear", call)
+		}
+		seen[call.key]++
+	}
+	for k := range entries {
+		if seen[k] != 2 {
+			t.Fatalf("key %d reported %d times by two Clears", k, seen[k])
+		}
+	}
+}
+
+func TestOnEvictMayCallBack(t *testing.T) {
+	var c *SecureLRUCache
+	log := &evictLog{}
+	c = newTestCache(t, 4, WithOnEvict(func(key, value int, reason EvictReason) {
+		log.mu.Lock()
+		log.entries = append(log.entries, evictCall{key, value, reason})
+		log.mu.Unlock()
+		if n := c.Size(); n > 4 {
+			t.Errorf("OnEvict(%d) saw Size %d over the capacity", key, n)
+		}
+		switch {
+		case reason == ReasonCapacity && key < 100:
+			// Demote the entry, which evicts the next one in turn.
+			c.Put(key+100, value)
+		case reason == ReasonRemoved:
+			c.Remove(key + 1)
+		}
+	}))
+
+	for k := 1; k <= 5; k++ {
+		c.Put(k, k)
+	}
+	// Each demotion's own eviction is reported before the Put in the hook
+	// returns, so the calls come in eviction order, all before Put(5) did.
+	want := []evictCall{
+		{1, 1, ReasonCapacity}, {2, 2, ReasonCapacity}, {3, 3, ReasonCapacity},
+		{4, 4, ReasonCapacity}, {5, 5, ReasonCapacity}, {101, 1, ReasonCapacity},
+	}
+	if got := log.take(); !slices.Equal(got, want) {
+		t.Errorf("OnEvict calls %v, want %v", got, want)
+	}
+	if got := c.Keys(); !slices.Equal(got, []int{105, 104, 103, 102}) {
+		t.Fatalf("Keys = %v, want the last four demotions", got)
+	}
+
+	c.Remove(102)
+	want = []evictCall{{102, 2, ReasonRemoved}, {103, 3, ReasonRemoved}, {104, 4, ReasonRemoved}, {105, 5, ReasonRemoved}}
+	if got := log.take(); !slices.Equal(got, want) || c.Size() != 0 {
+		t.Errorf("OnEvict calls %v leaving %v, want %v leaving none", got, c.Keys(), want)
+	}
+}
+
+// OnEvict calling back into the cache from every path that evicts, while
+// other goroutines use it, must neither deadlock nor corrupt it.
+func TestOnEvictCallsBackUnderLoad(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	var c *SecureLRUCache
+	c = newTestCache(t, 8, WithOnEvict(func(key, value int, reason EvictReason) {
+		c.Size()
+		switch reason {
+		case ReasonCapacity, ReasonResize, ReasonExpired:
+			if key < 32 {
+				c.Put(key+32, value)
+			}
+		case ReasonRemoved:
+			c.Remove(key + 32)
+		}
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for g := range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r := rand.New(rand.NewSource(int64(g)))
+				for range 2000 {
+					k := r.Intn(32)
+					switch r.Intn(10) {
+					case 0:
+						c.Remove(k)
+					case 1:
+						c.Resize(4 + r.Intn(8))
+					case 2:
+						c.PutWithTTL(k, k, time.Microsecond)
+					case 3:
+						if r.Intn(20) == 0 {
+							c.Clear()
+						}
+					case 4, 5:
+						c.Put(k, k)
+					default:
+						c.Get(k)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		c.drains.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("OnEvict calling back into the cache deadlocked")
+	}
+}
+
+func TestNoHooksNoAllocations(t *testing.T) {
+	c, err := NewSecureLRUCache(100, WithDenseStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// Keys and values stay below 256, which box without allocating.
+	k := 0
+	evicting := testing.AllocsPerRun(1000, func() {
+		c.Put(k%200, k%200)
+		k++
+	})
+	removing := testing.AllocsPerRun(1000, func() {
+		c.Put(250, 1)
+		c.Remove(250)
+	})
+	if c.Stats().Evictions == 0 || evicting != 0 || removing != 0 {
+		t.Errorf("without hooks, %d evictions allocated %v times per Put and removals %v times",
+			c.Stats().Evictions, evicting, removing)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// KeyCount is a key and the number of reads it has had while cached.
+type KeyCount struct {
+	Key   int   `json:"key"`
+	Count int64 `json:"count"`
+}
+
+// WithAccessDecay halves every entry's access count each interval, so that
+// HotKeys reflects recent traffic rather than all-time totals. Close stops
+// it.
+func WithAccessDecay(interval time.Duration) Option {
+	return func(c *SecureLRUCache) error {
+		if interval <= 0 {
+			return fmt.Errorf("access decay interval must be positive")
+		}
+		c.decayInterval = interval
+		return nil
+	}
+}
+
+// HotKeys returns up to n live entries with the highest access counts, most
+// accessed first. Get, GetOrDefault and loader hits count as accesses; Peek
+// does not. A count survives overwrites of the key but starts again from
+// zero if the entry is evicted or removed and later added back.
+func (c *SecureLRUCache) HotKeys(n int) []KeyCount {
+	if n <= 0 {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	top := make(keyCountHeap, 0, min(n, len(c.cache)))
+	for _, node := range c.cache {
+		if !c.visible(node) {
+			continue
+		}
+		kc := KeyCount{Key: node.key, Count: node.accesses.Load()}
+		if len(top) < n {
+			heap.Push(&top, kc)
+		} else if kc.Count > top[0].Count {
+			top[0] = kc
+			heap.Fix(&top, 0)
+		}
+	}
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Key < top[j].Key
+	})
+	return top
+}
+
+func (c *SecureLRUCache) startAccessDecay() {
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		ticker := time.NewTicker(c.decayInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.decayAccesses()
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+func (c *SecureLRUCache) decayAccesses() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, node := range c.cache {
+		// Get may be counting concurrently under the read lock; losing
+		// one of its increments to the halving is fine.
+		node.accesses.Store(node.accesses.Load() / 2)
+	}
+}
+
+// keyCountHeap is a min-heap on Count, holding the best n seen so far.
+type keyCountHeap []KeyCount
+
+func (h keyCountHeap) Len() int           { return len(h) }
+func (h keyCountHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h keyCountHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *keyCountHeap) Push(x any)        { *h = append(*h, x.(KeyCount)) }
+
+func (h *keyCountHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
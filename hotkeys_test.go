@@ -0,0 +1,38 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHotKeys(t *testing.T) {
+	c := newTestCache(t, 8)
+	reads := map[int]int{1: 5, 2: 1, 3: 3, 4: 3, 5: 0}
+	for k, n := range reads {
+		c.Put(k, k)
+		for range n {
+			c.Get(k)
+		}
+	}
+	c.Peek(2)
+	c.Put(3, 30) // an overwrite keeps the count
+
+	want := []KeyCount{{Key: 1, Count: 5}, {Key: 3, Count: 3}, {Key: 4, Count: 3}}
+	if got := c.HotKeys(3); !slices.Equal(got, want) {
+		t.Errorf("HotKeys(3) = %v, want %v", got, want)
+	}
+	if got := c.HotKeys(100); len(got) != 5 || got[3] != (KeyCount{Key: 2, Count: 1}) {
+		t.Errorf("HotKeys(100) = %v, want all five with Peek uncounted", got)
+	}
+	if got := c.HotKeys(0); got != nil {
+		t.Errorf("HotKeys(0) = %v", got)
+	}
+
+	c.Remove(1)
+	c.Put(1, 1)
+	c.decayAccesses()
+	want = []KeyCount{{Key: 3, Count: 1}, {Key: 4, Count: 1}}
+	if got := c.HotKeys(2); !slices.Equal(got, want) {
+		t.Errorf("after re-adding 1 and a decay, HotKeys(2) = %v, want %v", got, want)
+	}
+}
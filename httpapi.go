@@ -0,0 +1,186 @@
+// The handlers use method and wildcard patterns, which GOPATH builds turn off
+// by default.
+
+//go:debug httpmuxgo121=0
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+type putResponse struct {
+	Key     int    `json:"key"`
+	Value   int    `json:"value"`
+	Evicted *Entry `json:"evicted,omitempty"`
+}
+
+type keysResponse struct {
+	Keys []int `json:"keys"`
+	// Next is the cursor of the following page, empty after the last one.
+	Next Cursor `json:"next,omitempty"`
+	// Total is Size, which may count expired entries not yet dropped.
+	Total int `json:"total"`
+}
+
+type resizeRequest struct {
+	Capacity int `json:"capacity"`
+}
+
+// HTTPHandler serves the cache as a small REST key-value API. Values are
+// JSON numbers.
+//
+//	GET    /keys/{key}  the value, or 404
+//	PUT    /keys/{key}  store the body; ?ttl=30s sets a TTL, and the
+//	                    response reports the entry evicted, if any
+//	DELETE /keys/{key}  204, or 404
+//	GET    /keys        keys from most to least recent, a page of ?limit= at
+//	                    a time from the ?cursor= the previous page returned
+//	GET    /stats       Stats
+//	POST   /resize      {"capacity": n}
+//
+// Every cache call returns before the response is written, so a slow
+// client never holds the cache's lock.
+func (c *SecureLRUCache) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /keys/{key}", c.handleGet)
+	mux.HandleFunc("PUT /keys/{key}", c.handlePut)
+	mux.HandleFunc("DELETE /keys/{key}", c.handleDelete)
+	mux.HandleFunc("GET /keys", c.handleKeys)
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Stats())
+	})
+	mux.HandleFunc("POST /resize", c.handleResize)
+	return mux
+}
+
+func (c *SecureLRUCache) handleGet(w http.ResponseWriter, r *http.Request) {
+	key, ok := pathKey(w, r)
+	if !ok {
+		return
+	}
+	value, found := c.Get(key)
+	if !found {
+		http.Error(w, "key not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, value)
+}
+
+func (c *SecureLRUCache) handlePut(w http.ResponseWriter, r *http.Request) {
+	key, ok := pathKey(w, r)
+	if !ok {
+		return
+	}
+	var value int
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64)).Decode(&value); err != nil {
+		http.Error(w, "body must be a JSON integer", http.StatusBadRequest)
+		return
+	}
+	ttl := c.defaultTTL
+	if s := r.URL.Query().Get("ttl"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			http.Error(w, "ttl must be a positive duration", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	evicted, ok, err := c.write(key, value, 1, ttl)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	resp := putResponse{Key: key, Value: value}
+	if ok {
+		resp.Evicted = &evicted
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (c *SecureLRUCache) handleDelete(w http.ResponseWriter, r *http.Request) {
+	key, ok := pathKey(w, r)
+	if !ok {
+		return
+	}
+	if !c.Remove(key) {
+		http.Error(w, "key not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *SecureLRUCache) handleKeys(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := queryInt(query.Get("limit"), defaultPageLimit)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPageLimit), http.StatusBadRequest)
+		return
+	}
+
+	keys, next, err := c.KeysPage(Cursor(query.Get("cursor")), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if keys == nil {
+		keys = []int{}
+	}
+	writeJSON(w, http.StatusOK, keysResponse{Keys: keys, Next: next, Total: c.Size()})
+}
+
+func (c *SecureLRUCache) handleResize(w http.ResponseWriter, r *http.Request) {
+	var req resizeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+		http.Error(w, `body must be {"capacity": n}`, http.StatusBadRequest)
+		return
+	}
+	if err := c.Resize(req.Capacity); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+func pathKey(w http.ResponseWriter, r *http.Request) (int, bool) {
+	key, err := strconv.Atoi(r.PathValue("key"))
+	if err != nil {
+		http.Error(w, "key must be an integer", http.StatusBadRequest)
+		return 0, false
+	}
+	return key, true
+}
+
+func queryInt(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// errorStatus maps an error from a write onto an HTTP status: the entry's
+// own fault is the client's, anything else, such as a failing write-through
+// store, the server's.
+func errorStatus(err error) int {
+	if errors.Is(err, ErrEntryTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// do sends a request to h and returns the status and the body.
+func do(t *testing.T, h http.Handler, method, target, body string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec.Code, rec.Body.String()
+}
+
+func TestHTTPHandlerKeyRoutes(t *testing.T) {
+	c := newTestCache(t, 2)
+	h := c.HTTPHandler()
+
+	steps := []struct {
+		method, target, body string
+		code                 int
+		want                 string
+	}{
+		{"GET", "/keys/1", "", 404, "key not found\n"},
+		{"PUT", "/keys/1", "10", 200, `{"key":1,"value":10}` + "\n"},
+		{"PUT", "/keys/2", "20", 200, `{"key":2,"value":20}` + "\n"},
+		{"GET", "/keys/1", "", 200, "10\n"},
+		{"PUT", "/keys/3", "30", 200, `{"key":3,"value":30,"evicted":{"key":2,"value":20}}` + "\n"},
+		{"GET", "/keys/2", "", 404, "key not found\n"},
+		{"DELETE", "/keys/1", "", 204, ""},
+		{"DELETE", "/keys/1", "", 404, "key not found\n"},
+		{"GET", "/keys/x", "", 400, "key must be an integer\n"},
+		{"PUT", "/keys/4", `"forty"`, 400, "body must be a JSON integer\n"},
+		{"POST", "/keys/4", "40", 405, "Method Not Allowed\n"},
+	}
+	for _, s := range steps {
+		code, body := do(t, h, s.method, s.target, s.body)
+		if code != s.code || body != s.want {
+			t.Errorf("%s %s = %d %q, want %d %q", s.method, s.target, code, body, s.code, s.want)
+		}
+	}
+}
+
+func TestHTTPHandlerPutTTL(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 2, WithClock(clock))
+	h := c.HTTPHandler()
+
+	if code, body := do(t, h, "PUT", "/keys/1?ttl=1m", "1"); code != 200 {
+		t.Fatalf("PUT with ttl = %d %q", code, body)
+	}
+	if code, _ := do(t, h, "PUT", "/keys/1?ttl=soon", "1"); code != 400 {
+		t.Errorf("PUT with a bad ttl = %d, want 400", code)
+	}
+	clock.Advance(time.Minute)
+	if code, _ := do(t, h, "GET", "/keys/1", ""); code != 404 {
+		t.Errorf("GET after the ttl = %d, want 404", code)
+	}
+}
+
+func TestHTTPHandlerWriteErrors(t *testing.T) {
+	c := newTestCache(t, 2, WithWriteThrough(func(int, int) error { return errors.New("store down") }))
+	if code, body := do(t, c.HTTPHandler(), "PUT", "/keys/1", "1"); code != 500 || body != "store down\n" {
+		t.Errorf("PUT with a failing store = %d %q, want 500", code, body)
+	}
+	if got := errorStatus(fmt.Errorf("wrapped: %w", ErrEntryTooLarge)); got != 413 {
+		t.Errorf("errorStatus(ErrEntryTooLarge) = %d, want 413", got)
+	}
+}
+
+func TestHTTPHandlerListsKeysInPages(t *testing.T) {
+	c := newTestCache(t, 10)
+	for k := range 5 {
+		c.Put(k, k)
+	}
+	h := c.HTTPHandler()
+
+	var got []int
+	var cursor Cursor
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging did not end")
+		}
+		code, body := do(t, h, "GET", "/keys?limit=2&cursor="+string(cursor), "")
+		if code != 200 {
+			t.Fatalf("GET /keys = %d %q", code, body)
+		}
+		var page keysResponse
+		if err := json.Unmarshal([]byte(body), &page); err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 5 || len(page.Keys) > 2 {
+			t.Fatalf("page %+v", page)
+		}
+		got = append(got, page.Keys...)
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
+	}
+	if want := []int{4, 3, 2, 1, 0}; !slices.Equal(got, want) {
+		t.Errorf("paged keys %v, want %v", got, want)
+	}
+
+	empty := newTestCache(t, 4).HTTPHandler()
+	if _, body := do(t, empty, "GET", "/keys", ""); body != `{"keys":[],"total":0}`+"\n" {
+		t.Errorf("an empty cache: %q", body)
+	}
+	for _, q := range []string{"limit=0", "limit=1001", "cursor=x", "limit=x"} {
+		if code, _ := do(t, h, "GET", "/keys?"+q, ""); code != 400 {
+			t.Errorf("GET /keys?%s = %d, want 400", q, code)
+		}
+	}
+}
+
+func TestHTTPHandlerStatsAndResize(t *testing.T) {
+	c := newTestCache(t, 4)
+	for k := range 4 {
+		c.Put(k, k)
+	}
+	h := c.HTTPHandler()
+
+	if code, body := do(t, h, "POST", "/resize", `{"capacity": 2}`); code != 200 || body != `{"capacity":2}`+"\n" {
+		t.Errorf("POST /resize = %d %q", code, body)
+	}
+	for _, body := range []string{`{"capacity": 0}`, `2`} {
+		if code, _ := do(t, h, "POST", "/resize", body); code != 400 {
+			t.Errorf("POST /resize %s = %d, want 400", body, code)
+		}
+	}
+
+	code, body := do(t, h, "GET", "/stats", "")
+	var st CacheStats
+	if err := json.Unmarshal([]byte(body), &st); code != 200 || err != nil {
+		t.Fatalf("GET /stats = %d %q: %v", code, body, err)
+	}
+	if st.Size != 2 || st.Capacity != 2 || st.Evictions != 2 || st.Puts != 4 {
+		t.Errorf("stats %+v", st)
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMaxBodySize = 1 << 20
+
+// defaultCachedHeaders are the response headers replayed on a hit.
+var defaultCachedHeaders = []string{
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Length",
+	"Content-Type",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+	"Vary",
+}
+
+type httpCache struct {
+	cache   *SecureLRUCache
+	key     func(r *http.Request) string
+	maxBody int
+	headers []string
+	ttl     time.Duration
+
+	mu sync.Mutex
+	// responses holds the bodies the cache's int values stand for: the
+	// value is the response's generation, so a response is served only
+	// while the cache still holds the entry it was stored under.
+	responses map[int]*cachedResponse
+	// vary maps a base key to the request headers its responses vary on.
+	vary map[string][]string
+	gen  int
+}
+
+type cachedResponse struct {
+	// key is the variant key the response was stored under, as hashed keys
+	// may collide.
+	key    string
+	gen    int
+	status int
+	header http.Header
+	body   []byte
+}
+
+type HTTPCacheOption func(*httpCache)
+
+// WithCacheKey replaces the default key, the method and URL, with fn.
+func WithCacheKey(fn func(r *http.Request) string) HTTPCacheOption {
+	return func(h *httpCache) {
+		h.key = fn
+	}
+}
+
+// WithMaxBodySize sets the largest body cached, 1 MiB by default. Larger
+// responses are passed through uncached.
+func WithMaxBodySize(n int) HTTPCacheOption {
+	return func(h *httpCache) {
+		h.maxBody = n
+	}
+}
+
+// WithCachedHeaders sets the response headers stored and replayed, in place
+// of the default set.
+func WithCachedHeaders(names ...string) HTTPCacheOption {
+	return func(h *httpCache) {
+		h.headers = make([]string, len(names))
+		for i, name := range names {
+			h.headers[i] = http.CanonicalHeaderKey(name)
+		}
+	}
+}
+
+// WithResponseTTL sets the TTL of responses with neither a max-age nor an
+// Expires header. It defaults to the cache's default TTL; with neither set
+// such responses are kept until evicted.
+func WithResponseTTL(ttl time.Duration) HTTPCacheOption {
+	return func(h *httpCache) {
+		h.ttl = ttl
+	}
+}
+
+// HTTPCacheMiddleware caches successful GET and HEAD responses in cache and
+// replays them on later requests, marking each response X-Cache: HIT or
+// MISS. Responses are kept for their max-age, or else until their Expires
+// time, when they give one; an Expires that is not a valid date has already
+// passed. Requests
+// with credentials or cookies, responses with Cache-Control no-store,
+// private or no-cache, Set-Cookie or Vary: *, and bodies over the size limit
+// are not cached. A Vary header keys later requests on the headers it names.
+//
+// cache holds which responses are resident and for how long; the responses
+// themselves live beside it and are dropped once their entries are gone. It
+// panics if cache is nil.
+func HTTPCacheMiddleware(cache *SecureLRUCache, opts ...HTTPCacheOption) func(http.Handler) http.Handler {
+	if cache == nil {
+		panic("cache must not be nil")
+	}
+	h := &httpCache{
+		cache:     cache,
+		key:       func(r *http.Request) string { return r.Method + " " + r.URL.String() },
+		maxBody:   defaultMaxBodySize,
+		headers:   defaultCachedHeaders,
+		ttl:       cache.defaultTTL,
+		responses: make(map[int]*cachedResponse),
+		vary:      make(map[string][]string),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.serve(next, w, r)
+		})
+	}
+}
+
+func (h *httpCache) serve(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	if !cacheableRequest(r) {
+		w.Header().Set("X-Cache", "MISS")
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	base := h.key(r)
+	if !hasDirective(r.Header, "no-cache") {
+		if resp := h.lookup(base, r); resp != nil {
+			resp.replay(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("X-Cache", "MISS")
+	rec := &responseRecorder{ResponseWriter: w, max: h.maxBody}
+	next.ServeHTTP(rec, r)
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	h.store(base, r, rec)
+}
+
+// cacheableRequest reports whether r may be answered from, or stored in, a
+// cache shared between clients.
+func cacheableRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+		return false
+	}
+	return !hasDirective(r.Header, "no-store")
+}
+
+// variantKey is base extended with the values r sends for the headers a
+// response varies on.
+func variantKey(base string, vary []string, r *http.Request) string {
+	if len(vary) == 0 {
+		return base
+	}
+	var b strings.Builder
+	b.WriteString(base)
+	for _, name := range vary {
+		b.WriteString("\x00")
+		b.WriteString(name)
+		b.WriteString(":")
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+func (h *httpCache) lookup(base string, r *http.Request) *cachedResponse {
+	h.mu.Lock()
+	vary, ok := h.vary[base]
+	h.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	variant := variantKey(base, vary, r)
+	key := HashKey(variant)
+	gen, ok := h.cache.Get(key)
+	if !ok {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	resp := h.responses[key]
+	if resp == nil || resp.gen != gen || resp.key != variant {
+		return nil
+	}
+	return resp
+}
+
+func (h *httpCache) store(base string, r *http.Request, rec *responseRecorder) {
+	header := rec.Header()
+	if rec.overflow || rec.status < 200 || rec.status >= 300 || rec.status == http.StatusPartialContent {
+		return
+	}
+	if header.Get("Set-Cookie") != "" || hasDirective(header, "no-store") ||
+		hasDirective(header, "private") || hasDirective(header, "no-cache") {
+		return
+	}
+	ttl := h.ttl
+	if maxAge, ok := maxAge(header); ok {
+		if maxAge <= 0 {
+			return
+		}
+		ttl = maxAge
+	} else if expires, ok := expiresIn(header, h.cache.clock.Now()); ok {
+		if expires <= 0 {
+			return
+		}
+		ttl = expires
+	}
+	var vary []string
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "*" {
+				return
+			}
+			if name != "" {
+				vary = append(vary, name)
+			}
+		}
+	}
+	slices.Sort(vary)
+	vary = slices.Compact(vary)
+
+	resp := &cachedResponse{status: rec.status, header: make(http.Header), body: rec.body.Bytes()}
+	for _, name := range h.headers {
+		if values := header.Values(name); len(values) > 0 {
+			resp.header[name] = slices.Clone(values)
+		}
+	}
+	if r.Method == http.MethodGet {
+		resp.header.Set("Content-Length", strconv.Itoa(len(resp.body)))
+	}
+
+	resp.key = variantKey(base, vary, r)
+	key := HashKey(resp.key)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.gen++
+	resp.gen = h.gen
+	if _, _, _, err := h.cache.writeIf(key, resp.gen, 1, ttl, writeAlways); err != nil {
+		return
+	}
+	h.responses[key] = resp
+	h.vary[base] = vary
+	h.prune()
+}
+
+// prune drops the responses whose entries the cache no longer holds, once
+// they far outnumber what it can hold. The caller holds h.mu.
+func (h *httpCache) prune() {
+	limit := 2*h.cache.Capacity() + 64
+	if len(h.responses) <= limit && len(h.vary) <= limit {
+		return
+	}
+	for key, resp := range h.responses {
+		if gen, ok := h.cache.Peek(key); !ok || gen != resp.gen {
+			delete(h.responses, key)
+		}
+	}
+	if len(h.vary) > limit {
+		// Variant keys cannot be traced back to their base, so start over;
+		// the next response for each URL records its Vary again.
+		clear(h.vary)
+	}
+}
+
+func (resp *cachedResponse) replay(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	for name, values := range resp.header {
+		header[name] = slices.Clone(values)
+	}
+	header.Set("X-Cache", "HIT")
+	w.WriteHeader(resp.status)
+	if r.Method != http.MethodHead {
+		w.Write(resp.body)
+	}
+}
+
+// hasDirective reports whether header's Cache-Control lists directive.
+func hasDirective(header http.Header, directive string) bool {
+	_, ok := cacheControl(header, directive)
+	return ok
+}
+
+// cacheControl finds directive in header's Cache-Control and returns its
+// argument, if any.
+func cacheControl(header http.Header, directive string) (string, bool) {
+	for _, v := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(v, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if strings.EqualFold(name, directive) {
+				return strings.Trim(arg, `"`), true
+			}
+		}
+	}
+	return "", false
+}
+
+// maxAge is the response's freshness lifetime from s-maxage or max-age.
+func maxAge(header http.Header) (time.Duration, bool) {
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if arg, ok := cacheControl(header, directive); ok {
+			seconds, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil || seconds < 0 {
+				return 0, true
+			}
+			return time.Duration(min(seconds, int64(1<<62)/int64(time.Second))) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// expiresIn is how long from now the response's Expires header lasts. An
+// Expires that does not parse, such as "0", is in the past.
+func expiresIn(header http.Header, now time.Time) (time.Duration, bool) {
+	v := header.Get("Expires")
+	if v == "" {
+		return 0, false
+	}
+	at, err := http.ParseTime(v)
+	if err != nil {
+		return 0, true
+	}
+	return at.Sub(now), true
+}
+
+// responseRecorder passes a response through to the client while keeping a
+// copy of its status and up to max bytes of its body.
+type responseRecorder struct {
+	http.ResponseWriter
+	max         int
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	overflow    bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = status
+	rec.wroteHeader = true
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if !rec.overflow {
+		if rec.body.Len()+len(p) > rec.max {
+			rec.overflow = true
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(p)
+		}
+	}
+	return rec.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the client's writer, for
+// flushing and deadlines.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
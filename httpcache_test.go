@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingHandler answers with body and counts its calls.
+type countingHandler struct {
+	calls  int
+	status int
+	header http.Header
+	body   string
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	for name, values := range h.header {
+		w.Header()[name] = values
+	}
+	if h.status != 0 {
+		w.WriteHeader(h.status)
+	}
+	fmt.Fprintf(w, "%s #%d", h.body, h.calls)
+}
+
+func doCached(t *testing.T, handler http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHTTPCacheHitAndMiss(t *testing.T) {
+	c := newTestCache(t, 8)
+	next := &countingHandler{body: "page", header: http.Header{
+		"Content-Type": {"text/plain"},
+		"X-Internal":   {"secret"},
+	}}
+	handler := HTTPCacheMiddleware(c)(next)
+
+	first := doCached(t, handler, "GET", "/a?x=1", nil)
+	if first.Header().Get("X-Cache") != "MISS" || first.Body.String() != "page #1" {
+		t.Fatalf("first request: %s %q", first.Header().Get("X-Cache"), first.Body)
+	}
+	second := doCached(t, handler, "GET", "/a?x=1", nil)
+	if second.Header().Get("X-Cache") != "HIT" || second.Body.String() != "page #1" {
+		t.Fatalf("second request: %s %q", second.Header().Get("X-Cache"), second.Body)
+	}
+	if got := second.Header().Get("Content-Type"); got != "text/plain" {
+		t.Errorf("replayed Content-Type = %q", got)
+	}
+	if got := second.Header().Get("Content-Length"); got != "7" {
+		t.Errorf("replayed Content-Length = %q, want 7", got)
+	}
+	if got := second.Header().Get("X-Internal"); got != "" {
+		t.Errorf("replayed an unselected header: %q", got)
+	}
+
+	// Another URL or method is another entry.
+	if got := doCached(t, handler, "GET", "/a?x=2", nil).Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("another query: %s", got)
+	}
+	head := doCached(t, handler, "HEAD", "/a?x=1", nil)
+	if head.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("HEAD after GET: %s", head.Header().Get("X-Cache"))
+	}
+	head = doCached(t, handler, "HEAD", "/a?x=1", nil)
+	if head.Header().Get("X-Cache") != "HIT" || head.Body.Len() != 0 {
+		t.Errorf("second HEAD: %s with %d body bytes", head.Header().Get("X-Cache"), head.Body.Len())
+	}
+	if next.calls != 3 {
+		t.Errorf("handler ran %d times, want 3", next.calls)
+	}
+
+	// Evicted or removed entries are misses again.
+	c.Clear()
+	if got := doCached(t, handler, "GET", "/a?x=1", nil).Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("after Clear: %s", got)
+	}
+}
+
+func TestHTTPCacheBypass(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		next   *countingHandler
+		method string
+		header http.Header
+	}{
+		{"too large", &countingHandler{body: strings.Repeat("x", 64)}, "GET", nil},
+		{"no-store", &countingHandler{body: "a", header: http.Header{"Cache-Control": {"no-store"}}}, "GET", nil},
+		{"private", &countingHandler{body: "a", header: http.Header{"Cache-Control": {"public, private"}}}, "GET", nil},
+		{"max-age=0", &countingHandler{body: "a", header: http.Header{"Cache-Control": {"max-age=0"}}}, "GET", nil},
+		{"set-cookie", &countingHandler{body: "a", header: http.Header{"Set-Cookie": {"id=1"}}}, "GET", nil},
+		{"vary star", &countingHandler{body: "a", header: http.Header{"Vary": {"*"}}}, "GET", nil},
+		{"not found", &countingHandler{body: "a", status: http.StatusNotFound}, "GET", nil},
+		{"post", &countingHandler{body: "a"}, "POST", nil},
+		{"authorization", &countingHandler{body: "a"}, "GET", http.Header{"Authorization": {"Bearer x"}}},
+		{"request no-store", &countingHandler{body: "a"}, "GET", http.Header{"Cache-Control": {"no-store"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestCache(t, 8)
+			handler := HTTPCacheMiddleware(c, WithMaxBodySize(32))(tc.next)
+			for i := 1; i <= 2; i++ {
+				rec := doCached(t, handler, tc.method, "/", tc.header)
+				if got := rec.Header().Get("X-Cache"); got != "MISS" {
+					t.Fatalf("request %d: X-Cache %s", i, got)
+				}
+				if want := fmt.Sprintf("%s #%d", tc.next.body, i); rec.Body.String() != want {
+					t.Fatalf("request %d: body %q, want %q", i, rec.Body, want)
+				}
+			}
+			if c.Size() != 0 {
+				t.Errorf("cache holds %d entries", c.Size())
+			}
+		})
+	}
+}
+
+func TestHTTPCacheRequestNoCacheRefreshes(t *testing.T) {
+	c := newTestCache(t, 8)
+	next := &countingHandler{body: "a"}
+	handler := HTTPCacheMiddleware(c)(next)
+	doCached(t, handler, "GET", "/", nil)
+	rec := doCached(t, handler, "GET", "/", http.Header{"Cache-Control": {"no-cache"}})
+	if rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != "a #2" {
+		t.Fatalf("no-cache request: %s %q", rec.Header().Get("X-Cache"), rec.Body)
+	}
+	if got := doCached(t, handler, "GET", "/", nil).Body.String(); got != "a #2" {
+		t.Errorf("after a no-cache request the cache serves %q, want the refreshed response", got)
+	}
+}
+
+func TestHTTPCacheMaxAge(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 8, WithClock(clock))
+	short := &countingHandler{body: "a", header: http.Header{"Cache-Control": {"max-age=10"}}}
+	shared := &countingHandler{body: "b", header: http.Header{"Cache-Control": {"max-age=1, s-maxage=100"}}}
+	plain := &countingHandler{body: "c"}
+	mw := HTTPCacheMiddleware(c, WithResponseTTL(time.Minute))
+	handlers := map[string]http.Handler{"/short": mw(short), "/shared": mw(shared), "/plain": mw(plain)}
+	hit := func(path string) bool {
+		return doCached(t, handlers[path], "GET", path, nil).Header().Get("X-Cache") == "HIT"
+	}
+	for path := range handlers {
+		hit(path)
+	}
+
+	clock.Advance(9 * time.Second)
+	if !hit("/short") || !hit("/shared") || !hit("/plain") {
+		t.Fatal("an entry expired early")
+	}
+	clock.Advance(time.Second)
+	if hit("/short") {
+		t.Error("max-age=10 served after 10s")
+	}
+	clock.Advance(50 * time.Second)
+	if hit("/plain") {
+		t.Error("default TTL not applied")
+	}
+	if !hit("/shared") {
+		t.Error("s-maxage did not override max-age")
+	}
+}
+
+func TestHTTPCacheVary(t *testing.T) {
+	c := newTestCache(t, 8)
+	handler := HTTPCacheMiddleware(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept-Language, accept-encoding")
+		fmt.Fprint(w, r.Header.Get("Accept-Language"))
+	}))
+	get := func(lang string) *httptest.ResponseRecorder {
+		return doCached(t, handler, "GET", "/", http.Header{"Accept-Language": {lang}})
+	}
+
+	if rec := get("en"); rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatal("first en request hit")
+	}
+	if rec := get("fr"); rec.Header().Get("X-Cache") != "MISS" || rec.Body.String() != "fr" {
+		t.Fatalf("fr after en: %s %q", rec.Header().Get("X-Cache"), rec.Body)
+	}
+	for _, lang := range []string{"en", "fr"} {
+		if rec := get(lang); rec.Header().Get("X-Cache") != "HIT" || rec.Body.String() != lang {
+			t.Errorf("%s again: %s %q", lang, rec.Header().Get("X-Cache"), rec.Body)
+		}
+	}
+	rec := doCached(t, handler, "GET", "/", http.Header{"Accept-Language": {"en"}, "Accept-Encoding": {"gzip"}})
+	if rec.Header().Get("X-Cache") != "MISS" {
+		t.Error("a different Accept-Encoding shared the entry")
+	}
+}
+
+func TestHTTPCacheCustomKeyAndHeaders(t *testing.T) {
+	c := newTestCache(t, 8)
+	next := &countingHandler{body: "a", header: http.Header{"X-Version": {"3"}}}
+	handler := HTTPCacheMiddleware(c,
+		WithCacheKey(func(r *http.Request) string { return r.URL.Path }),
+		WithCachedHeaders("x-version"))(next)
+	doCached(t, handler, "GET", "/p?v=1", nil)
+	rec := doCached(t, handler, "GET", "/p?v=2", nil)
+	if rec.Header().Get("X-Cache") != "HIT" || rec.Header().Get("X-Version") != "3" {
+		t.Errorf("got %s with X-Version %q", rec.Header().Get("X-Cache"), rec.Header().Get("X-Version"))
+	}
+}
+
+func TestHTTPCacheDropsEvictedResponses(t *testing.T) {
+	c := newTestCache(t, 4)
+	h := &httpCache{
+		cache:     c,
+		key:       func(r *http.Request) string { return r.URL.Path },
+		maxBody:   defaultMaxBodySize,
+		headers:   defaultCachedHeaders,
+		responses: make(map[int]*cachedResponse),
+		vary:      make(map[string][]string),
+	}
+	for i := range 500 {
+		rec := &responseRecorder{ResponseWriter: httptest.NewRecorder(), max: h.maxBody}
+		rec.Write([]byte("x"))
+		h.store(fmt.Sprintf("/%d", i), httptest.NewRequest("GET", "/", nil), rec)
+	}
+	if n := len(h.responses); n > 2*c.Capacity()+64 {
+		t.Errorf("%d responses kept for a cache of %d entries", n, c.Capacity())
+	}
+	if n := len(h.vary); n > 2*c.Capacity()+64 {
+		t.Errorf("%d vary records kept for a cache of %d entries", n, c.Capacity())
+	}
+}
+
+func TestHTTPCacheExpires(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 8, WithClock(clock))
+	at := clock.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	expires := &countingHandler{body: "a", header: http.Header{"Expires": {at}}}
+	both := &countingHandler{body: "b", header: http.Header{"Expires": {at}, "Cache-Control": {"max-age=100"}}}
+	invalid := &countingHandler{body: "c", header: http.Header{"Expires": {"0"}}}
+	mw := HTTPCacheMiddleware(c)
+	handlers := map[string]http.Handler{"/expires": mw(expires), "/both": mw(both), "/invalid": mw(invalid)}
+	hit := func(path string) bool {
+		return doCached(t, handlers[path], "GET", path, nil).Header().Get("X-Cache") == "HIT"
+	}
+	for path := range handlers {
+		hit(path)
+	}
+
+	if hit("/invalid") {
+		t.Error("Expires: 0 was cached")
+	}
+	clock.Advance(29 * time.Second)
+	if !hit("/expires") || !hit("/both") {
+		t.Fatal("an entry expired early")
+	}
+	clock.Advance(time.Second)
+	if hit("/expires") {
+		t.Error("served past its Expires time")
+	}
+	if !hit("/both") {
+		t.Error("Expires overrode max-age")
+	}
+}
+
+func TestHTTPCacheHashCollisionIsAMiss(t *testing.T) {
+	c := newTestCache(t, 8)
+	var h *httpCache
+	next := &countingHandler{body: "a"}
+	handler := HTTPCacheMiddleware(c,
+		WithCacheKey(func(r *http.Request) string { return r.URL.Path }),
+		func(hc *httpCache) { h = hc })(next)
+	doCached(t, handler, "GET", "/a", nil)
+
+	// Pose /a's response as one stored under the hash of /b.
+	h.mu.Lock()
+	resp := h.responses[HashKey("/a")]
+	h.responses[HashKey("/b")] = resp
+	h.vary["/b"] = nil
+	h.mu.Unlock()
+	c.Put(HashKey("/b"), resp.gen)
+
+	if rec := doCached(t, handler, "GET", "/b", nil); rec.Header().Get("X-Cache") != "MISS" || next.calls != 2 {
+		t.Errorf("/b answered %s with %q, want a miss", rec.Header().Get("X-Cache"), rec.Body)
+	}
+}
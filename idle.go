@@ -0,0 +1,60 @@
+package main
+
+import "time"
+
+// lastUsed is when node was last read or written.
+func lastUsed(node *Node) time.Time {
+	if at := node.accessedAt.Load(); at > node.createdAt.UnixNano() {
+		return time.Unix(0, at)
+	}
+	return node.createdAt
+}
+
+// RemoveOlderThan removes the entries not read or written within d, by the
+// cache's clock, as Remove would, and reports how many it removed. It walks
+// from the next victim and stops at the first entry used since the cutoff,
+// so under LRU and FIFO only the idle tail is visited; under other policies
+// idle entries the policy ranks behind a recent one are kept. Policies
+// without CandidatePolicy are walked in full. Expired entries met on the way
+// are dropped without being counted.
+func (c *SecureLRUCache) RemoveOlderThan(d time.Duration) int {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.applyPromotions()
+	cutoff := c.clock.Now().Add(-d)
+	var idle []*Node
+	visit := func(node *Node) bool {
+		if c.visible(node) && !lastUsed(node).Before(cutoff) {
+			return false
+		}
+		idle = append(idle, node)
+		return true
+	}
+	if p, ok := c.policy.(CandidatePolicy); ok {
+		p.Candidates(visit)
+	} else {
+		var order []*Node
+		c.policy.Each(func(node *Node) bool {
+			order = append(order, node)
+			return true
+		})
+		for i := len(order) - 1; i >= 0; i-- {
+			if !visit(order[i]) {
+				break
+			}
+		}
+	}
+
+	removed := 0
+	for _, node := range idle {
+		if !c.visible(node) {
+			c.expire(node)
+			continue
+		}
+		c.invalidate(Invalidation{Key: node.key})
+		c.removeKey(node.key)
+		removed++
+	}
+	return removed
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRemoveOlderThanWalksOnlyTheColdTail(t *testing.T) {
+	clock := newFakeClock()
+	p := &countingCandidates{Policy: LRU()}
+	c := newTestCache(t, 1001, WithPolicy(p), WithClock(clock))
+	for k := range 1000 {
+		c.Put(k, k)
+	}
+	clock.Advance(2 * time.Hour)
+	for k := 10; k < 1000; k++ {
+		c.Get(k)
+	}
+	c.PutWithTTL(5000, 0, time.Minute)
+	clock.Advance(30 * time.Minute)
+	events, cancel := c.Events(16)
+	defer cancel()
+
+	if got := c.RemoveOlderThan(time.Hour); got != 10 {
+		t.Errorf("RemoveOlderThan removed %d, want the 10 unread keys", got)
+	}
+	// The ten idle keys and the first recent one.
+	if p.visited != 11 {
+		t.Errorf("walk visited %d entries, want 11", p.visited)
+	}
+	if c.Size() != 991 || c.Contains(9) || !c.Contains(10) {
+		t.Errorf("size %d after the purge", c.Size())
+	}
+	var removed []int
+	for range 10 {
+		e := <-events
+		if e.Op != EventRemove {
+			t.Fatalf("event %+v, want a removal", e)
+		}
+		removed = append(removed, e.Key)
+	}
+	if !slices.Equal(removed, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Errorf("removed %v, coldest first", removed)
+	}
+
+	// The expired entry is dropped, not counted, and the walk goes on past it.
+	clock.Advance(2 * time.Hour)
+	c.Get(999)
+	if got := c.RemoveOlderThan(time.Hour); got != 989 || c.Size() != 1 {
+		t.Errorf("second purge removed %d, leaving %d", got, c.Size())
+	}
+}
+
+func TestRemoveOlderThanWithoutCandidates(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 8, WithPolicy(LRUK(2)), WithClock(clock))
+	for k := range 4 {
+		c.Put(k, k)
+	}
+	clock.Advance(time.Hour)
+	c.Get(2)
+	if got := c.RemoveOlderThan(time.Minute); got != 3 || !slices.Equal(c.Keys(), []int{2}) {
+		t.Errorf("removed %d, leaving %v", got, c.Keys())
+	}
+}
+
+func TestRemoveOlderThanKeepsOverwrites(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 8, WithClock(clock))
+	c.Put(1, 1)
+	c.Put(2, 2)
+	clock.Advance(2 * time.Hour)
+	c.Put(2, 22)
+	if got := c.RemoveOlderThan(time.Hour); got != 1 || !slices.Equal(c.Keys(), []int{2}) {
+		t.Errorf("removed %d, leaving %v; want key 2 kept by its overwrite", got, c.Keys())
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// Invalidation tells the caches on a bus that Key changed at Origin, or
+// with All that Origin was cleared.
+type Invalidation struct {
+	Origin string
+	Key    int
+	All    bool
+}
+
+const invalidationVersion = 1
+
+// MarshalBinary encodes inv for a transport that carries bytes, such as a
+// NATS subject or a Redis channel.
+func (inv Invalidation) MarshalBinary() ([]byte, error) {
+	b := []byte{invalidationVersion, 0}
+	if inv.All {
+		b[1] = 1
+	}
+	b = binary.AppendVarint(b, int64(inv.Key))
+	return append(b, inv.Origin...), nil
+}
+
+func (inv *Invalidation) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 || data[0] != invalidationVersion || data[1] > 1 {
+		return fmt.Errorf("malformed invalidation")
+	}
+	key, n := binary.Varint(data[2:])
+	if n <= 0 {
+		return fmt.Errorf("malformed invalidation")
+	}
+	*inv = Invalidation{Origin: string(data[2+n:]), Key: int(key), All: data[1] == 1}
+	return nil
+}
+
+// InvalidationBus carries invalidations between caches, typically one per
+// process, so a write in one drops the stale copies in the others.
+// Subscribers see every invalidation published, their own included; the
+// cache skips its own by Origin. An implementation backed by a message
+// broker publishes MarshalBinary's bytes and decodes them for subscribers.
+type InvalidationBus interface {
+	Publish(inv Invalidation) error
+	// Subscribe calls fn for each invalidation published until unsubscribe
+	// is called. fn may be called on any goroutine but not after
+	// unsubscribe returns.
+	Subscribe(fn func(inv Invalidation)) (unsubscribe func(), err error)
+}
+
+type invalidationLink struct {
+	bus         InvalidationBus
+	origin      string
+	unsubscribe func()
+	// pending holds the invalidations of the current write-lock holder,
+	// published once it is released.
+	pending []Invalidation
+	// applying is set while an invalidation from the bus is applied, so
+	// it is not published again.
+	applying bool
+}
+
+// WithInvalidationBus connects the cache to bus: Put and its variants,
+// Remove and Clear publish what they change, and invalidations from other
+// caches remove the key, or clear the cache, without being published again.
+// Evictions and expirations are local and not published. Invalidations are
+// published after the lock is released; a failure to publish is logged, if
+// there is a logger, and otherwise ignored, since the write itself
+// succeeded.
+//
+// An invalidation races with a peer that is loading the key: the peer may
+// fill in a value read before the write. Pair the bus with a TTL where that
+// matters.
+func WithInvalidationBus(bus InvalidationBus) Option {
+	return func(c *SecureLRUCache) error {
+		if bus == nil {
+			return fmt.Errorf("invalidation bus must not be nil")
+		}
+		c.bus = &invalidationLink{bus: bus, origin: rand.Text()}
+		return nil
+	}
+}
+
+func (c *SecureLRUCache) subscribeInvalidations() error {
+	unsubscribe, err := c.bus.bus.Subscribe(c.applyInvalidation)
+	if err != nil {
+		return fmt.Errorf("subscribing to invalidations: %w", err)
+	}
+	c.bus.unsubscribe = unsubscribe
+	return nil
+}
+
+// invalidate queues inv for publishing. The caller holds the write lock.
+func (c *SecureLRUCache) invalidate(inv Invalidation) {
+	if c.bus == nil || c.bus.applying {
+		return
+	}
+	inv.Origin = c.bus.origin
+	c.bus.pending = append(c.bus.pending, inv)
+}
+
+func (c *SecureLRUCache) publishInvalidations(invs []Invalidation) {
+	for _, inv := range invs {
+		if err := c.bus.bus.Publish(inv); err != nil && c.logEnabled(slog.LevelWarn) {
+			c.logger.LogAttrs(context.Background(), slog.LevelWarn, "invalidation not published",
+				slog.Int("key", inv.Key), slog.Bool("all", inv.All), slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (c *SecureLRUCache) applyInvalidation(inv Invalidation) {
+	if inv.Origin == c.bus.origin {
+		return
+	}
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.bus.applying = true
+	defer func() { c.bus.applying = false }()
+	if inv.All {
+		c.reset()
+	} else {
+		c.removeKey(inv.Key)
+	}
+}
+
+// MemoryBus is an InvalidationBus within one process, delivering each
+// invalidation to every subscriber before Publish returns.
+type MemoryBus struct {
+	mu   sync.RWMutex
+	subs map[*memorySub]struct{}
+}
+
+type memorySub struct {
+	fn func(inv Invalidation)
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subs: make(map[*memorySub]struct{})}
+}
+
+func (b *MemoryBus) Publish(inv Invalidation) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		sub.fn(inv)
+	}
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(fn func(inv Invalidation)) (func(), error) {
+	if fn == nil {
+		return nil, fmt.Errorf("subscriber must not be nil")
+	}
+	sub := &memorySub{fn: fn}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			// Taking the write lock waits out any Publish still calling fn.
+			b.mu.Lock()
+			delete(b.subs, sub)
+			b.mu.Unlock()
+		})
+	}, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// countingBus wraps a MemoryBus, recording what is published.
+type countingBus struct {
+	*MemoryBus
+	mu        sync.Mutex
+	published []Invalidation
+	err       error
+}
+
+func (b *countingBus) Publish(inv Invalidation) error {
+	b.mu.Lock()
+	b.published = append(b.published, inv)
+	err := b.err
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return b.MemoryBus.Publish(inv)
+}
+
+func (b *countingBus) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.published)
+}
+
+func TestInvalidationBusRemovesStaleEntries(t *testing.T) {
+	bus := &countingBus{MemoryBus: NewMemoryBus()}
+	a := newTestCache(t, 8, WithInvalidationBus(bus))
+	b := newTestCache(t, 8, WithInvalidationBus(bus))
+
+	b.Put(1, 10)
+	b.Put(2, 20)
+	b.Put(3, 30)
+	if got := bus.count(); got != 3 {
+		t.Fatalf("%d invalidations published for 3 Puts", got)
+	}
+
+	a.Put(1, 11)
+	if b.Contains(1) {
+		t.Error("B kept key 1 after A wrote it")
+	}
+	if v, ok := a.Get(1); !ok || v != 11 {
+		t.Errorf("A lost its own write: %d, %v", v, ok)
+	}
+	if got := bus.count(); got != 4 {
+		t.Errorf("%d invalidations published, want 4: B's removal was published again", got)
+	}
+
+	a.Remove(2)
+	if b.Contains(2) {
+		t.Error("B kept key 2 after A removed it")
+	}
+	if ok, _ := a.PutIfAbsent(4, 40); !ok {
+		t.Fatal("PutIfAbsent failed")
+	}
+	if ok, _ := a.Replace(5, 50); ok {
+		t.Fatal("Replace wrote a missing key")
+	}
+	if got := bus.count(); got != 6 {
+		t.Errorf("%d invalidations published, want 6: a write that did not happen was published", got)
+	}
+
+	a.Clear()
+	if b.Size() != 0 {
+		t.Errorf("B holds %d entries after A was cleared", b.Size())
+	}
+	last := bus.published[len(bus.published)-1]
+	if !last.All || last.Origin == "" {
+		t.Errorf("Clear published %+v", last)
+	}
+}
+
+func TestInvalidationBusIgnoresEvictionsAndReads(t *testing.T) {
+	bus := &countingBus{MemoryBus: NewMemoryBus()}
+	a := newTestCache(t, 2, WithInvalidationBus(bus))
+	b := newTestCache(t, 8, WithInvalidationBus(bus))
+	b.Put(1, 1)
+	a.Put(2, 2)
+	a.Put(3, 3)
+	before := bus.count()
+	a.Put(1, 1)
+	a.Get(1)
+	if got := bus.count() - before; got != 1 {
+		t.Errorf("a Put that evicted published %d invalidations, want 1", got)
+	}
+}
+
+func TestInvalidationBusStopsAtClose(t *testing.T) {
+	bus := NewMemoryBus()
+	a := newTestCache(t, 8, WithInvalidationBus(bus))
+	b := newTestCache(t, 8, WithInvalidationBus(bus))
+	b.Put(1, 1)
+	b.Close()
+	a.Put(1, 2)
+	if v, ok := b.Get(1); !ok || v != 1 {
+		t.Errorf("a closed cache still took invalidations: %d, %v", v, ok)
+	}
+	if len(bus.subs) != 1 {
+		t.Errorf("%d subscribers after one cache closed, want 1", len(bus.subs))
+	}
+}
+
+func TestInvalidationPublishFailureIsLogged(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	bus := &countingBus{MemoryBus: NewMemoryBus(), err: errors.New("broker down")}
+	c := newTestCache(t, 8, WithInvalidationBus(bus), WithLogger(logger, slog.LevelInfo))
+	if err := c.Put(1, 1); err != nil {
+		t.Fatalf("Put failed with the bus down: %v", err)
+	}
+	if !strings.Contains(buf.String(), "invalidation not published") || !strings.Contains(buf.String(), "broker down") {
+		t.Errorf("log = %q", buf.String())
+	}
+}
+
+func TestInvalidationBusConcurrentWriters(t *testing.T) {
+	bus := NewMemoryBus()
+	caches := make([]*SecureLRUCache, 3)
+	for i := range caches {
+		caches[i] = newTestCache(t, 64, WithInvalidationBus(bus))
+	}
+	var wg sync.WaitGroup
+	for i, c := range caches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range 500 {
+				c.Put(k%32, i)
+				c.Get((k + 7) % 32)
+				if k%50 == 0 {
+					c.Remove(k % 32)
+				}
+			}
+		}()
+	}
+	// Caches publishing into each other must neither deadlock nor race;
+	// the cleanup checks each one's invariants.
+	wg.Wait()
+}
+
+func TestInvalidationMarshalBinary(t *testing.T) {
+	for _, inv := range []Invalidation{
+		{Origin: "abc", Key: -42},
+		{Origin: "", Key: 1 << 40},
+		{Origin: "xyz", All: true},
+	} {
+		data, err := inv.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Invalidation
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if got != inv {
+			t.Errorf("round trip %+v = %+v", inv, got)
+		}
+	}
+	for _, data := range [][]byte{nil, {1, 0}, {2, 0, 0}, {1, 2, 0}, {1, 0, 0x80}} {
+		var inv Invalidation
+		if err := inv.UnmarshalBinary(data); err == nil {
+			t.Errorf("UnmarshalBinary(%v) accepted", data)
+		}
+	}
+}
+
+// bytesBus ships invalidations as bytes, the way a broker-backed bus
+// would.
+type bytesBus struct {
+	mu   sync.Mutex
+	subs []func([]byte)
+}
+
+func (b *bytesBus) Publish(inv Invalidation) error {
+	data, err := inv.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	subs := slices.Clone(b.subs)
+	b.mu.Unlock()
+	for _, fn := range subs {
+		fn(data)
+	}
+	return nil
+}
+
+func (b *bytesBus) Subscribe(fn func(Invalidation)) (func(), error) {
+	b.mu.Lock()
+	b.subs = append(b.subs, func(data []byte) {
+		var inv Invalidation
+		if inv.UnmarshalBinary(data) == nil {
+			fn(inv)
+		}
+	})
+	b.mu.Unlock()
+	return func() {}, nil
+}
+
+func TestInvalidationOverByteTransport(t *testing.T) {
+	bus := &bytesBus{}
+	a := newTestCache(t, 8, WithInvalidationBus(bus))
+	b := newTestCache(t, 8, WithInvalidationBus(bus))
+	b.Put(7, 7)
+	a.Put(7, 8)
+	if b.Contains(7) {
+		t.Error("B kept key 7 after A wrote it over a byte transport")
+	}
+}
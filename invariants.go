@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+)
+
+// maxViolations is how many problems CheckInvariants reports before it stops
+// looking.
+const maxViolations = 8
+
+// structureChecker is implemented by policies that can verify their own
+// links. check reports problems through add, which returns false once
+// enough have been found.
+type structureChecker interface {
+	checkStructure(add func(error) bool)
+}
+
+// WithDebugChecks runs CheckInvariants after every operation that takes the
+// write lock and panics if it fails. It makes every write O(n) and is meant
+// for tests.
+func WithDebugChecks() Option {
+	return func(c *SecureLRUCache) error {
+		c.debugChecks = true
+		return nil
+	}
+}
+
+// CheckInvariants verifies under the read lock that the policy tracks
+// exactly the entries in the key map, that the policy's links are intact and
+// consistent, and that the cost, byte and group totals match the entries. It
+// returns the first few violations joined into one error, or nil.
+func (c *SecureLRUCache) CheckInvariants() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.checkInvariants()
+}
+
+func (c *SecureLRUCache) checkInvariants() error {
+	var errs []error
+	add := func(err error) bool {
+		errs = append(errs, err)
+		return len(errs) < maxViolations
+	}
+	c.check(add)
+	return errors.Join(errs...)
+}
+
+func (c *SecureLRUCache) check(add func(error) bool) {
+	seen := make(map[*Node]bool, len(c.cache))
+	visited := 0
+	ok := true
+	c.policy.Each(func(node *Node) bool {
+		visited++
+		if visited > len(c.cache) {
+			ok = add(fmt.Errorf("policy tracks more nodes than the %d in the map", len(c.cache)))
+			return false
+		}
+		if seen[node] {
+			ok = add(fmt.Errorf("policy visits key %d twice", node.key))
+			return false
+		}
+		seen[node] = true
+		if c.cache[node.key] != node {
+			ok = add(fmt.Errorf("policy tracks key %d, which the map does not hold", node.key))
+		}
+		return ok
+	})
+	if !ok {
+		return
+	}
+
+	var totalCost, totalBytes int64
+	groups := make(map[string]int)
+	for key, node := range c.cache {
+		if node.key != key {
+			if !add(fmt.Errorf("map key %d holds the node for key %d", key, node.key)) {
+				return
+			}
+		}
+		if !seen[node] {
+			if !add(fmt.Errorf("map holds key %d, which the policy does not track", key)) {
+				return
+			}
+		}
+		totalCost += node.cost
+		totalBytes += estimateSize(node.key, node.value)
+		if c.groups != nil {
+			groups[c.groups.of(key)]++
+		}
+	}
+	if c.groups != nil && !maps.Equal(groups, c.groups.sizes) && !add(fmt.Errorf("group sizes are %v, entries make %v", c.groups.sizes, groups)) {
+		return
+	}
+	if totalCost != c.totalCost && !add(fmt.Errorf("total cost is %d, entries cost %d", c.totalCost, totalCost)) {
+		return
+	}
+	if totalBytes != c.totalBytes && !add(fmt.Errorf("memory total is %d, entries take %d", c.totalBytes, totalBytes)) {
+		return
+	}
+	if size := c.size.Load(); size != int64(len(c.cache)) && !add(fmt.Errorf("size is %d, the map holds %d", size, len(c.cache))) {
+		return
+	}
+	if capacity := c.capacityNow.Load(); capacity != int64(c.capacity) && !add(fmt.Errorf("capacity reads as %d, is %d", capacity, c.capacity)) {
+		return
+	}
+	if len(c.cache) > c.capacity && !add(fmt.Errorf("%d entries exceed the capacity of %d", len(c.cache), c.capacity)) {
+		return
+	}
+
+	if p, ok := c.policy.(structureChecker); ok {
+		p.checkStructure(add)
+	}
+}
+
+// check verifies the sentinels and that every prev link mirrors a next link,
+// and returns the number of nodes between the sentinels.
+func (l *nodeList) check(name string, add func(error) bool) (int, bool) {
+	if l.head.prev != nil || l.tail.next != nil {
+		return 0, add(fmt.Errorf("%s: sentinels are linked outward", name))
+	}
+	n := 0
+	for node := l.head; node != l.tail; node = node.next {
+		if node.next == nil {
+			return n, add(fmt.Errorf("%s: list ends before the tail sentinel", name))
+		}
+		if node.next.prev != node {
+			return n, add(fmt.Errorf("%s: key %d's next does not link back to it", name, node.key))
+		}
+		if node != l.head {
+			n++
+		}
+	}
+	return n, true
+}
+
+func (p *lruPolicy) checkStructure(add func(error) bool)  { p.list.check("lru", add) }
+func (p *fifoPolicy) checkStructure(add func(error) bool) { p.list.check("fifo", add) }
+func (p *mruPolicy) checkStructure(add func(error) bool)  { p.list.check("mru", add) }
+
+func (p *slruPolicy) checkStructure(add func(error) bool) {
+	if _, ok := p.probation.check("slru probation", add); !ok {
+		return
+	}
+	n, ok := p.protected.check("slru protected", add)
+	if ok && n != p.protectedLen {
+		add(fmt.Errorf("slru: protected holds %d nodes but counts %d", n, p.protectedLen))
+	}
+}
+
+func (p *arcPolicy) checkStructure(add func(error) bool) {
+	t1, ok := p.t1.check("arc t1", add)
+	if !ok {
+		return
+	}
+	t2, ok := p.t2.check("arc t2", add)
+	if !ok {
+		return
+	}
+	if t1 != p.t1Len || t2 != p.t2Len {
+		if !add(fmt.Errorf("arc: t1 and t2 hold %d and %d nodes but count %d and %d", t1, t2, p.t1Len, p.t2Len)) {
+			return
+		}
+	}
+	if len(p.ghosts) != p.b1.Len()+p.b2.Len() {
+		add(fmt.Errorf("arc: %d ghost keys indexed but %d listed", len(p.ghosts), p.b1.Len()+p.b2.Len()))
+	}
+}
+
+func (p *lfuPolicy) checkStructure(add func(error) bool) {
+	prevFreq := 0
+	for b := p.head.next; b != p.tail; b = b.next {
+		if b.next == nil || b.next.prev != b {
+			add(fmt.Errorf("lfu: bucket %d is not linked back", b.freq))
+			return
+		}
+		if b.freq <= prevFreq {
+			if !add(fmt.Errorf("lfu: bucket %d follows bucket %d", b.freq, prevFreq)) {
+				return
+			}
+		}
+		prevFreq = b.freq
+		n, ok := b.list.check(fmt.Sprintf("lfu bucket %d", b.freq), add)
+		if !ok {
+			return
+		}
+		if n == 0 && !add(fmt.Errorf("lfu: bucket %d is empty", b.freq)) {
+			return
+		}
+		for node := b.list.front(); node != nil && node != b.list.tail; node = node.next {
+			if node.bucket != b || node.freq != b.freq {
+				if !add(fmt.Errorf("lfu: key %d sits in bucket %d but records frequency %d", node.key, b.freq, node.freq)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *clockPolicy) checkStructure(add func(error) bool) {
+	n, ok := p.ring.check("clock", add)
+	if !ok {
+		return
+	}
+	if (n == 0) != (p.hand == nil) {
+		add(fmt.Errorf("clock: hand is %v with %d nodes on the ring", p.hand != nil, n))
+	}
+}
+
+func (p *sampledPolicy) checkStructure(add func(error) bool) {
+	for i, node := range p.nodes {
+		if node.index != i && !add(fmt.Errorf("sampled: key %d at %d records index %d", node.key, i, node.index)) {
+			return
+		}
+	}
+}
+
+func (p *lrukPolicy) checkStructure(add func(error) bool) {
+	for i, node := range p.nodes.nodes {
+		if node.index != i && !add(fmt.Errorf("lru-k: key %d at %d records index %d", node.key, i, node.index)) {
+			return
+		}
+		if parent := (i - 1) / 2; i > 0 && p.nodes.less(node, p.nodes.nodes[parent]) {
+			if !add(fmt.Errorf("lru-k: key %d ranks below its heap parent", node.key)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// testStorageEnv names the variable that picks the node storage of
+// newTestCache: unset for pooled nodes, "dense" for WithDenseStorage.
+const testStorageEnv = "LRU_TEST_STORAGE"
+
+// TestMain runs the suite with pooled nodes and then, if that passed, again
+// in a child process with dense storage.
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if code != 0 || os.Getenv(testStorageEnv) != "" {
+		os.Exit(code)
+	}
+	if testing.Verbose() {
+		fmt.Printf("=== %s=dense\n", testStorageEnv)
+	}
+	cmd := exec.Command(os.Args[0], os.Args[1:]...)
+	cmd.Env = append(os.Environ(), testStorageEnv+"=dense")
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "with %s=dense: %v\n", testStorageEnv, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// newTestCache builds a cache with WithDebugChecks, so that every write the
+// test makes also verifies the cache's structure, and checks it once more
+// and closes it when the test ends. Under LRU_TEST_STORAGE=dense it adds
+// WithDenseStorage.
+func newTestCache(t testing.TB, capacity int, opts ...Option) *SecureLRUCache {
+	t.Helper()
+	opts = append(opts[:len(opts):len(opts)], WithDebugChecks())
+	if os.Getenv(testStorageEnv) == "dense" {
+		opts = append(opts, WithDenseStorage())
+	}
+	c, err := NewSecureLRUCache(capacity, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := c.CheckInvariants(); err != nil {
+			t.Error(err)
+		}
+		c.Close()
+	})
+	return c
+}
+
+func TestCheckInvariantsReportsCorruption(t *testing.T) {
+	corruptions := map[string]func(c *SecureLRUCache){
+		"size":     func(c *SecureLRUCache) { c.size.Add(1) },
+		"capacity": func(c *SecureLRUCache) { c.capacityNow.Add(1) },
+		"cost":     func(c *SecureLRUCache) { c.totalCost++ },
+		"untracked node": func(c *SecureLRUCache) {
+			c.cache[99] = &Node{key: 99}
+		},
+		"unmapped node": func(c *SecureLRUCache) { delete(c.cache, 2) },
+		"broken link": func(c *SecureLRUCache) {
+			c.cache[2].prev = c.cache[2]
+		},
+		"wrong key": func(c *SecureLRUCache) {
+			c.cache[1], c.cache[3] = c.cache[3], c.cache[1]
+		},
+	}
+	for name, corrupt := range corruptions {
+		t.Run(name, func(t *testing.T) {
+			c, err := NewSecureLRUCache(4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k := 1; k <= 3; k++ {
+				c.Put(k, k)
+			}
+			if err := c.CheckInvariants(); err != nil {
+				t.Fatalf("healthy cache: %v", err)
+			}
+			corrupt(c)
+			if err := c.CheckInvariants(); err == nil {
+				t.Fatal("corruption went unreported")
+			}
+		})
+	}
+}
+
+func TestCheckInvariantsHoldsForEveryPolicy(t *testing.T) {
+	policies := map[string]func() Policy{
+		"lru":     LRU,
+		"fifo":    FIFO,
+		"mru":     MRU,
+		"lfu":     LFU,
+		"slru":    SLRU,
+		"arc":     ARC,
+		"clock":   CLOCK,
+		"sieve":   Sieve,
+		"lruk":    func() Policy { return LRUK(2) },
+		"sampled": func() Policy { return SampledLRU(4) },
+	}
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			c := newTestCache(t, 8, WithPolicy(policy()))
+			for i := range 200 {
+				k := (i * 7) % 23
+				switch i % 5 {
+				case 0:
+					c.Remove(k)
+				case 1, 2:
+					c.Get(k)
+				default:
+					c.Put(k, i)
+				}
+				if i%50 == 49 {
+					c.Resize(4 + i%8)
+				}
+			}
+		})
+	}
+}
+
+func TestDebugChecksPanicOnCorruption(t *testing.T) {
+	c, err := NewSecureLRUCache(4, WithDebugChecks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(1, 1)
+	c.size.Add(1)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("a write to a corrupted cache did not panic")
+		}
+	}()
+	c.Put(2, 2)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// ErrNotFound is returned by a loader to report that key has no value in the
+// backing store. With negative caching enabled the miss itself is cached.
+var ErrNotFound = errors.New("key not found")
+
+// WithNegativeCaching makes GetOrLoad remember ErrNotFound results from the
+// loader as tombstones for ttl. Tombstones occupy capacity like any other
+// entry, read as misses everywhere, and are replaced by the next Put.
+func WithNegativeCaching(ttl time.Duration) Option {
+	return func(c *SecureLRUCache) error {
+		if ttl <= 0 {
+			return fmt.Errorf("negative caching ttl must be positive")
+		}
+		c.negativeTTL = ttl
+		return nil
+	}
+}
+
+// WithErrorCaching makes GetOrLoad remember a loader error for key and return
+// it without calling the loader again until the error expires. The first
+// failure is kept for ttl; each further consecutive failure doubles that, and
+// the period stops growing after maxConsecutive failures in a row. A
+// successful load or Remove(key) forgets the error. No more errors are kept
+// than the cache's capacity; past it the one expiring soonest is forgotten.
+func WithErrorCaching(ttl time.Duration, maxConsecutive int) Option {
+	return func(c *SecureLRUCache) error {
+		if ttl <= 0 {
+			return fmt.Errorf("error caching ttl must be positive")
+		}
+		if maxConsecutive < 1 {
+			return fmt.Errorf("maxConsecutive must be at least 1")
+		}
+		c.errorTTL = ttl
+		c.errorMaxRuns = maxConsecutive
+		return nil
+	}
+}
+
+// WithRefreshAhead lets GetOrLoad keep serving an entry for up to staleFor
+// after its TTL lapses. The stale value is returned immediately while a single
+// background load refreshes it; Get and Peek still treat it as expired.
+func WithRefreshAhead(staleFor time.Duration) Option {
+	return func(c *SecureLRUCache) error {
+		if staleFor <= 0 {
+			return fmt.Errorf("refresh-ahead window must be positive")
+		}
+		c.staleFor = staleFor
+		return nil
+	}
+}
+
+type cachedError struct {
+	err         error
+	consecutive int
+	until       time.Time
+}
+
+type loadCall struct {
+	done  chan struct{}
+	value int
+	err   error
+}
+
+func (c *SecureLRUCache) GetOrLoad(key int, loader func(key int) (int, error)) (int, error) {
+	return c.GetOrLoadContext(context.Background(), key, func(_ context.Context, key int) (int, error) {
+		return loader(key)
+	})
+}
+
+// GetOrLoadContext returns the cached value for key, calling loader on a miss.
+// Concurrent callers for the same key share a single in-flight load. A caller
+// whose ctx is done stops waiting and gets ctx.Err(), but the shared load is
+// never canceled by its callers: it runs with a context that keeps ctx's values
+// without its deadline or cancellation, and a successful result is cached even
+// if every caller has already given up.
+func (c *SecureLRUCache) GetOrLoadContext(ctx context.Context, key int, loader func(ctx context.Context, key int) (int, error)) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	c.touch(key)
+
+	c.mu.Lock()
+	if node, exists := c.lookup(key); exists {
+		if node.tombstone {
+			c.unlock()
+			c.stats.misses.Add(1)
+			c.traceOp(TraceGet, key, false)
+			return 0, ErrNotFound
+		}
+		c.access(node)
+		value := node.value
+		c.unlock()
+		c.stats.hits.Add(1)
+		c.traceOp(TraceGet, key, true)
+		return value, nil
+	}
+	// lookup leaves only stale nodes behind.
+	if node, exists := c.cache[key]; exists {
+		c.access(node)
+		value := node.value
+		if _, inFlight := c.loads[key]; !inFlight {
+			call := &loadCall{done: make(chan struct{})}
+			c.loads[key] = call
+			go c.load(context.WithoutCancel(ctx), key, call, loader, true)
+		}
+		c.unlock()
+		c.stats.staleHits.Add(1)
+		c.traceOp(TraceGet, key, true)
+		return value, nil
+	}
+	c.stats.misses.Add(1)
+	c.traceOp(TraceGet, key, false)
+
+	if cached, exists := c.errs[key]; exists && c.clock.Now().Before(cached.until) {
+		c.unlock()
+		c.stats.errorHits.Add(1)
+		return 0, cached.err
+	}
+
+	call, inFlight := c.loads[key]
+	if !inFlight {
+		call = &loadCall{done: make(chan struct{})}
+		c.loads[key] = call
+		go c.load(context.WithoutCancel(ctx), key, call, loader, false)
+	}
+	c.unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// load runs loader for key and installs the result.
+func (c *SecureLRUCache) load(ctx context.Context, key int, call *loadCall, loader func(ctx context.Context, key int) (int, error), refresh bool) {
+	value, err := loader(ctx, key)
+
+	c.mu.Lock()
+	value, err = c.install(key, call, value, err, refresh)
+	c.unlock()
+	call.finish(value, err)
+}
+
+// install caches what a loader returned for key and retires call, returning
+// what call's waiters get. A refresh replaces a stale entry in place; if it
+// fails the stale value is kept and the error is not cached, so the next
+// access retries. The caller holds the write lock.
+func (c *SecureLRUCache) install(key int, call *loadCall, value int, err error, refresh bool) (int, error) {
+	if err == nil {
+		delete(c.errs, key)
+		// A Put that landed while the loader was running is fresher than
+		// what we loaded, so it wins.
+		if node, exists := c.lookup(key); exists && !node.tombstone {
+			value = node.value
+		} else if _, lru, setErr := c.set(key, value, 1, c.deadline(c.defaultTTL)); errors.Is(setErr, errAdmissionRejected) {
+			// Not cached, but the caller still gets what was loaded.
+		} else if setErr != nil {
+			err = setErr
+		} else {
+			if lru != nil {
+				c.releaseNode(lru)
+			}
+			c.wake(key, value)
+			c.record(Event{Op: EventPut, Key: key, Value: value})
+			c.added(key, value)
+			c.traceOp(TracePut, key, false)
+		}
+	} else if errors.Is(err, ErrNotFound) && c.negativeTTL > 0 {
+		if node, exists := c.lookup(key); exists && !node.tombstone {
+			value, err = node.value, nil
+		} else if !exists {
+			if node, lru, setErr := c.set(key, 0, 1, c.deadline(c.negativeTTL)); setErr == nil {
+				node.tombstone = true
+				if lru != nil {
+					c.releaseNode(lru)
+				}
+			}
+		}
+	} else if c.errorTTL > 0 && !refresh {
+		c.cacheError(key, err)
+	}
+	if c.loads[key] == call {
+		delete(c.loads, key)
+	}
+	if err != nil {
+		value = 0
+	}
+	return value, err
+}
+
+func (call *loadCall) finish(value int, err error) {
+	call.value, call.err = value, err
+	close(call.done)
+}
+
+func (c *SecureLRUCache) cacheError(key int, err error) {
+	now := c.clock.Now()
+	cached, exists := c.errs[key]
+	if !exists {
+		if len(c.errs) >= c.capacity {
+			c.dropCachedErrors(now)
+		}
+		cached = &cachedError{}
+		c.errs[key] = cached
+	}
+
+	cached.err = err
+	cached.consecutive++
+	// Stop doubling before the period overflows a Duration, which can be on
+	// the first failure for a ttl close to its maximum.
+	doublings := max(min(cached.consecutive, c.errorMaxRuns)-1, 0)
+	period := time.Duration(math.MaxInt64)
+	if doublings < bits.LeadingZeros64(uint64(c.errorTTL)) {
+		period = c.errorTTL << doublings
+	}
+	cached.until = now.Add(period)
+}
+
+// dropCachedErrors makes room for one more cached error, so there are never
+// more of them than the cache holds entries. Expired errors go first, then the
+// one that would expire soonest.
+func (c *SecureLRUCache) dropCachedErrors(now time.Time) {
+	soonest := 0
+	var at time.Time
+	for k, e := range c.errs {
+		if !now.Before(e.until) {
+			delete(c.errs, k)
+		} else if at.IsZero() || e.until.Before(at) {
+			soonest, at = k, e.until
+		}
+	}
+	if len(c.errs) >= c.capacity {
+		delete(c.errs, soonest)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestErrorCachingBackoffDoesNotOverflow(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 4, WithErrorCaching(time.Second, 100), WithClock(clock))
+	down := errors.New("backend down")
+	loader := func(int) (int, error) { return 0, down }
+
+	for i := range 70 {
+		if _, err := c.GetOrLoad(1, loader); !errors.Is(err, down) {
+			t.Fatalf("GetOrLoad error %v", err)
+		}
+		c.mu.RLock()
+		until := c.errs[1].until
+		c.mu.RUnlock()
+		if !until.After(clock.Now()) {
+			t.Fatalf("failure %d is cached until %v, which has passed", i+1, until)
+		}
+		clock.Advance(until.Sub(clock.Now()))
+	}
+}
+
+func TestErrorCachingHugeTTL(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 4, WithErrorCaching(1<<62, 3), WithClock(clock))
+	loader := func(int) (int, error) { return 0, errors.New("down") }
+	for i := range 3 {
+		c.GetOrLoad(1, loader)
+		c.mu.RLock()
+		until := c.errs[1].until
+		c.mu.RUnlock()
+		if !until.After(clock.Now().Add(1<<62 - 1)) {
+			t.Fatalf("failure %d is cached until %v", i+1, until)
+		}
+		clock.Advance(until.Sub(clock.Now()))
+	}
+}
+
+func TestErrorCachingIsBoundedByCapacity(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 4, WithErrorCaching(time.Minute, 1), WithClock(clock))
+	loader := func(int) (int, error) { return 0, errors.New("down") }
+	for k := range 100 {
+		c.GetOrLoad(k, loader)
+		clock.Advance(time.Second)
+	}
+	c.mu.RLock()
+	n := len(c.errs)
+	_, newest := c.errs[99]
+	c.mu.RUnlock()
+	if n > 4 || !newest {
+		t.Errorf("%d cached errors, holding the newest: %v; want at most 4 and it", n, newest)
+	}
+}
+
+func TestErrorCachingBackoffSchedule(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 4, WithErrorCaching(time.Second, 3), WithClock(clock))
+	calls := 0
+	loader := func(int) (int, error) {
+		calls++
+		return 0, errors.New("down")
+	}
+	// Periods of 1s, 2s, then capped at 4s.
+	for _, period := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		c.GetOrLoad(1, loader)
+		n := calls
+		clock.Advance(period - time.Nanosecond)
+		c.GetOrLoad(1, loader)
+		if calls != n {
+			t.Fatalf("loader retried before %v had passed", period)
+		}
+		clock.Advance(time.Nanosecond)
+	}
+}
+
+func TestGetOrLoadContextCanceledCaller(t *testing.T) {
+	c := newTestCache(t, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.GetOrLoadContext(ctx, 1, func(context.Context, int) (int, error) {
+		t.Error("loader called for a canceled caller")
+		return 1, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+type ctxKey struct{}
+
+func TestGetOrLoadContextDeadlinePassesMidLoad(t *testing.T) {
+	c := newTestCache(t, 4)
+	release := make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "v"), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.GetOrLoadContext(ctx, 1, func(ctx context.Context, key int) (int, error) {
+		<-release
+		if _, ok := ctx.Deadline(); ok || ctx.Err() != nil || ctx.Value(ctxKey{}) != "v" {
+			t.Errorf("the load ran with deadline, error %v and value %v", ctx.Err(), ctx.Value(ctxKey{}))
+		}
+		return 10, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	close(release)
+	// This joins the load, which caches its result for nobody.
+	v, err := c.GetOrLoad(1, func(int) (int, error) { return 0, errors.New("loaded twice") })
+	if err != nil || v != 10 {
+		t.Errorf("after the deadline: %d, %v; want 10 from the abandoned load", v, err)
+	}
+}
+
+func TestGetOrLoadContextSharedLoadOutlivesAWaiter(t *testing.T) {
+	c := newTestCache(t, 4)
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int64
+	loader := func(ctx context.Context, key int) (int, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return 20, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := c.GetOrLoadContext(ctx, 2, loader)
+		canceled <- err
+	}()
+	<-started
+	staying := make(chan int, 1)
+	go func() {
+		v, err := c.GetOrLoadContext(context.Background(), 2, loader)
+		if err != nil {
+			t.Error(err)
+		}
+		staying <- v
+	}()
+	// The second caller counts its miss under the lock it joins the load
+	// under, and the load cannot finish while release is open.
+	for c.Stats().Misses < 2 {
+		runtime.Gosched()
+	}
+	cancel()
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled waiter got %v", err)
+	}
+	close(release)
+	if v := <-staying; v != 20 || calls.Load() != 1 {
+		t.Errorf("remaining waiter got %d after %d loads, want 20 from one", v, calls.Load())
+	}
+	if v, ok := c.Peek(2); !ok || v != 20 {
+		t.Errorf("Peek(2) = %d, %v", v, ok)
+	}
+}
+
+func TestRefreshAheadServesStaleWhileOneLoadRuns(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 4, WithRefreshAhead(time.Minute), WithClock(clock))
+	c.PutWithTTL(1, 1, time.Minute)
+	clock.Advance(90 * time.Second)
+
+	var calls atomic.Int64
+	release := make(chan struct{})
+	loader := func(int) (int, error) {
+		calls.Add(1)
+		<-release
+		return 2, nil
+	}
+	for range 5 {
+		if v, err := c.GetOrLoad(1, loader); err != nil || v != 1 {
+			t.Fatalf("stale hit = %d, %v; want the stale 1", v, err)
+		}
+	}
+	if _, ok := c.Get(1); ok {
+		t.Error("Get served the stale entry")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	close(release)
+	if v, err := c.GetWait(ctx, 1); err != nil || v != 2 {
+		t.Fatalf("refreshed value %d, %v; want 2", v, err)
+	}
+	if v, err := c.GetOrLoad(1, loader); err != nil || v != 2 || calls.Load() != 1 {
+		t.Errorf("after the refresh: %d, %v with %d loads, want 2 from one", v, err, calls.Load())
+	}
+	if s := c.Stats(); s.StaleHits != 5 {
+		t.Errorf("StaleHits = %d, want 5", s.StaleHits)
+	}
+
+	// Past the window the entry is gone and the load is waited for.
+	c.PutWithTTL(3, 3, time.Minute)
+	clock.Advance(3 * time.Minute)
+	if v, err := c.GetOrLoad(3, func(int) (int, error) { return 4, nil }); err != nil || v != 4 {
+		t.Errorf("outside the window: %d, %v; want the loaded 4", v, err)
+	}
+}
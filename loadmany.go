@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// BatchLoader loads the values of missing keys in one call. It may leave
+// out keys the backing store does not have, and anything it returns for
+// keys it was not asked about is ignored.
+type BatchLoader func(ctx context.Context, missing []int) (map[int]int, error)
+
+// GetOrLoadMany is GetOrLoadContext for many keys with one loader call. Hits
+// are served and promoted as by GetOrLoad, stale ones included; each key
+// already being loaded, by GetOrLoad or another GetOrLoadMany, is waited on;
+// and the rest are passed to loader together, once each, however often they
+// appear in keys. Keys loader leaves out are absent from the result, and
+// with WithNegativeCaching are remembered as misses.
+//
+// If loader fails, if a key has a cached error or if ctx ends first,
+// GetOrLoadMany returns the first such error with every value it has. As with
+// GetOrLoadContext, the load itself runs on after ctx ends and its results
+// are cached.
+func (c *SecureLRUCache) GetOrLoadMany(ctx context.Context, keys []int, loader BatchLoader) (map[int]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if loader == nil {
+		return nil, fmt.Errorf("loader must not be nil")
+	}
+	values := make(map[int]int, len(keys))
+	waits := make(map[int]*loadCall)
+	var missing []int
+	var calls []*loadCall
+	var firstErr error
+
+	c.mu.Lock()
+	for _, key := range keys {
+		if _, done := values[key]; done {
+			continue
+		}
+		if _, waiting := waits[key]; waiting {
+			continue
+		}
+		c.touch(key)
+		if node, exists := c.lookup(key); exists {
+			if node.tombstone {
+				c.stats.misses.Add(1)
+				c.traceOp(TraceGet, key, false)
+				continue
+			}
+			c.access(node)
+			values[key] = node.value
+			c.stats.hits.Add(1)
+			c.traceOp(TraceGet, key, true)
+			continue
+		}
+		// lookup leaves only stale nodes behind.
+		if node, exists := c.cache[key]; exists {
+			c.access(node)
+			values[key] = node.value
+			if _, inFlight := c.loads[key]; !inFlight {
+				call := &loadCall{done: make(chan struct{})}
+				c.loads[key] = call
+				go c.load(context.WithoutCancel(ctx), key, call, loader.one, true)
+			}
+			c.stats.staleHits.Add(1)
+			c.traceOp(TraceGet, key, true)
+			continue
+		}
+		c.stats.misses.Add(1)
+		c.traceOp(TraceGet, key, false)
+
+		if cached, exists := c.errs[key]; exists && c.clock.Now().Before(cached.until) {
+			c.stats.errorHits.Add(1)
+			if firstErr == nil {
+				firstErr = cached.err
+			}
+			continue
+		}
+		call, inFlight := c.loads[key]
+		if !inFlight {
+			call = &loadCall{done: make(chan struct{})}
+			c.loads[key] = call
+			missing = append(missing, key)
+			calls = append(calls, call)
+		}
+		waits[key] = call
+	}
+	if len(missing) > 0 {
+		go c.loadMany(context.WithoutCancel(ctx), missing, calls, loader)
+	}
+	c.unlock()
+
+	for key, call := range waits {
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return values, ctx.Err()
+		}
+		switch {
+		case call.err == nil:
+			values[key] = call.value
+		case errors.Is(call.err, ErrNotFound):
+		case firstErr == nil:
+			firstErr = call.err
+		}
+	}
+	return values, firstErr
+}
+
+// loadMany runs loader for missing, whose calls are in the same order, and
+// installs each result as load does.
+func (c *SecureLRUCache) loadMany(ctx context.Context, missing []int, calls []*loadCall, loader BatchLoader) {
+	loaded, err := loader(ctx, missing)
+
+	results := make([]int, len(missing))
+	errs := make([]error, len(missing))
+	c.mu.Lock()
+	for i, key := range missing {
+		value, keyErr := loaded[key], err
+		if _, ok := loaded[key]; !ok && err == nil {
+			keyErr = ErrNotFound
+		}
+		results[i], errs[i] = c.install(key, calls[i], value, keyErr, false)
+	}
+	c.unlock()
+	for i, call := range calls {
+		call.finish(results[i], errs[i])
+	}
+}
+
+// one loads a single key, as refreshing a stale entry needs.
+func (loader BatchLoader) one(ctx context.Context, key int) (int, error) {
+	loaded, err := loader(ctx, []int{key})
+	if err != nil {
+		return 0, err
+	}
+	value, ok := loaded[key]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return value, nil
+}
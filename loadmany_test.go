@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingBatchLoader loads every key k as 10*k, except those in absent, and
+// counts how often each key was asked for.
+type countingBatchLoader struct {
+	mu     sync.Mutex
+	asked  map[int]int
+	calls  int
+	absent map[int]bool
+	delay  time.Duration
+}
+
+func (l *countingBatchLoader) load(_ context.Context, missing []int) (map[int]int, error) {
+	time.Sleep(l.delay)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.asked == nil {
+		l.asked = make(map[int]int)
+	}
+	l.calls++
+	loaded := make(map[int]int)
+	for _, key := range missing {
+		l.asked[key]++
+		if !l.absent[key] {
+			loaded[key] = 10 * key
+		}
+	}
+	return loaded, nil
+}
+
+func TestGetOrLoadMany(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 16, WithClock(clock), WithDefaultTTL(time.Minute))
+	c.Put(1, 1)
+	c.Put(2, 2)
+	loader := &countingBatchLoader{absent: map[int]bool{5: true}}
+
+	got, err := c.GetOrLoadMany(context.Background(), []int{1, 2, 3, 3, 4, 5}, loader.load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int]int{1: 1, 2: 2, 3: 30, 4: 40}; !maps.Equal(got, want) {
+		t.Errorf("GetOrLoadMany = %v, want %v", got, want)
+	}
+	if want := map[int]int{3: 1, 4: 1, 5: 1}; loader.calls != 1 || !maps.Equal(loader.asked, want) {
+		t.Errorf("%d loader calls asked for %v, want one for %v", loader.calls, loader.asked, want)
+	}
+	if st := c.Stats(); st.Hits != 2 || st.Misses != 3 {
+		t.Errorf("hits %d, misses %d, want 2 and 3", st.Hits, st.Misses)
+	}
+
+	// Only the absent key is asked for again.
+	if _, err := c.GetOrLoadMany(context.Background(), []int{3, 4, 5}, loader.load); err != nil {
+		t.Fatal(err)
+	}
+	if loader.calls != 2 || loader.asked[5] != 2 || loader.asked[3] != 1 {
+		t.Errorf("second call asked for %v in %d calls", loader.asked, loader.calls)
+	}
+
+	// Loaded values take the default TTL.
+	clock.Advance(2 * time.Minute)
+	if _, ok := c.Get(3); ok {
+		t.Error("loaded key outlived the default TTL")
+	}
+}
+
+func TestGetOrLoadManyNegativeCaching(t *testing.T) {
+	c := newTestCache(t, 16, WithNegativeCaching(time.Minute))
+	loader := &countingBatchLoader{absent: map[int]bool{5: true}}
+	for range 2 {
+		got, err := c.GetOrLoadMany(context.Background(), []int{4, 5}, loader.load)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !maps.Equal(got, map[int]int{4: 40}) {
+			t.Errorf("GetOrLoadMany = %v", got)
+		}
+	}
+	if loader.asked[5] != 1 {
+		t.Errorf("absent key asked for %d times, want once", loader.asked[5])
+	}
+	if _, err := c.GetOrLoad(5, func(int) (int, error) { return 0, nil }); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetOrLoad of the remembered miss: %v", err)
+	}
+}
+
+func TestGetOrLoadManyWaitsForGetOrLoad(t *testing.T) {
+	c := newTestCache(t, 16)
+	started, release := make(chan struct{}), make(chan struct{})
+	single := make(chan error)
+	go func() {
+		_, err := c.GetOrLoad(7, func(int) (int, error) {
+			close(started)
+			<-release
+			return 77, nil
+		})
+		single <- err
+	}()
+	<-started
+
+	loader := &countingBatchLoader{}
+	type result struct {
+		values map[int]int
+		err    error
+	}
+	batch := make(chan result)
+	go func() {
+		values, err := c.GetOrLoadMany(context.Background(), []int{7, 8}, loader.load)
+		batch <- result{values, err}
+	}()
+	select {
+	case r := <-batch:
+		t.Fatalf("GetOrLoadMany returned %v before key 7 loaded", r)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-single; err != nil {
+		t.Fatal(err)
+	}
+	r := <-batch
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if want := map[int]int{7: 77, 8: 80}; !maps.Equal(r.values, want) {
+		t.Errorf("GetOrLoadMany = %v, want %v", r.values, want)
+	}
+	if !maps.Equal(loader.asked, map[int]int{8: 1}) {
+		t.Errorf("batch loader asked for %v, want only key 8", loader.asked)
+	}
+}
+
+func TestGetOrLoadManyLoadsEachKeyOnce(t *testing.T) {
+	c := newTestCache(t, 1000)
+	loader := &countingBatchLoader{delay: time.Millisecond}
+	var wg sync.WaitGroup
+	for g := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Overlapping windows of 40 keys.
+			keys := make([]int, 40)
+			for i := range keys {
+				keys[i] = (g*13 + i) % 200
+			}
+			for range 5 {
+				got, err := c.GetOrLoadMany(context.Background(), keys, loader.load)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				for _, key := range keys {
+					if got[key] != 10*key {
+						t.Errorf("key %d = %d", key, got[key])
+					}
+				}
+				// A key of another goroutine's window, which may be loading.
+				if _, err := c.GetOrLoad((g*13+45)%200, func(key int) (int, error) {
+					loader.load(context.Background(), []int{key})
+					return 10 * key, nil
+				}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for key, n := range loader.asked {
+		if n != 1 {
+			t.Errorf("key %d loaded %d times", key, n)
+		}
+	}
+	if len(loader.asked) != 200 || c.Size() != 200 {
+		t.Errorf("%d keys loaded and %d cached, want 200", len(loader.asked), c.Size())
+	}
+}
+
+func TestGetOrLoadManyErrors(t *testing.T) {
+	c := newTestCache(t, 16, WithErrorCaching(time.Minute, 1))
+	c.Put(1, 1)
+	down := errors.New("backend down")
+	calls := 0
+	failing := func(context.Context, []int) (map[int]int, error) {
+		calls++
+		return nil, down
+	}
+	for range 2 {
+		got, err := c.GetOrLoadMany(context.Background(), []int{1, 2}, failing)
+		if !errors.Is(err, down) {
+			t.Fatalf("error %v, want %v", err, down)
+		}
+		if !maps.Equal(got, map[int]int{1: 1}) {
+			t.Errorf("GetOrLoadMany = %v, want the hit", got)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("loader called %d times, want the cached error the second time", calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.GetOrLoadMany(ctx, []int{3}, failing); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled context: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// WithNoLock turns the cache's read-write lock into a no-op, for a cache
+// owned by a single goroutine. Concurrent use of such a cache is undefined:
+// the caller must make sure no two calls ever overlap. With WithDebugChecks
+// overlapping calls panic instead.
+//
+// Options that start background workers, refresh-ahead loads and an
+// invalidation bus touch the cache from other goroutines and are refused.
+// GetOrLoad still runs its loader on another goroutine; the caller waits for
+// it, except in GetOrLoadContext when ctx ends first, after which the cache
+// must not be used until the load is done.
+func WithNoLock() Option {
+	return func(c *SecureLRUCache) error {
+		c.mu.off = true
+		return nil
+	}
+}
+
+// cacheMutex is the cache's lock, which WithNoLock turns off.
+type cacheMutex struct {
+	sync.RWMutex
+	off bool
+	// With off and debug checks, state catches overlapping use: it is -1
+	// while a writer is inside and otherwise counts readers.
+	check bool
+	state atomic.Int32
+}
+
+func (m *cacheMutex) Lock() {
+	if !m.off {
+		m.RWMutex.Lock()
+		return
+	}
+	if m.check && !m.state.CompareAndSwap(0, -1) {
+		panic("concurrent use of a cache built WithNoLock")
+	}
+}
+
+func (m *cacheMutex) Unlock() {
+	if !m.off {
+		m.RWMutex.Unlock()
+		return
+	}
+	if m.check {
+		m.state.Store(0)
+	}
+}
+
+func (m *cacheMutex) RLock() {
+	if !m.off {
+		m.RWMutex.RLock()
+		return
+	}
+	if m.check && m.state.Add(1) <= 0 {
+		panic("concurrent use of a cache built WithNoLock")
+	}
+}
+
+func (m *cacheMutex) RUnlock() {
+	if !m.off {
+		m.RWMutex.RUnlock()
+		return
+	}
+	if m.check {
+		m.state.Add(-1)
+	}
+}
+
+// checkNoLock refuses the options that would use a WithNoLock cache from
+// goroutines of its own.
+func (c *SecureLRUCache) checkNoLock() error {
+	switch {
+	case c.writeBehind != nil:
+		return fmt.Errorf("WithNoLock cannot be used with write-behind")
+	case c.pressure != nil && c.pressure.interval > 0:
+		return fmt.Errorf("WithNoLock cannot be used with memory pressure polling")
+	case c.adaptive != nil:
+		return fmt.Errorf("WithNoLock cannot be used with adaptive capacity")
+	case c.decayInterval > 0:
+		return fmt.Errorf("WithNoLock cannot be used with access decay")
+	case c.persist != nil && c.persist.interval > 0:
+		return fmt.Errorf("WithNoLock cannot be used with periodic persistence")
+	case c.wal != nil:
+		return fmt.Errorf("WithNoLock cannot be used with a write-ahead log")
+	case c.promotions != nil:
+		return fmt.Errorf("WithNoLock cannot be used with async promotion")
+	case c.staleFor > 0:
+		return fmt.Errorf("WithNoLock cannot be used with refresh-ahead")
+	case c.refresh != nil:
+		return fmt.Errorf("WithNoLock cannot be used with background refresh")
+	case c.bus != nil:
+		return fmt.Errorf("WithNoLock cannot be used with an invalidation bus")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNoLockRejectsBackgroundWorkers(t *testing.T) {
+	refresh := WithBackgroundRefresh(time.Minute,
+		func(Entry) bool { return true },
+		func(context.Context, int) (int, error) { return 0, nil })
+	for name, opt := range map[string]Option{
+		"async promotion":    WithAsyncPromotion(4),
+		"background refresh": refresh,
+		"invalidation bus":   WithInvalidationBus(NewMemoryBus()),
+	} {
+		if _, err := NewSecureLRUCache(10, WithNoLock(), opt); err == nil {
+			t.Errorf("WithNoLock accepted %s", name)
+		}
+	}
+	if _, err := NewSecureLRUCache(10, WithNoLock()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNoLockDebugChecksCatchOverlap(t *testing.T) {
+	c, err := NewSecureLRUCache(4, WithNoLock(), WithDebugChecks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(1, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Holding the lock stands in for a call still running on another
+	// goroutine.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("overlapping Put did not panic")
+		}
+	}()
+	c.Put(2, 2)
+}
+
+func benchmarkSerial(b *testing.B, opts ...Option) {
+	c, err := NewSecureLRUCache(1000, opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Put(i%2000, i)
+		c.Get(i % 1500)
+	}
+}
+
+func BenchmarkSerialLocked(b *testing.B) { benchmarkSerial(b) }
+func BenchmarkSerialNoLock(b *testing.B) { benchmarkSerial(b, WithNoLock()) }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// WithLogger makes the cache log what happens to its entries. Resizes and
+// Clear are logged at level; evictions and expirations, which a busy cache
+// produces on every Put, are only ever logged at Debug. Records are built
+// under the lock but handed to logger after it is released, so a slow
+// handler never holds up other callers.
+func WithLogger(logger *slog.Logger, level slog.Level) Option {
+	return func(c *SecureLRUCache) error {
+		if logger == nil {
+			return fmt.Errorf("logger must not be nil")
+		}
+		c.logger = logger
+		c.logLevel = level
+		return nil
+	}
+}
+
+type logRecord struct {
+	level slog.Level
+	msg   string
+	attrs []slog.Attr
+}
+
+// logEnabled reports whether the logger takes records at level, so callers
+// can skip building attributes nobody will see.
+func (c *SecureLRUCache) logEnabled(level slog.Level) bool {
+	return c.logger != nil && c.logger.Enabled(context.Background(), level)
+}
+
+// logf queues a record for the logger. The caller must hold the write lock
+// and should check logEnabled first to keep the quiet path free.
+func (c *SecureLRUCache) logf(level slog.Level, msg string, attrs ...slog.Attr) {
+	c.logs = append(c.logs, logRecord{level: level, msg: msg, attrs: attrs})
+}
+
+func (c *SecureLRUCache) logEvicted(node *Node, reason EvictReason) {
+	c.logf(slog.LevelDebug, "evicted",
+		slog.Int("key", node.key),
+		slog.String("reason", reason.String()),
+		slog.Duration("age", c.residency(node)),
+	)
+}
+
+func (c *SecureLRUCache) flushLogs(records []logRecord) {
+	ctx := context.Background()
+	for _, r := range records {
+		c.logger.LogAttrs(ctx, r.level, r.msg, r.attrs...)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLoggerSkipsDisabledLevels(t *testing.T) {
+	quiet := slog.New(slog.NewTextHandler(&bytes.Buffer{}, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	plain, err := NewSecureLRUCache(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	logged, err := NewSecureLRUCache(2, WithLogger(quiet, slog.LevelInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logged.Close()
+
+	churn := func(c *SecureLRUCache) func() {
+		k := 0
+		return func() {
+			k++
+			c.Put(k, k) // evicts once the cache is full
+		}
+	}
+	want := testing.AllocsPerRun(1000, churn(plain))
+	if got := testing.AllocsPerRun(1000, churn(logged)); got != want {
+		t.Errorf("evicting with Debug disabled costs %v allocs per Put, %v without a logger", got, want)
+	}
+}
+
+func TestLoggerRecordsEnabledLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c := newTestCache(t, 1, WithLogger(logger, slog.LevelInfo))
+	c.Put(1, 1)
+	c.Put(2, 2)
+	c.Resize(2)
+
+	out := buf.String()
+	for _, want := range []string{"level=DEBUG msg=evicted key=1 reason=capacity", "level=INFO msg=resized"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log lacks %q:\n%s", want, out)
+		}
+	}
+}
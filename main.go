@@ -1,265 +1,864 @@
 package main
 
 import (
+	"crypto/cipher"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type Node struct {
-	key   int
-	value int
-	prev  *Node
-	next  *Node
+	key       int
+	value     int
+	prev      *Node
+	next      *Node
+	expiresAt time.Time
+	tombstone bool
+	freq      int
+	bucket    *lfuBucket
+	index     int
+	stamp     int64
+	segment   int8
+	cost      int64
+	// referenced is the CLOCK policy's second-chance bit, set under the
+	// read lock.
+	referenced atomic.Bool
+	createdAt  time.Time
+	refs       []int64
+	// accessedAt is the time of the last read or overwrite in place in Unix
+	// nanoseconds, or zero if there has been neither.
+	accessedAt atomic.Int64
+	// accesses counts reads for HotKeys.
+	accesses atomic.Int64
+	// seq is the cache's move count when the entry was last inserted or
+	// moved by the policy under the write lock, for KeysPage cursors.
+	seq uint64
 }
 
 type SecureLRUCache struct {
 	capacity      int
 	cache         map[int]*Node
-	head          *Node
-	tail          *Node
-	mu            sync.RWMutex
-	hits          int64
-	misses        int64
-	evictions     int64
-	enableMetrics bool
+	policy        Policy
+	admission     *frequencySketch
+	maxCost       int64
+	totalCost     int64
+	maxBytes      int64
+	totalBytes    int64
+	sharedAccess  bool
+	frontAccess   FrontAccessPolicy
+	readFirst     atomic.Bool // read unlocked, as SetPolicy may change it
+	promotions    *promotionBuffer
+	slab          *nodeSlab
+	nodes         sync.Pool
+	size          atomic.Int64
+	capacityNow   atomic.Int64
+	mu            cacheMutex
+	resizeMu      sync.Mutex
+	stats         cacheCounters
+	evictFilter   func(key, value int) bool
+	evictSkips    int
+	pressure      *memoryPressure
+	adaptive      *adaptiveCapacity
+	decayInterval time.Duration
+	logger        *slog.Logger
+	logLevel      slog.Level
+	logs          []logRecord
+	stream        eventStream
+	stringLimit   int
+	debugChecks   bool
+	initial       *CacheDump
+	initialTTL    bool
+	wal           *writeAheadLog
+	persist       *persistence
+	snapshotAEAD  cipher.AEAD
+	zeroize       bool
+	redactDumps   bool
+	maxEntryCost  int64
+	highWater     float64
+	lowWater      float64
+	groups        *groupQuotas
+	maxEntryBytes int64
+	loads         map[int]*loadCall
+	clock         Clock
+	defaultTTL    time.Duration
+	staleFor      time.Duration
+	negativeTTL   time.Duration
+	errorTTL      time.Duration
+	errorMaxRuns  int
+	errs          map[int]*cachedError
+	writeThrough  func(key, value int) error
+	writeBehind   *writeBehind
+	bus           *invalidationLink
+	trace         *traceRecorder
+	refresh       *backgroundRefresh
+	audit         *auditLog
+	hooks         *lifecycleHooks
+	shardHasher   Hasher
+	seq           uint64
+	waiters       map[int]*keyWaiters
+	pending       []Event
+	watchMu       sync.RWMutex
+	watchers      map[int]map[*watcher]struct{}
+	watchCount    int64
+	done          chan struct{}
+	closed        bool
+	closeOnce     sync.Once
+	workers       sync.WaitGroup
+	drains        sync.WaitGroup
 }
 
-func NewSecureLRUCache(capacity int) (*SecureLRUCache, error) {
-	if capacity < 1 {
-		return nil, fmt.Errorf("capacity must be at least 1")
+type Option func(*SecureLRUCache) error
+
+// WithMetrics is kept for compatibility.
+//
+// Deprecated: statistics are always collected.
+func WithMetrics() Option {
+	return func(c *SecureLRUCache) error {
+		return nil
 	}
-	
-	head := &Node{key: -1, value: -1}
-	tail := &Node{key: -1, value: -1}
-	head.next = tail
-	tail.prev = head
-	
-	return &SecureLRUCache{
-		capacity: capacity,
-		cache:    make(map[int]*Node),
-		head:     head,
-		tail:     tail,
-	}, nil
 }
 
-func (c *SecureLRUCache) removeNode(node *Node) {
-	if node == nil || node.prev == nil || node.next == nil {
-		return
+func WithClock(clock Clock) Option {
+	return func(c *SecureLRUCache) error {
+		if clock == nil {
+			return fmt.Errorf("clock must not be nil")
+		}
+		c.clock = clock
+		return nil
 	}
-	
-	if node == c.head || node == c.tail {
-		return
+}
+
+// WithDefaultTTL gives every entry written without an explicit TTL, including
+// loaded ones, a lifetime of ttl.
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(c *SecureLRUCache) error {
+		if ttl <= 0 {
+			return fmt.Errorf("default ttl must be positive")
+		}
+		c.defaultTTL = ttl
+		return nil
 	}
-	
-	node.prev.next = node.next
-	node.next.prev = node.prev
-	
-	node.prev = nil
-	node.next = nil
 }
 
-func (c *SecureLRUCache) addToHead(node *Node) {
-	if node == nil {
-		return
+func NewSecureLRUCache(capacity int, opts ...Option) (*SecureLRUCache, error) {
+	if capacity < 1 {
+		return nil, fmt.Errorf("capacity must be at least 1")
 	}
-	
-	if node == c.head || node == c.tail {
-		return
+
+	c := &SecureLRUCache{}
+	if err := c.init(capacity, opts); err != nil {
+		return nil, err
 	}
-	
-	node.next = c.head.next
-	node.prev = c.head
-	
-	c.head.next.prev = node
-	c.head.next = node
+	return c, nil
 }
 
-func (c *SecureLRUCache) moveToHead(node *Node) {
-	if node == nil || node.prev == nil || node.next == nil {
-		return
+// init sets up a zero cache and starts its background workers.
+func (c *SecureLRUCache) init(capacity int, opts []Option) error {
+	c.capacity = capacity
+	c.capacityNow.Store(int64(capacity))
+	c.cache = c.newMap()
+	c.policy = LRU()
+	c.loads = make(map[int]*loadCall)
+	c.clock = realClock{}
+	c.errs = make(map[int]*cachedError)
+	c.waiters = make(map[int]*keyWaiters)
+	c.watchers = make(map[int]map[*watcher]struct{})
+	c.done = make(chan struct{})
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return err
+		}
 	}
-	
-	if node == c.head || node == c.tail {
-		return
+	if p, ok := c.policy.(SharedAccessPolicy); ok {
+		c.sharedAccess = p.SharedAccess()
 	}
-	
-	if node == c.head.next {
-		return
+	if p, ok := c.policy.(FrontAccessPolicy); ok && !c.sharedAccess {
+		c.frontAccess = p
 	}
-	
-	c.removeNode(node)
-	c.addToHead(node)
+	c.readFirst.Store(c.sharedAccess || c.frontAccess != nil || c.promotions != nil)
+	if c.mu.off {
+		if err := c.checkNoLock(); err != nil {
+			return err
+		}
+		c.mu.check = c.debugChecks
+	}
+	if p, ok := c.policy.(CapacityAwarePolicy); ok {
+		p.SetCapacity(c.capacity)
+	}
+	if c.groups != nil {
+		if err := c.checkGroups(); err != nil {
+			return err
+		}
+	}
+	if c.zeroize {
+		if err := c.checkZeroize(); err != nil {
+			return err
+		}
+	}
+	if c.wal != nil {
+		if err := c.openWAL(); err != nil {
+			return err
+		}
+	}
+	if c.initial != nil {
+		if err := c.preload(); err != nil {
+			return err
+		}
+	}
+	if c.persist != nil {
+		if err := c.loadPersisted(); err != nil {
+			return err
+		}
+	}
+	if c.bus != nil {
+		if err := c.subscribeInvalidations(); err != nil {
+			return err
+		}
+	}
+	if c.writeBehind != nil {
+		c.startWriteBehind()
+	}
+	if c.pressure != nil && c.pressure.interval > 0 {
+		c.startMemoryPressure()
+	}
+	if c.adaptive != nil {
+		c.startAdaptiveCapacity()
+	}
+	if c.decayInterval > 0 {
+		c.startAccessDecay()
+	}
+	if c.persist != nil && c.persist.interval > 0 {
+		c.startPersistence()
+	}
+	if c.wal != nil {
+		c.startWAL()
+	}
+	if c.promotions != nil {
+		c.startPromotions()
+	}
+	if c.trace != nil {
+		c.startTrace()
+	}
+	if c.refresh != nil {
+		c.startBackgroundRefresh()
+	}
+	if c.audit != nil {
+		c.startAudit()
+	}
+	return nil
+}
+
+// Close stops the cache's background workers, flushes anything still queued
+// for write-behind, saves the persistence snapshot and syncs the write-ahead
+// log. The cache remains usable afterwards, but nothing runs in the
+// background any more.
+func (c *SecureLRUCache) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		if c.bus != nil {
+			c.bus.unsubscribe()
+		}
+		// Events checks closed under the lock, so no worker is added once
+		// Wait may have started.
+		c.mu.Lock()
+		c.closed = true
+		c.unlock()
+		close(c.done)
+		c.workers.Wait()
+		c.drains.Wait()
+		err = c.Flush()
+		if c.persist != nil {
+			err = errors.Join(err, c.savePersisted())
+		}
+		if c.wal != nil {
+			err = errors.Join(err, c.closeWAL())
+		}
+		if c.trace != nil && c.trace.err != nil {
+			err = errors.Join(err, fmt.Errorf("writing trace: %w", c.trace.err))
+		}
+		if c.audit != nil && c.audit.err != nil {
+			err = errors.Join(err, fmt.Errorf("writing audit log: %w", c.audit.err))
+		}
+	})
+	return err
+}
+
+func (c *SecureLRUCache) deadline(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return c.clock.Now().Add(ttl)
+}
+
+func (c *SecureLRUCache) expired(node *Node) bool {
+	return !node.expiresAt.IsZero() && !c.clock.Now().Before(node.expiresAt)
+}
+
+// stale reports whether an expired node is still inside the refresh-ahead
+// window and may be served while it is reloaded.
+func (c *SecureLRUCache) stale(node *Node) bool {
+	return c.staleFor > 0 && !node.tombstone && c.clock.Now().Before(node.expiresAt.Add(c.staleFor))
+}
+
+// visible reports whether node holds a value callers may see: tombstones and
+// expired entries still occupy a slot but read as misses.
+func (c *SecureLRUCache) visible(node *Node) bool {
+	return !node.tombstone && !c.expired(node)
+}
+
+func (c *SecureLRUCache) deleteNode(node *Node) {
+	c.policy.Remove(node)
+	delete(c.cache, node.key)
+	c.size.Add(-1)
+	c.countGroup(node, -1)
+	c.totalCost -= node.cost
+	c.totalBytes -= estimateSize(node.key, node.value)
+}
+
+// access records a read of node: with the policy, in its HotKeys count and
+// as the time it was last read. The caller holds the write lock.
+func (c *SecureLRUCache) access(node *Node) {
+	c.policy.RecordAccess(node)
+	c.moved(node)
+	c.noteAccess(node)
+}
+
+// moved stamps node as the entry the policy moved last. The caller holds the
+// write lock.
+func (c *SecureLRUCache) moved(node *Node) {
+	c.seq++
+	node.seq = c.seq
+}
+
+// noteAccess is access without the policy, which is safe under the read lock.
+func (c *SecureLRUCache) noteAccess(node *Node) {
+	node.accesses.Add(1)
+	node.accessedAt.Store(c.clock.Now().UnixNano())
 }
 
 func (c *SecureLRUCache) Get(key int) (int, bool) {
+	c.touch(key)
+	if c.readFirst.Load() {
+		c.mu.RLock()
+		node, exists := c.cache[key]
+		if exists && c.visible(node) {
+			if ok, filled := c.readAccess(node); ok {
+				value := node.value
+				c.mu.RUnlock()
+				c.stats.hits.Add(1)
+				c.traceOp(TraceGet, key, true)
+				if filled {
+					c.flushPromotions()
+				}
+				return value, true
+			}
+		}
+		c.mu.RUnlock()
+		if !exists {
+			c.stats.misses.Add(1)
+			c.traceOp(TraceGet, key, false)
+			return 0, false
+		}
+		// Expired, a tombstone or in need of a relink: fall through, and
+		// lookup checks the key again under the write lock, since it may
+		// have been evicted in between.
+	}
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	node, exists := c.cache[key]
-	if !exists {
-		if c.enableMetrics {
-			atomic.AddInt64(&c.misses, 1)
-		}
+	node, exists := c.lookup(key)
+	if !exists || node.tombstone {
+		c.stats.misses.Add(1)
+		c.traceOp(TraceGet, key, false)
 		return 0, false
 	}
 
-	c.moveToHead(node)
-	if c.enableMetrics {
-		atomic.AddInt64(&c.hits, 1)
-	}
+	c.access(node)
+	c.stats.hits.Add(1)
+	c.traceOp(TraceGet, key, true)
 	return node.value, true
 }
 
 func (c *SecureLRUCache) GetOrDefault(key int, defaultValue int) int {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if value, found := c.Get(key); found {
+		return value
+	}
+	return defaultValue
+}
 
+// lookup returns the resident node for key, dropping it first if it has
+// expired. Stale nodes are kept for GetOrLoad but still read as misses. The
+// caller must hold the write lock.
+func (c *SecureLRUCache) lookup(key int) (*Node, bool) {
 	node, exists := c.cache[key]
 	if !exists {
-		if c.enableMetrics {
-			atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+	if c.expired(node) {
+		if !c.stale(node) {
+			c.expire(node)
 		}
-		return defaultValue
+		return nil, false
 	}
+	return node, true
+}
 
-	c.moveToHead(node)
-	if c.enableMetrics {
-		atomic.AddInt64(&c.hits, 1)
+// expire drops an expired node or a tombstone. The caller holds the write
+// lock.
+func (c *SecureLRUCache) expire(node *Node) {
+	c.deleteNode(node)
+	if !node.tombstone {
+		c.record(Event{Op: EventExpired, Key: node.key, Value: node.value, Reason: ReasonExpired})
+		c.stats.expirations.Add(1)
+		c.stats.expiryAges.add(c.residency(node))
+		if c.logEnabled(slog.LevelDebug) {
+			c.logf(slog.LevelDebug, "expired", slog.Int("key", node.key))
+		}
 	}
-	return node.value
+	c.releaseNode(node)
 }
 
 func (c *SecureLRUCache) Put(key, value int) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	_, _, err := c.write(key, value, 1, c.defaultTTL)
+	return err
+}
+
+// PutEvicted is Put that also reports the live entry, if any, evicted to make
+// room. Tombstones and expired entries pushed out are not reported.
+func (c *SecureLRUCache) PutEvicted(key, value int) (Entry, bool, error) {
+	return c.write(key, value, 1, c.defaultTTL)
+}
 
+func (c *SecureLRUCache) PutWithTTL(key, value int, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive")
+	}
+	_, _, err := c.write(key, value, 1, ttl)
+	return err
+}
+
+// set installs key with the given cost, evicting until the entry count and
+// the cost and byte budgets fit. evicted is the first entry pushed out, if
+// any; the caller may release it once done with it. Other nodes pushed out are
+// reused or released. An entry too large to be cached at all replaces nothing: an existing
+// entry for key is removed rather than left stale.
+func (c *SecureLRUCache) set(key, value int, cost int64, expiresAt time.Time) (node, evicted *Node, err error) {
+	size := estimateSize(key, value)
+	if err := c.checkEntrySize(key, cost, size); err != nil {
+		if node, exists := c.cache[key]; exists {
+			c.deleteNode(node)
+			if !node.tombstone {
+				c.record(Event{Op: EventRemove, Key: key, Value: node.value, Reason: ReasonRemoved})
+			}
+			c.releaseNode(node)
+		}
+		c.stats.oversizeRejections.Add(1)
+		return nil, nil, err
+	}
+
+	c.applyPromotions()
+	overwrite := false
+	var accesses int64
+	// spare is a node this call freed, reused for the new entry rather than
+	// taking one from the pool.
+	var spare *Node
 	if node, exists := c.cache[key]; exists {
-		node.value = value
-		c.moveToHead(node)
-		return nil
+		oldSize := estimateSize(node.key, node.value)
+		if c.fits(cost-node.cost, size-oldSize) {
+			c.totalCost += cost - node.cost
+			c.totalBytes += size - oldSize
+			node.value = value
+			node.cost = cost
+			node.expiresAt = expiresAt
+			node.tombstone = false
+			node.accessedAt.Store(c.clock.Now().UnixNano())
+			c.policy.RecordAccess(node)
+			c.moved(node)
+			return node, nil, nil
+		}
+		// Making room must not evict the entry being updated, so take it
+		// out and insert it afresh.
+		c.deleteNode(node)
+		overwrite = true
+		accesses = node.accesses.Load()
+		spare = node
 	}
 
-	if len(c.cache) >= c.capacity {
-		lru := c.tail.prev
-		if lru != c.head {
-			c.removeNode(lru)
-			delete(c.cache, lru.key)
-			if c.enableMetrics {
-				atomic.AddInt64(&c.evictions, 1)
+	// keep holds on to an evicted node: the first is returned, the second
+	// reused, the rest released.
+	keep := func(lru *Node) {
+		switch {
+		case evicted == nil:
+			evicted = lru
+		case spare == nil:
+			spare = lru
+		default:
+			c.releaseNode(lru)
+		}
+	}
+	// A group at its quota makes room from its own entries first.
+	if group, full := c.groupFull(key); full {
+		for full {
+			lru := c.groupVictim(group)
+			if lru == nil {
+				break
 			}
-		} else {
-			return fmt.Errorf("cache is full and cannot evict")
+			c.evict(lru, ReasonCapacity)
+			keep(lru)
+			_, full = c.groupFull(key)
 		}
 	}
+	below := c.evictBelow()
+	for len(c.cache) >= below || !c.fits(cost, size) {
+		lru := c.victimFor(key)
+		if lru == nil {
+			return nil, nil, fmt.Errorf("cache is full and cannot evict")
+		}
+		if evicted == nil && !overwrite && c.admission != nil && !lru.tombstone && !c.admission.admit(key, lru.key) {
+			c.stats.admissionRejections.Add(1)
+			return nil, nil, errAdmissionRejected
+		}
+		c.evict(lru, ReasonCapacity)
+		keep(lru)
+	}
 
-	node := &Node{key: key, value: value}
+	if spare != nil {
+		node = spare
+		*node = Node{}
+	} else {
+		node = c.newNode()
+	}
+	node.key, node.value, node.cost = key, value, cost
+	node.expiresAt, node.createdAt = expiresAt, c.clock.Now()
+	node.accesses.Store(accesses)
 	c.cache[key] = node
-	c.addToHead(node)
-	return nil
+	c.size.Add(1)
+	c.countGroup(node, 1)
+	c.totalCost += cost
+	c.totalBytes += size
+	c.policy.RecordInsert(node)
+	c.moved(node)
+	return node, evicted, nil
+}
+
+// fits reports whether the cost and byte budgets have room for the given
+// increases.
+func (c *SecureLRUCache) fits(cost, bytes int64) bool {
+	return (c.maxCost == 0 || c.totalCost+cost <= c.maxCost) &&
+		(c.maxBytes == 0 || c.totalBytes+bytes <= c.maxBytes)
+}
+
+// evict removes a victim picked by the policy to make room.
+func (c *SecureLRUCache) evict(node *Node, reason EvictReason) {
+	c.deleteNode(node)
+	if !node.tombstone {
+		c.stats.evictionAges.add(c.residency(node))
+	}
+	if c.logEnabled(slog.LevelDebug) {
+		c.logEvicted(node, reason)
+	}
+	if c.adaptive != nil && c.clock.Now().Sub(node.createdAt) < c.adaptive.interval {
+		c.adaptive.young++
+	}
+	if !node.tombstone {
+		c.record(Event{Op: EventEvicted, Key: node.key, Value: node.value, Reason: reason})
+	}
+	c.stats.evictions.Add(1)
 }
 
 func (c *SecureLRUCache) Contains(key int) bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	_, exists := c.cache[key]
-	return exists
+	node, exists := c.cache[key]
+	if !exists || !c.visible(node) {
+		c.stats.peekMisses.Add(1)
+		return false
+	}
+	c.stats.peekHits.Add(1)
+	return true
 }
 
+// Size and Capacity do not take the lock, so they never wait for a writer.
 func (c *SecureLRUCache) Size() int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return len(c.cache)
+	return int(c.size.Load())
 }
 
 func (c *SecureLRUCache) Capacity() int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return c.capacity
+	return int(c.capacityNow.Load())
 }
 
+// resizeBatch is how many entries Resize evicts per hold of the write lock.
+const resizeBatch = 1024
+
+// Resize changes the capacity, evicting down to it. A large shrink evicts in
+// batches and lets other callers in between, so until Resize returns the
+// cache may hold more than the new capacity and Capacity still reports the
+// old one. Concurrent Resize calls take effect one after another.
 func (c *SecureLRUCache) Resize(newCapacity int) error {
 	if newCapacity < 1 {
 		return fmt.Errorf("capacity must be at least 1")
 	}
 
+	c.resizeMu.Lock()
+	defer c.resizeMu.Unlock()
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if newCapacity < c.capacity && len(c.cache) > newCapacity {
-		// Remove enough nodes to fit new capacity
-		toRemove := len(c.cache) - newCapacity
-		for i := 0; i < toRemove; i++ {
-			lru := c.tail.prev
-			if lru == c.head {
-				break
-			}
-			
-			c.removeNode(lru)
-			delete(c.cache, lru.key)
-			if c.enableMetrics {
-				atomic.AddInt64(&c.evictions, 1)
-			}
+	defer c.unlock()
+
+	oldCapacity, evicted, batch := c.capacity, 0, 0
+	for newCapacity < c.capacity && len(c.cache) > newCapacity {
+		if batch == resizeBatch {
+			// Let readers and writers in before the next batch.
+			c.unlock()
+			c.mu.Lock()
+			batch = 0
+			continue
 		}
+		lru := c.victim()
+		if lru == nil {
+			break
+		}
+		c.evict(lru, ReasonResize)
+		c.releaseNode(lru)
+		evicted++
+		batch++
 	}
 
-	c.capacity = newCapacity
+	c.setCapacity(newCapacity)
+	if newCapacity < oldCapacity/2 {
+		// A map never gives back its buckets, so rebuild it at the new
+		// size.
+		m := c.newMap()
+		maps.Copy(m, c.cache)
+		c.cache = m
+	}
+	if c.logEnabled(c.logLevel) {
+		c.logf(c.logLevel, "resized",
+			slog.Int("old", oldCapacity),
+			slog.Int("new", newCapacity),
+			slog.Int("evicted", evicted),
+		)
+	}
 	return nil
 }
 
+// maxMapHint caps the size hint for the key map, so that a cache whose
+// capacity is far beyond what it will hold, such as one bounded by cost, does
+// not reserve all of it up front.
+const maxMapHint = 1 << 20
+
+func (c *SecureLRUCache) newMap() map[int]*Node {
+	return make(map[int]*Node, min(c.capacity, maxMapHint))
+}
+
+func (c *SecureLRUCache) setCapacity(n int) {
+	c.capacity = n
+	c.capacityNow.Store(int64(n))
+	c.record(Event{Op: EventResize, Value: n})
+	if p, ok := c.policy.(CapacityAwarePolicy); ok {
+		p.SetCapacity(n)
+	}
+}
+
+// Clear empties the cache. The entries are dropped by swapping in an empty
+// map and policy under the write lock; their nodes are recycled afterwards,
+// off the lock.
 func (c *SecureLRUCache) Clear() {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
-	c.cache = make(map[int]*Node)
-	c.head.next = c.tail
-	c.tail.prev = c.head
+	c.reset()
+	c.invalidate(Invalidation{All: true})
+}
+
+// reset empties the cache. The caller holds the write lock.
+func (c *SecureLRUCache) reset() {
+	if c.logEnabled(c.logLevel) {
+		c.logf(c.logLevel, "cleared", slog.Int("size", len(c.cache)))
+	}
+	dropped := c.cache
+	c.cache = c.newMap()
+	c.size.Store(0)
+	if c.groups != nil {
+		clear(c.groups.sizes)
+	}
+	c.totalCost = 0
+	c.totalBytes = 0
+	c.policy.Clear()
+	c.dropAll(dropped)
+	c.errs = make(map[int]*cachedError)
+	c.record(Event{Op: EventClear, Reason: ReasonCleared})
 }
 
 func (c *SecureLRUCache) Remove(key int) bool {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlock()
 
+	c.invalidate(Invalidation{Key: key})
+	return c.removeKey(key)
+}
+
+// RemoveMany removes every key in keys under a single write lock, reporting
+// how many were cached. A key listed twice counts once, and removal events
+// are delivered after the lock is released in the order of keys.
+func (c *SecureLRUCache) RemoveMany(keys []int) int {
+	if len(keys) == 0 {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.unlock()
+
+	removed := 0
+	for _, key := range keys {
+		c.invalidate(Invalidation{Key: key})
+		if c.removeKey(key) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// RemoveOldest removes and returns the entry the policy would evict next,
+// the least recently used under LRU, as Remove would. Expired entries and
+// tombstones in its way are dropped. The eviction filter is not consulted.
+func (c *SecureLRUCache) RemoveOldest() (Entry, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.applyPromotions()
+	for {
+		node := c.policy.Victim()
+		if node == nil {
+			return Entry{}, false
+		}
+		if !c.visible(node) {
+			c.expire(node)
+			continue
+		}
+		entry := Entry{Key: node.key, Value: node.value}
+		c.invalidate(Invalidation{Key: node.key})
+		c.removeKey(node.key)
+		return entry, true
+	}
+}
+
+// removeKey is Remove for a caller holding the write lock.
+func (c *SecureLRUCache) removeKey(key int) bool {
+	delete(c.errs, key)
 	node, exists := c.cache[key]
 	if !exists {
+		c.traceOp(TraceRemove, key, false)
 		return false
 	}
 
-	c.removeNode(node)
-	delete(c.cache, key)
+	c.deleteNode(node)
+	defer c.releaseNode(node)
+	if node.tombstone {
+		c.traceOp(TraceRemove, key, false)
+		return false
+	}
+	c.traceOp(TraceRemove, key, true)
+	c.record(Event{Op: EventRemove, Key: key, Value: node.value, Reason: ReasonRemoved})
+	c.stats.removals.Add(1)
+	c.stats.removalAges.add(c.residency(node))
 	return true
 }
 
 type CacheDump struct {
-	Capacity int         `json:"capacity"`
-	Size     int         `json:"size"`
-	Items    map[int]int `json:"items"`
-	Order    []int       `json:"order"`
+	// Version is the format version, 4 for dumps written by this build. A
+	// dump without one is version 1.
+	Version     int               `json:"version,omitempty"`
+	Capacity    int               `json:"capacity"`
+	Size        int               `json:"size"`
+	Items       map[int]int       `json:"items"`
+	Order       []int             `json:"order"`
+	Tombstones  []int             `json:"tombstones,omitempty"`
+	Expires     map[int]time.Time `json:"expires,omitempty"`
+	Frequencies map[int]int       `json:"frequencies,omitempty"`
+	// Costs holds the cost of every entry stored with a cost other than 1.
+	Costs  map[int]int64 `json:"costs,omitempty"`
+	Policy *PolicyState  `json:"policy,omitempty"`
+	// TotalCost and MaxCost are only reported for caches built WithMaxCost.
+	TotalCost int64 `json:"total_cost,omitempty"`
+	MaxCost   int64 `json:"max_cost,omitempty"`
+	// Checksum is set by ToJSON and MarshalJSON to the CRC-32C of the
+	// compact JSON encoding of the dump without it, and checked on restore.
+	Checksum *uint32 `json:"checksum,omitempty"`
 }
 
 func (c *SecureLRUCache) Dump() CacheDump {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
+	return c.dump()
+}
 
-	items := make(map[int]int, len(c.cache))
-	order := make([]int, 0, len(c.cache))
-
-	for node := c.head.next; node != c.tail; node = node.next {
-		items[node.key] = node.value
-		order = append(order, node.key)
-	}
-
-	return CacheDump{
+func (c *SecureLRUCache) dump() CacheDump {
+	d := CacheDump{
+		Version:  dumpVersion,
 		Capacity: c.capacity,
 		Size:     len(c.cache),
-		Items:    items,
-		Order:    order,
+		Items:    make(map[int]int, len(c.cache)),
+		Order:    make([]int, 0, len(c.cache)),
+		MaxCost:  c.maxCost,
+	}
+	c.policy.Each(func(node *Node) bool {
+		d.addNode(node)
+		return true
+	})
+
+	if p, ok := c.policy.(StatefulPolicy); ok {
+		s := p.State()
+		d.Policy = &s
+	}
+	if c.maxCost > 0 {
+		d.TotalCost = c.totalCost
+	}
+	c.redact(&d)
+	return d
+}
+
+// addNode appends node's entry to d, after those already in it.
+func (d *CacheDump) addNode(node *Node) {
+	d.Order = append(d.Order, node.key)
+	if node.cost != 1 {
+		if d.Costs == nil {
+			d.Costs = make(map[int]int64)
+		}
+		d.Costs[node.key] = node.cost
+	}
+	if !node.expiresAt.IsZero() {
+		if d.Expires == nil {
+			d.Expires = make(map[int]time.Time)
+		}
+		d.Expires[node.key] = node.expiresAt
+	}
+	if node.freq > 0 {
+		if d.Frequencies == nil {
+			d.Frequencies = make(map[int]int)
+		}
+		d.Frequencies[node.key] = node.freq
+	}
+	if node.tombstone {
+		d.Tombstones = append(d.Tombstones, node.key)
+	} else {
+		d.Items[node.key] = node.value
 	}
 }
 
 func (c *SecureLRUCache) ToJSON() (string, error) {
-	dump := c.Dump()
+	if err := c.snapshotAllowed(); err != nil {
+		return "", err
+	}
+	dump, err := c.Dump().withChecksum()
+	if err != nil {
+		return "", err
+	}
 	bytes, err := json.Marshal(dump)
 	if err != nil {
 		return "", err
@@ -268,7 +867,13 @@ func (c *SecureLRUCache) ToJSON() (string, error) {
 }
 
 func (c *SecureLRUCache) ToJSONPretty() (string, error) {
-	dump := c.Dump()
+	if err := c.snapshotAllowed(); err != nil {
+		return "", err
+	}
+	dump, err := c.Dump().withChecksum()
+	if err != nil {
+		return "", err
+	}
 	bytes, err := json.MarshalIndent(dump, "", "  ")
 	if err != nil {
 		return "", err
@@ -281,20 +886,64 @@ func (c *SecureLRUCache) Peek(key int) (int, bool) {
 	defer c.mu.RUnlock()
 
 	node, exists := c.cache[key]
-	if !exists {
+	if !exists || !c.visible(node) {
+		c.stats.peekMisses.Add(1)
 		return 0, false
 	}
+	c.stats.peekHits.Add(1)
 	return node.value, true
 }
 
+// EntryInfo describes a live entry without counting as an access to it.
+type EntryInfo struct {
+	Key   int `json:"key"`
+	Value int `json:"value"`
+	// ExpiresAt is zero for entries without a TTL.
+	ExpiresAt time.Time `json:"expires_at"`
+	// Frequency is the use count kept by the LFU policy, and zero otherwise.
+	Frequency int `json:"frequency,omitempty"`
+	// Segment names the part of a segmented policy (SLRU, ARC) the entry
+	// is in, and is empty for other policies.
+	Segment string `json:"segment,omitempty"`
+	// References are the logical times of the entry's latest references
+	// under the LRU-K policy, newest first.
+	References []int64 `json:"references,omitempty"`
+}
+
+func (c *SecureLRUCache) EntryInfo(key int) (EntryInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	node, exists := c.cache[key]
+	if !exists || !c.visible(node) {
+		return EntryInfo{}, false
+	}
+	info := EntryInfo{
+		Key:       node.key,
+		Value:     node.value,
+		ExpiresAt: node.expiresAt,
+		Frequency: node.freq,
+	}
+	if p, ok := c.policy.(SegmentedPolicy); ok {
+		info.Segment = p.Segment(node)
+	}
+	if len(node.refs) > 0 {
+		info.References = append([]int64(nil), node.refs...)
+	}
+	return info, true
+}
+
 func (c *SecureLRUCache) Keys() []int {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	keys := make([]int, 0, len(c.cache))
-	for node := c.head.next; node != c.tail; node = node.next {
-		keys = append(keys, node.key)
-	}
+	c.policy.Each(func(node *Node) bool {
+		if c.visible(node) {
+			keys = append(keys, node.key)
+		}
+		return true
+	})
 	return keys
 }
 
@@ -303,9 +952,12 @@ func (c *SecureLRUCache) Values() []int {
 	defer c.mu.RUnlock()
 
 	values := make([]int, 0, len(c.cache))
-	for node := c.head.next; node != c.tail; node = node.next {
-		values = append(values, node.value)
-	}
+	c.policy.Each(func(node *Node) bool {
+		if c.visible(node) {
+			values = append(values, node.value)
+		}
+		return true
+	})
 	return values
 }
 
@@ -317,12 +969,15 @@ func (c *SecureLRUCache) Range(f func(key, value int) bool) {
 		value int
 	}, 0, len(c.cache))
 	
-	for node := c.head.next; node != c.tail; node = node.next {
-		items = append(items, struct {
-			key   int
-			value int
-		}{node.key, node.value})
-	}
+	c.policy.Each(func(node *Node) bool {
+		if c.visible(node) {
+			items = append(items, struct {
+				key   int
+				value int
+			}{node.key, node.value})
+		}
+		return true
+	})
 	
 	c.mu.RUnlock()
 	
@@ -334,11 +989,64 @@ func (c *SecureLRUCache) Range(f func(key, value int) bool) {
 }
 
 type CacheStats struct {
-	Hits      int64 `json:"hits"`
-	Misses    int64 `json:"misses"`
-	Evictions int64 `json:"evictions"`
-	Size      int   `json:"size"`
-	Capacity  int   `json:"capacity"`
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// PeekHits and PeekMisses count Peek and Contains, which read without
+	// promoting.
+	PeekHits   int64 `json:"peek_hits"`
+	PeekMisses int64 `json:"peek_misses"`
+	// Puts counts writes that added a key and Updates those that
+	// overwrote a live one.
+	Puts        int64 `json:"puts"`
+	Updates     int64 `json:"updates"`
+	Evictions   int64 `json:"evictions"`
+	Removals    int64 `json:"removals"`
+	Expirations int64 `json:"expirations"`
+	ErrorHits   int64 `json:"error_hits"`
+	StaleHits   int64 `json:"stale_hits"`
+	// DroppedEvents counts Watch and Events notifications discarded
+	// because a buffer was full.
+	DroppedEvents int64 `json:"dropped_events"`
+	// AdmissionRejections counts Puts of new keys turned away by the
+	// TinyLFU filter.
+	AdmissionRejections int64 `json:"admission_rejections"`
+	// OversizeRejections counts Puts refused with ErrEntryTooLarge.
+	OversizeRejections int64 `json:"oversize_rejections"`
+	// ForcedEvictions counts evictions made despite the eviction filter
+	// because every candidate tried was vetoed.
+	ForcedEvictions int64 `json:"forced_evictions"`
+	// PreloadSkipped counts entries given to WithInitialData or
+	// WithInitialDump that were not loaded, mostly for lack of capacity.
+	PreloadSkipped int64 `json:"preload_skipped"`
+	// DroppedPromotions counts hits left unpromoted because the
+	// WithAsyncPromotion buffer was full.
+	DroppedPromotions int64 `json:"dropped_promotions"`
+	// DroppedTraceRecords counts WithTraceRecorder records discarded
+	// because the queue to the writer was full.
+	DroppedTraceRecords int64 `json:"dropped_trace_records"`
+	// Refreshes counts entries WithBackgroundRefresh reloaded and
+	// RefreshFailures those it could not.
+	Refreshes       int64 `json:"refreshes"`
+	RefreshFailures int64 `json:"refresh_failures"`
+	// DroppedAuditRecords counts WithAudit records discarded because the
+	// queue to the sink was full.
+	DroppedAuditRecords int64 `json:"dropped_audit_records"`
+	// TotalCost is the summed cost of every entry; it equals Size unless
+	// entries were stored with PutWithCost. MaxCost is zero when unbounded.
+	TotalCost int64 `json:"total_cost"`
+	MaxCost   int64 `json:"max_cost"`
+	// MemoryBytes is the estimate reported by MemoryBytes.
+	MemoryBytes int64 `json:"memory_bytes"`
+	// EvictionAge is how long entries evicted by Put or a resize had been
+	// cached; RemovalAge and ExpiryAge cover Remove and TTL expiry.
+	EvictionAge AgeStats `json:"eviction_age"`
+	RemovalAge  AgeStats `json:"removal_age"`
+	ExpiryAge   AgeStats `json:"expiry_age"`
+	Size        int      `json:"size"`
+	Capacity    int      `json:"capacity"`
+	// Groups maps each group with entries to its share of Size, under
+	// WithGroups.
+	Groups map[string]int `json:"groups,omitempty"`
 }
 
 func (c *SecureLRUCache) Stats() CacheStats {
@@ -346,15 +1054,56 @@ func (c *SecureLRUCache) Stats() CacheStats {
 	defer c.mu.RUnlock()
 	
 	return CacheStats{
-		Hits:      atomic.LoadInt64(&c.hits),
-		Misses:    atomic.LoadInt64(&c.misses),
-		Evictions: atomic.LoadInt64(&c.evictions),
-		Size:      len(c.cache),
-		Capacity:  c.capacity,
+		Hits:                c.stats.hits.Load(),
+		Misses:              c.stats.misses.Load(),
+		PeekHits:            c.stats.peekHits.Load(),
+		PeekMisses:          c.stats.peekMisses.Load(),
+		Puts:                c.stats.puts.Load(),
+		Updates:             c.stats.updates.Load(),
+		Removals:            c.stats.removals.Load(),
+		Expirations:         c.stats.expirations.Load(),
+		Evictions:           c.stats.evictions.Load(),
+		ErrorHits:           c.stats.errorHits.Load(),
+		StaleHits:           c.stats.staleHits.Load(),
+		DroppedEvents:       c.stats.droppedEvents.Load(),
+		AdmissionRejections: c.stats.admissionRejections.Load(),
+		OversizeRejections:  c.stats.oversizeRejections.Load(),
+		ForcedEvictions:     c.stats.forcedEvictions.Load(),
+		PreloadSkipped:      c.stats.preloadSkipped.Load(),
+		DroppedPromotions:   c.stats.droppedPromotions.Load(),
+		DroppedTraceRecords: c.stats.droppedTraceRecords.Load(),
+		Refreshes:           c.stats.refreshes.Load(),
+		RefreshFailures:     c.stats.refreshFailures.Load(),
+		DroppedAuditRecords: c.stats.droppedAuditRecords.Load(),
+		TotalCost:           c.totalCost,
+		MaxCost:             c.maxCost,
+		MemoryBytes:         c.totalBytes,
+		EvictionAge:         c.stats.evictionAges.snapshot(),
+		RemovalAge:          c.stats.removalAges.snapshot(),
+		ExpiryAge:           c.stats.expiryAges.snapshot(),
+		Size:                len(c.cache),
+		Capacity:            c.capacity,
+		Groups:              c.groupSizes(),
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		os.Exit(runSnapshot(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		os.Exit(runServe(os.Args[2:], os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "memcached" {
+		os.Exit(runMemcached(os.Args[2:], os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		os.Exit(runSimulate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "redis" {
+		os.Exit(runRESP(os.Args[2:], os.Stderr))
+	}
+
 	fmt.Println("=== Secure LRU Cache Demo (Capacity: 2) ===")
 	fmt.Println()
 
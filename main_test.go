@@ -0,0 +1,496 @@
+package main
+
+import (
+	"math/rand"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// GetOrDefault must return either the default or a value the key really
+// held, however it interleaves with writers dropping the entry.
+func TestGetOrDefaultRacesRemoval(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	for name, opts := range map[string][]Option{
+		"write lock":      nil,
+		"async promotion": {WithAsyncPromotion(4)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := newTestCache(t, 8, opts...)
+			var wg sync.WaitGroup
+			for g := range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					r := rand.New(rand.NewSource(int64(g)))
+					for range 2000 {
+						k := r.Intn(16)
+						switch r.Intn(8) {
+						case 0:
+							c.Remove(k)
+						case 1:
+							if r.Intn(10) == 0 {
+								c.Clear()
+							}
+						case 2:
+							c.Put(k, k*10)
+						case 3:
+							c.PutWithTTL(k, k*10, time.Microsecond)
+						default:
+							if v := c.GetOrDefault(k, -1); v != -1 && v != k*10 {
+								t.Errorf("GetOrDefault(%d) = %d", k, v)
+							}
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestRemoveKeepsMapPolicyAndSizeInStep(t *testing.T) {
+	cases := []struct {
+		name   string
+		fill   []int
+		remove int
+		want   []int
+	}{
+		{"most recent", []int{1, 2, 3}, 3, []int{2, 1}},
+		{"least recent", []int{1, 2, 3}, 1, []int{3, 2}},
+		{"middle", []int{1, 2, 3}, 2, []int{3, 1}},
+		{"only", []int{1}, 1, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestCache(t, 4)
+			for _, k := range tc.fill {
+				c.Put(k, k)
+			}
+			if !c.Remove(tc.remove) {
+				t.Fatalf("Remove(%d) = false", tc.remove)
+			}
+			if c.Remove(tc.remove) {
+				t.Fatalf("second Remove(%d) = true", tc.remove)
+			}
+			if got := c.Keys(); !slices.Equal(got, tc.want) {
+				t.Errorf("Keys = %v, want %v", got, tc.want)
+			}
+			if c.Size() != len(tc.want) {
+				t.Errorf("Size = %d, want %d", c.Size(), len(tc.want))
+			}
+			if err := c.CheckInvariants(); err != nil {
+				t.Fatal(err)
+			}
+			// The freed slot is usable again.
+			for k := 10; k < 10+4-len(tc.want); k++ {
+				c.Put(k, k)
+			}
+			if got := c.Stats().Evictions; got != 0 {
+				t.Errorf("refilling the cache evicted %d entries", got)
+			}
+		})
+	}
+}
+
+func TestRemoveMany(t *testing.T) {
+	cases := []struct {
+		name    string
+		remove  []int
+		want    int
+		keys    []int
+		removed []int
+	}{
+		{"empty", nil, 0, []int{5, 4, 3, 2, 1}, nil},
+		{"all missing", []int{7, 8, 9}, 0, []int{5, 4, 3, 2, 1}, nil},
+		{"mixed", []int{4, 9, 2, 4, 1, 2}, 3, []int{5, 3}, []int{4, 2, 1}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestCache(t, 8)
+			for k := 1; k <= 5; k++ {
+				c.Put(k, k*10)
+			}
+			events, cancel := c.Events(16)
+			defer cancel()
+			if got := c.RemoveMany(tc.remove); got != tc.want {
+				t.Errorf("RemoveMany(%v) = %d, want %d", tc.remove, got, tc.want)
+			}
+			if got := c.Keys(); !slices.Equal(got, tc.keys) {
+				t.Errorf("Keys = %v, want %v", got, tc.keys)
+			}
+			if st := c.Stats(); c.Size() != len(tc.keys) || st.Removals != int64(tc.want) {
+				t.Errorf("Size = %d after %d removals, want %d after %d", c.Size(), st.Removals, len(tc.keys), tc.want)
+			}
+			var removed []int
+			for range tc.removed {
+				e := <-events
+				if e.Op != EventRemove || e.Value != e.Key*10 {
+					t.Fatalf("event %+v, want a removal", e)
+				}
+				removed = append(removed, e.Key)
+			}
+			if !slices.Equal(removed, tc.removed) {
+				t.Errorf("removal events for %v, want %v", removed, tc.removed)
+			}
+		})
+	}
+}
+
+func BenchmarkRemoveMany(b *testing.B) {
+	keys := make([]int, 500)
+	for i := range keys {
+		keys[i] = i * 2
+	}
+	for name, remove := range map[string]func(c *SecureLRUCache){
+		"RemoveMany": func(c *SecureLRUCache) { c.RemoveMany(keys) },
+		"Remove": func(c *SecureLRUCache) {
+			for _, k := range keys {
+				c.Remove(k)
+			}
+		},
+	} {
+		b.Run(name, func(b *testing.B) {
+			c, err := NewSecureLRUCache(1000)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer c.Close()
+			for b.Loop() {
+				b.StopTimer()
+				for _, k := range keys {
+					c.Put(k, k)
+				}
+				b.StartTimer()
+				remove(c)
+			}
+		})
+	}
+}
+
+// BenchmarkFillLarge fills a cache of a million entries, new and after a
+// Clear. Both start from a map sized for the capacity, so the fill never
+// rehashes it.
+func BenchmarkFillLarge(b *testing.B) {
+	const capacity = 1 << 20
+	fill := func(c *SecureLRUCache) {
+		for k := range capacity {
+			c.Put(k, k)
+		}
+	}
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			c, err := NewSecureLRUCache(capacity)
+			if err != nil {
+				b.Fatal(err)
+			}
+			fill(c)
+			c.Close()
+		}
+	})
+	b.Run("after Clear", func(b *testing.B) {
+		c, err := NewSecureLRUCache(capacity)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer c.Close()
+		b.ReportAllocs()
+		for b.Loop() {
+			b.StopTimer()
+			c.Clear()
+			b.StartTimer()
+			fill(c)
+		}
+	})
+}
+
+// cacheOp is one step of a table-driven sequence: "put", "get", "remove",
+// "resize" (to key) or "clear".
+type cacheOp struct {
+	op         string
+	key, value int
+}
+
+func TestInsertEvictSequences(t *testing.T) {
+	cases := []struct {
+		name      string
+		ops       []cacheOp
+		want      []int
+		evictions int64
+	}{
+		{
+			name: "fill",
+			ops:  []cacheOp{{"put", 1, 1}, {"put", 2, 2}, {"put", 3, 3}},
+			want: []int{3, 2, 1},
+		},
+		{
+			name:      "evict oldest",
+			ops:       []cacheOp{{"put", 1, 1}, {"put", 2, 2}, {"put", 3, 3}, {"put", 4, 4}},
+			want:      []int{4, 3, 2},
+			evictions: 1,
+		},
+		{
+			name:      "read protects",
+			ops:       []cacheOp{{"put", 1, 1}, {"put", 2, 2}, {"put", 3, 3}, {"get", 1, 0}, {"put", 4, 4}},
+			want:      []int{4, 1, 3},
+			evictions: 1,
+		},
+		{
+			name:      "overwrite protects",
+			ops:       []cacheOp{{"put", 1, 1}, {"put", 2, 2}, {"put", 3, 3}, {"put", 1, 10}, {"put", 4, 4}},
+			want:      []int{4, 1, 3},
+			evictions: 1,
+		},
+		{
+			name: "overwrite when full",
+			ops:  []cacheOp{{"put", 1, 1}, {"put", 2, 2}, {"put", 3, 3}, {"put", 2, 20}},
+			want: []int{2, 3, 1},
+		},
+		{
+			name: "remove then insert",
+			ops:  []cacheOp{{"put", 1, 1}, {"put", 2, 2}, {"put", 3, 3}, {"remove", 2, 0}, {"put", 4, 4}},
+			want: []int{4, 3, 1},
+		},
+		{
+			name:      "shrink",
+			ops:       []cacheOp{{"put", 1, 1}, {"put", 2, 2}, {"put", 3, 3}, {"resize", 1, 0}},
+			want:      []int{3},
+			evictions: 2,
+		},
+		{
+			name:      "shrink and grow",
+			ops:       []cacheOp{{"put", 1, 1}, {"put", 2, 2}, {"put", 3, 3}, {"resize", 2, 0}, {"resize", 3, 0}, {"put", 4, 4}, {"put", 5, 5}},
+			want:      []int{5, 4, 3},
+			evictions: 2,
+		},
+		{
+			name: "clear and refill",
+			ops:  []cacheOp{{"put", 1, 1}, {"put", 2, 2}, {"clear", 0, 0}, {"put", 3, 3}, {"put", 1, 1}},
+			want: []int{1, 3},
+		},
+		{
+			name: "remove everything",
+			ops:  []cacheOp{{"put", 1, 1}, {"put", 2, 2}, {"remove", 1, 0}, {"remove", 2, 0}, {"remove", 2, 0}},
+			want: nil,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestCache(t, 3)
+			values := make(map[int]int)
+			for i, op := range tc.ops {
+				var err error
+				switch op.op {
+				case "put":
+					err = c.Put(op.key, op.value)
+					values[op.key] = op.value
+				case "get":
+					c.Get(op.key)
+				case "remove":
+					c.Remove(op.key)
+				case "resize":
+					err = c.Resize(op.key)
+				case "clear":
+					c.Clear()
+				}
+				if err != nil {
+					t.Fatalf("step %d %s(%d): %v", i, op.op, op.key, err)
+				}
+			}
+			if got := c.Keys(); !slices.Equal(got, tc.want) {
+				t.Errorf("Keys = %v, want %v", got, tc.want)
+			}
+			if c.Size() != len(tc.want) {
+				t.Errorf("Size = %d, want %d", c.Size(), len(tc.want))
+			}
+			if got := c.Stats().Evictions; got != tc.evictions {
+				t.Errorf("Evictions = %d, want %d", got, tc.evictions)
+			}
+			for _, k := range tc.want {
+				if v, ok := c.Peek(k); !ok || v != values[k] {
+					t.Errorf("Peek(%d) = %d, %v, want %d", k, v, ok, values[k])
+				}
+			}
+		})
+	}
+}
+
+func TestSizeAndCapacityUnderConcurrentWrites(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	c := newTestCache(t, 32)
+	stop := make(chan struct{})
+	var readers, writers sync.WaitGroup
+	for range 2 {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// Resize only moves between 16 and 32, and the size may
+				// exceed the capacity only while a shrink is under way.
+				if n := c.Size(); n < 0 || n > 32 {
+					t.Errorf("Size = %d", n)
+				}
+				if n := c.Capacity(); n != 16 && n != 32 {
+					t.Errorf("Capacity = %d", n)
+				}
+			}
+		}()
+	}
+	for g := range 4 {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			for i := range 2000 {
+				k := r.Intn(64)
+				switch {
+				case g == 0 && i%200 == 0:
+					c.Resize(16 + 16*(i/200%2))
+				case r.Intn(3) == 0:
+					c.Remove(k)
+				default:
+					c.Put(k, k)
+				}
+			}
+		}()
+	}
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+
+	if got, want := c.Size(), len(c.Keys()); got != want {
+		t.Fatalf("Size = %d, Keys lists %d", got, want)
+	}
+}
+
+func TestResizeShrinksInBatches(t *testing.T) {
+	if testing.Short() {
+		t.Skip("fills a cache of 200000 entries")
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	const from, to = 200000, 1000
+	c, err := NewSecureLRUCache(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for k := range from {
+		c.Put(k, k)
+	}
+
+	done := make(chan struct{})
+	var worst time.Duration
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for k := 0; ; k++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			start := time.Now()
+			c.Get(from - 1 - k%to)
+			worst = max(worst, time.Since(start))
+		}
+	}()
+	if err := c.Resize(to); err != nil {
+		t.Fatal(err)
+	}
+	close(done)
+	wg.Wait()
+
+	if worst > 100*time.Millisecond {
+		t.Errorf("a Get waited %v during the shrink", worst)
+	}
+	if c.Size() != to || c.Capacity() != to {
+		t.Errorf("Size %d, Capacity %d after the shrink, want %d", c.Size(), c.Capacity(), to)
+	}
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConditionalWrites(t *testing.T) {
+	clock := newFakeClock()
+	var stored []int
+	c := newTestCache(t, 4, WithClock(clock), WithWriteThrough(func(key, _ int) error {
+		stored = append(stored, key)
+		return nil
+	}))
+
+	if ok, err := c.Replace(1, 10); ok || err != nil {
+		t.Fatalf("Replace of a missing key = %v, %v", ok, err)
+	}
+	if ok, err := c.PutIfAbsent(1, 10); !ok || err != nil {
+		t.Fatalf("PutIfAbsent of a missing key = %v, %v", ok, err)
+	}
+	if ok, _ := c.PutIfAbsent(1, 11); ok {
+		t.Error("PutIfAbsent overwrote a live key")
+	}
+	if ok, _ := c.Replace(1, 12); !ok {
+		t.Error("Replace skipped a live key")
+	}
+	if v, _ := c.Get(1); v != 12 {
+		t.Errorf("Get(1) = %d, want 12", v)
+	}
+	if !slices.Equal(stored, []int{1, 1}) {
+		t.Errorf("write-through saw %v, want only the two writes that went ahead", stored)
+	}
+
+	// An expired entry counts as absent.
+	c.PutWithTTL(2, 20, time.Second)
+	clock.Advance(time.Second)
+	if ok, _ := c.Replace(2, 21); ok {
+		t.Error("Replace wrote over an expired entry")
+	}
+	if ok, _ := c.PutIfAbsent(2, 22); !ok {
+		t.Error("PutIfAbsent refused a key whose entry had expired")
+	}
+	if st := c.Stats(); st.Puts != 3 || st.Updates != 1 {
+		t.Errorf("Puts %d, Updates %d, want 3 and 1", st.Puts, st.Updates)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 4, WithClock(clock))
+	c.PutWithTTL(1, 10, time.Second)
+	c.Put(2, 20)
+
+	if !c.Touch(1, time.Minute) {
+		t.Fatal("Touch missed a live key")
+	}
+	clock.Advance(30 * time.Second)
+	if v, ok := c.Get(1); !ok || v != 10 {
+		t.Errorf("Get(1) = %d, %v after Touch extended it", v, ok)
+	}
+	if !c.Touch(2, time.Second) {
+		t.Fatal("Touch missed a key without a TTL")
+	}
+	if !c.Touch(1, 0) {
+		t.Fatal("Touch missed a live key")
+	}
+	clock.Advance(time.Hour)
+	if c.Contains(2) {
+		t.Error("Touch did not give key 2 a TTL")
+	}
+	if !c.Contains(1) {
+		t.Error("Touch with no TTL left key 1 expiring")
+	}
+	if c.Touch(2, time.Minute) || c.Touch(3, time.Minute) {
+		t.Error("Touch reported an expired or missing key")
+	}
+}
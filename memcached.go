@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// memcachedMaxKey is the protocol's limit on key length.
+	memcachedMaxKey = 250
+	// memcachedMaxLine bounds a command line, keys included.
+	memcachedMaxLine = 4096
+	// memcachedMaxValue bounds a data block. Values are cache ints, so
+	// anything near this is already unstorable.
+	memcachedMaxValue = 1 << 20
+	// memcachedRelativeLimit is the largest exptime taken as seconds from
+	// now; larger ones are Unix times.
+	memcachedRelativeLimit = 30 * 24 * 60 * 60
+)
+
+// MemcachedServer serves a SecureLRUCache over the memcached text protocol:
+// get, gets, set, add, replace, delete, touch, flush_all, stats, version
+// and quit. String keys are mapped onto the cache's int keys by keys and
+// values by values, so with the default DecimalCodec only decimal integers
+// can be stored. Flags are not kept and read back as 0, and the CAS value
+// gets reports is a hash of the value, since cas itself is not supported.
+type MemcachedServer struct {
+	cache  *SecureLRUCache
+	keys   func(key string) int
+	values ValueCodec
+	conns  connServer
+}
+
+// NewMemcachedServer serves cache. keys defaults to HashKey and values to
+// DecimalCodec when nil.
+func NewMemcachedServer(cache *SecureLRUCache, keys func(key string) int, values ValueCodec) (*MemcachedServer, error) {
+	if cache == nil {
+		return nil, fmt.Errorf("cache must not be nil")
+	}
+	if keys == nil {
+		keys = HashKey
+	}
+	if values == nil {
+		values = DecimalCodec{}
+	}
+	return &MemcachedServer{cache: cache, keys: keys, values: values}, nil
+}
+
+// Serve accepts connections on ln until Close, serving each on its own
+// goroutine. It returns nil once closed.
+func (s *MemcachedServer) Serve(ln net.Listener) error {
+	return s.conns.serve(ln, func(conn net.Conn) { s.ServeConn(conn) })
+}
+
+// Close stops Serve, closes every open connection and waits for their
+// goroutines to finish. It does not close the cache.
+func (s *MemcachedServer) Close() error {
+	return s.conns.close()
+}
+
+// ServeConn runs the protocol on conn until the client quits or the
+// connection fails, then closes it. Replies are flushed whenever no further
+// pipelined command is already buffered.
+func (s *MemcachedServer) ServeConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+	r := bufio.NewReaderSize(conn, memcachedMaxLine)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := readLine(r)
+		if errors.Is(err, errLineTooLong) {
+			w.WriteString("CLIENT_ERROR line too long\r\n")
+			w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		if !s.handle(line, r, w) {
+			w.Flush()
+			return
+		}
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handle runs one command, reporting false if the connection should close.
+func (s *MemcachedServer) handle(line []byte, r *bufio.Reader, w *bufio.Writer) bool {
+	fields := bytes.Fields(line)
+	if len(fields) == 0 {
+		w.WriteString("ERROR\r\n")
+		return true
+	}
+	args := make([]string, len(fields)-1)
+	for i, f := range fields[1:] {
+		args[i] = string(f)
+	}
+
+	switch cmd := string(fields[0]); cmd {
+	case "get", "gets":
+		s.get(args, cmd == "gets", w)
+	case "set", "add", "replace":
+		return s.store(cmd, args, r, w)
+	case "delete":
+		s.delete(args, w)
+	case "touch":
+		s.touch(args, w)
+	case "flush_all":
+		s.flushAll(args, w)
+	case "stats":
+		s.stats(args, w)
+	case "version":
+		w.WriteString("VERSION lru-cache\r\n")
+	case "quit":
+		return false
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return true
+}
+
+func validMemcachedKey(key string) bool {
+	if len(key) == 0 || len(key) > memcachedMaxKey {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// noreply strips a trailing "noreply" from args, reporting whether it was
+// there.
+func noreply(args []string) ([]string, bool) {
+	if n := len(args); n > 0 && args[n-1] == "noreply" {
+		return args[:n-1], true
+	}
+	return args, false
+}
+
+func (s *MemcachedServer) get(keys []string, withCAS bool, w *bufio.Writer) {
+	if len(keys) == 0 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	for _, key := range keys {
+		if !validMemcachedKey(key) {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return
+		}
+	}
+	for _, key := range keys {
+		value, ok := s.cache.Get(s.keys(key))
+		if !ok {
+			continue
+		}
+		data, err := s.values.Decode(value)
+		if err != nil {
+			continue
+		}
+		if withCAS {
+			h := fnv.New64a()
+			h.Write(data)
+			fmt.Fprintf(w, "VALUE %s 0 %d %d\r\n", key, len(data), h.Sum64())
+		} else {
+			fmt.Fprintf(w, "VALUE %s 0 %d\r\n", key, len(data))
+		}
+		w.Write(data)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
+
+// store runs set, add or replace: "<cmd> <key> <flags> <exptime> <bytes>
+// [noreply]" followed by the data block.
+func (s *MemcachedServer) store(cmd string, args []string, r *bufio.Reader, w *bufio.Writer) bool {
+	args, quiet := noreply(args)
+	reply := func(msg string) {
+		if !quiet {
+			w.WriteString(msg)
+		}
+	}
+	if len(args) != 4 || !validMemcachedKey(args[0]) {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return true
+	}
+	_, flagsErr := strconv.ParseUint(args[1], 10, 32)
+	exptime, expErr := strconv.ParseInt(args[2], 10, 64)
+	n, sizeErr := strconv.Atoi(args[3])
+	if flagsErr != nil || expErr != nil || sizeErr != nil || n < 0 {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return true
+	}
+	if n > memcachedMaxValue {
+		// The block cannot be skipped safely, so drop the connection.
+		w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return false
+	}
+
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return false
+	}
+	if !bytes.HasSuffix(data, []byte("\r\n")) {
+		w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return true
+	}
+	value, err := s.values.Encode(data[:n])
+	if err != nil {
+		reply("SERVER_ERROR cannot store value: " + err.Error() + "\r\n")
+		return true
+	}
+
+	key := s.keys(args[0])
+	ttl, expired := s.ttl(exptime)
+	cond := map[string]writeCond{"set": writeAlways, "add": writeIfAbsent, "replace": writeIfPresent}[cmd]
+	if expired {
+		// The item would be gone at once: store nothing, but see that
+		// an existing entry does not outlive the write.
+		_, live := s.cache.Peek(key)
+		if (cond == writeIfAbsent && live) || (cond == writeIfPresent && !live) {
+			reply("NOT_STORED\r\n")
+			return true
+		}
+		s.cache.Remove(key)
+		reply("STORED\r\n")
+		return true
+	}
+	_, _, written, err := s.cache.writeIf(key, value, 1, ttl, cond)
+	switch {
+	case err != nil:
+		reply("SERVER_ERROR " + err.Error() + "\r\n")
+	case written:
+		reply("STORED\r\n")
+	default:
+		reply("NOT_STORED\r\n")
+	}
+	return true
+}
+
+// ttl converts a protocol exptime: 0 is no expiry, up to 30 days is seconds
+// from now, anything larger a Unix time, and negative already expired.
+func (s *MemcachedServer) ttl(exptime int64) (ttl time.Duration, expired bool) {
+	switch {
+	case exptime == 0:
+		return 0, false
+	case exptime < 0:
+		return 0, true
+	case exptime <= memcachedRelativeLimit:
+		return time.Duration(exptime) * time.Second, false
+	}
+	ttl = time.Unix(exptime, 0).Sub(s.cache.clock.Now())
+	return ttl, ttl <= 0
+}
+
+func (s *MemcachedServer) delete(args []string, w *bufio.Writer) {
+	args, quiet := noreply(args)
+	if len(args) != 1 || !validMemcachedKey(args[0]) {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+	removed := s.cache.Remove(s.keys(args[0]))
+	switch {
+	case quiet:
+	case removed:
+		w.WriteString("DELETED\r\n")
+	default:
+		w.WriteString("NOT_FOUND\r\n")
+	}
+}
+
+func (s *MemcachedServer) touch(args []string, w *bufio.Writer) {
+	args, quiet := noreply(args)
+	if len(args) != 2 || !validMemcachedKey(args[0]) {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR invalid exptime argument\r\n")
+		return
+	}
+	key := s.keys(args[0])
+	var touched bool
+	if ttl, expired := s.ttl(exptime); expired {
+		touched = s.cache.Remove(key)
+	} else {
+		touched = s.cache.Touch(key, ttl)
+	}
+	switch {
+	case quiet:
+	case touched:
+		w.WriteString("TOUCHED\r\n")
+	default:
+		w.WriteString("NOT_FOUND\r\n")
+	}
+}
+
+// flushAll empties the cache. A delayed flush is not supported.
+func (s *MemcachedServer) flushAll(args []string, w *bufio.Writer) {
+	args, quiet := noreply(args)
+	if len(args) > 1 {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+	if len(args) == 1 {
+		if delay, err := strconv.Atoi(args[0]); err != nil || delay != 0 {
+			w.WriteString("CLIENT_ERROR delayed flush_all is not supported\r\n")
+			return
+		}
+	}
+	s.cache.Clear()
+	if !quiet {
+		w.WriteString("OK\r\n")
+	}
+}
+
+// stats reports Stats under the names memcached uses for them.
+func (s *MemcachedServer) stats(args []string, w *bufio.Writer) {
+	if len(args) > 0 {
+		// Only the general group exists.
+		w.WriteString("END\r\n")
+		return
+	}
+	st := s.cache.Stats()
+	for _, stat := range []struct {
+		name  string
+		value int64
+	}{
+		{"curr_items", int64(st.Size)},
+		{"total_items", st.Puts + st.Updates},
+		{"limit_maxitems", int64(st.Capacity)},
+		{"get_hits", st.Hits},
+		{"get_misses", st.Misses},
+		{"cmd_get", st.Hits + st.Misses},
+		{"evictions", st.Evictions},
+		{"reclaimed", st.Expirations},
+		{"bytes", st.MemoryBytes},
+	} {
+		fmt.Fprintf(w, "STAT %s %d\r\n", stat.name, stat.value)
+	}
+	w.WriteString("END\r\n")
+}
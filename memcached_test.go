@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memcachedClient is a raw client on one end of a net.Pipe whose other end
+// a MemcachedServer is serving.
+type memcachedClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newMemcachedClient(t *testing.T, c *SecureLRUCache) *memcachedClient {
+	t.Helper()
+	srv, err := NewMemcachedServer(c, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.ServeConn(server)
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+	return &memcachedClient{t: t, conn: client, r: bufio.NewReader(client)}
+}
+
+// exchange sends req and asserts the server answers exactly want.
+func (m *memcachedClient) exchange(req, want string) {
+	m.t.Helper()
+	m.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	// net.Pipe is unbuffered: write from another goroutine so a reply the
+	// server flushes mid-request cannot deadlock the test.
+	go io.WriteString(m.conn, req)
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(m.r, got); err != nil {
+		m.t.Fatalf("%q: read %q: %v", req, got, err)
+	}
+	if string(got) != want {
+		m.t.Fatalf("%q: got %q, want %q", req, got, want)
+	}
+}
+
+func TestMemcachedStorageCommands(t *testing.T) {
+	m := newMemcachedClient(t, newTestCache(t, 8))
+
+	m.exchange("get a\r\n", "END\r\n")
+	m.exchange("set a 0 0 2\r\n10\r\n", "STORED\r\n")
+	m.exchange("get a\r\n", "VALUE a 0 2\r\n10\r\nEND\r\n")
+	m.exchange("add a 0 0 2\r\n20\r\n", "NOT_STORED\r\n")
+	m.exchange("replace b 0 0 2\r\n20\r\n", "NOT_STORED\r\n")
+	m.exchange("add b 0 0 2\r\n20\r\n", "STORED\r\n")
+	m.exchange("replace a 0 0 2\r\n11\r\n", "STORED\r\n")
+	m.exchange("get a b c\r\n", "VALUE a 0 2\r\n11\r\nVALUE b 0 2\r\n20\r\nEND\r\n")
+	m.exchange("delete a\r\n", "DELETED\r\n")
+	m.exchange("delete a\r\n", "NOT_FOUND\r\n")
+	m.exchange("get a\r\n", "END\r\n")
+	m.exchange("version\r\n", "VERSION lru-cache\r\n")
+}
+
+func TestMemcachedGetsReportsValueHash(t *testing.T) {
+	m := newMemcachedClient(t, newTestCache(t, 8))
+	m.exchange("set a 0 0 2\r\n10\r\nset b 0 0 2\r\n10\r\nset c 0 0 2\r\n12\r\n", "STORED\r\nSTORED\r\nSTORED\r\n")
+
+	cas := func(key string) string {
+		t.Helper()
+		m.conn.SetDeadline(time.Now().Add(5 * time.Second))
+		go io.WriteString(m.conn, "gets "+key+"\r\n")
+		header, err := m.r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 5 || fields[0] != "VALUE" || fields[1] != key {
+			t.Fatalf("gets %s: header %q", key, header)
+		}
+		if _, err := strconv.ParseUint(fields[4], 10, 64); err != nil {
+			t.Fatalf("gets %s: cas %q is not a number", key, fields[4])
+		}
+		rest := make([]byte, len("10\r\nEND\r\n"))
+		io.ReadFull(m.r, rest)
+		return fields[4]
+	}
+	if cas("a") != cas("b") {
+		t.Error("equal values report different cas values")
+	}
+	if cas("a") == cas("c") {
+		t.Error("different values report the same cas value")
+	}
+}
+
+func TestMemcachedExpiration(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 8, WithClock(clock))
+	m := newMemcachedClient(t, c)
+
+	m.exchange("set a 0 10 1\r\n1\r\n", "STORED\r\n")
+	m.exchange("set forever 0 0 1\r\n2\r\n", "STORED\r\n")
+	clock.Advance(9 * time.Second)
+	m.exchange("touch a 10\r\n", "TOUCHED\r\n")
+	clock.Advance(9 * time.Second)
+	m.exchange("get a\r\n", "VALUE a 0 1\r\n1\r\nEND\r\n")
+	clock.Advance(2 * time.Second)
+	m.exchange("get a forever\r\n", "VALUE forever 0 1\r\n2\r\nEND\r\n")
+	m.exchange("touch a 10\r\n", "NOT_FOUND\r\n")
+
+	// Past 30 days exptime is a Unix time.
+	abs := clock.Now().Add(time.Hour).Unix()
+	m.exchange("set b 0 "+strconv.FormatInt(abs, 10)+" 1\r\n3\r\n", "STORED\r\n")
+	clock.Advance(59 * time.Minute)
+	m.exchange("get b\r\n", "VALUE b 0 1\r\n3\r\nEND\r\n")
+	clock.Advance(time.Minute)
+	m.exchange("get b\r\n", "END\r\n")
+
+	// A negative exptime is already expired, so an existing entry goes.
+	m.exchange("set forever 0 -1 1\r\n5\r\n", "STORED\r\n")
+	m.exchange("get forever\r\n", "END\r\n")
+	m.exchange("add c 0 -1 1\r\n5\r\n", "STORED\r\n")
+	m.exchange("get c\r\n", "END\r\n")
+	m.exchange("set d 0 0 1\r\n6\r\n", "STORED\r\n")
+	m.exchange("touch d -1\r\n", "TOUCHED\r\n")
+	m.exchange("get d\r\n", "END\r\n")
+}
+
+func TestMemcachedMalformedCommands(t *testing.T) {
+	m := newMemcachedClient(t, newTestCache(t, 8))
+	long := strings.Repeat("k", memcachedMaxKey+1)
+
+	for _, tc := range []struct{ req, want string }{
+		{"\r\n", "ERROR\r\n"},
+		{"bogus\r\n", "ERROR\r\n"},
+		{"get\r\n", "ERROR\r\n"},
+		{"get " + long + "\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		{"set a 0 0\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		{"set a x 0 1\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		{"set a 0 0 -1\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		{"set " + long + " 0 0 1\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		// The block is read to its declared length, so the rest is then
+		// taken as a command.
+		{"set a 0 0 1\r\n12\r\n", "CLIENT_ERROR bad data chunk\r\nERROR\r\n"},
+		{"set a 0 0 3\r\nabc\r\n", "SERVER_ERROR cannot store value: strconv.Atoi: parsing \"abc\": invalid syntax\r\n"},
+		{"delete\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		{"touch a\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		{"touch a soon\r\n", "CLIENT_ERROR invalid exptime argument\r\n"},
+		{"flush_all 10\r\n", "CLIENT_ERROR delayed flush_all is not supported\r\n"},
+	} {
+		m.exchange(tc.req, tc.want)
+	}
+	// The connection is still usable.
+	m.exchange("set a 0 0 1\r\n1\r\nget a\r\n", "STORED\r\nVALUE a 0 1\r\n1\r\nEND\r\n")
+}
+
+func TestMemcachedNoreplyAndPipelining(t *testing.T) {
+	m := newMemcachedClient(t, newTestCache(t, 8))
+	m.exchange("set a 0 0 1 noreply\r\n1\r\n"+
+		"add a 0 0 1 noreply\r\n2\r\n"+
+		"set b 0 0 1 noreply\r\n3\r\n"+
+		"delete b noreply\r\n"+
+		"touch a 100 noreply\r\n"+
+		"get a b\r\n",
+		"VALUE a 0 1\r\n1\r\nEND\r\n")
+	m.exchange("flush_all noreply\r\nget a\r\n", "END\r\n")
+}
+
+func TestMemcachedFlushAllAndStats(t *testing.T) {
+	m := newMemcachedClient(t, newTestCache(t, 2))
+	m.exchange("set a 0 0 1\r\n1\r\nset b 0 0 1\r\n2\r\nset c 0 0 1\r\n3\r\n", "STORED\r\nSTORED\r\nSTORED\r\n")
+	m.exchange("get a c\r\n", "VALUE c 0 1\r\n3\r\nEND\r\n")
+	m.exchange("stats\r\n", "STAT curr_items 2\r\n"+
+		"STAT total_items 3\r\n"+
+		"STAT limit_maxitems 2\r\n"+
+		"STAT get_hits 1\r\n"+
+		"STAT get_misses 1\r\n"+
+		"STAT cmd_get 2\r\n"+
+		"STAT evictions 1\r\n"+
+		"STAT reclaimed 0\r\n")
+	// bytes depends on the entry layout; read past it.
+	line, err := m.r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "STAT bytes ") {
+		t.Fatalf("stats: got %q, %v", line, err)
+	}
+	m.exchange("", "END\r\n")
+	m.exchange("stats items\r\n", "END\r\n")
+
+	m.exchange("flush_all\r\n", "OK\r\n")
+	m.exchange("flush_all 0\r\n", "OK\r\n")
+	m.exchange("get b c\r\n", "END\r\n")
+}
+
+func TestMemcachedQuitAndLongLineClose(t *testing.T) {
+	m := newMemcachedClient(t, newTestCache(t, 2))
+	m.exchange("quit\r\n", "")
+	if _, err := m.r.ReadByte(); err != io.EOF {
+		t.Errorf("after quit: %v, want EOF", err)
+	}
+
+	m = newMemcachedClient(t, newTestCache(t, 2))
+	m.exchange(strings.Repeat("x", memcachedMaxLine+10), "CLIENT_ERROR line too long\r\n")
+	if _, err := m.r.ReadByte(); err != io.EOF {
+		t.Errorf("after an overlong line: %v, want EOF", err)
+	}
+}
+
+func TestMemcachedServeOverTCP(t *testing.T) {
+	c := newTestCache(t, 8)
+	srv, err := NewMemcachedServer(c, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+
+	conns := make([]net.Conn, 3)
+	for i := range conns {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+		key := strconv.Itoa(i)
+		io.WriteString(conn, "set k"+key+" 0 0 1\r\n"+key+"\r\n")
+	}
+	for i, conn := range conns {
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(conn)
+		if line, err := r.ReadString('\n'); line != "STORED\r\n" {
+			t.Fatalf("conn %d: %q, %v", i, line, err)
+		}
+	}
+	if got := c.Size(); got != 3 {
+		t.Errorf("Size = %d, want 3", got)
+	}
+
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve = %v, want nil after Close", err)
+	}
+	// Close dropped the idle connections.
+	for i, conn := range conns {
+		if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Errorf("conn %d still open after Close", i)
+		}
+	}
+}
+
+func TestServeMemcachedUntilCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addrs := make(chan string, 1)
+	code := make(chan int, 1)
+	var stderr bytes.Buffer
+	go func() {
+		code <- serveMemcached(ctx, []string{"-addr", "127.0.0.1:0", "-capacity", "2"}, &stderr, func(addr string) { addrs <- addr })
+	}()
+	conn, err := net.Dial("tcp", <-addrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "set a 0 0 2\r\n42\r\nget a\r\n")
+	want := "STORED\r\nVALUE a 0 2\r\n42\r\nEND\r\n"
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil || string(got) != want {
+		t.Errorf("got %q, %v", got, err)
+	}
+
+	cancel()
+	if got := <-code; got != 0 {
+		t.Errorf("serveMemcached exited %d: %s", got, stderr.String())
+	}
+	for _, args := range [][]string{{"-capacity", "0"}, {"extra"}} {
+		if got := serveMemcached(context.Background(), args, io.Discard, nil); got != 2 {
+			t.Errorf("serveMemcached %v = %d, want 2", args, got)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// MarshalMsgpack encodes the cache's Dump as a MessagePack map with the same
+// field names as the JSON form. Keys and values stay integers, and expiry
+// times are Unix nanoseconds. Policy state beyond the order and LFU
+// frequencies is not kept.
+func (c *SecureLRUCache) MarshalMsgpack() ([]byte, error) {
+	if err := c.snapshotAllowed(); err != nil {
+		return nil, err
+	}
+	return c.Dump().appendMsgpack(nil), nil
+}
+
+// UnmarshalMsgpack restores a dump written by MarshalMsgpack, with the same
+// rules as UnmarshalJSON. Fields it does not know are skipped.
+func (c *SecureLRUCache) UnmarshalMsgpack(data []byte) error {
+	d, err := decodeMsgpackDump(data)
+	if err != nil {
+		return err
+	}
+	return c.restoreDump(d)
+}
+
+func (d CacheDump) appendMsgpack(buf []byte) []byte {
+	fields := 5
+	if len(d.Tombstones) > 0 {
+		fields++
+	}
+	if len(d.Expires) > 0 {
+		fields++
+	}
+	if len(d.Frequencies) > 0 {
+		fields++
+	}
+	if len(d.Costs) > 0 {
+		fields++
+	}
+	if d.MaxCost > 0 {
+		fields += 2
+	}
+
+	buf = appendMsgpackMapHeader(buf, fields)
+	buf = appendMsgpackString(buf, "version")
+	buf = appendMsgpackInt(buf, int64(d.Version))
+	buf = appendMsgpackString(buf, "capacity")
+	buf = appendMsgpackInt(buf, int64(d.Capacity))
+	buf = appendMsgpackString(buf, "size")
+	buf = appendMsgpackInt(buf, int64(d.Size))
+	buf = appendMsgpackString(buf, "items")
+	buf = appendMsgpackIntMap(buf, d.Items)
+	buf = appendMsgpackString(buf, "order")
+	buf = appendMsgpackIntArray(buf, d.Order)
+	if len(d.Tombstones) > 0 {
+		buf = appendMsgpackString(buf, "tombstones")
+		buf = appendMsgpackIntArray(buf, d.Tombstones)
+	}
+	if len(d.Expires) > 0 {
+		expires := make(map[int]int, len(d.Expires))
+		for key, at := range d.Expires {
+			expires[key] = int(at.UnixNano())
+		}
+		buf = appendMsgpackString(buf, "expires")
+		buf = appendMsgpackIntMap(buf, expires)
+	}
+	if len(d.Frequencies) > 0 {
+		buf = appendMsgpackString(buf, "frequencies")
+		buf = appendMsgpackIntMap(buf, d.Frequencies)
+	}
+	if len(d.Costs) > 0 {
+		costs := make(map[int]int, len(d.Costs))
+		for key, cost := range d.Costs {
+			costs[key] = int(cost)
+		}
+		buf = appendMsgpackString(buf, "costs")
+		buf = appendMsgpackIntMap(buf, costs)
+	}
+	if d.MaxCost > 0 {
+		buf = appendMsgpackString(buf, "total_cost")
+		buf = appendMsgpackInt(buf, d.TotalCost)
+		buf = appendMsgpackString(buf, "max_cost")
+		buf = appendMsgpackInt(buf, d.MaxCost)
+	}
+	return buf
+}
+
+func decodeMsgpackDump(data []byte) (CacheDump, error) {
+	var d CacheDump
+	r := &msgpackReader{data: data}
+	n, err := r.mapHeader()
+	if err != nil {
+		return d, err
+	}
+	for i := 0; i < n; i++ {
+		field, err := r.readString()
+		if err != nil {
+			return d, err
+		}
+		switch field {
+		case "version":
+			d.Version, err = r.readInt()
+		case "capacity":
+			d.Capacity, err = r.readInt()
+		case "size":
+			d.Size, err = r.readInt()
+		case "items":
+			d.Items, err = r.intMap()
+		case "order":
+			d.Order, err = r.intArray()
+		case "tombstones":
+			d.Tombstones, err = r.intArray()
+		case "expires":
+			var expires map[int]int
+			if expires, err = r.intMap(); err == nil {
+				d.Expires = make(map[int]time.Time, len(expires))
+				for key, at := range expires {
+					d.Expires[key] = time.Unix(0, int64(at))
+				}
+			}
+		case "frequencies":
+			d.Frequencies, err = r.intMap()
+		case "costs":
+			var costs map[int]int
+			if costs, err = r.intMap(); err == nil {
+				d.Costs = make(map[int]int64, len(costs))
+				for key, cost := range costs {
+					d.Costs[key] = int64(cost)
+				}
+			}
+		case "total_cost":
+			var cost int
+			cost, err = r.readInt()
+			d.TotalCost = int64(cost)
+		case "max_cost":
+			var cost int
+			cost, err = r.readInt()
+			d.MaxCost = int64(cost)
+		default:
+			err = r.skip()
+		}
+		if err != nil {
+			return d, fmt.Errorf("msgpack dump field %q: %w", field, err)
+		}
+	}
+	if r.pos != len(data) {
+		return d, fmt.Errorf("unexpected data after the msgpack dump")
+	}
+	if d.Items == nil {
+		d.Items = map[int]int{}
+	}
+	return d, nil
+}
+
+func appendMsgpackMapHeader(buf []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(buf, 0xde, byte(n>>8), byte(n))
+	}
+	return append(buf, 0xdf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendMsgpackArrayHeader(buf []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(buf, 0xdc, byte(n>>8), byte(n))
+	}
+	return append(buf, 0xdd, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	// Field names are all short enough for a fixstr.
+	buf = append(buf, 0xa0|byte(len(s)))
+	return append(buf, s...)
+}
+
+// appendMsgpackInt writes v in the smallest integer encoding that holds it.
+func appendMsgpackInt(buf []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v < 128:
+		return append(buf, byte(v))
+	case v < 0 && v >= -32:
+		return append(buf, byte(v))
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		return append(buf, 0xd0, byte(v))
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return append(buf, 0xd1, byte(v>>8), byte(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return append(buf, 0xd2, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return append(buf, 0xd3, byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+		byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendMsgpackIntArray(buf []byte, values []int) []byte {
+	buf = appendMsgpackArrayHeader(buf, len(values))
+	for _, v := range values {
+		buf = appendMsgpackInt(buf, int64(v))
+	}
+	return buf
+}
+
+// appendMsgpackIntMap writes m with its keys sorted, so a dump always encodes
+// the same way.
+func appendMsgpackIntMap(buf []byte, m map[int]int) []byte {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	buf = appendMsgpackMapHeader(buf, len(m))
+	for _, key := range keys {
+		buf = appendMsgpackInt(buf, int64(key))
+		buf = appendMsgpackInt(buf, int64(m[key]))
+	}
+	return buf
+}
+
+// msgpackReader decodes the subset of MessagePack a dump uses, and can skip
+// any other value.
+type msgpackReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.data)-r.pos < n {
+		return nil, fmt.Errorf("msgpack data is truncated")
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *msgpackReader) readByte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *msgpackReader) readUint(n int) (uint64, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+	return v, nil
+}
+
+func (r *msgpackReader) readInt() (int, error) {
+	t, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	var v int64
+	switch {
+	case t < 0x80:
+		return int(t), nil
+	case t >= 0xe0:
+		return int(int8(t)), nil
+	case t >= 0xcc && t <= 0xcf:
+		u, err := r.readUint(1 << (t - 0xcc))
+		if err != nil {
+			return 0, err
+		}
+		if u > math.MaxInt {
+			return 0, fmt.Errorf("msgpack integer %d does not fit in int", u)
+		}
+		return int(u), nil
+	case t >= 0xd0 && t <= 0xd3:
+		size := 1 << (t - 0xd0)
+		u, err := r.readUint(size)
+		if err != nil {
+			return 0, err
+		}
+		// Sign-extend from the encoded width.
+		shift := 64 - 8*size
+		v = int64(u<<shift) >> shift
+	default:
+		return 0, fmt.Errorf("msgpack type %#x is not an integer", t)
+	}
+	if int64(int(v)) != v {
+		return 0, fmt.Errorf("msgpack integer %d does not fit in int", v)
+	}
+	return int(v), nil
+}
+
+func (r *msgpackReader) length(t byte, fix, fixMask, b8, b16, b32 byte) (int, bool, error) {
+	var n uint64
+	var err error
+	switch {
+	case t&^fixMask == fix:
+		return int(t & fixMask), true, nil
+	case b8 != 0 && t == b8:
+		n, err = r.readUint(1)
+	case t == b16:
+		n, err = r.readUint(2)
+	case t == b32:
+		n, err = r.readUint(4)
+	default:
+		return 0, false, nil
+	}
+	return int(n), true, err
+}
+
+func (r *msgpackReader) readString() (string, error) {
+	t, err := r.readByte()
+	if err != nil {
+		return "", err
+	}
+	n, ok, err := r.length(t, 0xa0, 0x1f, 0xd9, 0xda, 0xdb)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("msgpack type %#x is not a string", t)
+	}
+	b, err := r.next(n)
+	return string(b), err
+}
+
+func (r *msgpackReader) mapHeader() (int, error) {
+	t, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	n, ok, err := r.length(t, 0x80, 0x0f, 0, 0xde, 0xdf)
+	if err == nil && !ok {
+		err = fmt.Errorf("msgpack type %#x is not a map", t)
+	}
+	return n, err
+}
+
+func (r *msgpackReader) arrayHeader() (int, error) {
+	t, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	n, ok, err := r.length(t, 0x90, 0x0f, 0, 0xdc, 0xdd)
+	if err == nil && !ok {
+		err = fmt.Errorf("msgpack type %#x is not an array", t)
+	}
+	return n, err
+}
+
+func (r *msgpackReader) intArray() ([]int, error) {
+	n, err := r.arrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	// Every element takes at least a byte, which bounds the allocation.
+	if n > len(r.data)-r.pos {
+		return nil, fmt.Errorf("msgpack data is truncated")
+	}
+	values := make([]int, n)
+	for i := range values {
+		if values[i], err = r.readInt(); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (r *msgpackReader) intMap() (map[int]int, error) {
+	n, err := r.mapHeader()
+	if err != nil {
+		return nil, err
+	}
+	if n > (len(r.data)-r.pos)/2 {
+		return nil, fmt.Errorf("msgpack data is truncated")
+	}
+	m := make(map[int]int, n)
+	for i := 0; i < n; i++ {
+		key, err := r.readInt()
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.readInt()
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// skip steps over one value of any type.
+func (r *msgpackReader) skip() error {
+	t, err := r.readByte()
+	if err != nil {
+		return err
+	}
+	var n int
+	var ok bool
+	switch {
+	case t < 0x80 || t >= 0xe0 || t == 0xc0 || t == 0xc2 || t == 0xc3:
+		return nil
+	case t >= 0xcc && t <= 0xcf:
+		_, err = r.next(1 << (t - 0xcc))
+		return err
+	case t >= 0xd0 && t <= 0xd3:
+		_, err = r.next(1 << (t - 0xd0))
+		return err
+	case t == 0xca:
+		_, err = r.next(4)
+		return err
+	case t == 0xcb:
+		_, err = r.next(8)
+		return err
+	case t >= 0xd4 && t <= 0xd8:
+		_, err = r.next(1 + 1<<(t-0xd4))
+		return err
+	case t >= 0xc7 && t <= 0xc9:
+		if n, err = r.lengthOf(1 << (t - 0xc7)); err == nil {
+			_, err = r.next(n + 1)
+		}
+		return err
+	case t >= 0xc4 && t <= 0xc6:
+		if n, err = r.lengthOf(1 << (t - 0xc4)); err == nil {
+			_, err = r.next(n)
+		}
+		return err
+	}
+	if n, ok, err = r.length(t, 0xa0, 0x1f, 0xd9, 0xda, 0xdb); ok || err != nil {
+		if err == nil {
+			_, err = r.next(n)
+		}
+		return err
+	}
+	if n, ok, err = r.length(t, 0x90, 0x0f, 0, 0xdc, 0xdd); ok || err != nil {
+		for i := 0; i < n && err == nil; i++ {
+			err = r.skip()
+		}
+		return err
+	}
+	if n, ok, err = r.length(t, 0x80, 0x0f, 0, 0xde, 0xdf); ok || err != nil {
+		for i := 0; i < 2*n && err == nil; i++ {
+			err = r.skip()
+		}
+		return err
+	}
+	return fmt.Errorf("msgpack type %#x is not valid", t)
+}
+
+func (r *msgpackReader) lengthOf(size int) (int, error) {
+	n, err := r.readUint(size)
+	return int(n), err
+}
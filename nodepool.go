@@ -0,0 +1,127 @@
+package main
+
+import "time"
+
+// slabChunk is how many nodes WithDenseStorage allocates at a time.
+const slabChunk = 1024
+
+// WithDenseStorage allocates nodes in contiguous chunks of 1024 owned by the
+// cache and recycles them through a free list, rather than one heap object
+// per entry drawn from a pool. Neighbouring entries then share cache
+// lines, and the collector tracks a few large objects instead of one per
+// entry. Nodes keep their pointer links, since policies are handed nodes by
+// pointer, so the collector still scans them.
+func WithDenseStorage() Option {
+	return func(c *SecureLRUCache) error {
+		c.slab = &nodeSlab{}
+		return nil
+	}
+}
+
+type nodeSlab struct {
+	// unused is what is left of the newest chunk.
+	unused []Node
+	free   []*Node
+}
+
+func (s *nodeSlab) get() *Node {
+	if n := len(s.free); n > 0 {
+		node := s.free[n-1]
+		s.free = s.free[:n-1]
+		return node
+	}
+	if len(s.unused) == 0 {
+		s.unused = make([]Node, slabChunk)
+	}
+	node := &s.unused[0]
+	s.unused = s.unused[1:]
+	return node
+}
+
+// newNode returns a zeroed node. The caller must hold the write lock.
+func (c *SecureLRUCache) newNode() *Node {
+	if c.slab != nil {
+		return c.slab.get()
+	}
+	if node, ok := c.nodes.Get().(*Node); ok {
+		return node
+	}
+	return new(Node)
+}
+
+// releaseNode zeroes node, so that it holds on to nothing from its old entry,
+// and recycles it. The caller must hold the write lock and be done with the
+// node: nothing may read it once it has been released. Buffered promotions
+// are applied first, so that the buffer cannot point at a recycled node, and
+// nodes are recycled only within their own cache.
+func (c *SecureLRUCache) releaseNode(node *Node) {
+	c.applyPromotions()
+	*node = Node{}
+	if c.slab != nil {
+		c.slab.free = append(c.slab.free, node)
+		return
+	}
+	c.nodes.Put(node)
+}
+
+// dropAll recycles the nodes of a key map the cache has just swapped out, as
+// Clear and Restore do, so that the write lock is held for the swap alone:
+// a background worker, which Close waits for, reports the live entries to
+// WithOnEvict, then zeroes the nodes and returns them to the pool, or under
+// dense storage to the free list, which it takes the lock again for. A
+// cache that is closed or has no lock does it all before returning. The
+// caller holds the write lock.
+func (c *SecureLRUCache) dropAll(dropped map[int]*Node) {
+	if len(dropped) == 0 {
+		return
+	}
+	// Buffered promotions skip the dropped nodes, which are no longer
+	// mapped, but must not be left pointing at them.
+	c.applyPromotions()
+	now := c.clock.Now()
+	if c.closed || c.mu.off {
+		c.recycle(c.freeAll(dropped, now))
+		return
+	}
+	c.drains.Add(1)
+	go func() {
+		defer c.drains.Done()
+		if freed := c.freeAll(dropped, now); len(freed) > 0 {
+			c.mu.Lock()
+			c.recycle(freed)
+			c.unlock()
+		}
+	}()
+}
+
+// freeAll is dropAll's worker. It runs without the lock, which it does not
+// need, as nothing else refers to the dropped nodes. Entries live when they
+// were dropped, at now, are reported. The zeroed nodes go back to the pool,
+// or under dense storage are returned for the free list.
+func (c *SecureLRUCache) freeAll(dropped map[int]*Node, now time.Time) []*Node {
+	var freed []*Node
+	if c.slab != nil {
+		freed = make([]*Node, 0, len(dropped))
+	}
+	for _, node := range dropped {
+		live := !node.tombstone && (node.expiresAt.IsZero() || now.Before(node.expiresAt))
+		if live && c.hooks != nil && c.hooks.onEvict != nil {
+			c.hooks.onEvict(node.key, node.value, ReasonCleared)
+		}
+		*node = Node{}
+		if c.slab != nil {
+			freed = append(freed, node)
+		} else {
+			c.nodes.Put(node)
+		}
+	}
+	return freed
+}
+
+// recycle puts zeroed nodes on the dense storage free list. The caller holds
+// the write lock.
+func (c *SecureLRUCache) recycle(freed []*Node) {
+	if len(freed) > 0 {
+		c.slab.free = append(c.slab.free, freed...)
+	}
+}
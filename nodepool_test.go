@@ -0,0 +1,156 @@
+package main
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Nodes released by one cache must never be rewritten while a promotion
+// buffer, in that cache or another, still points at them.
+func TestNodeReuseWithAsyncPromotion(t *testing.T) {
+	// Interleave the goroutines even on a single CPU.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+
+	var caches []*SecureLRUCache
+	for range 2 {
+		c := newTestCache(t, 8, WithAsyncPromotion(4))
+		caches = append(caches, c)
+	}
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := caches[g%2]
+			r := rand.New(rand.NewSource(int64(g)))
+			for range 5000 {
+				k := r.Intn(16)
+				switch r.Intn(4) {
+				case 0:
+					c.Put(k, k*10)
+				case 1:
+					c.Remove(k)
+				case 2:
+					c.PutWithTTL(k, k*10, time.Microsecond)
+				default:
+					if v, ok := c.Get(k); ok && v != k*10 {
+						t.Errorf("Get(%d) = %d", k, v)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, c := range caches {
+		if err := c.CheckInvariants(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReleasedNodesHoldNothing(t *testing.T) {
+	c := newTestCache(t, 2)
+	c.Put(1, 100)
+	c.Put(2, 200)
+	c.Put(3, 300) // evicts 1
+	c.Remove(2)
+	c.Put(4, 400)
+	c.Put(5, 500)
+	if _, ok := c.Get(1); ok {
+		t.Fatal("evicted key 1 is back")
+	}
+	if _, ok := c.Get(2); ok {
+		t.Fatal("removed key 2 is back")
+	}
+	for key, want := range map[int]int{4: 400, 5: 500} {
+		if v, ok := c.Get(key); !ok || v != want {
+			t.Fatalf("Get(%d) = %d, %v", key, v, ok)
+		}
+	}
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClearRecyclesNodesOffTheLock(t *testing.T) {
+	for name, opts := range map[string][]Option{"pooled": nil, "dense": {WithDenseStorage()}} {
+		t.Run(name, func(t *testing.T) {
+			const entries = 3000
+			// The first report holds the drain up until the cache has been
+			// used with it still running.
+			var evicted atomic.Int64
+			holding, release := make(chan struct{}), make(chan struct{})
+			onEvict := WithOnEvict(func(key, value int, reason EvictReason) {
+				if evicted.Add(1) == 1 {
+					close(holding)
+					<-release
+				}
+			})
+			c := newTestCache(t, entries, append(opts, WithZeroize(), onEvict)...)
+			for k := range entries {
+				c.Put(k, k+1)
+			}
+			c.mu.RLock()
+			nodes := make(map[*Node]bool, entries)
+			for _, node := range c.cache {
+				nodes[node] = true
+			}
+			c.mu.RUnlock()
+
+			c.Clear()
+			<-holding
+			if c.Size() != 0 || len(c.Keys()) != 0 || c.Contains(1) {
+				t.Fatal("Clear returned before the cache was empty")
+			}
+			if _, ok := c.Get(1); ok || evicted.Load() != 1 {
+				t.Fatalf("Get(1) found a value with %d of the entries reported", evicted.Load())
+			}
+			close(release)
+			c.drains.Wait()
+			if evicted.Load() != entries {
+				t.Errorf("%d entries reported, want %d", evicted.Load(), entries)
+			}
+			for node := range nodes {
+				if !wiped(node) {
+					t.Fatalf("node left holding %+v", node)
+				}
+			}
+
+			for k := range entries {
+				c.Put(k, k)
+			}
+			if c.slab != nil {
+				c.mu.RLock()
+				for _, node := range c.cache {
+					if !nodes[node] {
+						t.Fatal("dense storage allocated nodes with the cleared ones free")
+					}
+				}
+				c.mu.RUnlock()
+			}
+			if v, ok := c.Get(1); !ok || v != 1 {
+				t.Errorf("Get(1) = %d, %v after the drain", v, ok)
+			}
+		})
+	}
+}
+
+func BenchmarkPutChurn(b *testing.B) {
+	c, err := NewSecureLRUCache(1000)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := range 1000 {
+		c.Put(i, i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Put(i+1000, i)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+// cursorAnchors is how many entries past the end of a page a Cursor
+// remembers, to resume from if the last entry of the page moves.
+const cursorAnchors = 4
+
+const cursorVersion = 1
+
+// Cursor is an opaque position in the order Keys lists entries in, safe to
+// hand to a client and back. The zero Cursor is the start, and the pages
+// return it again after the last page.
+type Cursor string
+
+type cursorAnchor struct {
+	key int
+	seq uint64
+}
+
+func encodeCursor(anchors []cursorAnchor) Cursor {
+	b := binary.AppendUvarint([]byte{cursorVersion}, uint64(len(anchors)))
+	for _, a := range anchors {
+		b = binary.AppendVarint(b, int64(a.key))
+		b = binary.AppendUvarint(b, a.seq)
+	}
+	return Cursor(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func decodeCursor(cursor Cursor) ([]cursorAnchor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(string(cursor))
+	if err != nil || len(b) == 0 || b[0] != cursorVersion {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	b = b[1:]
+	n, size := binary.Uvarint(b)
+	if size <= 0 || n == 0 || n > cursorAnchors+1 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	b = b[size:]
+	anchors := make([]cursorAnchor, n)
+	for i := range anchors {
+		key, size := binary.Varint(b)
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		b = b[size:]
+		seq, size := binary.Uvarint(b)
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		b = b[size:]
+		anchors[i] = cursorAnchor{key: int(key), seq: seq}
+	}
+	if len(b) != 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return anchors, nil
+}
+
+// KeysPage returns up to limit keys in the order Keys lists them, starting
+// at cursor, and the cursor of the next page. Only the page itself is copied
+// under the read lock, and with LRU, FIFO, MRU, LFU and SLRU the walk starts
+// at the cursor rather than at the most recent entry.
+//
+// Entries move between pages, so a listing is not a snapshot. An entry
+// inserted or promoted past the cursor is skipped rather than listed again,
+// and if the entry a page ended on has moved or gone, the next page resumes
+// at its nearest colder neighbour that has not. An entry that moves from
+// behind the cursor to in front of it is missed. Under LRU nothing is listed
+// twice; other policies can move an entry colder without a use, such as
+// SLRU's demotions and CLOCK's hand, which may list it again.
+func (c *SecureLRUCache) KeysPage(cursor Cursor, limit int) ([]int, Cursor, error) {
+	var keys []int
+	next, err := c.page(cursor, limit, func(node *Node) {
+		keys = append(keys, node.key)
+	})
+	return keys, next, err
+}
+
+// EntriesPage is KeysPage with the entries' values.
+func (c *SecureLRUCache) EntriesPage(cursor Cursor, limit int) ([]Entry, Cursor, error) {
+	var entries []Entry
+	next, err := c.page(cursor, limit, func(node *Node) {
+		entries = append(entries, Entry{Key: node.key, Value: node.value})
+	})
+	return entries, next, err
+}
+
+func (c *SecureLRUCache) page(cursor Cursor, limit int, add func(node *Node)) (Cursor, error) {
+	if limit < 1 {
+		return "", fmt.Errorf("limit must be at least 1")
+	}
+	anchors, err := decodeCursor(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	n := 0
+	var ahead []cursorAnchor
+	var last *Node
+	visit := func(node *Node) bool {
+		if !c.visible(node) {
+			return true
+		}
+		if n < limit {
+			add(node)
+			last = node
+			n++
+			return true
+		}
+		ahead = append(ahead, cursorAnchor{key: node.key, seq: node.seq})
+		return len(ahead) < cursorAnchors
+	}
+	c.resume(anchors, visit)
+
+	if len(ahead) == 0 {
+		return "", nil
+	}
+	return encodeCursor(append([]cursorAnchor{{key: last.key, seq: last.seq}}, ahead...)), nil
+}
+
+// resume walks the policy's order from the position anchors describe: after
+// the first anchor if it has not moved, else from the first later one that
+// has not, else every entry not moved since the first anchor was issued.
+// The caller holds the read lock.
+func (c *SecureLRUCache) resume(anchors []cursorAnchor, f func(node *Node) bool) {
+	if len(anchors) == 0 {
+		c.policy.Each(f)
+		return
+	}
+	unmoved := func(a cursorAnchor) *Node {
+		if node, ok := c.cache[a.key]; ok && node.seq == a.seq {
+			return node
+		}
+		return nil
+	}
+	if node := unmoved(anchors[0]); node != nil {
+		c.eachAfter(node, f)
+		return
+	}
+	for _, a := range anchors[1:] {
+		if node := unmoved(a); node != nil {
+			if f(node) {
+				c.eachAfter(node, f)
+			}
+			return
+		}
+	}
+	// Every anchor moved or went. Under LRU the entries colder than the
+	// cursor are exactly those that have not moved since.
+	seq := anchors[0].seq
+	c.policy.Each(func(node *Node) bool {
+		return node.seq >= seq || f(node)
+	})
+}
+
+// eachAfter visits the nodes after node in the policy's order, walking from
+// the start if the policy cannot resume. The caller holds the read lock.
+func (c *SecureLRUCache) eachAfter(node *Node, f func(node *Node) bool) {
+	if p, ok := c.policy.(ResumablePolicy); ok {
+		p.EachAfter(node, f)
+		return
+	}
+	passed := false
+	c.policy.Each(func(n *Node) bool {
+		if passed {
+			return f(n)
+		}
+		passed = n == node
+		return true
+	})
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"math/rand"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// allPages reads every page of c, limit keys at a time.
+func allPages(t *testing.T, c *SecureLRUCache, limit int) []int {
+	t.Helper()
+	var all []int
+	var cursor Cursor
+	for range 1 << 20 {
+		keys, next, err := c.KeysPage(cursor, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) > limit {
+			t.Fatalf("page of %d keys for limit %d", len(keys), limit)
+		}
+		all = append(all, keys...)
+		if next == "" {
+			return all
+		}
+		cursor = next
+	}
+	t.Fatal("paging did not end")
+	return nil
+}
+
+func TestKeysPageMatchesKeys(t *testing.T) {
+	policies := map[string]func() Policy{
+		"lru":   LRU,
+		"fifo":  FIFO,
+		"mru":   MRU,
+		"lfu":   LFU,
+		"slru":  SLRU,
+		"arc":   ARC,
+		"clock": CLOCK,
+		"sieve": Sieve,
+		"lruk":  func() Policy { return LRUK(2) },
+	}
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			c := newTestCache(t, 50, WithPolicy(policy()))
+			for k := range 60 {
+				c.Put(k, k)
+				if k%3 == 0 {
+					c.Get(k / 2)
+				}
+			}
+			want := c.Keys()
+			for _, limit := range []int{1, 7, 50, 100} {
+				if got := allPages(t, c, limit); !slices.Equal(got, want) {
+					t.Errorf("limit %d: pages list %v, Keys %v", limit, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEntriesPage(t *testing.T) {
+	c := newTestCache(t, 8)
+	for k := range 5 {
+		c.Put(k, k*10)
+	}
+	entries, next, err := c.EntriesPage("", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Entry{{4, 40}, {3, 30}, {2, 20}}; !slices.Equal(entries, want) {
+		t.Errorf("first page %v, want %v", entries, want)
+	}
+	entries, next, err = c.EntriesPage(next, 3)
+	if err != nil || next != "" {
+		t.Fatalf("second page: next %q, %v", next, err)
+	}
+	if want := []Entry{{1, 10}, {0, 0}}; !slices.Equal(entries, want) {
+		t.Errorf("second page %v, want %v", entries, want)
+	}
+	if entries, next, _ := c.EntriesPage("", 5); len(entries) != 5 || next != "" {
+		t.Errorf("an exact page returned %d entries and cursor %q", len(entries), next)
+	}
+}
+
+func TestKeysPageCursorContract(t *testing.T) {
+	newCache := func() *SecureLRUCache {
+		c := newTestCache(t, 16)
+		for k := 9; k >= 0; k-- {
+			c.Put(k, k)
+		}
+		return c // Keys: 0 1 2 ... 9
+	}
+	page := func(c *SecureLRUCache, cursor Cursor, limit int) ([]int, Cursor) {
+		t.Helper()
+		keys, next, err := c.KeysPage(cursor, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return keys, next
+	}
+
+	t.Run("promoted entries are skipped", func(t *testing.T) {
+		c := newCache()
+		_, cursor := page(c, "", 3) // 0 1 2
+		c.Get(2)                    // the cursor's own entry moves
+		c.Get(5)
+		c.Put(20, 20)
+		if got, _ := page(c, cursor, 4); !slices.Equal(got, []int{3, 4, 6, 7}) {
+			t.Errorf("page after promotions = %v, want [3 4 6 7]", got)
+		}
+	})
+	t.Run("removed cursor entry resumes at its colder neighbour", func(t *testing.T) {
+		c := newCache()
+		_, cursor := page(c, "", 3)
+		c.Remove(2)
+		c.Remove(3)
+		if got, _ := page(c, cursor, 3); !slices.Equal(got, []int{4, 5, 6}) {
+			t.Errorf("page after removals = %v, want [4 5 6]", got)
+		}
+	})
+	t.Run("every anchor gone", func(t *testing.T) {
+		c := newCache()
+		_, cursor := page(c, "", 3)
+		for k := 2; k <= 7; k++ {
+			c.Remove(k)
+		}
+		c.Get(0)
+		if got, next := page(c, cursor, 3); !slices.Equal(got, []int{8, 9}) || next != "" {
+			t.Errorf("page after removing the anchors = %v, %q, want [8 9]", got, next)
+		}
+	})
+	t.Run("cache emptied", func(t *testing.T) {
+		c := newCache()
+		_, cursor := page(c, "", 3)
+		c.Clear()
+		if got, next := page(c, cursor, 3); len(got) != 0 || next != "" {
+			t.Errorf("page of an empty cache = %v, %q", got, next)
+		}
+	})
+}
+
+func TestKeysPageRejectsBadInput(t *testing.T) {
+	c := newTestCache(t, 4)
+	if _, _, err := c.KeysPage("", 0); err == nil {
+		t.Error("limit 0 accepted")
+	}
+	valid := encodeCursor([]cursorAnchor{{key: 1, seq: 2}})
+	for _, cursor := range []Cursor{"!", "AA", valid + "A", Cursor(encodeCursor(make([]cursorAnchor, cursorAnchors+2))), encodeCursor(nil)} {
+		if _, _, err := c.KeysPage(cursor, 1); err == nil {
+			t.Errorf("cursor %q accepted", cursor)
+		}
+	}
+	if _, _, err := c.KeysPage(valid, 1); err != nil {
+		t.Errorf("a cursor for a missing key: %v", err)
+	}
+}
+
+// countingEach counts walks that start at the front of an LRU policy.
+type countingEach struct {
+	*lruPolicy
+	fromFront int
+}
+
+func (p *countingEach) Each(f func(node *Node) bool) {
+	p.fromFront++
+	p.lruPolicy.Each(f)
+}
+
+func TestKeysPageResumesWithoutRewalking(t *testing.T) {
+	p := &countingEach{lruPolicy: LRU().(*lruPolicy)}
+	c, err := NewSecureLRUCache(1000, WithPolicy(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for k := range 1000 {
+		c.Put(k, k)
+	}
+	p.fromFront = 0
+	if got := allPages(t, c, 10); len(got) != 1000 {
+		t.Fatalf("listed %d keys", len(got))
+	}
+	if p.fromFront != 1 {
+		t.Errorf("100 pages walked from the front %d times, want once", p.fromFront)
+	}
+}
+
+func TestKeysPageUnderConcurrentWrites(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	const (
+		stable = 2000 // keys 0..1999 are never touched while paging
+		churn  = 2000 // keys stable.. are read, written and removed
+	)
+	c, err := NewSecureLRUCache(stable + churn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for k := range stable + churn {
+		// Interleave the two ranges so churn happens around the stable
+		// entries.
+		if k%2 == 0 {
+			c.Put(k/2, k/2)
+		} else {
+			c.Put(stable+k/2, k)
+		}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				k := stable + r.Intn(churn)
+				switch r.Intn(3) {
+				case 0:
+					c.Get(k)
+				case 1:
+					c.Put(k, k)
+				default:
+					c.Remove(k)
+				}
+			}
+		}()
+	}
+	for range 5 {
+		seen := make(map[int]bool)
+		for _, k := range allPages(t, c, 37) {
+			if seen[k] {
+				t.Fatalf("key %d listed twice", k)
+			}
+			seen[k] = true
+		}
+		for k := range stable {
+			if !seen[k] {
+				t.Fatalf("untouched key %d was missed", k)
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type persistence struct {
+	path     string
+	interval time.Duration
+	// mu keeps saves from overlapping.
+	mu sync.Mutex
+}
+
+// WithPersistence keeps the cache in a binary snapshot at path. The snapshot
+// is loaded when the cache is built, if the file exists, in place of any
+// initial data, and saved every interval in the background and again by
+// Close. An interval of 0 saves only on Close. The cache keeps the capacity it
+// was built with, evicting if the snapshot holds more. Background saves that
+// fail are logged at Error if the cache has a logger.
+func WithPersistence(path string, interval time.Duration) Option {
+	return func(c *SecureLRUCache) error {
+		if path == "" {
+			return fmt.Errorf("persistence path must not be empty")
+		}
+		if interval < 0 {
+			return fmt.Errorf("persistence interval must not be negative")
+		}
+		c.persist = &persistence{path: path, interval: interval}
+		return nil
+	}
+}
+
+// SaveToFile writes a binary snapshot to path atomically: it is written to a
+// temporary file in the same directory, synced, and renamed over path, so a
+// crash leaves either the old snapshot or the new one. Like WriteTo it only
+// holds the read lock while copying entries, never during file I/O.
+func (c *SecureLRUCache) SaveToFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err := c.writeFile(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Make the rename itself durable.
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+func (c *SecureLRUCache) writeFile(f *os.File) error {
+	w := bufio.NewWriter(f)
+	if c.snapshotAEAD != nil {
+		if _, err := c.saveEncrypted(w, c.snapshotAEAD); err != nil {
+			return err
+		}
+	} else if _, err := c.WriteTo(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// LoadFromFile replaces the cache's contents with the snapshot at path, as
+// ReadFrom does, or LoadEncrypted with WithSnapshotEncryption. A missing file returns an error matching fs.ErrNotExist.
+func (c *SecureLRUCache) LoadFromFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if c.snapshotAEAD != nil {
+		_, err = c.loadEncrypted(f, c.snapshotAEAD)
+	} else {
+		_, err = c.ReadFrom(f)
+	}
+	if err != nil {
+		return fmt.Errorf("load %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadPersisted restores the snapshot at the persistence path, if there is
+// one yet, keeping the configured capacity.
+func (c *SecureLRUCache) loadPersisted() error {
+	capacity := c.capacity
+	if err := c.LoadFromFile(c.persist.path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if c.capacity != capacity {
+		return c.Resize(capacity)
+	}
+	return nil
+}
+
+// savePersisted saves to the persistence path, waiting for any save already
+// running rather than overlapping it.
+func (c *SecureLRUCache) savePersisted() error {
+	c.persist.mu.Lock()
+	defer c.persist.mu.Unlock()
+	return c.SaveToFile(c.persist.path)
+}
+
+func (c *SecureLRUCache) startPersistence() {
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		ticker := time.NewTicker(c.persist.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.savePersisted(); err != nil && c.logger != nil {
+					c.logger.LogAttrs(context.Background(), slog.LevelError, "snapshot failed",
+						slog.String("path", c.persist.path), slog.Any("error", err))
+				}
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,324 @@
+package main
+
+import "fmt"
+
+// Policy decides which entry a full cache evicts. The cache owns the key map,
+// locking and capacity accounting, and calls the policy under its write lock
+// as nodes are inserted, accessed and removed. A node is handed to at most one
+// policy at a time, which may use its prev and next links.
+type Policy interface {
+	RecordAccess(node *Node)
+	RecordInsert(node *Node)
+	// Victim returns the node to evict next, or nil if there is none. It
+	// does not remove the node; the cache calls Remove for that.
+	Victim() *Node
+	Remove(node *Node)
+	Clear()
+	// Each visits the tracked nodes from the most valuable to the next
+	// victim, stopping early if f returns false.
+	Each(f func(node *Node) bool)
+}
+
+// SharedAccessPolicy is implemented by policies whose RecordAccess is safe to
+// call concurrently under the cache's read lock. When SharedAccess reports
+// true, Get and GetOrDefault never take the write lock for a live entry.
+type SharedAccessPolicy interface {
+	Policy
+	SharedAccess() bool
+}
+
+// FrontAccessPolicy is implemented by policies that can tell, under the
+// cache's read lock, that RecordAccess(node) would change nothing: AtFront
+// may only read, and when it reports true RecordAccess must only read too. Get
+// then serves such a hit without taking the write lock.
+type FrontAccessPolicy interface {
+	Policy
+	AtFront(node *Node) bool
+}
+
+// CandidatePolicy is implemented by policies that can list the nodes they
+// would evict, in order, starting from Victim. Candidates must not change the
+// policy and stops early if f returns false. The eviction filter uses it to
+// pass over vetoed entries without moving them.
+type CandidatePolicy interface {
+	Policy
+	Candidates(f func(node *Node) bool)
+}
+
+// ResumablePolicy is implemented by policies that can continue Each from a
+// node, visiting the nodes Each would visit after it. EachAfter must not
+// change the policy. KeysPage uses it to resume a page without walking the
+// entries before the cursor.
+type ResumablePolicy interface {
+	Policy
+	EachAfter(node *Node, f func(node *Node) bool)
+}
+
+// CapacityAwarePolicy is told the cache's capacity when the cache is built and
+// on every Resize.
+type CapacityAwarePolicy interface {
+	Policy
+	SetCapacity(n int)
+}
+
+// KeyedVictimPolicy chooses the victim knowing which key is about to be
+// inserted. The cache calls VictimFor instead of Victim when a Put of a new
+// key finds the cache full.
+type KeyedVictimPolicy interface {
+	Policy
+	VictimFor(incoming int) *Node
+}
+
+// SegmentedPolicy names the segment of the policy a node currently sits in,
+// for EntryInfo.
+type SegmentedPolicy interface {
+	Policy
+	Segment(node *Node) string
+}
+
+// PolicyState is a policy's internal ordering, carried in a CacheDump so a
+// restore can rebuild it. Lists hold keys, most recent first.
+type PolicyState struct {
+	Name   string           `json:"name"`
+	Lists  map[string][]int `json:"lists,omitempty"`
+	Params map[string]int   `json:"params,omitempty"`
+}
+
+type StatefulPolicy interface {
+	Policy
+	State() PolicyState
+}
+
+// RestorablePolicy rebuilds its internal state from a PolicyState it produced,
+// for Restore. nodes holds every restored node by key. Restore replaces
+// whatever the policy tracked, and returns an error without changing anything
+// if state does not describe exactly those nodes.
+type RestorablePolicy interface {
+	StatefulPolicy
+	Restore(state PolicyState, nodes map[int]*Node) error
+}
+
+// restoreList checks that keys name distinct nodes not already in placed, and
+// marks them placed.
+func restoreList(name string, keys []int, nodes map[int]*Node, placed map[int]bool) error {
+	for _, key := range keys {
+		if _, ok := nodes[key]; !ok {
+			return fmt.Errorf("%s lists key %d, which is not restored", name, key)
+		}
+		if placed[key] {
+			return fmt.Errorf("%s lists key %d twice", name, key)
+		}
+		placed[key] = true
+	}
+	return nil
+}
+
+// pushAll pushes the nodes for keys so that the list holds them in order.
+func (l *nodeList) pushAll(keys []int, nodes map[int]*Node) {
+	for i := len(keys) - 1; i >= 0; i-- {
+		l.pushFront(nodes[keys[i]])
+	}
+}
+
+func WithPolicy(p Policy) Option {
+	return func(c *SecureLRUCache) error {
+		if p == nil {
+			return fmt.Errorf("policy must not be nil")
+		}
+		c.policy = p
+		return nil
+	}
+}
+
+// WithPolicyFunc is WithPolicy with a fresh policy from newPolicy each time
+// the option is applied, for options shared by several caches, such as the
+// shards of a ShardedLRUCache.
+func WithPolicyFunc(newPolicy func() Policy) Option {
+	return func(c *SecureLRUCache) error {
+		if newPolicy == nil {
+			return fmt.Errorf("policy func must not be nil")
+		}
+		return WithPolicy(newPolicy())(c)
+	}
+}
+
+// nodeList is a doubly-linked list of nodes between two sentinels.
+type nodeList struct {
+	head *Node
+	tail *Node
+}
+
+func newNodeList() nodeList {
+	head := &Node{key: -1, value: -1}
+	tail := &Node{key: -1, value: -1}
+	head.next = tail
+	tail.prev = head
+	return nodeList{head: head, tail: tail}
+}
+
+func (l *nodeList) clear() {
+	l.head.next = l.tail
+	l.tail.prev = l.head
+}
+
+func (l *nodeList) remove(node *Node) {
+	if node == nil || node.prev == nil || node.next == nil {
+		return
+	}
+
+	if node == l.head || node == l.tail {
+		return
+	}
+
+	node.prev.next = node.next
+	node.next.prev = node.prev
+
+	node.prev = nil
+	node.next = nil
+}
+
+func (l *nodeList) pushFront(node *Node) {
+	if node == nil {
+		return
+	}
+
+	if node == l.head || node == l.tail {
+		return
+	}
+
+	node.next = l.head.next
+	node.prev = l.head
+
+	l.head.next.prev = node
+	l.head.next = node
+}
+
+func (l *nodeList) moveToFront(node *Node) {
+	if node == nil || node.prev == nil || node.next == nil {
+		return
+	}
+
+	if node == l.head || node == l.tail {
+		return
+	}
+
+	if node == l.head.next {
+		return
+	}
+
+	l.remove(node)
+	l.pushFront(node)
+}
+
+func (l *nodeList) front() *Node {
+	if l.head.next == l.tail {
+		return nil
+	}
+	return l.head.next
+}
+
+func (l *nodeList) back() *Node {
+	if l.tail.prev == l.head {
+		return nil
+	}
+	return l.tail.prev
+}
+
+func (l *nodeList) each(f func(node *Node) bool) bool {
+	for node := l.head.next; node != l.tail; {
+		// Read next first so f may unlink node.
+		next := node.next
+		if !f(node) {
+			return false
+		}
+		node = next
+	}
+	return true
+}
+
+// eachAfter is each from the node after node, which must be in the list.
+func (l *nodeList) eachAfter(node *Node, f func(node *Node) bool) bool {
+	for node = node.next; node != l.tail; node = node.next {
+		if !f(node) {
+			return false
+		}
+	}
+	return true
+}
+
+// eachBack is each from the back of the list; f must not unlink nodes.
+func (l *nodeList) eachBack(f func(node *Node) bool) bool {
+	for node := l.tail.prev; node != l.head; node = node.prev {
+		if !f(node) {
+			return false
+		}
+	}
+	return true
+}
+
+type lruPolicy struct {
+	list nodeList
+}
+
+// LRU evicts the least recently used entry. It is the default policy.
+func LRU() Policy {
+	return &lruPolicy{list: newNodeList()}
+}
+
+func (p *lruPolicy) RecordAccess(node *Node)      { p.list.moveToFront(node) }
+func (p *lruPolicy) RecordInsert(node *Node)      { p.list.pushFront(node) }
+func (p *lruPolicy) Victim() *Node                { return p.list.back() }
+func (p *lruPolicy) Remove(node *Node)            { p.list.remove(node) }
+func (p *lruPolicy) Clear()                       { p.list.clear() }
+func (p *lruPolicy) Each(f func(node *Node) bool) { p.list.each(f) }
+func (p *lruPolicy) AtFront(node *Node) bool      { return p.list.head.next == node }
+
+func (p *lruPolicy) Candidates(f func(node *Node) bool) { p.list.eachBack(f) }
+
+func (p *lruPolicy) EachAfter(node *Node, f func(node *Node) bool) { p.list.eachAfter(node, f) }
+
+type fifoPolicy struct {
+	list nodeList
+}
+
+// FIFO evicts entries in insertion order; reads and overwrites do not affect
+// it, so Get only needs the read lock and Keys lists entries newest first.
+func FIFO() Policy {
+	return &fifoPolicy{list: newNodeList()}
+}
+
+func (p *fifoPolicy) SharedAccess() bool           { return true }
+func (p *fifoPolicy) RecordAccess(*Node)           {}
+func (p *fifoPolicy) RecordInsert(node *Node)      { p.list.pushFront(node) }
+func (p *fifoPolicy) Victim() *Node                { return p.list.back() }
+func (p *fifoPolicy) Remove(node *Node)            { p.list.remove(node) }
+func (p *fifoPolicy) Clear()                       { p.list.clear() }
+func (p *fifoPolicy) Each(f func(node *Node) bool) { p.list.each(f) }
+
+func (p *fifoPolicy) Candidates(f func(node *Node) bool) { p.list.eachBack(f) }
+
+func (p *fifoPolicy) EachAfter(node *Node, f func(node *Node) bool) { p.list.eachAfter(node, f) }
+
+type mruPolicy struct {
+	list nodeList
+}
+
+// MRU evicts the most recently used entry, which suits cyclic scans over more
+// keys than the cache holds. Reads still count as uses. Keys and Dump keep
+// most recent first, so unlike the other policies they list the next victim
+// first.
+func MRU() Policy {
+	return &mruPolicy{list: newNodeList()}
+}
+
+func (p *mruPolicy) RecordAccess(node *Node)      { p.list.moveToFront(node) }
+func (p *mruPolicy) RecordInsert(node *Node)      { p.list.pushFront(node) }
+func (p *mruPolicy) Victim() *Node                { return p.list.front() }
+func (p *mruPolicy) Remove(node *Node)            { p.list.remove(node) }
+func (p *mruPolicy) Clear()                       { p.list.clear() }
+func (p *mruPolicy) Each(f func(node *Node) bool) { p.list.each(f) }
+func (p *mruPolicy) AtFront(node *Node) bool      { return p.list.head.next == node }
+
+func (p *mruPolicy) Candidates(f func(node *Node) bool) { p.list.each(f) }
+
+func (p *mruPolicy) EachAfter(node *Node, f func(node *Node) bool) { p.list.eachAfter(node, f) }
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+)
+
+const (
+	arcT1 int8 = iota + 1
+	arcT2
+)
+
+type arcGhost struct {
+	elem *list.Element
+	inB2 bool
+}
+
+// arcPolicy is the Adaptive Replacement Cache of Megiddo and Modha. T1 and T2
+// hold resident nodes seen once and more than once; B1 and B2 remember the
+// keys recently evicted from each, and hits on those ghosts move the target
+// size p of T1 towards whichever side would have kept the key.
+type arcPolicy struct {
+	c      int
+	p      int
+	t1     nodeList
+	t2     nodeList
+	t1Len  int
+	t2Len  int
+	b1     *list.List
+	b2     *list.List
+	ghosts map[int]arcGhost
+
+	// Bookkeeping for the insert in progress: admit runs once per missed
+	// key, and the node chosen by VictimFor is ghosted when it is removed.
+	admitted    bool
+	admittedKey int
+	ghostHit    bool
+	ghostInB2   bool
+	evicting    *Node
+	evictToB2   bool
+	evictGhost  bool
+}
+
+// ARC adapts between recency and frequency as the workload shifts. Ghost
+// lists hold keys only and never count toward the cache's capacity; together
+// they are bounded by it.
+func ARC() Policy {
+	p := &arcPolicy{t1: newNodeList(), t2: newNodeList()}
+	p.Clear()
+	return p
+}
+
+func (p *arcPolicy) SetCapacity(n int) {
+	p.c = n
+	p.p = min(p.p, n)
+	p.trimGhosts()
+}
+
+func (p *arcPolicy) RecordAccess(node *Node) {
+	p.unlink(node)
+	p.t2.pushFront(node)
+	node.segment = arcT2
+	p.t2Len++
+}
+
+func (p *arcPolicy) RecordInsert(node *Node) {
+	p.admit(node.key)
+	p.admitted = false
+
+	if g, exists := p.ghosts[node.key]; exists {
+		p.dropGhost(node.key, g)
+		p.t2.pushFront(node)
+		node.segment = arcT2
+		p.t2Len++
+		return
+	}
+	p.t1.pushFront(node)
+	node.segment = arcT1
+	p.t1Len++
+}
+
+// admit adapts p on a ghost hit and trims the ghost lists on a plain miss,
+// as ARC does before every insert of a key that is not resident.
+func (p *arcPolicy) admit(key int) {
+	if p.admitted && p.admittedKey == key {
+		return
+	}
+	p.admitted, p.admittedKey = true, key
+
+	if g, exists := p.ghosts[key]; exists {
+		p.ghostHit, p.ghostInB2 = true, g.inB2
+		b1, b2 := p.b1.Len(), p.b2.Len()
+		if g.inB2 {
+			p.p = max(0, p.p-max(b1/b2, 1))
+		} else {
+			p.p = min(p.c, p.p+max(b2/b1, 1))
+		}
+		return
+	}
+
+	p.ghostHit, p.ghostInB2 = false, false
+	l1 := p.t1Len + p.b1.Len()
+	total := l1 + p.t2Len + p.b2.Len()
+	if l1 >= p.c {
+		if p.t1Len < p.c {
+			p.dropOldestGhost(p.b1)
+		}
+	} else if total >= 2*p.c {
+		p.dropOldestGhost(p.b2)
+	}
+}
+
+func (p *arcPolicy) VictimFor(key int) *Node {
+	p.admit(key)
+
+	if !p.ghostHit && p.t1Len >= p.c {
+		// B1 is empty and T1 fills the cache: evict from T1 outright.
+		p.evicting, p.evictGhost = p.t1.back(), false
+		return p.evicting
+	}
+
+	if p.t1Len > 0 && ((p.ghostHit && p.ghostInB2 && p.t1Len == p.p) || p.t1Len > p.p || p.t2Len == 0) {
+		p.evicting, p.evictGhost, p.evictToB2 = p.t1.back(), true, false
+	} else {
+		p.evicting, p.evictGhost, p.evictToB2 = p.t2.back(), true, true
+	}
+	return p.evicting
+}
+
+func (p *arcPolicy) Victim() *Node {
+	if p.t1Len > 0 && (p.t1Len > p.p || p.t2Len == 0) {
+		return p.t1.back()
+	}
+	return p.t2.back()
+}
+
+func (p *arcPolicy) Remove(node *Node) {
+	p.unlink(node)
+	node.segment = 0
+
+	if node != p.evicting {
+		return
+	}
+	p.evicting = nil
+	if !p.evictGhost {
+		return
+	}
+	ghosts := p.b1
+	if p.evictToB2 {
+		ghosts = p.b2
+	}
+	p.ghosts[node.key] = arcGhost{elem: ghosts.PushFront(node.key), inB2: p.evictToB2}
+	p.trimGhosts()
+}
+
+func (p *arcPolicy) unlink(node *Node) {
+	switch node.segment {
+	case arcT1:
+		p.t1.remove(node)
+		p.t1Len--
+	case arcT2:
+		p.t2.remove(node)
+		p.t2Len--
+	}
+}
+
+func (p *arcPolicy) dropGhost(key int, g arcGhost) {
+	if g.inB2 {
+		p.b2.Remove(g.elem)
+	} else {
+		p.b1.Remove(g.elem)
+	}
+	delete(p.ghosts, key)
+}
+
+func (p *arcPolicy) dropOldestGhost(ghosts *list.List) {
+	if e := ghosts.Back(); e != nil {
+		key := e.Value.(int)
+		p.dropGhost(key, p.ghosts[key])
+	}
+}
+
+// trimGhosts keeps the ghost lists within the capacity after a Resize or
+// explicit removals have upset the usual ARC invariants.
+func (p *arcPolicy) trimGhosts() {
+	for p.b1.Len()+p.b2.Len() > p.c {
+		if p.b1.Len() > p.b2.Len() {
+			p.dropOldestGhost(p.b1)
+		} else {
+			p.dropOldestGhost(p.b2)
+		}
+	}
+}
+
+func (p *arcPolicy) Clear() {
+	p.t1.clear()
+	p.t2.clear()
+	p.t1Len, p.t2Len, p.p = 0, 0, 0
+	p.b1, p.b2 = list.New(), list.New()
+	p.ghosts = make(map[int]arcGhost)
+	p.admitted, p.evicting = false, nil
+}
+
+// Each visits T2 and then T1, each from most to least recently used.
+func (p *arcPolicy) Each(f func(node *Node) bool) {
+	if p.t2.each(f) {
+		p.t1.each(f)
+	}
+}
+
+func (p *arcPolicy) Segment(node *Node) string {
+	if node.segment == arcT2 {
+		return "t2"
+	}
+	return "t1"
+}
+
+func (p *arcPolicy) State() PolicyState {
+	keys := func(l nodeList) []int {
+		var out []int
+		l.each(func(node *Node) bool {
+			out = append(out, node.key)
+			return true
+		})
+		return out
+	}
+	ghostKeys := func(l *list.List) []int {
+		var out []int
+		for e := l.Front(); e != nil; e = e.Next() {
+			out = append(out, e.Value.(int))
+		}
+		return out
+	}
+	return PolicyState{
+		Name: "arc",
+		Lists: map[string][]int{
+			"t1": keys(p.t1),
+			"t2": keys(p.t2),
+			"b1": ghostKeys(p.b1),
+			"b2": ghostKeys(p.b2),
+		},
+		Params: map[string]int{"p": p.p},
+	}
+}
+
+func (p *arcPolicy) Restore(state PolicyState, nodes map[int]*Node) error {
+	t1, t2 := state.Lists["t1"], state.Lists["t2"]
+	placed := make(map[int]bool, len(nodes))
+	if err := restoreList("t1", t1, nodes, placed); err != nil {
+		return err
+	}
+	if err := restoreList("t2", t2, nodes, placed); err != nil {
+		return err
+	}
+	if len(placed) != len(nodes) {
+		return fmt.Errorf("t1 and t2 hold %d of %d keys", len(placed), len(nodes))
+	}
+	b1, b2 := state.Lists["b1"], state.Lists["b2"]
+	for _, key := range append(b1[:len(b1):len(b1)], b2...) {
+		if placed[key] {
+			return fmt.Errorf("ghost key %d is resident or listed twice", key)
+		}
+		placed[key] = true
+	}
+
+	p.Clear()
+	p.t1.pushAll(t1, nodes)
+	p.t2.pushAll(t2, nodes)
+	for _, key := range t1 {
+		nodes[key].segment = arcT1
+	}
+	for _, key := range t2 {
+		nodes[key].segment = arcT2
+	}
+	p.t1Len, p.t2Len = len(t1), len(t2)
+	for _, key := range b1 {
+		p.ghosts[key] = arcGhost{elem: p.b1.PushBack(key)}
+	}
+	for _, key := range b2 {
+		p.ghosts[key] = arcGhost{elem: p.b2.PushBack(key), inB2: true}
+	}
+	p.p = max(0, min(state.Params["p"], p.c))
+	p.trimGhosts()
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+// clockPolicy is the CLOCK, or second-chance, approximation of LRU. Nodes sit
+// on a ring that a hand sweeps when a victim is needed: a referenced node has
+// its bit cleared and is passed over, and the first unreferenced node is
+// evicted. Get only sets the bit, so it runs under the read lock.
+type clockPolicy struct {
+	ring nodeList
+	hand *Node
+}
+
+// CLOCK approximates LRU without relinking on reads. Keys, Values and Dump
+// list entries in reverse hand order, so the entry the hand reaches next
+// comes last.
+func CLOCK() Policy {
+	return &clockPolicy{ring: newNodeList()}
+}
+
+func (p *clockPolicy) SharedAccess() bool { return true }
+
+func (p *clockPolicy) RecordAccess(node *Node) { node.referenced.Store(true) }
+
+// RecordInsert places node just behind the hand, so it is the last one the
+// sweep examines.
+func (p *clockPolicy) RecordInsert(node *Node) {
+	node.referenced.Store(false)
+	if p.hand == nil {
+		p.ring.pushFront(node)
+		p.hand = node
+		return
+	}
+	node.prev = p.hand.prev
+	node.next = p.hand
+	p.hand.prev.next = node
+	p.hand.prev = node
+}
+
+func (p *clockPolicy) Victim() *Node {
+	if p.hand == nil {
+		return nil
+	}
+	// Every node has its bit cleared within one revolution, so this stops
+	// by the second time round.
+	for p.hand.referenced.Load() {
+		p.hand.referenced.Store(false)
+		p.hand = p.after(p.hand)
+	}
+	return p.hand
+}
+
+func (p *clockPolicy) Remove(node *Node) {
+	if node == p.hand {
+		p.hand = p.after(node)
+		if p.hand == node {
+			p.hand = nil
+		}
+	}
+	p.ring.remove(node)
+}
+
+func (p *clockPolicy) after(node *Node) *Node {
+	if node.next == p.ring.tail {
+		return p.ring.front()
+	}
+	return node.next
+}
+
+func (p *clockPolicy) before(node *Node) *Node {
+	if node.prev == p.ring.head {
+		return p.ring.back()
+	}
+	return node.prev
+}
+
+func (p *clockPolicy) Clear() {
+	p.ring.clear()
+	p.hand = nil
+}
+
+func (p *clockPolicy) Each(f func(node *Node) bool) {
+	if p.hand == nil {
+		return
+	}
+	stop := p.hand
+	for node := p.before(stop); ; {
+		// Read ahead first so f may unlink node.
+		prev := p.before(node)
+		if !f(node) || node == stop {
+			return
+		}
+		node = prev
+	}
+}
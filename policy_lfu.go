@@ -0,0 +1,138 @@
+package main
+
+type lfuBucket struct {
+	freq int
+	list nodeList
+	prev *lfuBucket
+	next *lfuBucket
+}
+
+// lfuPolicy keeps one list per access frequency, ordered by recency, in a
+// chain of buckets sorted by frequency, so every operation is O(1).
+type lfuPolicy struct {
+	head *lfuBucket
+	tail *lfuBucket
+}
+
+// LFU evicts the least frequently used entry, breaking ties by least recent
+// use. Every Get and every overwrite counts as a use.
+func LFU() Policy {
+	p := &lfuPolicy{head: &lfuBucket{}, tail: &lfuBucket{}}
+	p.Clear()
+	return p
+}
+
+func (p *lfuPolicy) insertAfter(at *lfuBucket, freq int) *lfuBucket {
+	b := &lfuBucket{freq: freq, list: newNodeList(), prev: at, next: at.next}
+	at.next.prev = b
+	at.next = b
+	return b
+}
+
+func (p *lfuPolicy) unlinkIfEmpty(b *lfuBucket) {
+	if b.list.front() != nil {
+		return
+	}
+	b.prev.next = b.next
+	b.next.prev = b.prev
+}
+
+func (p *lfuPolicy) RecordInsert(node *Node) {
+	b := p.head.next
+	if b == p.tail || b.freq != 1 {
+		b = p.insertAfter(p.head, 1)
+	}
+	node.freq = 1
+	node.bucket = b
+	b.list.pushFront(node)
+}
+
+func (p *lfuPolicy) RecordAccess(node *Node) {
+	from := node.bucket
+	if from == nil {
+		return
+	}
+
+	to := from.next
+	if to == p.tail || to.freq != from.freq+1 {
+		to = p.insertAfter(from, from.freq+1)
+	}
+	from.list.remove(node)
+	p.unlinkIfEmpty(from)
+
+	node.freq = to.freq
+	node.bucket = to
+	to.list.pushFront(node)
+}
+
+func (p *lfuPolicy) Victim() *Node {
+	if p.head.next == p.tail {
+		return nil
+	}
+	return p.head.next.list.back()
+}
+
+func (p *lfuPolicy) Remove(node *Node) {
+	b := node.bucket
+	if b == nil {
+		return
+	}
+	b.list.remove(node)
+	p.unlinkIfEmpty(b)
+	node.bucket = nil
+}
+
+func (p *lfuPolicy) Clear() {
+	p.head.next = p.tail
+	p.tail.prev = p.head
+}
+
+func (p *lfuPolicy) Each(f func(node *Node) bool) {
+	for b := p.tail.prev; b != p.head; b = b.prev {
+		if !b.list.each(f) {
+			return
+		}
+	}
+}
+
+func (p *lfuPolicy) EachAfter(node *Node, f func(node *Node) bool) {
+	if node.bucket == nil || !node.bucket.list.eachAfter(node, f) {
+		return
+	}
+	for b := node.bucket.prev; b != p.head; b = b.prev {
+		if !b.list.each(f) {
+			return
+		}
+	}
+}
+
+// Candidates visits the buckets from the lowest frequency, each from least
+// to most recent.
+func (p *lfuPolicy) Candidates(f func(node *Node) bool) {
+	for b := p.head.next; b != p.tail; b = b.next {
+		if !b.list.eachBack(f) {
+			return
+		}
+	}
+}
+
+// frequencyPolicy lets Restore put a node back at a dumped frequency.
+type frequencyPolicy interface {
+	insertWithFrequency(node *Node, freq int)
+}
+
+// insertWithFrequency inserts node as the most recent entry of the bucket for
+// freq.
+func (p *lfuPolicy) insertWithFrequency(node *Node, freq int) {
+	at := p.head
+	for at.next != p.tail && at.next.freq <= freq {
+		at = at.next
+	}
+	b := at
+	if b == p.head || b.freq != freq {
+		b = p.insertAfter(at, freq)
+	}
+	node.freq = freq
+	node.bucket = b
+	b.list.pushFront(node)
+}
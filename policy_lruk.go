@@ -0,0 +1,118 @@
+package main
+
+import (
+	"container/heap"
+	"sort"
+)
+
+const defaultLRUK = 2
+
+// lrukPolicy is LRU-K: the victim is the entry whose K-th most recent
+// reference is oldest. Entries with fewer than K references rank below all
+// others and among themselves by their latest reference. References are
+// logical times kept in node.refs, newest first, and the nodes sit in a
+// min-heap on that ordering.
+type lrukPolicy struct {
+	k     int
+	clock int64
+	nodes lrukHeap
+}
+
+// LRUK evicts by the K-th most recent reference, or the second if k is not
+// positive, so entries read only once cannot push out ones read repeatedly.
+// EntryInfo reports each entry's reference history.
+func LRUK(k int) Policy {
+	if k < 1 {
+		k = defaultLRUK
+	}
+	return &lrukPolicy{k: k, nodes: lrukHeap{k: k}}
+}
+
+func (p *lrukPolicy) reference(node *Node) {
+	p.clock++
+	if len(node.refs) < p.k {
+		node.refs = append(node.refs, 0)
+	}
+	copy(node.refs[1:], node.refs)
+	node.refs[0] = p.clock
+}
+
+func (p *lrukPolicy) RecordAccess(node *Node) {
+	p.reference(node)
+	heap.Fix(&p.nodes, node.index)
+}
+
+func (p *lrukPolicy) RecordInsert(node *Node) {
+	node.refs = node.refs[:0]
+	p.reference(node)
+	heap.Push(&p.nodes, node)
+}
+
+func (p *lrukPolicy) Victim() *Node {
+	if len(p.nodes.nodes) == 0 {
+		return nil
+	}
+	return p.nodes.nodes[0]
+}
+
+func (p *lrukPolicy) Remove(node *Node) {
+	if node.index < 0 || node.index >= len(p.nodes.nodes) || p.nodes.nodes[node.index] != node {
+		return
+	}
+	heap.Remove(&p.nodes, node.index)
+	node.index = -1
+}
+
+func (p *lrukPolicy) Clear() {
+	p.nodes.nodes = nil
+}
+
+func (p *lrukPolicy) Each(f func(node *Node) bool) {
+	nodes := append([]*Node(nil), p.nodes.nodes...)
+	sort.Slice(nodes, func(i, j int) bool { return p.nodes.less(nodes[j], nodes[i]) })
+	for _, node := range nodes {
+		if !f(node) {
+			return
+		}
+	}
+}
+
+// lrukHeap implements heap.Interface over nodes, least valuable first.
+type lrukHeap struct {
+	k     int
+	nodes []*Node
+}
+
+func (h *lrukHeap) less(a, b *Node) bool {
+	aFull, bFull := len(a.refs) >= h.k, len(b.refs) >= h.k
+	if aFull != bFull {
+		return bFull
+	}
+	if aFull && a.refs[h.k-1] != b.refs[h.k-1] {
+		return a.refs[h.k-1] < b.refs[h.k-1]
+	}
+	return a.refs[0] < b.refs[0]
+}
+
+func (h *lrukHeap) Len() int           { return len(h.nodes) }
+func (h *lrukHeap) Less(i, j int) bool { return h.less(h.nodes[i], h.nodes[j]) }
+
+func (h *lrukHeap) Swap(i, j int) {
+	h.nodes[i], h.nodes[j] = h.nodes[j], h.nodes[i]
+	h.nodes[i].index = i
+	h.nodes[j].index = j
+}
+
+func (h *lrukHeap) Push(x any) {
+	node := x.(*Node)
+	node.index = len(h.nodes)
+	h.nodes = append(h.nodes, node)
+}
+
+func (h *lrukHeap) Pop() any {
+	n := len(h.nodes)
+	node := h.nodes[n-1]
+	h.nodes[n-1] = nil
+	h.nodes = h.nodes[:n-1]
+	return node
+}
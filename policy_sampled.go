@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sort"
+	"sync/atomic"
+)
+
+const defaultSampleSize = 5
+
+// sampledPolicy approximates LRU the way Redis does: Get only stamps the node
+// with a logical time, and eviction compares a few randomly chosen nodes. The
+// slice of nodes gives O(1) random picks and swap-removal.
+type sampledPolicy struct {
+	k     int
+	nodes []*Node
+	clock int64
+}
+
+// SampledLRU evicts the least recently used of k randomly sampled entries,
+// or of 5 if k is not positive. Get needs only the read lock; the cost moves
+// to eviction, and Each sorts a copy of the entries by recency.
+func SampledLRU(k int) Policy {
+	if k < 1 {
+		k = defaultSampleSize
+	}
+	return &sampledPolicy{k: k}
+}
+
+func (p *sampledPolicy) SharedAccess() bool { return true }
+
+func (p *sampledPolicy) RecordAccess(node *Node) {
+	atomic.StoreInt64(&node.stamp, atomic.AddInt64(&p.clock, 1))
+}
+
+func (p *sampledPolicy) RecordInsert(node *Node) {
+	node.index = len(p.nodes)
+	p.nodes = append(p.nodes, node)
+	p.RecordAccess(node)
+}
+
+func (p *sampledPolicy) Victim() *Node {
+	n := len(p.nodes)
+	if n == 0 {
+		return nil
+	}
+
+	var victim *Node
+	consider := func(node *Node) {
+		if victim == nil || atomic.LoadInt64(&node.stamp) < atomic.LoadInt64(&victim.stamp) {
+			victim = node
+		}
+	}
+	if n <= p.k {
+		for _, node := range p.nodes {
+			consider(node)
+		}
+		return victim
+	}
+	for i := 0; i < p.k; i++ {
+		consider(p.nodes[rand.IntN(n)])
+	}
+	return victim
+}
+
+func (p *sampledPolicy) Remove(node *Node) {
+	i := node.index
+	if i < 0 || i >= len(p.nodes) || p.nodes[i] != node {
+		return
+	}
+	last := len(p.nodes) - 1
+	p.nodes[i] = p.nodes[last]
+	p.nodes[i].index = i
+	p.nodes[last] = nil
+	p.nodes = p.nodes[:last]
+	node.index = -1
+}
+
+func (p *sampledPolicy) Clear() {
+	clear(p.nodes)
+	p.nodes = p.nodes[:0]
+}
+
+func (p *sampledPolicy) Each(f func(node *Node) bool) {
+	nodes := append([]*Node(nil), p.nodes...)
+	sort.Slice(nodes, func(i, j int) bool {
+		return atomic.LoadInt64(&nodes[i].stamp) > atomic.LoadInt64(&nodes[j].stamp)
+	})
+	for _, node := range nodes {
+		if !f(node) {
+			return
+		}
+	}
+}
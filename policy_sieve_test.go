@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestSieveEvictsAtTheHand(t *testing.T) {
+	c := newTestCache(t, 3, WithPolicy(Sieve()))
+	for k := 1; k <= 3; k++ {
+		c.Put(k, k)
+	}
+	c.Get(1)
+
+	// The hand starts at the tail, clears 1's bit and evicts 2.
+	if evicted, ok, _ := c.PutEvicted(4, 4); !ok || evicted.Key != 2 {
+		t.Fatalf("first eviction = %v, %v, want key 2", evicted, ok)
+	}
+	// It stays put: 3 is next, although 1 is now unvisited too, and the new
+	// entry 4 at the head is not passed over.
+	if evicted, _, _ := c.PutEvicted(5, 5); evicted.Key != 3 {
+		t.Fatalf("second eviction = %v, want key 3", evicted)
+	}
+	// From 3 the hand moves towards the head, to 4, without going back to
+	// the older 1.
+	c.Get(1)
+	if evicted, _, _ := c.PutEvicted(6, 6); evicted.Key != 4 {
+		t.Fatalf("third eviction = %v, want key 4", evicted)
+	}
+	if got := c.Keys(); !slices.Equal(got, []int{1, 6, 5}) {
+		t.Errorf("Keys = %v, want [1 6 5] with the next victim last", got)
+	}
+}
+
+func TestSieveRestoresTheHand(t *testing.T) {
+	c := newTestCache(t, 8, WithPolicy(Sieve()))
+	for k := range 12 {
+		c.Put(k, k)
+		if k%3 == 0 {
+			c.Get(k / 2)
+		}
+	}
+	c.Get(9)
+	restored := newTestCache(t, 8, WithPolicy(Sieve()))
+	if err := restored.Restore(c.Dump()); err != nil {
+		t.Fatal(err)
+	}
+	if s, r := c.policy.(*sievePolicy).State(), restored.policy.(*sievePolicy).State(); s.Params["hand"] != r.Params["hand"] ||
+		!slices.Equal(s.Lists["queue"], r.Lists["queue"]) || !slices.Equal(s.Lists["visited"], r.Lists["visited"]) {
+		t.Fatalf("restored state %+v, want %+v", r, s)
+	}
+	for k := 100; k < 110; k++ {
+		a, _, _ := c.PutEvicted(k, k)
+		b, _, _ := restored.PutEvicted(k, k)
+		if a != b {
+			t.Fatalf("Put(%d) evicted %v from the original and %v from the restore", k, a, b)
+		}
+	}
+}
+
+func TestSieveRestoreRejectsBadState(t *testing.T) {
+	nodes := map[int]*Node{1: {key: 1}, 2: {key: 2}}
+	for _, state := range []PolicyState{
+		{Name: "sieve", Lists: map[string][]int{"queue": {1}}, Params: map[string]int{"hand": -1}},
+		{Name: "sieve", Lists: map[string][]int{"queue": {1, 2}, "visited": {3}}, Params: map[string]int{"hand": -1}},
+		{Name: "sieve", Lists: map[string][]int{"queue": {1, 2}}, Params: map[string]int{"hand": 2}},
+		{Name: "sieve", Lists: map[string][]int{"queue": {1, 2}}},
+	} {
+		if err := Sieve().(*sievePolicy).Restore(state, nodes); err == nil {
+			t.Errorf("Restore(%+v) accepted", state)
+		}
+	}
+}
+
+func TestSieveHitRatioAgainstLRU(t *testing.T) {
+	ratio := func(policy Policy) float64 {
+		c, err := NewSecureLRUCache(1000, WithPolicy(policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		r := rand.New(rand.NewSource(7))
+		zipf := rand.NewZipf(r, 1.05, 1, 100000)
+		for range 100000 {
+			k := int(zipf.Uint64())
+			if _, ok := c.Get(k); !ok {
+				c.Put(k, k)
+			}
+		}
+		return c.Stats().HitRatio()
+	}
+	lru, sieve := ratio(LRU()), ratio(Sieve())
+	t.Logf("hit ratio: LRU %.4f, SIEVE %.4f", lru, sieve)
+	if sieve < lru {
+		t.Errorf("SIEVE hit %.4f of a zipfian trace, below LRU's %.4f", sieve, lru)
+	}
+}
+
+// BenchmarkParallelGet compares hits under LRU, which relinks under the
+// write lock, with SIEVE, which only sets a bit under the read lock.
+func BenchmarkParallelGet(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		policy func() Policy
+	}{{"lru", LRU}, {"sieve", Sieve}} {
+		b.Run(bc.name, func(b *testing.B) {
+			c, err := NewSecureLRUCache(1024, WithPolicy(bc.policy()))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer c.Close()
+			for k := range 1024 {
+				c.Put(k, k)
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				k := rand.Int()
+				for pb.Next() {
+					c.Get(k & 1023)
+					k++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import "fmt"
+
+const (
+	slruProbation int8 = iota + 1
+	slruProtected
+)
+
+// defaultProtectedRatio is the share of capacity SLRU gives the protected
+// segment unless WithSegmentedLRU says otherwise.
+const defaultProtectedRatio = 0.8
+
+// slruPolicy is a segmented LRU. New entries start on probation and a hit
+// promotes them to the protected segment; when that is over its share of the
+// capacity its least recently used entry drops back to probation. Victims
+// come from the probation segment first, so a burst of keys that are never
+// read again only displaces other probationary entries.
+type slruPolicy struct {
+	ratio        float64
+	protectedCap int
+	probation    nodeList
+	protected    nodeList
+	protectedLen int
+}
+
+// SLRU is a segmented LRU whose protected segment takes 80% of capacity.
+func SLRU() Policy {
+	return newSLRU(defaultProtectedRatio)
+}
+
+// WithSegmentedLRU selects the SLRU policy with the given share of capacity,
+// between 0 and 1 exclusive, reserved for the protected segment.
+func WithSegmentedLRU(protectedRatio float64) Option {
+	return func(c *SecureLRUCache) error {
+		if !(protectedRatio > 0 && protectedRatio < 1) {
+			return fmt.Errorf("protected ratio must be between 0 and 1")
+		}
+		c.policy = newSLRU(protectedRatio)
+		return nil
+	}
+}
+
+func newSLRU(ratio float64) *slruPolicy {
+	return &slruPolicy{ratio: ratio, probation: newNodeList(), protected: newNodeList()}
+}
+
+func (p *slruPolicy) SetCapacity(n int) {
+	p.protectedCap = int(float64(n) * p.ratio)
+	p.rebalance()
+}
+
+func (p *slruPolicy) RecordAccess(node *Node) {
+	if node.segment == slruProtected {
+		p.protected.moveToFront(node)
+		return
+	}
+	p.probation.remove(node)
+	p.protected.pushFront(node)
+	node.segment = slruProtected
+	p.protectedLen++
+	p.rebalance()
+}
+
+func (p *slruPolicy) RecordInsert(node *Node) {
+	p.probation.pushFront(node)
+	node.segment = slruProbation
+}
+
+// rebalance demotes protected entries to the front of probation until the
+// protected segment fits its share again.
+func (p *slruPolicy) rebalance() {
+	for p.protectedLen > p.protectedCap {
+		node := p.protected.back()
+		p.protected.remove(node)
+		p.protectedLen--
+		p.probation.pushFront(node)
+		node.segment = slruProbation
+	}
+}
+
+func (p *slruPolicy) Victim() *Node {
+	if node := p.probation.back(); node != nil {
+		return node
+	}
+	return p.protected.back()
+}
+
+func (p *slruPolicy) Remove(node *Node) {
+	if node.segment == slruProtected {
+		p.protected.remove(node)
+		p.protectedLen--
+	} else {
+		p.probation.remove(node)
+	}
+	node.segment = 0
+}
+
+func (p *slruPolicy) Clear() {
+	p.probation.clear()
+	p.protected.clear()
+	p.protectedLen = 0
+}
+
+func (p *slruPolicy) Each(f func(node *Node) bool) {
+	if p.protected.each(f) {
+		p.probation.each(f)
+	}
+}
+
+func (p *slruPolicy) EachAfter(node *Node, f func(node *Node) bool) {
+	if node.segment == slruProtected {
+		if p.protected.eachAfter(node, f) {
+			p.probation.each(f)
+		}
+		return
+	}
+	p.probation.eachAfter(node, f)
+}
+
+// Candidates visits probation and then the protected segment, each from
+// least to most recent.
+func (p *slruPolicy) Candidates(f func(node *Node) bool) {
+	if p.probation.eachBack(f) {
+		p.protected.eachBack(f)
+	}
+}
+
+func (p *slruPolicy) Segment(node *Node) string {
+	if node.segment == slruProtected {
+		return "protected"
+	}
+	return "probation"
+}
+
+func (p *slruPolicy) State() PolicyState {
+	var protected, probation []int
+	p.protected.each(func(node *Node) bool {
+		protected = append(protected, node.key)
+		return true
+	})
+	p.probation.each(func(node *Node) bool {
+		probation = append(probation, node.key)
+		return true
+	})
+	return PolicyState{
+		Name:   "slru",
+		Lists:  map[string][]int{"protected": protected, "probation": probation},
+		Params: map[string]int{"protected_capacity": p.protectedCap},
+	}
+}
+
+func (p *slruPolicy) Restore(state PolicyState, nodes map[int]*Node) error {
+	protected, probation := state.Lists["protected"], state.Lists["probation"]
+	placed := make(map[int]bool, len(nodes))
+	if err := restoreList("protected", protected, nodes, placed); err != nil {
+		return err
+	}
+	if err := restoreList("probation", probation, nodes, placed); err != nil {
+		return err
+	}
+	if len(placed) != len(nodes) {
+		return fmt.Errorf("segments hold %d of %d keys", len(placed), len(nodes))
+	}
+
+	p.Clear()
+	p.protected.pushAll(protected, nodes)
+	p.probation.pushAll(probation, nodes)
+	for _, key := range protected {
+		nodes[key].segment = slruProtected
+	}
+	for _, key := range probation {
+		nodes[key].segment = slruProbation
+	}
+	p.protectedLen = len(protected)
+	p.rebalance()
+	return nil
+}
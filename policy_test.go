@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// TestEvictionOrder fills a cache of four, reads keys 1, 1 and 3, and checks
+// which entries three more Puts push out.
+func TestEvictionOrder(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy Policy
+		want   []int
+	}{
+		// Recency: 2 and 4 were never read, then 1 was read before 3.
+		{"lru", LRU(), []int{2, 4, 1}},
+		// Reads count toward frequency; the unread keys go first, the
+		// least recent of them before the newcomers.
+		{"lfu", LFU(), []int{2, 4, 5}},
+		// Reads change nothing: insertion order.
+		{"fifo", FIFO(), []int{1, 2, 3}},
+		// A sample of at least the whole cache is exact LRU.
+		{"sampled", SampledLRU(4), []int{2, 4, 1}},
+		// The read keys move to T2; T1 gives up its oldest entries and
+		// then the newcomers.
+		{"arc", ARC(), []int{2, 4, 5}},
+		// The read keys are protected; probation gives up the rest.
+		{"slru", SLRU(), []int{2, 4, 5}},
+		// The hand passes over the referenced 1 and 3, clearing them, then
+		// reaches them again once the unreferenced entries are gone.
+		{"clock", CLOCK(), []int{2, 4, 1}},
+		// The most recent entry goes, each newcomer in turn.
+		{"mru", MRU(), []int{3, 5, 6}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestCache(t, 4, WithPolicy(tc.policy))
+			for k := 1; k <= 4; k++ {
+				c.Put(k, k)
+			}
+			c.Get(1)
+			c.Get(1)
+			c.Get(3)
+			var got []int
+			for k := 5; k <= 7; k++ {
+				evicted, ok, err := c.PutEvicted(k, k)
+				if err != nil || !ok {
+					t.Fatalf("Put(%d) evicted nothing: %v", k, err)
+				}
+				got = append(got, evicted.Key)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("evicted %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// benchmarkGoroutineGets splits b.N hits on a full cache of 1024 entries
+// over the given number of goroutines.
+func benchmarkGoroutineGets(b *testing.B, policy func() Policy, goroutines int) {
+	c, err := NewSecureLRUCache(1024, WithPolicy(policy()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+	for k := range 1024 {
+		c.Put(k, k)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := g; i < b.N; i += goroutines {
+				c.Get((i * 7) & 1023)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// BenchmarkSampledGet compares hits from 16 goroutines under exact LRU and
+// under sampling, which reads under the read lock.
+func BenchmarkSampledGet(b *testing.B) {
+	b.Run("lru", func(b *testing.B) { benchmarkGoroutineGets(b, LRU, 16) })
+	b.Run("sampled", func(b *testing.B) { benchmarkGoroutineGets(b, func() Policy { return SampledLRU(5) }, 16) })
+}
+
+// BenchmarkClockGet compares hits from 32 goroutines under LRU and under
+// CLOCK, which only sets a bit under the read lock.
+func BenchmarkClockGet(b *testing.B) {
+	b.Run("lru", func(b *testing.B) { benchmarkGoroutineGets(b, LRU, 32) })
+	b.Run("clock", func(b *testing.B) { benchmarkGoroutineGets(b, CLOCK, 32) })
+}
+
+// BenchmarkZipfianGet reads a zipfian trace of keys from 32 goroutines per
+// CPU. LRU serves a hit on the most recent entry under the read lock; hiding
+// its AtFront behind a wrapper sends every hit to the write lock instead.
+func BenchmarkZipfianGet(b *testing.B) {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.2, 1, 1023)
+	trace := make([]int, 1<<16)
+	for i := range trace {
+		trace[i] = int(zipf.Uint64())
+	}
+	for _, bc := range []struct {
+		name   string
+		policy Policy
+	}{
+		{"front read", LRU()},
+		{"write lock", struct{ Policy }{LRU()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			c, err := NewSecureLRUCache(1024, WithPolicy(bc.policy))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer c.Close()
+			for k := range 1024 {
+				c.Put(k, k)
+			}
+			b.SetParallelism(32)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.Intn(len(trace))
+				for pb.Next() {
+					c.Get(trace[i&(len(trace)-1)])
+					i++
+				}
+			})
+		})
+	}
+}
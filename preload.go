@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithInitialData fills the cache with entries before it is returned. The
+// slice runs from coldest to hottest, so its last entry ends up the most
+// recently used; a key listed twice keeps its later value. Entries beyond the
+// capacity are dropped from the cold end and counted in
+// CacheStats.PreloadSkipped. Preloaded entries get the default TTL.
+func WithInitialData(entries []Entry) Option {
+	return func(c *SecureLRUCache) error {
+		d := CacheDump{Version: dumpVersion, Items: make(map[int]int, len(entries))}
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			if _, dup := d.Items[e.Key]; dup {
+				continue
+			}
+			d.Items[e.Key] = e.Value
+			d.Order = append(d.Order, e.Key)
+		}
+		d.Size = len(d.Order)
+		c.initial = &d
+		c.initialTTL = true
+		return nil
+	}
+}
+
+// WithInitialDump fills the cache from d before it is returned, as Restore
+// would, but keeps the capacity the cache is built with. If d holds more
+// entries, the coldest are dropped and counted in CacheStats.PreloadSkipped.
+func WithInitialDump(d CacheDump) Option {
+	return func(c *SecureLRUCache) error {
+		if err := d.validate(); err != nil {
+			return fmt.Errorf("initial dump: %w", err)
+		}
+		c.initial = &d
+		c.initialTTL = false
+		return nil
+	}
+}
+
+// preload restores the initial data given to the constructor.
+func (c *SecureLRUCache) preload() error {
+	if c.wal != nil && len(c.cache) > 0 {
+		// The write-ahead log already had something to restore.
+		c.initial = nil
+		return nil
+	}
+	given := len(c.initial.Order)
+	d := c.initial.truncate(c.capacity)
+	c.initial = nil
+	if given == 0 {
+		return nil
+	}
+	d.Capacity = c.capacity
+	d.Checksum = nil
+	if c.initialTTL && c.defaultTTL > 0 {
+		d.Expires = make(map[int]time.Time, len(d.Order))
+		for _, key := range d.Order {
+			d.Expires[key] = c.deadline(c.defaultTTL)
+		}
+	}
+	if err := c.Restore(d); err != nil {
+		return fmt.Errorf("initial data: %w", err)
+	}
+	// Restore also leaves out expired entries and unwanted tombstones.
+	c.stats.preloadSkipped.Add(int64(given - len(c.cache)))
+	return nil
+}
+
+// truncate returns d with only its first n entries in Order, copying what it
+// changes.
+func (d CacheDump) truncate(n int) CacheDump {
+	if len(d.Order) <= n {
+		return d
+	}
+	keep := d.Order[:n]
+	out := d
+	out.Order = keep
+	out.Size = n
+	out.Items = make(map[int]int, n)
+	out.Tombstones = nil
+	out.Expires, out.Frequencies, out.Costs = nil, nil, nil
+	out.Policy = nil
+	for _, key := range keep {
+		if value, ok := d.Items[key]; ok {
+			out.Items[key] = value
+		} else {
+			out.Tombstones = append(out.Tombstones, key)
+		}
+		if at, ok := d.Expires[key]; ok {
+			if out.Expires == nil {
+				out.Expires = make(map[int]time.Time)
+			}
+			out.Expires[key] = at
+		}
+		if freq, ok := d.Frequencies[key]; ok {
+			if out.Frequencies == nil {
+				out.Frequencies = make(map[int]int)
+			}
+			out.Frequencies[key] = freq
+		}
+		if cost, ok := d.Costs[key]; ok {
+			if out.Costs == nil {
+				out.Costs = make(map[int]int64)
+			}
+			out.Costs[key] = cost
+		}
+	}
+	return out
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInitialDataGetsDefaultTTL(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 4,
+		WithInitialData([]Entry{{Key: 1, Value: 10}, {Key: 2, Value: 20}}),
+		WithDefaultTTL(time.Minute),
+		WithClock(clock),
+	)
+	if v, ok := c.Get(1); !ok || v != 10 {
+		t.Fatalf("Get(1) = %d, %v before the TTL", v, ok)
+	}
+	clock.Advance(time.Minute)
+	for _, key := range []int{1, 2} {
+		if _, ok := c.Get(key); ok {
+			t.Fatalf("preloaded key %d outlived the default TTL", key)
+		}
+	}
+}
+
+func TestInitialDumpKeepsItsExpiry(t *testing.T) {
+	clock := newFakeClock()
+	src := newTestCache(t, 4, WithClock(clock))
+	src.Put(1, 10)
+	c := newTestCache(t, 4, WithInitialDump(src.Dump()), WithDefaultTTL(time.Minute), WithClock(clock))
+	clock.Advance(time.Hour)
+	if _, ok := c.Get(1); !ok {
+		t.Fatal("an entry dumped without expiry was given the default TTL")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// pressureBatch bounds how many entries one memory-pressure pass evicts, so
+// the watcher never holds the write lock for long.
+const pressureBatch = 128
+
+type memoryPressure struct {
+	threshold uint64
+	interval  time.Duration
+	read      func() uint64
+	// restore is the capacity to go back to once pressure subsides, or
+	// zero while the cache is not shrinking.
+	restore int
+}
+
+// WithMemoryPressure starts a watcher that samples heap-in-use every interval
+// and, while it is above threshold bytes, evicts a bounded batch of entries
+// per pass and lowers the capacity to match. Once the heap drops back under
+// the threshold the original capacity is restored; entries are not. A
+// threshold of zero means 90% of the runtime's soft memory limit
+// (GOMEMLIMIT), which must then be set. Close stops the watcher.
+func WithMemoryPressure(threshold uint64, interval time.Duration) Option {
+	return func(c *SecureLRUCache) error {
+		if interval <= 0 {
+			return fmt.Errorf("memory pressure interval must be positive")
+		}
+		if threshold == 0 {
+			limit := debug.SetMemoryLimit(-1)
+			if limit == math.MaxInt64 {
+				return fmt.Errorf("memory pressure threshold is required without a memory limit")
+			}
+			threshold = uint64(limit) / 10 * 9
+		}
+		if c.pressure == nil {
+			c.pressure = &memoryPressure{read: heapInUse}
+		}
+		c.pressure.threshold = threshold
+		c.pressure.interval = interval
+		return nil
+	}
+}
+
+// WithMemoryReader replaces the heap-in-use reading used by
+// WithMemoryPressure.
+func WithMemoryReader(read func() uint64) Option {
+	return func(c *SecureLRUCache) error {
+		if read == nil {
+			return fmt.Errorf("memory reader must not be nil")
+		}
+		if c.pressure == nil {
+			c.pressure = &memoryPressure{}
+		}
+		c.pressure.read = read
+		return nil
+	}
+}
+
+func heapInUse() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse
+}
+
+// ShrinkToFraction evicts in one pass until at most f×capacity entries
+// remain, leaving the capacity itself unchanged, and returns how many
+// entries it evicted.
+func (c *SecureLRUCache) ShrinkToFraction(f float64) (int, error) {
+	if !(f >= 0 && f <= 1) {
+		return 0, fmt.Errorf("fraction must be between 0 and 1")
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	return c.shrinkTo(int(f*float64(c.capacity)), len(c.cache)), nil
+}
+
+// shrinkTo evicts until the cache holds at most target entries or limit
+// entries have gone.
+func (c *SecureLRUCache) shrinkTo(target, limit int) int {
+	evicted := 0
+	for len(c.cache) > target && evicted < limit {
+		lru := c.victim()
+		if lru == nil {
+			break
+		}
+		c.evict(lru, ReasonResize)
+		c.releaseNode(lru)
+		evicted++
+	}
+	return evicted
+}
+
+func (c *SecureLRUCache) startMemoryPressure() {
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		ticker := time.NewTicker(c.pressure.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.checkMemoryPressure()
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// checkMemoryPressure runs one pass of the memory-pressure watcher.
+func (c *SecureLRUCache) checkMemoryPressure() {
+	p := c.pressure
+	inUse := p.read()
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	if inUse <= p.threshold {
+		if p.restore > 0 {
+			c.setCapacity(max(p.restore, c.capacity))
+			p.restore = 0
+		}
+		return
+	}
+
+	if p.restore == 0 {
+		p.restore = c.capacity
+	}
+	c.shrinkTo(0, pressureBatch)
+	c.setCapacity(max(1, min(c.capacity, len(c.cache))))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShrinkToFraction(t *testing.T) {
+	c := newTestCache(t, 10)
+	for k := range 10 {
+		c.Put(k, k)
+	}
+	if n, err := c.ShrinkToFraction(0.5); err != nil || n != 5 {
+		t.Fatalf("ShrinkToFraction(0.5) = %d, %v; want 5 evicted", n, err)
+	}
+	if got := c.Keys(); !slices.Equal(got, []int{9, 8, 7, 6, 5}) || c.Capacity() != 10 {
+		t.Errorf("left %v at capacity %d, want the 5 newest at 10", got, c.Capacity())
+	}
+	if n, _ := c.ShrinkToFraction(1); n != 0 {
+		t.Errorf("ShrinkToFraction(1) evicted %d", n)
+	}
+	for _, f := range []float64{-0.1, 1.5, math.NaN()} {
+		if _, err := c.ShrinkToFraction(f); err == nil {
+			t.Errorf("fraction %v accepted", f)
+		}
+	}
+}
+
+func TestMemoryPressureShrinksAndRestores(t *testing.T) {
+	var inUse atomic.Uint64
+	c := newTestCache(t, 300, WithMemoryPressure(1000, time.Hour), WithMemoryReader(inUse.Load))
+	for k := range 300 {
+		c.Put(k, k)
+	}
+
+	inUse.Store(2000)
+	c.checkMemoryPressure()
+	if c.Size() != 300-pressureBatch || c.Capacity() != 300-pressureBatch {
+		t.Fatalf("first pass left %d entries at capacity %d, want one batch fewer", c.Size(), c.Capacity())
+	}
+	c.checkMemoryPressure()
+	if c.Size() != 300-2*pressureBatch {
+		t.Fatalf("second pass left %d entries", c.Size())
+	}
+
+	inUse.Store(500)
+	c.checkMemoryPressure()
+	if c.Capacity() != 300 || c.Size() != 300-2*pressureBatch {
+		t.Errorf("after the pressure: %d entries at capacity %d, want capacity 300 back", c.Size(), c.Capacity())
+	}
+	if !c.Contains(299) || c.Contains(0) {
+		t.Error("the pressure evicted recent entries before old ones")
+	}
+}
+
+func TestMemoryPressureWatcherRuns(t *testing.T) {
+	var inUse atomic.Uint64
+	inUse.Store(2000)
+	c := newTestCache(t, 300, WithMemoryPressure(1000, time.Millisecond), WithMemoryReader(inUse.Load))
+	for k := range 300 {
+		c.Put(k, k)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for c.Size() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("watcher left %d entries under pressure", c.Size())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Collector exports a cache's statistics in the Prometheus text exposition
+// format, labeled with the cache's name. The tree has no dependencies, so it
+// writes the format itself rather than implementing prometheus.Collector;
+// serve it with PrometheusHandler or append it to an existing /metrics
+// endpoint with WritePrometheus.
+type Collector struct {
+	cache *SecureLRUCache
+	name  string
+}
+
+func NewCollector(cache *SecureLRUCache, name string) *Collector {
+	return &Collector{cache: cache, name: name}
+}
+
+type promMetric struct {
+	name  string
+	kind  string
+	help  string
+	value func(s CacheStats) float64
+}
+
+var promMetrics = []promMetric{
+	{"lru_cache_size", "gauge", "Number of entries in the cache.", func(s CacheStats) float64 { return float64(s.Size) }},
+	{"lru_cache_capacity", "gauge", "Maximum number of entries.", func(s CacheStats) float64 { return float64(s.Capacity) }},
+	{"lru_cache_memory_bytes", "gauge", "Estimated memory held by the entries.", func(s CacheStats) float64 { return float64(s.MemoryBytes) }},
+	{"lru_cache_hits_total", "counter", "Lookups that found a live entry.", func(s CacheStats) float64 { return float64(s.Hits) }},
+	{"lru_cache_misses_total", "counter", "Lookups that found nothing.", func(s CacheStats) float64 { return float64(s.Misses) }},
+	{"lru_cache_evictions_total", "counter", "Entries evicted to make room.", func(s CacheStats) float64 { return float64(s.Evictions) }},
+	{"lru_cache_expirations_total", "counter", "Entries dropped because their TTL lapsed.", func(s CacheStats) float64 { return float64(s.Expirations) }},
+}
+
+// WritePrometheus writes every metric of every collector to w, one family at
+// a time. It only reads the caches' stats snapshots and never takes their
+// write locks.
+func WritePrometheus(w io.Writer, collectors ...*Collector) error {
+	stats := make([]CacheStats, len(collectors))
+	for i, col := range collectors {
+		stats[i] = col.cache.Stats()
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, m := range promMetrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for i, col := range collectors {
+			fmt.Fprintf(bw, "%s{cache=\"%s\"} %v\n", m.name, promLabelEscaper.Replace(col.name), m.value(stats[i]))
+		}
+	}
+	return bw.Flush()
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// PrometheusHandler serves the collectors' metrics for scraping.
+func PrometheusHandler(collectors ...*Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, collectors...)
+	})
+}
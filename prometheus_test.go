@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheusAfterWorkload(t *testing.T) {
+	a := newTestCache(t, 2)
+	a.Put(1, 1)
+	a.Put(2, 2)
+	a.Put(3, 3) // evicts 1
+	a.Get(3)
+	a.Get(1)
+	b := newTestCache(t, 4)
+	b.Get(7)
+
+	var buf strings.Builder
+	if err := WritePrometheus(&buf, NewCollector(a, "a"), NewCollector(b, `odd "name"`)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE lru_cache_size gauge\n",
+		`lru_cache_size{cache="a"} 2` + "\n",
+		`lru_cache_capacity{cache="a"} 2` + "\n",
+		`lru_cache_capacity{cache="odd \"name\""} 4` + "\n",
+		"# TYPE lru_cache_hits_total counter\n",
+		`lru_cache_hits_total{cache="a"} 1` + "\n",
+		`lru_cache_misses_total{cache="a"} 1` + "\n",
+		`lru_cache_misses_total{cache="odd \"name\""} 1` + "\n",
+		`lru_cache_evictions_total{cache="a"} 1` + "\n",
+		`lru_cache_expirations_total{cache="a"} 0` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if n := strings.Count(out, "# HELP "); n != len(promMetrics) {
+		t.Errorf("%d metric families, want %d", n, len(promMetrics))
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	c := newTestCache(t, 2)
+	rec := httptest.NewRecorder()
+	PrometheusHandler(NewCollector(c, "c")).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), `lru_cache_size{cache="c"} 0`) {
+		t.Errorf("body:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// promotionInterval is how often buffered promotions are applied when nothing
+// else applies them first.
+const promotionInterval = 100 * time.Millisecond
+
+// WithAsyncPromotion makes Get serve hits under the read lock and buffer the
+// promotion in up to bufferSize slots instead of taking the write lock for
+// it. Buffered promotions are applied in order when the buffer fills, before
+// the next write, every 100ms, and by Flush and Close, so evictions work from
+// a slightly stale order. A hit that finds the buffer full is not promoted
+// and counts as a dropped promotion. It has no effect while the policy's
+// reads already share the read lock, and takes effect if SetPolicy switches
+// to one whose reads do not.
+func WithAsyncPromotion(bufferSize int) Option {
+	return func(c *SecureLRUCache) error {
+		if bufferSize < 1 {
+			return fmt.Errorf("promotion buffer size must be at least 1")
+		}
+		c.promotions = &promotionBuffer{slots: make([]*Node, bufferSize)}
+		return nil
+	}
+}
+
+// promotionBuffer collects nodes read under the read lock. Readers claim
+// distinct slots through next, and the buffer is only drained under the write
+// lock, so the slots themselves need no synchronisation.
+type promotionBuffer struct {
+	slots []*Node
+	next  atomic.Int64
+}
+
+// add buffers node, reporting whether it found a free slot and whether it
+// took the last one.
+func (b *promotionBuffer) add(node *Node) (ok, filled bool) {
+	i := b.next.Add(1) - 1
+	if i >= int64(len(b.slots)) {
+		return false, false
+	}
+	b.slots[i] = node
+	return true, i == int64(len(b.slots))-1
+}
+
+// readAccess records a read of node under the read lock if the policy allows
+// it, reporting whether it did and whether the promotion buffer is now full.
+func (c *SecureLRUCache) readAccess(node *Node) (ok, filled bool) {
+	switch {
+	case c.sharedAccess, c.frontAccess != nil && c.promotionsApplied() && c.frontAccess.AtFront(node):
+		// Neither reorders the policy, so node keeps its seq.
+		c.policy.RecordAccess(node)
+		c.noteAccess(node)
+		return true, false
+	case c.promotions != nil:
+		c.noteAccess(node)
+		ok, filled := c.promotions.add(node)
+		if !ok {
+			c.stats.droppedPromotions.Add(1)
+		}
+		return true, filled
+	}
+	return false, false
+}
+
+// promotionsApplied reports whether no promotions are buffered. Until they
+// are applied the front of the policy's order is stale, and a read of the
+// node there must be buffered behind them.
+func (c *SecureLRUCache) promotionsApplied() bool {
+	return c.promotions == nil || c.promotions.next.Load() == 0
+}
+
+// applyPromotions hands the buffered reads to the policy. The caller must
+// hold the write lock.
+func (c *SecureLRUCache) applyPromotions() {
+	b := c.promotions
+	if b == nil {
+		return
+	}
+	n := min(b.next.Load(), int64(len(b.slots)))
+	for i, node := range b.slots[:n] {
+		// Skip nodes evicted or removed since they were read.
+		if c.cache[node.key] == node {
+			c.policy.RecordAccess(node)
+			c.moved(node)
+		}
+		b.slots[i] = nil
+	}
+	b.next.Store(0)
+}
+
+// flushPromotions applies every buffered promotion now.
+func (c *SecureLRUCache) flushPromotions() {
+	if c.promotions == nil || c.promotions.next.Load() == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.applyPromotions()
+	c.unlock()
+}
+
+func (c *SecureLRUCache) startPromotions() {
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		ticker := time.NewTicker(promotionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.flushPromotions()
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
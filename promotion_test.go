@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// A serial workload never overflows the buffer, since the read that fills it
+// applies it, so once flushed the order matches immediate promotion.
+func TestAsyncPromotionMatchesImmediateOrder(t *testing.T) {
+	immediate := newTestCache(t, 16)
+	async := newTestCache(t, 16, WithAsyncPromotion(8))
+	r := rand.New(rand.NewSource(1))
+	for i := range 5000 {
+		k := r.Intn(48)
+		if r.Intn(4) == 0 {
+			immediate.Put(k, i)
+			async.Put(k, i)
+		} else {
+			v1, ok1 := immediate.Get(k)
+			v2, ok2 := async.Get(k)
+			if v1 != v2 || ok1 != ok2 {
+				t.Fatalf("op %d: Get(%d) = %d, %v; immediate promotion got %d, %v", i, k, v2, ok2, v1, ok1)
+			}
+		}
+		if i%100 == 0 {
+			async.Flush()
+			if got, want := async.Keys(), immediate.Keys(); !slices.Equal(got, want) {
+				t.Fatalf("op %d: Keys = %v, want %v", i, got, want)
+			}
+		}
+	}
+	if n := async.Stats().DroppedPromotions; n != 0 {
+		t.Errorf("a serial workload dropped %d promotions", n)
+	}
+}
+
+// BenchmarkAsyncPromotion compares hits from 32 goroutines per CPU under the
+// write lock and with promotions buffered under the read lock.
+func BenchmarkAsyncPromotion(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"write lock", nil},
+		{"async", []Option{WithAsyncPromotion(256)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			c, err := NewSecureLRUCache(1024, bc.opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer c.Close()
+			for k := range 1024 {
+				c.Put(k, k)
+			}
+			b.SetParallelism(32)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				k := rand.Int()
+				for pb.Next() {
+					c.Get(k & 1023)
+					k += 7
+				}
+			})
+			b.ReportMetric(float64(c.Stats().DroppedPromotions)/float64(b.N), "dropped/op")
+		})
+	}
+}
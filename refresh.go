@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// backgroundRefreshConcurrency is how many loader calls WithBackgroundRefresh
+// makes at once.
+const backgroundRefreshConcurrency = 4
+
+type backgroundRefresh struct {
+	interval time.Duration
+	selector func(Entry) bool
+	loader   func(ctx context.Context, key int) (int, error)
+}
+
+// WithBackgroundRefresh reloads entries before anyone has to wait for them.
+// Every interval, timed by the cache's clock if it is a TickingClock, each
+// live entry selector picks is reloaded through loader, at most
+// backgroundRefreshConcurrency at a time, and its value replaced as a Put
+// would, keeping its cost and, unless WithDefaultTTL restarts it, its
+// deadline. An entry written or removed while its reload runs keeps the
+// newer state, and one that fails to reload keeps its value; failures are
+// counted in Stats().RefreshFailures. selector runs without the lock, so it
+// may consult the cache, as HotKeys does. Close cancels the loaders' context
+// and waits for them.
+func WithBackgroundRefresh(interval time.Duration, selector func(Entry) bool, loader func(ctx context.Context, key int) (int, error)) Option {
+	return func(c *SecureLRUCache) error {
+		if interval <= 0 {
+			return fmt.Errorf("background refresh interval must be positive")
+		}
+		if selector == nil || loader == nil {
+			return fmt.Errorf("background refresh needs a selector and a loader")
+		}
+		c.refresh = &backgroundRefresh{interval: interval, selector: selector, loader: loader}
+		return nil
+	}
+}
+
+func (c *SecureLRUCache) startBackgroundRefresh() {
+	ticks, stop := newTicker(c.clock, c.refresh.interval)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		defer stop()
+		defer cancel()
+		for {
+			select {
+			case <-ticks:
+				c.refreshSelected(ctx)
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	// Cancel loaders still running when Close is called.
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// refreshSelected runs one round of background refresh and returns when it
+// has finished.
+func (c *SecureLRUCache) refreshSelected(ctx context.Context) {
+	type candidate struct {
+		entry Entry
+		node  *Node
+	}
+	var candidates []candidate
+	c.mu.RLock()
+	for key, node := range c.cache {
+		if _, loading := c.loads[key]; !loading && c.visible(node) {
+			candidates = append(candidates, candidate{Entry{Key: key, Value: node.value}, node})
+		}
+	}
+	c.mu.RUnlock()
+
+	sem := make(chan struct{}, backgroundRefreshConcurrency)
+	var wg sync.WaitGroup
+	for _, cand := range candidates {
+		if !c.refresh.selector(cand.entry) {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			c.refreshEntry(ctx, cand.entry, cand.node)
+		}()
+	}
+	wg.Wait()
+}
+
+// refreshEntry reloads entry, replacing it if node still holds the value it
+// was read with.
+func (c *SecureLRUCache) refreshEntry(ctx context.Context, entry Entry, node *Node) {
+	value, err := c.refresh.loader(ctx, entry.Key)
+	if err != nil {
+		c.stats.refreshFailures.Add(1)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+	if current, exists := c.cache[entry.Key]; !exists || current != node || node.value != entry.Value || !c.visible(node) {
+		return
+	}
+	expiresAt := node.expiresAt
+	if c.defaultTTL > 0 {
+		expiresAt = c.deadline(c.defaultTTL)
+	}
+	if _, lru, err := c.set(entry.Key, value, node.cost, expiresAt); err != nil {
+		c.stats.refreshFailures.Add(1)
+		return
+	} else if lru != nil {
+		c.releaseNode(lru)
+	}
+	c.stats.refreshes.Add(1)
+	c.wake(entry.Key, value)
+	c.record(Event{Op: EventUpdate, Key: entry.Key, Value: value})
+	c.updated(entry.Key, entry.Value, value)
+	c.traceOp(TracePut, entry.Key, true)
+	c.invalidate(Invalidation{Key: entry.Key})
+}
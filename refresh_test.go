@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedLoader loads key k as 100+k, failing for keys in fail, and blocks
+// each call until gate is closed if gate is set.
+type scriptedLoader struct {
+	mu       sync.Mutex
+	keys     []int
+	inFlight int
+	maxIn    int
+	fail     map[int]bool
+	gate     chan struct{}
+	canceled int
+}
+
+func (l *scriptedLoader) load(ctx context.Context, key int) (int, error) {
+	l.mu.Lock()
+	l.keys = append(l.keys, key)
+	l.inFlight++
+	l.maxIn = max(l.maxIn, l.inFlight)
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.inFlight--
+		l.mu.Unlock()
+	}()
+	if l.gate != nil {
+		select {
+		case <-l.gate:
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.canceled++
+			l.mu.Unlock()
+			return 0, ctx.Err()
+		}
+	}
+	if l.fail[key] {
+		return 0, errors.New("backend down")
+	}
+	return 100 + key, nil
+}
+
+func (l *scriptedLoader) snapshot() (keys []int, inFlight int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Sorted(slices.Values(l.keys)), l.inFlight
+}
+
+// waitForRefreshes waits for the background refresher to have reloaded or
+// failed to reload n entries in all.
+func waitForRefreshes(t *testing.T, c *SecureLRUCache, n int64) CacheStats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := c.Stats()
+		if st.Refreshes+st.RefreshFailures >= n {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d refreshes and %d failures after 5s, want %d", st.Refreshes, st.RefreshFailures, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func even(e Entry) bool { return e.Key%2 == 0 }
+
+func TestBackgroundRefreshReloadsSelectedEntries(t *testing.T) {
+	clock := newFakeClock()
+	loader := &scriptedLoader{fail: map[int]bool{4: true}}
+	c := newTestCache(t, 16, WithClock(clock), WithBackgroundRefresh(time.Minute, even, loader.load))
+	for k := range 10 {
+		c.Put(k, k)
+	}
+
+	clock.Advance(time.Minute)
+	st := waitForRefreshes(t, c, 5)
+	if st.Refreshes != 4 || st.RefreshFailures != 1 {
+		t.Errorf("%d refreshes and %d failures, want 4 and 1", st.Refreshes, st.RefreshFailures)
+	}
+	if keys, _ := loader.snapshot(); !slices.Equal(keys, []int{0, 2, 4, 6, 8}) {
+		t.Errorf("loader asked for %v, want the even keys", keys)
+	}
+	for k := range 10 {
+		want := k
+		if k%2 == 0 && k != 4 {
+			want = 100 + k
+		}
+		if v, _ := c.Peek(k); v != want {
+			t.Errorf("key %d = %d, want %d", k, v, want)
+		}
+	}
+	// Like a Put, a refresh counts as a use, so the rest are now the oldest.
+	if got := c.Keys()[4:]; !slices.Equal(got, []int{9, 7, 5, 4, 3, 1}) {
+		t.Errorf("oldest keys %v, want the unrefreshed ones", got)
+	}
+}
+
+func TestBackgroundRefreshCapsConcurrency(t *testing.T) {
+	clock := newFakeClock()
+	loader := &scriptedLoader{gate: make(chan struct{})}
+	all := func(Entry) bool { return true }
+	c := newTestCache(t, 32, WithClock(clock), WithBackgroundRefresh(time.Minute, all, loader.load))
+	for k := range 20 {
+		c.Put(k, k)
+	}
+
+	clock.Advance(time.Minute)
+	deadline := time.Now().Add(5 * time.Second)
+	for _, n := loader.snapshot(); n < backgroundRefreshConcurrency; _, n = loader.snapshot() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d loads running, want %d", n, backgroundRefreshConcurrency)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(loader.gate)
+	waitForRefreshes(t, c, 20)
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	if loader.maxIn != backgroundRefreshConcurrency {
+		t.Errorf("%d loads ran at once, want %d", loader.maxIn, backgroundRefreshConcurrency)
+	}
+}
+
+func TestBackgroundRefreshYieldsToWrites(t *testing.T) {
+	clock := newFakeClock()
+	loader := &scriptedLoader{gate: make(chan struct{})}
+	c := newTestCache(t, 16, WithClock(clock), WithBackgroundRefresh(time.Minute, even, loader.load))
+	c.Put(0, 0)
+	c.Put(2, 2)
+
+	clock.Advance(time.Minute)
+	for keys, _ := loader.snapshot(); len(keys) < 2; keys, _ = loader.snapshot() {
+		time.Sleep(time.Millisecond)
+	}
+	c.Put(0, 999)
+	c.Remove(2)
+	close(loader.gate)
+	// Close waits for the round to finish.
+	c.Close()
+	if v, _ := c.Peek(0); v != 999 {
+		t.Errorf("key 0 = %d, want the Put made during its reload", v)
+	}
+	if c.Contains(2) {
+		t.Error("a reload brought back a removed key")
+	}
+	if st := c.Stats(); st.Refreshes != 0 {
+		t.Errorf("%d refreshes, want none", st.Refreshes)
+	}
+}
+
+func TestBackgroundRefreshStopsOnClose(t *testing.T) {
+	clock := newFakeClock()
+	loader := &scriptedLoader{gate: make(chan struct{})}
+	c, err := NewSecureLRUCache(16, WithClock(clock), WithBackgroundRefresh(time.Minute, even, loader.load))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(0, 0)
+	clock.Advance(time.Minute)
+	for keys, _ := loader.snapshot(); len(keys) < 1; keys, _ = loader.snapshot() {
+		time.Sleep(time.Millisecond)
+	}
+	c.Close()
+	if loader.canceled != 1 {
+		t.Errorf("%d loads canceled by Close, want 1", loader.canceled)
+	}
+	clock.Advance(time.Minute)
+	if keys, _ := loader.snapshot(); len(keys) != 1 {
+		t.Errorf("loader called %d times, want no call after Close", len(keys))
+	}
+}
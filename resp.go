@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// respMaxInline bounds an inline command and any protocol line.
+	respMaxInline = 64 << 10
+	// respMaxArgs bounds the elements of a multibulk command.
+	respMaxArgs = 1 << 16
+	// respMaxBulk bounds a bulk string. Values are cache ints, so anything
+	// near this is already unstorable.
+	respMaxBulk = 1 << 20
+)
+
+// respProtocolError is a request the connection cannot recover from: the
+// server replies with it and closes the connection, as Redis does.
+type respProtocolError struct{ msg string }
+
+func (e *respProtocolError) Error() string { return "Protocol error: " + e.msg }
+
+// readRESPCommand reads one command in either form Redis accepts: a
+// multibulk array of bulk strings, as client libraries send, or an inline
+// line of space-separated words, as typed into telnet. Inline commands do
+// not support quoting. An empty command is returned as no args and no
+// error.
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] != '*' {
+		line, err := readLine(r)
+		if errors.Is(err, errLineTooLong) {
+			return nil, &respProtocolError{"too big inline request"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(string(line)), nil
+	}
+
+	n, err := readRESPLength(r, '*', respMaxArgs, "invalid multibulk length")
+	if err != nil || n <= 0 {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		size, err := readRESPLength(r, '$', respMaxBulk, "invalid bulk length")
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, &respProtocolError{"invalid bulk length"}
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		if data[size] != '\r' || data[size+1] != '\n' {
+			return nil, &respProtocolError{"expected CRLF after bulk string"}
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+// readRESPLength reads a "<prefix><n>" line, such as "*3" or "$5". A
+// negative n is returned as is; one above limit, or a line that does not
+// parse, is a protocol error described by msg.
+func readRESPLength(r *bufio.Reader, prefix byte, limit int, msg string) (int, error) {
+	line, err := readLine(r)
+	if errors.Is(err, errLineTooLong) {
+		return 0, &respProtocolError{msg}
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(line) == 0 || line[0] != prefix {
+		got := "EOL"
+		if len(line) > 0 {
+			got = strconv.QuoteRune(rune(line[0]))
+		}
+		return 0, &respProtocolError{fmt.Sprintf("expected '%c', got %s", prefix, got)}
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > limit {
+		return 0, &respProtocolError{msg}
+	}
+	return n, nil
+}
+
+// respWriter serializes RESP2 replies.
+type respWriter struct {
+	w *bufio.Writer
+}
+
+func (w respWriter) simple(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+// error writes an error reply. msg should start with the error's kind, as
+// in "ERR unknown command"; newlines in it are replaced, since they would
+// end the reply.
+func (w respWriter) error(msg string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(strings.NewReplacer("\r", " ", "\n", " ").Replace(msg))
+	w.w.WriteString("\r\n")
+}
+
+func (w respWriter) integer(n int64) {
+	w.w.WriteByte(':')
+	w.w.WriteString(strconv.FormatInt(n, 10))
+	w.w.WriteString("\r\n")
+}
+
+func (w respWriter) bulk(b []byte) {
+	w.w.WriteByte('$')
+	w.w.WriteString(strconv.Itoa(len(b)))
+	w.w.WriteString("\r\n")
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+// null writes the null bulk string, RESP2's missing value.
+func (w respWriter) null() {
+	w.w.WriteString("$-1\r\n")
+}
+
+// array starts an array of n elements, which the caller writes next.
+func (w respWriter) array(n int) {
+	w.w.WriteByte('*')
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
+
+// respMatch reports whether name matches the KEYS glob pattern: * matches
+// any run, ? any one byte, [abc], [^abc] and [a-z] a set, and \ quotes the
+// next byte.
+func respMatch(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if respMatch(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+		case '[':
+			if len(name) == 0 {
+				return false
+			}
+			var ok bool
+			ok, pattern = respMatchSet(pattern[1:], name[0])
+			if !ok {
+				return false
+			}
+			name = name[1:]
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(name) == 0 || name[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// respMatchSet matches c against the set at the start of pattern, just past
+// its '[', returning the pattern after the closing ']'. An unclosed set runs
+// to the end of the pattern.
+func respMatchSet(pattern string, c byte) (bool, string) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+	match := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		lo := pattern[0]
+		if lo == '\\' && len(pattern) > 1 {
+			pattern = pattern[1:]
+			lo = pattern[0]
+		}
+		pattern = pattern[1:]
+		hi := lo
+		if len(pattern) > 1 && pattern[0] == '-' && pattern[1] != ']' {
+			hi = pattern[1]
+			pattern = pattern[2:]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+		}
+		if lo <= c && c <= hi {
+			match = true
+		}
+	}
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+	return match != negate, pattern
+}
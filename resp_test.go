@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadRESPCommand(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		want [][]string
+	}{
+		{"multibulk", "*2\r\n$3\r\nGET\r\n$1\r\na\r\n", [][]string{{"GET", "a"}}},
+		{"binary safe", "*2\r\n$4\r\nE\r\nX\r\n$0\r\n\r\n", [][]string{{"E\r\nX", ""}}},
+		{"inline", "SET  a 1\r\n", [][]string{{"SET", "a", "1"}}},
+		{"inline bare newline", "get a\n", [][]string{{"get", "a"}}},
+		{"empty inline", "\r\nPING\r\n", [][]string{nil, {"PING"}}},
+		{"empty multibulk", "*0\r\n*-1\r\n*1\r\n$4\r\nPING\r\n", [][]string{nil, nil, {"PING"}}},
+		{"pipelined", "*1\r\n$4\r\nPING\r\nDBSIZE\r\n", [][]string{{"PING"}, {"DBSIZE"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := bufio.NewReaderSize(strings.NewReader(tc.in), respMaxInline)
+			for i, want := range tc.want {
+				got, err := readRESPCommand(r)
+				if err != nil {
+					t.Fatalf("command %d: %v", i, err)
+				}
+				if !slices.Equal(got, want) {
+					t.Fatalf("command %d = %q, want %q", i, got, want)
+				}
+			}
+			if _, err := readRESPCommand(r); err != io.EOF {
+				t.Errorf("after the last command: %v, want EOF", err)
+			}
+		})
+	}
+}
+
+func TestReadRESPCommandProtocolErrors(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"*x\r\n", "invalid multibulk length"},
+		{"*99999999\r\n", "invalid multibulk length"},
+		{"*1\r\n:1\r\n", "expected '$', got ':'"},
+		{"*1\r\n\r\n", "expected '$', got EOL"},
+		{"*1\r\n$-1\r\n", "invalid bulk length"},
+		{"*1\r\n$abc\r\n", "invalid bulk length"},
+		{"*1\r\n$99999999\r\n", "invalid bulk length"},
+		{"*1\r\n$1\r\nab\r\n", "expected CRLF after bulk string"},
+		{strings.Repeat("a", respMaxInline+1), "too big inline request"},
+	} {
+		r := bufio.NewReaderSize(strings.NewReader(tc.in), respMaxInline)
+		_, err := readRESPCommand(r)
+		var perr *respProtocolError
+		if !errors.As(err, &perr) || perr.msg != tc.want {
+			t.Errorf("%.20q: err = %v, want protocol error %q", tc.in, err, tc.want)
+		}
+	}
+
+	// A command cut short is a read error, not a protocol error.
+	r := bufio.NewReader(strings.NewReader("*2\r\n$3\r\nGET\r\n"))
+	if _, err := readRESPCommand(r); err != io.EOF {
+		t.Errorf("truncated command: %v, want EOF", err)
+	}
+	r = bufio.NewReader(strings.NewReader("*1\r\n$3\r\nGE"))
+	if _, err := readRESPCommand(r); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated bulk: %v, want ErrUnexpectedEOF", err)
+	}
+}
+
+func TestRESPWriter(t *testing.T) {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	w := respWriter{bw}
+	w.simple("OK")
+	w.error("ERR bad\r\nthing")
+	w.integer(-2)
+	w.bulk([]byte("a\r\nb"))
+	w.bulk(nil)
+	w.null()
+	w.array(2)
+	w.bulk([]byte("x"))
+	w.integer(7)
+	w.array(0)
+	bw.Flush()
+
+	want := "+OK\r\n" +
+		"-ERR bad  thing\r\n" +
+		":-2\r\n" +
+		"$4\r\na\r\nb\r\n" +
+		"$0\r\n\r\n" +
+		"$-1\r\n" +
+		"*2\r\n$1\r\nx\r\n:7\r\n" +
+		"*0\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+func TestRESPMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*", "", true},
+		{"*", "a/b", true},
+		{"user:*", "user:1", true},
+		{"user:*", "users:1", false},
+		{"*:1", "user:1", true},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "aXbY", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[c-a]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{`[\]]`, "]", true},
+		{"[abc", "b", true},
+		{"exact", "exact", true},
+		{"exact", "exactly", false},
+	} {
+		if got := respMatch(tc.pattern, tc.name); got != tc.want {
+			t.Errorf("respMatch(%q, %q) = %v, want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RESPServer serves a SecureLRUCache to Redis clients over RESP2: GET, SET
+// with EX, PX, NX and XX, DEL, EXISTS, TTL, EXPIRE, KEYS, DBSIZE and
+// FLUSHALL, plus the PING, COMMAND and QUIT that clients send on their own.
+// String keys are mapped onto the cache's int keys by keys and values by
+// values, as with MemcachedServer. Since the mapping is one-way, KEYS lists
+// only keys written through a RESPServer, but DBSIZE counts every entry.
+type RESPServer struct {
+	cache  *SecureLRUCache
+	keys   func(key string) int
+	values ValueCodec
+	conns  connServer
+
+	// names maps int keys back to the strings written, for KEYS. Names
+	// outlive their entries until the next prune.
+	namesMu sync.Mutex
+	names   map[int]string
+}
+
+// NewRESPServer serves cache. keys defaults to HashKey and values to
+// DecimalCodec when nil.
+func NewRESPServer(cache *SecureLRUCache, keys func(key string) int, values ValueCodec) (*RESPServer, error) {
+	if cache == nil {
+		return nil, fmt.Errorf("cache must not be nil")
+	}
+	if keys == nil {
+		keys = HashKey
+	}
+	if values == nil {
+		values = DecimalCodec{}
+	}
+	return &RESPServer{cache: cache, keys: keys, values: values, names: make(map[int]string)}, nil
+}
+
+// Serve accepts connections on ln until Close, serving each on its own
+// goroutine. It returns nil once closed.
+func (s *RESPServer) Serve(ln net.Listener) error {
+	return s.conns.serve(ln, func(conn net.Conn) { s.ServeConn(conn) })
+}
+
+// Close stops Serve, closes every open connection and waits for their
+// goroutines to finish. It does not close the cache.
+func (s *RESPServer) Close() error {
+	return s.conns.close()
+}
+
+// ServeConn runs the protocol on conn until the client quits, sends a
+// request that cannot be parsed, or the connection fails, then closes it.
+func (s *RESPServer) ServeConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+	r := bufio.NewReaderSize(conn, respMaxInline)
+	bw := bufio.NewWriter(conn)
+	w := respWriter{bw}
+	for {
+		args, err := readRESPCommand(r)
+		var perr *respProtocolError
+		if errors.As(err, &perr) {
+			w.error("ERR " + perr.Error())
+			bw.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		if len(args) > 0 && !s.handle(args, w) {
+			bw.Flush()
+			return
+		}
+		if r.Buffered() == 0 {
+			if err := bw.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// respArity is each command's argument count, the command included; a
+// negative count is a minimum.
+var respArity = map[string]int{
+	"GET":      2,
+	"SET":      -3,
+	"DEL":      -2,
+	"EXISTS":   -2,
+	"TTL":      2,
+	"EXPIRE":   3,
+	"KEYS":     2,
+	"DBSIZE":   1,
+	"FLUSHALL": -1,
+	"PING":     -1,
+	"COMMAND":  -1,
+	"QUIT":     1,
+}
+
+// handle runs one command, reporting false if the connection should close.
+func (s *RESPServer) handle(args []string, w respWriter) bool {
+	cmd := strings.ToUpper(args[0])
+	arity, ok := respArity[cmd]
+	if !ok {
+		w.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return true
+	}
+	if (arity > 0 && len(args) != arity) || (arity < 0 && len(args) < -arity) {
+		w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+		return true
+	}
+
+	switch cmd {
+	case "GET":
+		s.get(args[1], w)
+	case "SET":
+		s.set(args[1:], w)
+	case "DEL":
+		var n int64
+		for _, name := range args[1:] {
+			key := s.keys(name)
+			if s.cache.Remove(key) {
+				n++
+			}
+			s.forget(key)
+		}
+		w.integer(n)
+	case "EXISTS":
+		var n int64
+		for _, name := range args[1:] {
+			if s.cache.Contains(s.keys(name)) {
+				n++
+			}
+		}
+		w.integer(n)
+	case "TTL":
+		s.ttl(args[1], w)
+	case "EXPIRE":
+		s.expire(args[1], args[2], w)
+	case "KEYS":
+		s.keysMatching(args[1], w)
+	case "DBSIZE":
+		w.integer(int64(s.cache.Size()))
+	case "FLUSHALL":
+		if len(args) > 2 || (len(args) == 2 && !strings.EqualFold(args[1], "ASYNC") && !strings.EqualFold(args[1], "SYNC")) {
+			w.error("ERR syntax error")
+			return true
+		}
+		s.cache.Clear()
+		s.namesMu.Lock()
+		clear(s.names)
+		s.namesMu.Unlock()
+		w.simple("OK")
+	case "PING":
+		switch len(args) {
+		case 1:
+			w.simple("PONG")
+		case 2:
+			w.bulk([]byte(args[1]))
+		default:
+			w.error("ERR wrong number of arguments for 'ping' command")
+		}
+	case "COMMAND":
+		// Clients ask for command docs on connect; there are none to give.
+		w.array(0)
+	case "QUIT":
+		w.simple("OK")
+		return false
+	}
+	return true
+}
+
+func (s *RESPServer) get(name string, w respWriter) {
+	value, ok := s.cache.Get(s.keys(name))
+	if !ok {
+		w.null()
+		return
+	}
+	data, err := s.values.Decode(value)
+	if err != nil {
+		w.error("ERR " + err.Error())
+		return
+	}
+	w.bulk(data)
+}
+
+// set runs "SET key value [NX|XX] [EX seconds|PX milliseconds]", replying
+// with the null bulk string when NX or XX stops the write. Without EX or PX
+// the entry gets the cache's default TTL, as with Put.
+func (s *RESPServer) set(args []string, w respWriter) {
+	name := args[0]
+	cond := writeAlways
+	var ttl time.Duration
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case (opt == "NX" || opt == "XX") && cond == writeAlways:
+			cond = writeIfAbsent
+			if opt == "XX" {
+				cond = writeIfPresent
+			}
+		case (opt == "EX" || opt == "PX") && ttl == 0 && i+1 < len(args):
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			if err != nil || n <= 0 || n > int64(1<<62)/int64(unit) {
+				w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl = time.Duration(n) * unit
+		default:
+			w.error("ERR syntax error")
+			return
+		}
+	}
+	if ttl == 0 {
+		ttl = s.cache.defaultTTL
+	}
+	value, err := s.values.Encode([]byte(args[1]))
+	if err != nil {
+		w.error("ERR value is not an integer or out of range")
+		return
+	}
+
+	key := s.keys(name)
+	_, _, written, err := s.cache.writeIf(key, value, 1, ttl, cond)
+	switch {
+	case err != nil:
+		w.error("ERR " + err.Error())
+	case !written:
+		w.null()
+	default:
+		s.remember(key, name)
+		w.simple("OK")
+	}
+}
+
+// ttl replies with the seconds left on name's entry, rounded to the
+// nearest second, -1 if it has no TTL and -2 if there is no entry.
+func (s *RESPServer) ttl(name string, w respWriter) {
+	info, ok := s.cache.EntryInfo(s.keys(name))
+	switch {
+	case !ok:
+		w.integer(-2)
+	case info.ExpiresAt.IsZero():
+		w.integer(-1)
+	default:
+		left := info.ExpiresAt.Sub(s.cache.clock.Now())
+		w.integer(int64((left + time.Second/2) / time.Second))
+	}
+}
+
+// expire runs "EXPIRE key seconds". A timeout that is not positive deletes
+// the entry, as in Redis.
+func (s *RESPServer) expire(name, seconds string, w respWriter) {
+	n, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil || n > int64(1<<62)/int64(time.Second) {
+		w.error("ERR value is not an integer or out of range")
+		return
+	}
+	key := s.keys(name)
+	var ok bool
+	if n <= 0 {
+		ok = s.cache.Remove(key)
+		s.forget(key)
+	} else {
+		ok = s.cache.Touch(key, time.Duration(n)*time.Second)
+	}
+	if ok {
+		w.integer(1)
+	} else {
+		w.integer(0)
+	}
+}
+
+// keysMatching replies with the known names of resident entries that match
+// pattern, dropping the names of entries that are gone.
+func (s *RESPServer) keysMatching(pattern string, w respWriter) {
+	s.namesMu.Lock()
+	var matched []string
+	for key, name := range s.names {
+		if !s.cache.Contains(key) {
+			delete(s.names, key)
+			continue
+		}
+		if respMatch(pattern, name) {
+			matched = append(matched, name)
+		}
+	}
+	s.namesMu.Unlock()
+
+	w.array(len(matched))
+	for _, name := range matched {
+		w.bulk([]byte(name))
+	}
+}
+
+// remember records name for key. Once the names far outnumber what the
+// cache can hold, the ones whose entries are gone are dropped, so evictions
+// do not leak them.
+func (s *RESPServer) remember(key int, name string) {
+	s.namesMu.Lock()
+	defer s.namesMu.Unlock()
+	s.names[key] = name
+	if len(s.names) <= 2*s.cache.Capacity()+64 {
+		return
+	}
+	for key := range s.names {
+		if !s.cache.Contains(key) {
+			delete(s.names, key)
+		}
+	}
+}
+
+func (s *RESPServer) forget(key int) {
+	s.namesMu.Lock()
+	delete(s.names, key)
+	s.namesMu.Unlock()
+}
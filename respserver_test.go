@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// respClient is a minimal Redis client over TCP: it sends commands as
+// multibulk arrays and decodes the replies.
+type respClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// respErr is an error reply, kept apart from simple strings.
+type respErr string
+
+func startRESPServer(t *testing.T, c *SecureLRUCache) string {
+	t.Helper()
+	srv, err := NewRESPServer(c, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+	t.Cleanup(func() {
+		srv.Close()
+		if err := <-served; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return ln.Addr().String()
+}
+
+func dialRESP(t *testing.T, addr string) *respClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &respClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// do sends args and returns the decoded reply: a string for simple and bulk
+// strings, respErr, int64, nil for the null bulk string, or []any.
+func (c *respClient) do(args ...string) any {
+	c.t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.reply()
+}
+
+func (c *respClient) reply() any {
+	c.t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	body := line[1:]
+	switch line[0] {
+	case '+':
+		return body
+	case '-':
+		return respErr(body)
+	case ':':
+		n, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			c.t.Fatalf("bad integer reply %q", line)
+		}
+		return n
+	case '$':
+		n, _ := strconv.Atoi(body)
+		if n < 0 {
+			return nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			c.t.Fatal(err)
+		}
+		return string(data[:n])
+	case '*':
+		n, _ := strconv.Atoi(body)
+		elems := make([]any, n)
+		for i := range elems {
+			elems[i] = c.reply()
+		}
+		return elems
+	}
+	c.t.Fatalf("bad reply %q", line)
+	return nil
+}
+
+func (c *respClient) expect(want any, args ...string) {
+	c.t.Helper()
+	if got := c.do(args...); fmt.Sprint(got) != fmt.Sprint(want) {
+		c.t.Errorf("%q = %#v, want %#v", args, got, want)
+	}
+}
+
+func TestRESPCommands(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 8, WithClock(clock))
+	r := dialRESP(t, startRESPServer(t, c))
+
+	r.expect("PONG", "PING")
+	r.expect("hi", "ping", "hi")
+	r.expect(nil, "GET", "a")
+	r.expect("OK", "SET", "a", "1")
+	r.expect("1", "get", "a")
+	r.expect(nil, "SET", "a", "2", "NX")
+	r.expect("OK", "SET", "b", "2", "NX")
+	r.expect(nil, "SET", "c", "3", "XX")
+	r.expect("OK", "SET", "a", "3", "XX")
+	r.expect("3", "GET", "a")
+	r.expect(int64(3), "EXISTS", "a", "b", "c", "a")
+	r.expect(int64(2), "DBSIZE")
+	r.expect(int64(2), "DEL", "a", "b", "c")
+	r.expect(int64(0), "DBSIZE")
+	r.expect([]any{}, "COMMAND", "DOCS")
+
+	// TTLs.
+	r.expect("OK", "SET", "t", "1", "EX", "10")
+	r.expect("OK", "SET", "p", "1", "px", "1500")
+	r.expect("OK", "SET", "n", "1")
+	r.expect(int64(10), "TTL", "t")
+	r.expect(int64(2), "TTL", "p")
+	r.expect(int64(-1), "TTL", "n")
+	r.expect(int64(-2), "TTL", "missing")
+	clock.Advance(2 * time.Second)
+	r.expect(nil, "GET", "p")
+	r.expect(int64(1), "EXPIRE", "n", "5")
+	r.expect(int64(5), "TTL", "n")
+	r.expect(int64(0), "EXPIRE", "missing", "5")
+	r.expect(int64(1), "EXPIRE", "t", "0")
+	r.expect(nil, "GET", "t")
+	clock.Advance(5 * time.Second)
+	r.expect(nil, "GET", "n")
+
+	r.expect("OK", "SET", "x", "1")
+	r.expect("OK", "FLUSHALL")
+	r.expect(int64(0), "DBSIZE")
+	r.expect("OK", "QUIT")
+	if _, err := r.r.ReadByte(); err != io.EOF {
+		t.Errorf("after QUIT: %v, want EOF", err)
+	}
+}
+
+func TestRESPSetUsesDefaultTTL(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 8, WithClock(clock), WithDefaultTTL(time.Minute))
+	r := dialRESP(t, startRESPServer(t, c))
+	r.expect("OK", "SET", "d", "1")
+	r.expect("OK", "SET", "nx", "1", "NX")
+	r.expect("OK", "SET", "ex", "1", "EX", "300")
+	r.expect(int64(60), "TTL", "d")
+	r.expect(int64(60), "TTL", "nx")
+	r.expect(int64(300), "TTL", "ex")
+	clock.Advance(2 * time.Minute)
+	r.expect(nil, "GET", "d")
+	r.expect("1", "GET", "ex")
+}
+
+// TestRESPRawOverTCP checks the exact bytes of a pipelined exchange, as a
+// Redis client writes and reads them, rather than going through respClient.
+func TestRESPRawOverTCP(t *testing.T) {
+	conn, err := net.Dial("tcp", startRESPServer(t, newTestCache(t, 8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := "*1\r\n$4\r\nPING\r\n" +
+		"*3\r\n$3\r\nSET\r\n$5\r\nuser1\r\n$2\r\n42\r\n" +
+		"*2\r\n$3\r\nGET\r\n$5\r\nuser1\r\n" +
+		"*2\r\n$3\r\nGET\r\n$7\r\nmissing\r\n" +
+		"*2\r\n$4\r\nKEYS\r\n$1\r\n*\r\n" +
+		"*3\r\n$3\r\nSET\r\n$1\r\nx\r\n$3\r\nabc\r\n" +
+		"*2\r\n$3\r\nDEL\r\n$5\r\nuser1\r\n" +
+		"*1\r\n$4\r\nQUIT\r\n"
+	want := "+PONG\r\n" +
+		"+OK\r\n" +
+		"$2\r\n42\r\n" +
+		"$-1\r\n" +
+		"*1\r\n$5\r\nuser1\r\n" +
+		"-ERR value is not an integer or out of range\r\n" +
+		":1\r\n" +
+		"+OK\r\n"
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("replies %q, want %q", got, want)
+	}
+}
+
+func TestRESPKeys(t *testing.T) {
+	c := newTestCache(t, 3)
+	r := dialRESP(t, startRESPServer(t, c))
+	for i, name := range []string{"user:1", "user:2", "order:1", "user:3"} {
+		r.expect("OK", "SET", name, strconv.Itoa(i))
+	}
+	keys := func(pattern string) []string {
+		t.Helper()
+		var names []string
+		for _, v := range r.do("KEYS", pattern).([]any) {
+			names = append(names, v.(string))
+		}
+		slices.Sort(names)
+		return names
+	}
+	// user:1 was evicted.
+	if got, want := keys("*"), []string{"order:1", "user:2", "user:3"}; !slices.Equal(got, want) {
+		t.Errorf("KEYS * = %q, want %q", got, want)
+	}
+	if got, want := keys("user:*"), []string{"user:2", "user:3"}; !slices.Equal(got, want) {
+		t.Errorf("KEYS user:* = %q, want %q", got, want)
+	}
+	r.expect(int64(1), "DEL", "user:2")
+	if got, want := keys("user:?"), []string{"user:3"}; !slices.Equal(got, want) {
+		t.Errorf("KEYS user:? = %q, want %q", got, want)
+	}
+}
+
+func TestRESPNamesDoNotLeak(t *testing.T) {
+	c := newTestCache(t, 4)
+	srv, err := NewRESPServer(c, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	var in strings.Builder
+	for i := range 1000 {
+		fmt.Fprintf(&in, "SET k%d %d\r\n", i, i)
+	}
+	srv.ServeConn(struct {
+		io.Reader
+		io.Writer
+		io.Closer
+	}{strings.NewReader(in.String()), &out, io.NopCloser(nil)})
+	if got := strings.Count(out.String(), "+OK\r\n"); got != 1000 {
+		t.Fatalf("%d of 1000 SETs succeeded", got)
+	}
+	if n := len(srv.names); n > 2*c.Capacity()+64 {
+		t.Errorf("%d names kept for a cache of %d entries", n, c.Capacity())
+	}
+}
+
+func TestRESPErrors(t *testing.T) {
+	r := dialRESP(t, startRESPServer(t, newTestCache(t, 8)))
+	for _, tc := range []struct {
+		args []string
+		want respErr
+	}{
+		{[]string{"HGET", "a", "b"}, "ERR unknown command 'HGET'"},
+		{[]string{"GET"}, "ERR wrong number of arguments for 'get' command"},
+		{[]string{"GET", "a", "b"}, "ERR wrong number of arguments for 'get' command"},
+		{[]string{"SET", "a"}, "ERR wrong number of arguments for 'set' command"},
+		{[]string{"SET", "a", "1", "EX"}, "ERR syntax error"},
+		{[]string{"SET", "a", "1", "NX", "XX"}, "ERR syntax error"},
+		{[]string{"SET", "a", "1", "EX", "1", "PX", "1"}, "ERR syntax error"},
+		{[]string{"SET", "a", "1", "EX", "0"}, "ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "a", "1", "PX", "soon"}, "ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "a", "text"}, "ERR value is not an integer or out of range"},
+		{[]string{"EXPIRE", "a", "x"}, "ERR value is not an integer or out of range"},
+		{[]string{"FLUSHALL", "LATER"}, "ERR syntax error"},
+		{[]string{"PING", "a", "b"}, "ERR wrong number of arguments for 'ping' command"},
+	} {
+		r.expect(tc.want, tc.args...)
+	}
+	// Error replies leave the connection usable, but a protocol error
+	// closes it.
+	r.expect("PONG", "PING")
+	io.WriteString(r.conn, "*1\r\n$x\r\n")
+	r.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if got := r.reply(); got != respErr("ERR Protocol error: invalid bulk length") {
+		t.Errorf("protocol error reply = %#v", got)
+	}
+	if _, err := r.r.ReadByte(); err != io.EOF {
+		t.Errorf("after a protocol error: %v, want EOF", err)
+	}
+}
+
+func TestRESPInlineCommands(t *testing.T) {
+	r := dialRESP(t, startRESPServer(t, newTestCache(t, 8)))
+	r.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(r.conn, "SET a 5\r\nGET a\r\nDBSIZE\r\n")
+	for _, want := range []any{"OK", "5", int64(1)} {
+		if got := r.reply(); got != want {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	}
+}
+
+func TestServeRESPUntilCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addrs := make(chan string, 1)
+	code := make(chan int, 1)
+	var stderr bytes.Buffer
+	go func() {
+		code <- serveRESP(ctx, []string{"-addr", "127.0.0.1:0"}, &stderr, func(addr string) { addrs <- addr })
+	}()
+	r := dialRESP(t, <-addrs)
+	r.expect("OK", "SET", "a", "42")
+	r.expect("42", "GET", "a")
+
+	cancel()
+	if got := <-code; got != 0 {
+		t.Errorf("serveRESP exited %d: %s", got, stderr.String())
+	}
+}
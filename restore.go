@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+)
+
+// dumpVersion is the format version Dump and the snapshot writers produce.
+// Version 2 added entry expiry times, version 3 checksums and version 4 entry
+// costs. Restore reads every version up to it; a dump without a version is
+// version 1.
+const dumpVersion = 4
+
+var (
+	// ErrDumpSizeMismatch reports a dump whose Size disagrees with its Order,
+	// Items and Tombstones.
+	ErrDumpSizeMismatch = errors.New("dump size does not match its entries")
+	// ErrDumpUnknownKey reports a key in Order, Expires, Frequencies or Costs that has no
+	// item or tombstone, or an item that is missing from Order.
+	ErrDumpUnknownKey = errors.New("dump order and items disagree")
+	// ErrDumpDuplicateKey reports a key listed twice in Order, or held both
+	// as an item and a tombstone.
+	ErrDumpDuplicateKey = errors.New("dump lists a key twice")
+	// ErrDumpOverCapacity reports a dump holding more entries than its
+	// Capacity, a Capacity below 1, or entries that do not fit the cache's
+	// cost and byte budgets.
+	ErrDumpOverCapacity = errors.New("dump does not fit its capacity")
+)
+
+// NewFromDump builds a cache with the dump's capacity and contents. Options
+// apply as for NewSecureLRUCache, including the policy the dump is restored
+// into.
+func NewFromDump(d CacheDump, opts ...Option) (*SecureLRUCache, error) {
+	c, err := NewSecureLRUCache(d.Capacity, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Restore(d); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// FromJSON builds a cache from the output of ToJSON.
+func FromJSON(s string, opts ...Option) (*SecureLRUCache, error) {
+	var d CacheDump
+	if err := json.Unmarshal([]byte(s), &d); err != nil {
+		return nil, fmt.Errorf("decode dump: %w", err)
+	}
+	return NewFromDump(d, opts...)
+}
+
+// Restore replaces the cache's contents and capacity with the dump's. Entries
+// are ordered so that Dump lists them as d.Order does, and a policy that
+// implements RestorablePolicy rebuilds its internal state from d.Policy when
+// the names match; LFU keeps the dumped frequencies, while LRU-K histories and
+// CLOCK reference bits are not dumped and start empty. Entries keep their
+// costs, and those from version 1 dumps get the cache's default TTL.
+// Tombstones are only restored with negative caching enabled. A dump that
+// fails validation leaves the cache unchanged.
+func (c *SecureLRUCache) Restore(d CacheDump) error {
+	if err := d.validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	plan, err := c.planRestore(d)
+	if err != nil {
+		return err
+	}
+	return c.applyRestore(d, plan)
+}
+
+// restorePlan is the nodes a restore installs and what they cost.
+type restorePlan struct {
+	nodes      map[int]*Node
+	totalCost  int64
+	totalBytes int64
+}
+
+// planRestore builds the nodes for a validated dump and checks they fit the
+// cache's budgets, changing nothing. The caller holds the write lock.
+func (c *SecureLRUCache) planRestore(d CacheDump) (restorePlan, error) {
+	now := c.clock.Now()
+	nodes := make(map[int]*Node, d.Size)
+	var totalCost, totalBytes int64
+	for _, key := range d.Order {
+		node := &Node{key: key, cost: 1, createdAt: now}
+		if cost, ok := d.Costs[key]; ok {
+			node.cost = cost
+		}
+		if value, ok := d.Items[key]; ok {
+			node.value = value
+			// Version 1 dumps carry no expiry, so their entries get the
+			// default TTL; from version 2 a missing expiry means none.
+			if d.Version < 2 {
+				node.expiresAt = c.deadline(c.defaultTTL)
+			}
+		} else if c.negativeTTL > 0 {
+			node.tombstone = true
+			node.expiresAt = c.deadline(c.negativeTTL)
+		} else {
+			continue
+		}
+		if at, ok := d.Expires[key]; ok {
+			node.expiresAt = at
+		}
+		if c.expired(node) {
+			continue
+		}
+		nodes[key] = node
+		totalCost += node.cost
+		totalBytes += estimateSize(node.key, node.value)
+	}
+	if (c.maxCost > 0 && totalCost > c.maxCost) || (c.maxBytes > 0 && totalBytes > c.maxBytes) {
+		return restorePlan{}, fmt.Errorf("%w: %d entries exceed the cache's budgets", ErrDumpOverCapacity, len(nodes))
+	}
+	return restorePlan{nodes: nodes, totalCost: totalCost, totalBytes: totalBytes}, nil
+}
+
+// applyRestore installs plan in place of the cache's contents. It fails,
+// changing nothing, only if d carries policy state the policy rejects. The
+// caller holds the write lock.
+func (c *SecureLRUCache) applyRestore(d CacheDump, plan restorePlan) error {
+	nodes := plan.nodes
+	for i := len(d.Order) - 1; i >= 0; i-- {
+		if node, ok := nodes[d.Order[i]]; ok {
+			c.moved(node)
+		}
+	}
+
+	restored := false
+	if p, ok := c.policy.(RestorablePolicy); ok && d.Policy != nil && len(nodes) == d.Size && d.Policy.Name == p.State().Name {
+		if err := p.Restore(*d.Policy, nodes); err != nil {
+			return fmt.Errorf("restore %s policy: %w", d.Policy.Name, err)
+		}
+		restored = true
+	}
+	if !restored {
+		c.policy.Clear()
+		f, frequencies := c.policy.(frequencyPolicy)
+		for i := len(d.Order) - 1; i >= 0; i-- {
+			node, ok := nodes[d.Order[i]]
+			if !ok {
+				continue
+			}
+			if freq := d.Frequencies[node.key]; frequencies && freq > 1 {
+				f.insertWithFrequency(node, freq)
+			} else {
+				c.policy.RecordInsert(node)
+			}
+		}
+	}
+
+	c.record(Event{Op: EventClear, Reason: ReasonCleared})
+	dropped := c.cache
+	c.cache = nodes
+	c.size.Store(int64(len(nodes)))
+	c.dropAll(dropped)
+	if c.groups != nil {
+		clear(c.groups.sizes)
+		for _, node := range nodes {
+			c.countGroup(node, 1)
+		}
+	}
+	c.totalCost = plan.totalCost
+	c.totalBytes = plan.totalBytes
+	c.errs = make(map[int]*cachedError)
+	if c.capacity != d.Capacity {
+		c.setCapacity(d.Capacity)
+	}
+	for i := len(d.Order) - 1; i >= 0; i-- {
+		if node, ok := nodes[d.Order[i]]; ok && !node.tombstone {
+			c.wake(node.key, node.value)
+			c.record(Event{Op: EventPut, Key: node.key, Value: node.value})
+			c.restored(node.key, node.value)
+		}
+	}
+	if c.logEnabled(c.logLevel) {
+		c.logf(c.logLevel, "restored", slog.Int("size", len(nodes)), slog.Int("capacity", d.Capacity))
+	}
+	return nil
+}
+
+func (d CacheDump) validate() error {
+	if d.Version > dumpVersion || d.Version < 0 {
+		return &DumpVersionError{Version: d.Version}
+	}
+	if d.Checksum != nil {
+		if actual, err := d.checksum(); err != nil {
+			return err
+		} else if actual != *d.Checksum {
+			return &ChecksumError{Expected: *d.Checksum, Actual: actual}
+		}
+	}
+	if d.Capacity < 1 {
+		return fmt.Errorf("%w: capacity %d", ErrDumpOverCapacity, d.Capacity)
+	}
+	if d.Size > d.Capacity {
+		return fmt.Errorf("%w: size %d exceeds capacity %d", ErrDumpOverCapacity, d.Size, d.Capacity)
+	}
+	if d.Size != len(d.Order) || d.Size != len(d.Items)+len(d.Tombstones) {
+		return fmt.Errorf("%w: size %d, %d ordered keys, %d items and %d tombstones",
+			ErrDumpSizeMismatch, d.Size, len(d.Order), len(d.Items), len(d.Tombstones))
+	}
+
+	for _, key := range d.Tombstones {
+		if _, ok := d.Items[key]; ok {
+			return fmt.Errorf("%w: key %d is both an item and a tombstone", ErrDumpDuplicateKey, key)
+		}
+	}
+	tombstones := make(map[int]bool, len(d.Tombstones))
+	for _, key := range d.Tombstones {
+		if tombstones[key] {
+			return fmt.Errorf("%w: tombstone %d", ErrDumpDuplicateKey, key)
+		}
+		tombstones[key] = true
+	}
+
+	seen := make(map[int]bool, len(d.Order))
+	for _, key := range d.Order {
+		if seen[key] {
+			return fmt.Errorf("%w: key %d in order", ErrDumpDuplicateKey, key)
+		}
+		seen[key] = true
+		if _, ok := d.Items[key]; !ok && !tombstones[key] {
+			return fmt.Errorf("%w: key %d is ordered but has no item", ErrDumpUnknownKey, key)
+		}
+	}
+	for key := range d.Expires {
+		if !seen[key] {
+			return fmt.Errorf("%w: key %d has an expiry but no item", ErrDumpUnknownKey, key)
+		}
+	}
+	for key, freq := range d.Frequencies {
+		if !seen[key] {
+			return fmt.Errorf("%w: key %d has a frequency but no item", ErrDumpUnknownKey, key)
+		}
+		if freq < 1 {
+			return fmt.Errorf("dump frequency of key %d must be positive, got %d", key, freq)
+		}
+	}
+	for key, cost := range d.Costs {
+		if !seen[key] {
+			return fmt.Errorf("%w: key %d has a cost but no item", ErrDumpUnknownKey, key)
+		}
+		if cost < 1 {
+			return fmt.Errorf("dump cost of key %d must be positive, got %d", key, cost)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the cache's Dump, so a cache held by pointer inside a
+// larger struct marshals with it.
+func (c *SecureLRUCache) MarshalJSON() ([]byte, error) {
+	if err := c.snapshotAllowed(); err != nil {
+		return nil, err
+	}
+	d, err := c.Dump().withChecksum()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(d)
+}
+
+// UnmarshalJSON restores a dump written by MarshalJSON or ToJSON. A cache
+// built by NewSecureLRUCache keeps its options; a zero SecureLRUCache is set
+// up with the defaults and the dump's capacity, which must not race with
+// other use of it. Invalid input leaves the cache as it was.
+func (c *SecureLRUCache) UnmarshalJSON(data []byte) error {
+	var d CacheDump
+	if err := json.Unmarshal(data, &d); err != nil {
+		return fmt.Errorf("decode dump: %w", err)
+	}
+	return c.restoreDump(d)
+}
+
+// restoreDump restores d, first setting up the cache if it is a zero value.
+func (c *SecureLRUCache) restoreDump(d CacheDump) error {
+	if err := d.validate(); err != nil {
+		return err
+	}
+	if c.cache == nil {
+		if err := c.init(d.Capacity, nil); err != nil {
+			return err
+		}
+	}
+	return c.Restore(d)
+}
+
+func (d CacheDump) checksum() (uint32, error) {
+	d.Checksum = nil
+	data, err := json.Marshal(d)
+	if err != nil {
+		return 0, err
+	}
+	return crc32.Checksum(data, crcTable), nil
+}
+
+func (d CacheDump) withChecksum() (CacheDump, error) {
+	sum, err := d.checksum()
+	if err != nil {
+		return d, err
+	}
+	d.Checksum = &sum
+	return d, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+func TestDumpRoundTripKeepsCosts(t *testing.T) {
+	newCache := func() *SecureLRUCache {
+		c := newTestCache(t, 10, WithMaxCost(100))
+		return c
+	}
+	src := newCache()
+	src.PutWithCost(1, 10, 40)
+	src.PutWithCost(2, 20, 50)
+	src.Put(3, 30)
+	const wantTotal = 91
+
+	formats := map[string]func(dst *SecureLRUCache) error{
+		"json": func(dst *SecureLRUCache) error {
+			data, err := src.MarshalJSON()
+			if err != nil {
+				return err
+			}
+			return dst.UnmarshalJSON(data)
+		},
+		"binary": func(dst *SecureLRUCache) error {
+			data, err := src.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			return dst.UnmarshalBinary(data)
+		},
+		"stream": func(dst *SecureLRUCache) error {
+			var buf bytes.Buffer
+			if _, err := src.WriteTo(&buf); err != nil {
+				return err
+			}
+			_, err := dst.ReadFrom(&buf)
+			return err
+		},
+		"gzip": func(dst *SecureLRUCache) error {
+			var buf bytes.Buffer
+			if _, err := src.SaveCompressed(&buf, gzip.BestSpeed); err != nil {
+				return err
+			}
+			_, err := dst.ReadFrom(&buf)
+			return err
+		},
+		"msgpack": func(dst *SecureLRUCache) error {
+			data, err := src.MarshalMsgpack()
+			if err != nil {
+				return err
+			}
+			return dst.UnmarshalMsgpack(data)
+		},
+	}
+	for name, roundTrip := range formats {
+		t.Run(name, func(t *testing.T) {
+			dst := newCache()
+			if err := roundTrip(dst); err != nil {
+				t.Fatal(err)
+			}
+			if got := dst.TotalCost(); got != wantTotal {
+				t.Fatalf("total cost %d after restore, want %d", got, wantTotal)
+			}
+			if err := dst.CheckInvariants(); err != nil {
+				t.Fatal(err)
+			}
+			// 91 of 100 is used, so a Put costing 20 must evict.
+			if err := dst.PutWithCost(4, 40, 20); err != nil {
+				t.Fatal(err)
+			}
+			if dst.TotalCost() > 100 {
+				t.Fatalf("total cost %d exceeds the budget", dst.TotalCost())
+			}
+		})
+	}
+}
+
+func TestRestoreRejectsDumpOverCostBudget(t *testing.T) {
+	src := newTestCache(t, 10)
+	src.PutWithCost(1, 1, 60)
+	src.PutWithCost(2, 2, 60)
+
+	dst := newTestCache(t, 10, WithMaxCost(100))
+	if err := dst.Restore(src.Dump()); err == nil {
+		t.Fatal("restored 120 worth of entries into a budget of 100")
+	}
+}
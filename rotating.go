@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ Cache = (*RotatingCache)(nil)
+
+// RotatingCache ages entries out in bulk, the way fastcache and bigcache do,
+// instead of tracking each one: Put writes to the current generation, Get
+// falls back to the previous one and moves a hit into the current, and
+// Rotate drops the previous generation whole and makes the current one
+// previous. An entry survives as long as it is used at least once per
+// rotation, and one that is not is gone within two.
+type RotatingCache struct {
+	mu       sync.RWMutex
+	current  *SecureLRUCache
+	previous *SecureLRUCache
+	capacity int
+	opts     []Option
+
+	// retired holds the counters of dropped generations, so Stats does not
+	// go backwards at a rotation.
+	retired      CacheStats
+	previousHits atomic.Int64
+	rotations    atomic.Int64
+
+	done      chan struct{}
+	ticker    sync.WaitGroup
+	closeOnce sync.Once
+}
+
+// NewRotatingCache builds a cache of two generations of capacity entries
+// each, so it holds up to twice capacity. A positive interval rotates on
+// that period by the generations' clock; with 0 only Rotate does. Options
+// are applied to every generation as it is built, so a policy must come
+// from WithPolicyFunc rather than WithPolicy, and WithPersistence, WithWAL,
+// the initial data options and WithAdaptiveCapacity are refused.
+func NewRotatingCache(capacity int, interval time.Duration, opts ...Option) (*RotatingCache, error) {
+	if interval < 0 {
+		return nil, fmt.Errorf("rotation interval must not be negative")
+	}
+	r := &RotatingCache{capacity: capacity, opts: opts, done: make(chan struct{})}
+	var err error
+	if r.previous, err = r.generation(); err != nil {
+		return nil, err
+	}
+	if r.current, err = r.generation(); err != nil {
+		r.previous.Close()
+		return nil, err
+	}
+	if r.current.policy == r.previous.policy {
+		r.Close()
+		return nil, fmt.Errorf("generations cannot share one policy; use WithPolicyFunc")
+	}
+	if interval > 0 {
+		ticks, stop := newTicker(r.current.clock, interval)
+		r.ticker.Add(1)
+		go r.rotateEvery(ticks, stop)
+	}
+	return r, nil
+}
+
+func (r *RotatingCache) generation() (*SecureLRUCache, error) {
+	gen, err := NewSecureLRUCache(r.capacity, r.opts...)
+	if err != nil {
+		return nil, err
+	}
+	var reason string
+	switch {
+	case gen.persist != nil || gen.wal != nil:
+		reason = "generations cannot share a persistence file"
+	case gen.Size() > 0 || gen.stats.preloadSkipped.Load() > 0:
+		reason = "initial data would be dropped at the first rotations; Put it instead"
+	case gen.adaptive != nil:
+		reason = "adaptive capacity cannot be applied to generations"
+	default:
+		return gen, nil
+	}
+	gen.Close()
+	return nil, errors.New(reason)
+}
+
+func (r *RotatingCache) rotateEvery(ticks <-chan time.Time, stop func()) {
+	defer r.ticker.Done()
+	defer stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticks:
+			r.Rotate()
+		}
+	}
+}
+
+// Rotate drops the previous generation and starts an empty current one.
+func (r *RotatingCache) Rotate() error {
+	gen, err := r.generation()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	select {
+	case <-r.done:
+		r.mu.Unlock()
+		gen.Close()
+		return fmt.Errorf("cache is closed")
+	default:
+	}
+	dropped := r.previous
+	r.previous, r.current = r.current, gen
+	st := dropped.Stats()
+	st.TotalCost, st.MaxCost, st.MemoryBytes, st.Size, st.Capacity = 0, 0, 0, 0, 0
+	st.Groups = nil
+	r.retired.add(st)
+	r.mu.Unlock()
+
+	r.rotations.Add(1)
+	return dropped.Close()
+}
+
+func (r *RotatingCache) Get(key int) (int, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if value, ok := r.current.Get(key); ok {
+		return value, true
+	}
+	info, ok := r.previous.EntryInfo(key)
+	if !ok {
+		return 0, false
+	}
+	r.previousHits.Add(1)
+	ttl := time.Duration(0)
+	if !info.ExpiresAt.IsZero() {
+		if ttl = info.ExpiresAt.Sub(r.current.clock.Now()); ttl <= 0 {
+			return info.Value, true
+		}
+	}
+	// A Put racing this one has already written the current generation, or
+	// will overwrite the promoted value; either way its value wins.
+	if _, _, written, err := r.current.writeIf(key, info.Value, 1, ttl, writeIfAbsent); written && err == nil {
+		r.previous.Remove(key)
+	}
+	return info.Value, true
+}
+
+func (r *RotatingCache) Put(key, value int) error {
+	_, _, err := r.PutEvicted(key, value)
+	return err
+}
+
+func (r *RotatingCache) PutEvicted(key, value int) (Entry, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	evicted, ok, err := r.current.PutEvicted(key, value)
+	if err == nil {
+		r.previous.Remove(key)
+	}
+	return evicted, ok, err
+}
+
+func (r *RotatingCache) PutWithTTL(key, value int, ttl time.Duration) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	err := r.current.PutWithTTL(key, value, ttl)
+	if err == nil {
+		r.previous.Remove(key)
+	}
+	return err
+}
+
+func (r *RotatingCache) Remove(key int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	inCurrent := r.current.Remove(key)
+	inPrevious := r.previous.Remove(key)
+	return inCurrent || inPrevious
+}
+
+func (r *RotatingCache) Contains(key int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current.Contains(key) || r.previous.Contains(key)
+}
+
+// Size counts both generations.
+func (r *RotatingCache) Size() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current.Size() + r.previous.Size()
+}
+
+// Capacity is that of both generations, twice the capacity given to
+// NewRotatingCache.
+func (r *RotatingCache) Capacity() int {
+	return 2 * r.capacity
+}
+
+// Rotations counts the rotations so far, timed or not.
+func (r *RotatingCache) Rotations() int64 {
+	return r.rotations.Load()
+}
+
+// Stats sums both generations and the counters of those already dropped. A
+// hit in the previous generation counts as a hit, not as the current
+// generation's miss. Residency ages are left zero, as for ShardedLRUCache.
+func (r *RotatingCache) Stats() CacheStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	total := r.retired
+	total.add(r.current.Stats())
+	total.add(r.previous.Stats())
+	hits := r.previousHits.Load()
+	total.Hits += hits
+	total.Misses -= hits
+	return total
+}
+
+// Close stops the rotation timer and closes both generations.
+func (r *RotatingCache) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.ticker.Wait()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		err = errors.Join(r.current.Close(), r.previous.Close())
+	})
+	return err
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestRotating(t *testing.T, capacity int, interval time.Duration, opts ...Option) *RotatingCache {
+	t.Helper()
+	r, err := NewRotatingCache(capacity, interval, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestRotatingCacheDropsUntouchedEntries(t *testing.T) {
+	r := newTestRotating(t, 8, 0)
+	r.Put(1, 10)
+	r.Put(2, 20)
+
+	for i := range 10 {
+		if v, ok := r.Get(2); !ok || v != 20 {
+			t.Fatalf("rotation %d: touched key 2 = %d, %v", i, v, ok)
+		}
+		if err := r.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 && !r.Contains(1) {
+			t.Fatal("key 1 gone after one rotation")
+		}
+		if i == 1 && r.Contains(1) {
+			t.Fatal("key 1 survived two rotations untouched")
+		}
+	}
+	if r.Size() != 1 {
+		t.Errorf("Size = %d, want 1", r.Size())
+	}
+	if r.Rotations() != 10 {
+		t.Errorf("Rotations = %d, want 10", r.Rotations())
+	}
+}
+
+func TestRotatingCacheWrites(t *testing.T) {
+	r := newTestRotating(t, 8, 0)
+	r.Put(1, 10)
+	r.Rotate()
+	r.Put(1, 11)
+	r.Rotate()
+	if v, ok := r.Get(1); !ok || v != 11 {
+		t.Errorf("a rewrite did not move the key into the current generation: %d, %v", v, ok)
+	}
+	if r.Size() != 1 {
+		t.Errorf("Size = %d after rewriting one key", r.Size())
+	}
+
+	r.Put(2, 20)
+	r.Rotate()
+	if !r.Remove(2) || r.Contains(2) {
+		t.Error("Remove missed a key in the previous generation")
+	}
+	if r.Remove(2) {
+		t.Error("Remove of a removed key reported true")
+	}
+}
+
+func TestRotatingCacheKeepsTTLOnPromotion(t *testing.T) {
+	clock := newFakeClock()
+	r := newTestRotating(t, 8, 0, WithClock(clock))
+	r.PutWithTTL(1, 1, 10*time.Second)
+	r.Rotate()
+	clock.Advance(6 * time.Second)
+	if _, ok := r.Get(1); !ok {
+		t.Fatal("entry gone before its TTL")
+	}
+	clock.Advance(5 * time.Second)
+	if _, ok := r.Get(1); ok {
+		t.Error("promotion reset the entry's TTL")
+	}
+}
+
+func TestRotatingCacheTimer(t *testing.T) {
+	clock := newFakeClock()
+	r := newTestRotating(t, 8, time.Minute, WithClock(clock))
+	r.Put(1, 1)
+	waitRotations := func(n int64) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for r.Rotations() < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d rotations, want %d", r.Rotations(), n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	clock.Advance(time.Minute)
+	waitRotations(1)
+	clock.Advance(time.Minute)
+	waitRotations(2)
+	if r.Contains(1) {
+		t.Error("key 1 survived two timed rotations")
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	time.Sleep(10 * time.Millisecond)
+	if r.Rotations() != 2 {
+		t.Errorf("rotated after Close: %d rotations", r.Rotations())
+	}
+	if err := r.Rotate(); err == nil {
+		t.Error("Rotate after Close succeeded")
+	}
+}
+
+func TestRotatingCacheStats(t *testing.T) {
+	r := newTestRotating(t, 4, 0)
+	r.Put(1, 1)
+	r.Put(2, 2)
+	r.Get(1)
+	r.Rotate()
+	r.Put(3, 3)
+	r.Get(2) // a hit in the previous generation
+	r.Get(9)
+	r.Rotate()
+	r.Rotate()
+
+	st := r.Stats()
+	if st.Hits != 2 || st.Misses != 1 {
+		t.Errorf("hits %d, misses %d, want 2 and 1", st.Hits, st.Misses)
+	}
+	if st.Puts != 4 {
+		t.Errorf("puts %d, want 4: 3 Puts and a promotion", st.Puts)
+	}
+	if st.Size != 0 || st.Capacity != 8 {
+		t.Errorf("size %d, capacity %d after dropping everything", st.Size, st.Capacity)
+	}
+	r.Put(4, 4)
+	r.Rotate()
+	r.Put(5, 5)
+	if st := r.Stats(); st.Size != 2 || st.Size != r.Size() {
+		t.Errorf("stats size %d, Size %d, want 2", st.Size, r.Size())
+	}
+}
+
+func TestRotatingCacheRefusesOptions(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"shared policy": WithPolicy(LRU()),
+		"persistence":   WithPersistence(t.TempDir()+"/cache.json", 0),
+		"initial data":  WithInitialData([]Entry{{1, 1}}),
+	} {
+		if r, err := NewRotatingCache(8, 0, opt); err == nil {
+			r.Close()
+			t.Errorf("%s accepted", name)
+		}
+	}
+	if _, err := NewRotatingCache(8, -time.Second); err == nil {
+		t.Error("negative interval accepted")
+	}
+	r := newTestRotating(t, 8, 0, WithPolicyFunc(SLRU))
+	r.Put(1, 1)
+	r.Rotate()
+	if _, ok := r.Get(1); !ok {
+		t.Error("WithPolicyFunc generations lost an entry")
+	}
+}
+
+func TestRotatingCacheConcurrent(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	r := newTestRotating(t, 64, 0)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; ; k++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				key := (k*7 + w) % 96
+				r.Put(key, key)
+				if v, ok := r.Get((key + 5) % 96); ok && v != (key+5)%96 {
+					t.Errorf("key %d = %d", (key+5)%96, v)
+				}
+				r.Remove((key + 11) % 96)
+			}
+		}()
+	}
+	for range 50 {
+		r.Rotate()
+	}
+	close(done)
+	wg.Wait()
+	if n := r.Size(); n > r.Capacity() {
+		t.Errorf("Size %d over capacity %d", n, r.Capacity())
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout is how long serve waits for requests in flight once it is
+// told to stop.
+const shutdownTimeout = 10 * time.Second
+
+// runServe runs the serve subcommand with args following "serve": a
+// standalone cache behind HTTPHandler until SIGINT or SIGTERM.
+func runServe(args []string, stderr io.Writer) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return serve(ctx, args, stderr, nil)
+}
+
+// serve runs the server until ctx is done, then shuts it down gracefully
+// and closes the cache. ready, if not nil, is called with the address once
+// the server is listening. It returns the exit code: 1 if the server could
+// not start, 2 for bad usage.
+func serve(ctx context.Context, args []string, stderr io.Writer, ready func(addr string)) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	capacity := fs.Int("capacity", 1024, "maximum number of entries")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	ttl := fs.Duration("ttl", 0, "default TTL for entries written without one (0 for none)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "serve takes no arguments, got %q\n", fs.Args())
+		return 2
+	}
+
+	var opts []Option
+	if *ttl > 0 {
+		opts = append(opts, WithDefaultTTL(*ttl))
+	}
+	cache, err := NewSecureLRUCache(*capacity, opts...)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	defer cache.Close()
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	srv := &http.Server{Handler: cache.HTTPHandler(), ReadHeaderTimeout: 10 * time.Second}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	if ready != nil {
+		ready(ln.Addr().String())
+	}
+
+	select {
+	case err := <-errc:
+		fmt.Fprintln(stderr, err)
+		return 1
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(stderr, err)
+	}
+	return 0
+}
+
+// runMemcached runs the memcached subcommand with args following
+// "memcached": a standalone cache behind MemcachedServer until SIGINT or
+// SIGTERM.
+func runMemcached(args []string, stderr io.Writer) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return serveMemcached(ctx, args, stderr, nil)
+}
+
+// runRESP runs the redis subcommand with args following "redis": a
+// standalone cache behind RESPServer until SIGINT or SIGTERM.
+func runRESP(args []string, stderr io.Writer) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return serveRESP(ctx, args, stderr, nil)
+}
+
+func serveMemcached(ctx context.Context, args []string, stderr io.Writer, ready func(addr string)) int {
+	return serveProtocol(ctx, "memcached", ":11211", args, stderr, ready, func(c *SecureLRUCache) (protocolServer, error) {
+		return NewMemcachedServer(c, nil, nil)
+	})
+}
+
+func serveRESP(ctx context.Context, args []string, stderr io.Writer, ready func(addr string)) int {
+	return serveProtocol(ctx, "redis", ":6379", args, stderr, ready, func(c *SecureLRUCache) (protocolServer, error) {
+		return NewRESPServer(c, nil, nil)
+	})
+}
+
+// protocolServer is what MemcachedServer and RESPServer have in common.
+type protocolServer interface {
+	Serve(ln net.Listener) error
+	Close() error
+}
+
+// serveProtocol is serve for the servers newServer builds. Stopping closes
+// open connections rather than waiting for clients to quit.
+func serveProtocol(ctx context.Context, name, defaultAddr string, args []string, stderr io.Writer, ready func(addr string), newServer func(*SecureLRUCache) (protocolServer, error)) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	capacity := fs.Int("capacity", 1024, "maximum number of entries")
+	addr := fs.String("addr", defaultAddr, "address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "%s takes no arguments, got %q\n", name, fs.Args())
+		return 2
+	}
+
+	cache, err := NewSecureLRUCache(*capacity)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	defer cache.Close()
+	srv, err := newServer(cache)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	if ready != nil {
+		ready(ln.Addr().String())
+	}
+
+	select {
+	case err := <-errc:
+		fmt.Fprintln(stderr, err)
+		return 1
+	case <-ctx.Done():
+	}
+	srv.Close()
+	if err := <-errc; err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServeUntilCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	addrs := make(chan string, 1)
+	code := make(chan int, 1)
+	var stderr bytes.Buffer
+	go func() {
+		code <- serve(ctx, []string{"-addr", "127.0.0.1:0", "-capacity", "2"}, &stderr, func(addr string) { addrs <- addr })
+	}()
+	base := "http://" + <-addrs
+
+	req, _ := http.NewRequest("PUT", base+"/keys/7", strings.NewReader("70"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	resp, err = http.Get(base + "/keys/7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != "70\n" {
+		t.Errorf("GET = %d %q", resp.StatusCode, body)
+	}
+
+	cancel()
+	if got := <-code; got != 0 {
+		t.Errorf("serve exited %d: %s", got, stderr.String())
+	}
+}
+
+func TestServeRejectsBadFlags(t *testing.T) {
+	for _, args := range [][]string{{"-capacity", "0"}, {"-nope"}, {"extra"}} {
+		var stderr bytes.Buffer
+		if got := serve(context.Background(), args, &stderr, nil); got != 2 {
+			t.Errorf("serve %v = %d, want 2", args, got)
+		}
+	}
+}
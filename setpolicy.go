@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// SetPolicy switches a live cache to p, which must be a new policy not used
+// by any other cache, keeping every entry. The entries are handed to p in the
+// current policy's eviction order, the next victim first, so p sees them as
+// inserted from oldest to newest: recency carries over to any policy, and
+// LFU frequencies carry over when both policies are LFU, while LFU seeded
+// from another policy starts every entry at frequency 1 in that order.
+// Other per-policy state, such as ARC's ghost lists, segments, LRU-K
+// histories and CLOCK and SIEVE reference bits, starts afresh. The switch
+// holds the write lock for one pass over the entries; Gets and Puts wait for
+// it and then run against p. WithAsyncPromotion buffers promotions under p
+// unless p's reads share the read lock, whatever the policy before.
+func (c *SecureLRUCache) SetPolicy(p Policy) error {
+	if p == nil {
+		return fmt.Errorf("policy must not be nil")
+	}
+	c.mu.Lock()
+	defer c.unlock()
+
+	if p == c.policy {
+		return fmt.Errorf("policy is already in use")
+	}
+	c.applyPromotions()
+	order := make([]*Node, 0, len(c.cache))
+	c.policy.Each(func(node *Node) bool {
+		order = append(order, node)
+		return true
+	})
+	if len(order) != len(c.cache) {
+		return fmt.Errorf("policy tracks %d of %d entries", len(order), len(c.cache))
+	}
+	c.policy.Clear()
+
+	if cp, ok := p.(CapacityAwarePolicy); ok {
+		cp.SetCapacity(c.capacity)
+	}
+	_, fromLFU := c.policy.(*lfuPolicy)
+	f, toLFU := p.(frequencyPolicy)
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		freq := node.freq
+		node.prev, node.next, node.bucket = nil, nil, nil
+		node.freq, node.index, node.stamp, node.segment, node.refs = 0, 0, 0, 0, nil
+		node.referenced.Store(false)
+		if fromLFU && toLFU && freq > 1 {
+			f.insertWithFrequency(node, freq)
+		} else {
+			p.RecordInsert(node)
+		}
+		c.moved(node)
+	}
+
+	c.policy = p
+	c.sharedAccess, c.frontAccess = false, nil
+	if sp, ok := p.(SharedAccessPolicy); ok {
+		c.sharedAccess = sp.SharedAccess()
+	}
+	if fp, ok := p.(FrontAccessPolicy); ok && !c.sharedAccess {
+		c.frontAccess = fp
+	}
+	c.readFirst.Store(c.sharedAccess || c.frontAccess != nil || c.promotions != nil)
+	if c.logEnabled(c.logLevel) {
+		c.logf(c.logLevel, "policy changed", slog.String("policy", policyName(p)))
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestSetPolicyCarriesOrderOver(t *testing.T) {
+	c := newTestCache(t, 5)
+	for k := 1; k <= 5; k++ {
+		c.Put(k, k)
+	}
+	c.Get(2)
+
+	if err := c.SetPolicy(LFU()); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Keys(); !slices.Equal(got, []int{2, 5, 4, 3, 1}) {
+		t.Errorf("LFU seeded as %v, want LRU order [2 5 4 3 1]", got)
+	}
+	c.Get(3)
+	c.Get(3)
+	c.Get(4)
+
+	// LFU to LFU keeps the frequencies.
+	if err := c.SetPolicy(LFU()); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Dump().Frequencies; got[3] != 3 || got[4] != 2 || got[1] != 1 {
+		t.Errorf("frequencies %v after LFU to LFU", got)
+	}
+	want := c.Keys()
+
+	if err := c.SetPolicy(LRU()); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Keys(); !slices.Equal(got, want) {
+		t.Errorf("LRU seeded as %v, want LFU order %v", got, want)
+	}
+	if d := c.Dump(); d.Frequencies != nil {
+		t.Errorf("LRU dump has frequencies %v", d.Frequencies)
+	}
+	if evicted, _, _ := c.PutEvicted(6, 6); evicted.Key != want[len(want)-1] {
+		t.Errorf("evicted %d, want LFU's next victim %d", evicted.Key, want[len(want)-1])
+	}
+}
+
+func TestSetPolicyArmsAsyncPromotion(t *testing.T) {
+	c := newTestCache(t, 4, WithPolicy(Sieve()), WithAsyncPromotion(4))
+	for k := 1; k <= 4; k++ {
+		c.Put(k, k)
+	}
+	if err := c.SetPolicy(LRU()); err != nil {
+		t.Fatal(err)
+	}
+	c.Get(1)
+	if n := c.promotions.next.Load(); n != 1 {
+		t.Fatalf("%d promotions buffered after a hit under LRU, want 1", n)
+	}
+	c.Flush()
+	if got := c.Keys(); !slices.Equal(got, []int{1, 4, 3, 2}) {
+		t.Errorf("Keys = %v, want the buffered hit applied", got)
+	}
+
+	if err := c.SetPolicy(CLOCK()); err != nil {
+		t.Fatal(err)
+	}
+	c.Get(2)
+	if n := c.promotions.next.Load(); n != 0 {
+		t.Errorf("%d promotions buffered under CLOCK, whose reads share the lock", n)
+	}
+}
+
+func TestSetPolicyThroughEveryPolicy(t *testing.T) {
+	policies := []Policy{FIFO(), MRU(), LFU(), SLRU(), ARC(), CLOCK(), Sieve(), LRUK(2), SampledLRU(4), LRU()}
+	c := newTestCache(t, 16)
+	for k := range 16 {
+		c.Put(k, k)
+	}
+	for _, p := range policies {
+		if err := c.SetPolicy(p); err != nil {
+			t.Fatalf("%T: %v", p, err)
+		}
+		for k := range 40 {
+			c.Get(k % 16)
+		}
+		if c.Size() != 16 {
+			t.Errorf("%T: size %d, want 16", p, c.Size())
+		}
+	}
+	if got := slices.Sorted(slices.Values(c.Keys())); len(got) != 16 || got[0] != 0 || got[15] != 15 {
+		t.Errorf("keys %v, want 0 to 15", got)
+	}
+}
+
+func TestSetPolicyUnderLoad(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	const keys = 64
+	c := newTestCache(t, keys)
+	for k := range keys {
+		c.Put(k, k)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				k := (g*7 + i) % keys
+				if i%3 == 0 {
+					c.Put(k, i)
+				} else if _, ok := c.Get(k); !ok {
+					t.Errorf("key %d missing mid-switch", k)
+					return
+				}
+			}
+		}()
+	}
+	for i := range 60 {
+		p := LFU()
+		if i%2 == 1 {
+			p = LRU()
+		}
+		if err := c.SetPolicy(p); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.CheckInvariants(); err != nil {
+			t.Fatalf("after switch %d: %v", i, err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if c.Size() != keys {
+		t.Errorf("size %d, want %d", c.Size(), keys)
+	}
+	got := slices.Sorted(slices.Values(c.Keys()))
+	for k := range keys {
+		if got[k] != k {
+			t.Fatalf("keys %v, want 0 to %d", got, keys-1)
+		}
+	}
+}
+
+func TestSetPolicyRejectsBadPolicies(t *testing.T) {
+	c := newTestCache(t, 4)
+	if err := c.SetPolicy(nil); err == nil {
+		t.Error("nil policy accepted")
+	}
+	if err := c.SetPolicy(c.policy); err == nil {
+		t.Error("the policy in use accepted")
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"math/bits"
+	"runtime"
+	"time"
+)
+
+var _ Cache = (*ShardedLRUCache)(nil)
+
+// ShardedLRUCache spreads keys by a seeded hash over independent
+// SecureLRUCache shards, each with its own lock, so that callers working on
+// different keys rarely contend. Recency is only tracked within a shard: a full shard
+// evicts its own least recently used entry even if another shard holds an
+// older one, and Keys lists each shard's keys in turn.
+type ShardedLRUCache struct {
+	shards []*SecureLRUCache
+	mask   uint64
+	hasher Hasher
+}
+
+// ShardedDump is the Dump of every shard, in shard order.
+type ShardedDump struct {
+	Capacity int         `json:"capacity"`
+	Size     int         `json:"size"`
+	Shards   []CacheDump `json:"shards"`
+}
+
+// NewShardedLRUCache builds a cache of the given total capacity split over
+// shards shards, which must be a power of two; 0 picks the power of two
+// nearest GOMAXPROCS. The capacity is divided as evenly as possible and must
+// be at least one per shard; the WithMaxCost and WithMaxBytes budgets are
+// divided the same way, so the shards together never hold more than they
+// allow. Options are applied to each shard in turn, so a policy must come
+// from WithPolicyFunc rather than WithPolicy, and options that would give
+// every shard the same file or data, WithPersistence, WithWAL and the
+// initial data options, are refused, as is WithAdaptiveCapacity, whose bounds
+// are per cache.
+func NewShardedLRUCache(capacity, shards int, opts ...Option) (*ShardedLRUCache, error) {
+	if shards == 0 {
+		shards = defaultShards()
+	}
+	if shards < 1 || shards&(shards-1) != 0 {
+		return nil, fmt.Errorf("shard count must be a power of two, got %d", shards)
+	}
+	if capacity < shards {
+		return nil, fmt.Errorf("capacity %d must be at least the shard count %d", capacity, shards)
+	}
+
+	s := &ShardedLRUCache{shards: make([]*SecureLRUCache, shards), mask: uint64(shards - 1)}
+	s.hasher = randomHasher{seed: maphash.MakeSeed()}
+	for i := range s.shards {
+		shard, err := NewSecureLRUCache(shardCapacity(capacity, shards, i), opts...)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.shards[i] = shard
+		if shard.shardHasher != nil {
+			s.hasher = shard.shardHasher
+		}
+		if err := s.checkShard(i); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if err := s.splitBudgets(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// splitBudgets divides the cost and memory budgets each shard was given by
+// the options over all the shards. The shards are still empty, so nothing
+// needs evicting.
+func (s *ShardedLRUCache) splitBudgets() error {
+	n := int64(len(s.shards))
+	first := s.shards[0]
+	if first.maxCost > 0 && first.maxCost < n {
+		return fmt.Errorf("max cost %d must be at least the shard count %d", first.maxCost, n)
+	}
+	if first.maxBytes > 0 && first.maxBytes < n*EntryBytes {
+		return fmt.Errorf("max bytes %d must fit one entry per shard (%d bytes)", first.maxBytes, n*EntryBytes)
+	}
+	for i, shard := range s.shards {
+		if shard.maxCost > 0 {
+			shard.maxCost = shardBudget(shard.maxCost, n, int64(i))
+		}
+		if shard.maxBytes > 0 {
+			shard.maxBytes = shardBudget(shard.maxBytes, n, int64(i))
+		}
+	}
+	return nil
+}
+
+func (s *ShardedLRUCache) checkShard(i int) error {
+	shard := s.shards[i]
+	switch {
+	case i > 0 && shard.policy == s.shards[0].policy:
+		return fmt.Errorf("shards cannot share one policy; use WithPolicyFunc")
+	case shard.persist != nil || shard.wal != nil:
+		return fmt.Errorf("shards cannot share a persistence file")
+	case shard.Size() > 0 || shard.stats.preloadSkipped.Load() > 0:
+		return fmt.Errorf("initial data cannot be split over shards; Put it instead")
+	case shard.adaptive != nil:
+		return fmt.Errorf("adaptive capacity cannot be split over shards")
+	}
+	return nil
+}
+
+// defaultShards is the power of two nearest GOMAXPROCS.
+func defaultShards() int {
+	n := runtime.GOMAXPROCS(0)
+	lower := 1 << (bits.Len(uint(n)) - 1)
+	if n-lower > 2*lower-n {
+		return 2 * lower
+	}
+	return lower
+}
+
+func shardCapacity(capacity, shards, i int) int {
+	n := capacity / shards
+	if i < capacity%shards {
+		n++
+	}
+	return n
+}
+
+func shardBudget(budget, shards, i int64) int64 {
+	n := budget / shards
+	if i < budget%shards {
+		n++
+	}
+	return n
+}
+
+// shard returns the shard owning key.
+func (s *ShardedLRUCache) shard(key int) *SecureLRUCache {
+	return s.shards[s.hasher.Hash(key)&s.mask]
+}
+
+// spread is the MurmurHash3 finalizer over key.
+func spread(key int) uint64 {
+	h := uint64(key)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// Hasher picks the shard of each key of a ShardedLRUCache from the low bits
+// of Hash. It must be safe for concurrent use.
+type Hasher interface {
+	Hash(key int) uint64
+}
+
+// randomHasher is the default Hasher, seeded afresh for every cache so that
+// keys cannot be chosen to pile onto one shard.
+type randomHasher struct {
+	seed maphash.Seed
+}
+
+func (h randomHasher) Hash(key int) uint64 { return maphash.Comparable(h.seed, key) }
+
+// FixedHasher returns a Hasher that places keys the same way in every run,
+// for reproducible tests. Anyone who knows the seed can pick keys that share
+// a shard, so leave the default random seed in place for untrusted keys.
+func FixedHasher(seed uint64) Hasher { return fixedHasher(seed) }
+
+type fixedHasher uint64
+
+func (h fixedHasher) Hash(key int) uint64 { return spread(key ^ int(h)) }
+
+// WithHasher has NewShardedLRUCache place keys with h instead of a hash
+// seeded at random for each cache. Other caches ignore it.
+func WithHasher(h Hasher) Option {
+	return func(c *SecureLRUCache) error {
+		if h == nil {
+			return fmt.Errorf("hasher must not be nil")
+		}
+		c.shardHasher = h
+		return nil
+	}
+}
+
+func (s *ShardedLRUCache) Get(key int) (int, bool) { return s.shard(key).Get(key) }
+
+func (s *ShardedLRUCache) GetOrDefault(key, defaultValue int) int {
+	return s.shard(key).GetOrDefault(key, defaultValue)
+}
+
+func (s *ShardedLRUCache) Peek(key int) (int, bool) { return s.shard(key).Peek(key) }
+func (s *ShardedLRUCache) Put(key, value int) error { return s.shard(key).Put(key, value) }
+
+func (s *ShardedLRUCache) PutEvicted(key, value int) (Entry, bool, error) {
+	return s.shard(key).PutEvicted(key, value)
+}
+
+func (s *ShardedLRUCache) PutWithTTL(key, value int, ttl time.Duration) error {
+	return s.shard(key).PutWithTTL(key, value, ttl)
+}
+
+func (s *ShardedLRUCache) Remove(key int) bool   { return s.shard(key).Remove(key) }
+func (s *ShardedLRUCache) Contains(key int) bool { return s.shard(key).Contains(key) }
+
+// Size sums the shards' sizes. Each is read separately, so under concurrent
+// writes the total is not a single point-in-time figure.
+func (s *ShardedLRUCache) Size() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Size()
+	}
+	return n
+}
+
+func (s *ShardedLRUCache) Capacity() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Capacity()
+	}
+	return n
+}
+
+// Keys lists the keys of each shard in turn, each shard's most recent first.
+func (s *ShardedLRUCache) Keys() []int {
+	var keys []int
+	for _, shard := range s.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	return keys
+}
+
+// Resize divides the new total capacity over the shards as
+// NewShardedLRUCache does.
+func (s *ShardedLRUCache) Resize(capacity int) error {
+	if capacity < len(s.shards) {
+		return fmt.Errorf("capacity %d must be at least the shard count %d", capacity, len(s.shards))
+	}
+	for i, shard := range s.shards {
+		if err := shard.Resize(shardCapacity(capacity, len(s.shards), i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ShardedLRUCache) Clear() {
+	for _, shard := range s.shards {
+		shard.Clear()
+	}
+}
+
+func (s *ShardedLRUCache) Dump() ShardedDump {
+	d := ShardedDump{Shards: make([]CacheDump, len(s.shards))}
+	for i, shard := range s.shards {
+		d.Shards[i] = shard.Dump()
+		d.Capacity += d.Shards[i].Capacity
+		d.Size += d.Shards[i].Size
+	}
+	return d
+}
+
+// Restore replaces the cache's contents with the dump's, placing every entry
+// in the shard this cache's hasher assigns it, so a dump restores into a
+// cache with any seed or shard count. The total capacity comes from the dump
+// and is divided as NewShardedLRUCache does. Each shard receives its entries
+// in the order of the dumped shards, each shard's most recent first; a shard
+// given more than its capacity keeps the first of them, as if it had evicted
+// the rest. Policy state is per shard and is not restored. A dump that fails
+// validation or does not fit a shard's budgets leaves the cache unchanged.
+func (s *ShardedLRUCache) Restore(d ShardedDump) error {
+	version := dumpVersion
+	for i, sd := range d.Shards {
+		if err := sd.validate(); err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+		if i == 0 {
+			version = sd.Version
+		} else if sd.Version != version {
+			return fmt.Errorf("shards dumped at versions %d and %d", version, sd.Version)
+		}
+	}
+	if d.Capacity < len(s.shards) {
+		return fmt.Errorf("%w: capacity %d is below the shard count %d", ErrDumpOverCapacity, d.Capacity, len(s.shards))
+	}
+
+	dumps := make([]CacheDump, len(s.shards))
+	for i := range dumps {
+		dumps[i] = CacheDump{
+			Version:     version,
+			Capacity:    shardCapacity(d.Capacity, len(s.shards), i),
+			Items:       make(map[int]int),
+			Expires:     make(map[int]time.Time),
+			Frequencies: make(map[int]int),
+			Costs:       make(map[int]int64),
+		}
+	}
+	seen := make(map[int]bool)
+	for _, sd := range d.Shards {
+		tombstones := make(map[int]bool, len(sd.Tombstones))
+		for _, key := range sd.Tombstones {
+			tombstones[key] = true
+		}
+		for _, key := range sd.Order {
+			if seen[key] {
+				return fmt.Errorf("%w: key %d is in two shards", ErrDumpDuplicateKey, key)
+			}
+			seen[key] = true
+			t := &dumps[s.hasher.Hash(key)&s.mask]
+			if t.Size == t.Capacity {
+				continue
+			}
+			t.Size++
+			t.Order = append(t.Order, key)
+			if tombstones[key] {
+				t.Tombstones = append(t.Tombstones, key)
+			} else {
+				t.Items[key] = sd.Items[key]
+			}
+			if at, ok := sd.Expires[key]; ok {
+				t.Expires[key] = at
+			}
+			if freq, ok := sd.Frequencies[key]; ok {
+				t.Frequencies[key] = freq
+			}
+			if cost, ok := sd.Costs[key]; ok {
+				t.Costs[key] = cost
+			}
+		}
+	}
+	for i := range dumps {
+		if err := dumps[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	// Every shard is locked, in order, until all have been restored, so
+	// that a share that does not fit leaves every shard as it was. Nothing
+	// is delivered until all are released, as a hook may call any shard.
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+	}
+	defer func() {
+		released := make([]queued, len(s.shards))
+		for i, shard := range s.shards {
+			released[i] = shard.release()
+		}
+		for i, shard := range s.shards {
+			released[i].deliver(shard)
+		}
+	}()
+	plans := make([]restorePlan, len(s.shards))
+	for i, shard := range s.shards {
+		plan, err := shard.planRestore(dumps[i])
+		if err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+		plans[i] = plan
+	}
+	for i, shard := range s.shards {
+		// The shares carry no policy state, so this cannot fail.
+		if err := shard.applyRestore(dumps[i], plans[i]); err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Stats sums the shards' counters, budgets and sizes. Residency ages cannot
+// be combined and are left zero; read them from a shard's Stats.
+func (s *ShardedLRUCache) Stats() CacheStats {
+	var total CacheStats
+	for _, shard := range s.shards {
+		total.add(shard.Stats())
+	}
+	return total
+}
+
+// add sums o's counters, budgets and sizes into st.
+func (st *CacheStats) add(o CacheStats) {
+	st.Hits += o.Hits
+	st.Misses += o.Misses
+	st.PeekHits += o.PeekHits
+	st.PeekMisses += o.PeekMisses
+	st.Puts += o.Puts
+	st.Updates += o.Updates
+	st.Evictions += o.Evictions
+	st.Removals += o.Removals
+	st.Expirations += o.Expirations
+	st.ErrorHits += o.ErrorHits
+	st.StaleHits += o.StaleHits
+	st.DroppedEvents += o.DroppedEvents
+	st.AdmissionRejections += o.AdmissionRejections
+	st.OversizeRejections += o.OversizeRejections
+	st.ForcedEvictions += o.ForcedEvictions
+	st.PreloadSkipped += o.PreloadSkipped
+	st.DroppedPromotions += o.DroppedPromotions
+	st.DroppedTraceRecords += o.DroppedTraceRecords
+	st.Refreshes += o.Refreshes
+	st.RefreshFailures += o.RefreshFailures
+	st.DroppedAuditRecords += o.DroppedAuditRecords
+	st.TotalCost += o.TotalCost
+	st.MaxCost += o.MaxCost
+	st.MemoryBytes += o.MemoryBytes
+	st.Size += o.Size
+	st.Capacity += o.Capacity
+	for group, n := range o.Groups {
+		if st.Groups == nil {
+			st.Groups = make(map[string]int)
+		}
+		st.Groups[group] += n
+	}
+}
+
+// Shards returns the shards, for reading per-shard stats or dumps.
+func (s *ShardedLRUCache) Shards() []*SecureLRUCache {
+	return append([]*SecureLRUCache(nil), s.shards...)
+}
+
+func (s *ShardedLRUCache) Close() error {
+	var errs []error
+	for _, shard := range s.shards {
+		if shard != nil {
+			errs = append(errs, shard.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"hash/maphash"
+	"math/rand"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardedSplitsCostBudget(t *testing.T) {
+	s, err := NewShardedLRUCache(64, 8, WithMaxCost(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for k := 0; k < 100; k++ {
+		if err := s.Put(k, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st := s.Stats()
+	if st.MaxCost != 10 {
+		t.Errorf("MaxCost = %d, want 10", st.MaxCost)
+	}
+	if st.TotalCost > 10 || s.Size() > 10 {
+		t.Errorf("total cost %d over %d entries, want at most 10", st.TotalCost, s.Size())
+	}
+
+	var costErr *EntryCostError
+	if err := s.shard(1000).PutWithCost(1000, 0, 3); !errors.As(err, &costErr) {
+		t.Errorf("entry over its shard's budget: err = %v, want *EntryCostError", err)
+	}
+}
+
+func TestShardedSplitsMemoryBudget(t *testing.T) {
+	const budget = 4 * 8 * EntryBytes
+	s, err := NewShardedLRUCache(1024, 8, WithMaxBytes(budget))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for k := 0; k < 1000; k++ {
+		if err := s.Put(k, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.Stats().MemoryBytes; got > budget {
+		t.Errorf("MemoryBytes = %d, want at most %d", got, budget)
+	}
+}
+
+func TestShardedRejectsUnsplittableOptions(t *testing.T) {
+	cases := map[string]Option{
+		"cost below shard count":  WithMaxCost(4),
+		"bytes below shard count": WithMaxBytes(4 * EntryBytes),
+		"adaptive capacity":       WithAdaptiveCapacity(8, 64, time.Second),
+	}
+	for name, opt := range cases {
+		if s, err := NewShardedLRUCache(64, 8, opt); err == nil {
+			s.Close()
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestShardedStatsSumsEveryCounter(t *testing.T) {
+	s, err := NewShardedLRUCache(8, 4, WithAsyncPromotion(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for k := 0; k < 32; k++ {
+		s.Put(k, k)
+		s.Put(k, k+1)
+		s.Get(k)
+		s.Get(k - 1)
+		s.Peek(k + 100)
+		s.Remove(k - 2)
+	}
+	for i, shard := range s.Shards() {
+		shard.stats.droppedPromotions.Add(int64(i + 1))
+	}
+
+	total := reflect.ValueOf(s.Stats())
+	var shards []reflect.Value
+	for _, shard := range s.Shards() {
+		shards = append(shards, reflect.ValueOf(shard.Stats()))
+	}
+	for i := 0; i < total.NumField(); i++ {
+		f := total.Type().Field(i)
+		if f.Type.Kind() != reflect.Int64 && f.Type.Kind() != reflect.Int {
+			continue
+		}
+		var want int64
+		for _, st := range shards {
+			want += st.Field(i).Int()
+		}
+		if got := total.Field(i).Int(); got != want {
+			t.Errorf("%s = %d, want the shards' sum %d", f.Name, got, want)
+		}
+	}
+	if got := s.Stats().DroppedPromotions; got < 10 {
+		t.Errorf("DroppedPromotions = %d, want at least 10", got)
+	}
+}
+
+func TestShardedSpreadsAdversarialKeys(t *testing.T) {
+	const shards, perShard = 16, 1000
+	patterns := map[string]func(i int) int{
+		"sequential":           func(i int) int { return i },
+		"shard count multiple": func(i int) int { return i * shards },
+		"high bits only":       func(i int) int { return i << 40 },
+	}
+	hashers := map[string]Hasher{
+		"random": randomHasher{seed: maphash.MakeSeed()},
+		"fixed":  FixedHasher(42),
+	}
+	for hname, h := range hashers {
+		for pname, key := range patterns {
+			var counts [shards]int
+			for i := range shards * perShard {
+				counts[h.Hash(key(i))&(shards-1)]++
+			}
+			for i, n := range counts {
+				if n < perShard*7/10 || n > perShard*13/10 {
+					t.Errorf("%s hasher, %s keys: shard %d got %d of %d keys", hname, pname, i, n, shards*perShard)
+				}
+			}
+		}
+	}
+}
+
+func TestShardedFixedHasherIsReproducible(t *testing.T) {
+	var keys [2][]int
+	for i := range keys {
+		s, err := NewShardedLRUCache(64, 8, WithHasher(FixedHasher(7)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		for k := range 40 {
+			s.Put(k, k)
+		}
+		keys[i] = s.Keys()
+	}
+	if !slices.Equal(keys[0], keys[1]) {
+		t.Errorf("same seed placed keys as %v and %v", keys[0], keys[1])
+	}
+	if _, err := NewShardedLRUCache(64, 8, WithHasher(nil)); err == nil {
+		t.Error("nil hasher accepted")
+	}
+}
+
+func TestShardedRestoreReshards(t *testing.T) {
+	clock := newFakeClock()
+	src, err := NewShardedLRUCache(256, 8, WithClock(clock), WithHasher(FixedHasher(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	for k := range 100 {
+		src.Put(k, k*10)
+	}
+	src.PutWithTTL(100, 1000, time.Minute)
+
+	dst, err := NewShardedLRUCache(64, 4, WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if err := dst.Restore(src.Dump()); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Size() != 101 || dst.Capacity() != 256 {
+		t.Errorf("restored %d entries at capacity %d, want 101 at 256", dst.Size(), dst.Capacity())
+	}
+	for k := range 101 {
+		if v, ok := dst.shard(k).Peek(k); !ok || v != k*10 {
+			t.Errorf("key %d = %d, %v in its shard, want %d", k, v, ok, k*10)
+		}
+	}
+	for _, shard := range dst.Shards() {
+		if err := shard.CheckInvariants(); err != nil {
+			t.Error(err)
+		}
+	}
+	clock.Advance(2 * time.Minute)
+	if dst.Contains(100) {
+		t.Error("key 100 outlived its TTL after the restore")
+	}
+}
+
+func TestShardedRestoreTrimsOverfullShards(t *testing.T) {
+	src, err := NewShardedLRUCache(64, 8, WithHasher(FixedHasher(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	for k := range 64 {
+		src.Put(k, k)
+	}
+	d := src.Dump()
+
+	dst, err := NewShardedLRUCache(64, 8, WithHasher(FixedHasher(2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	dst.Put(1000, 1)
+	if err := dst.Restore(d); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Size() > 64 || dst.Size() < 32 || dst.Contains(1000) {
+		t.Errorf("restored %d entries, holding key 1000: %v", dst.Size(), dst.Contains(1000))
+	}
+	for _, k := range dst.Keys() {
+		if v, _ := dst.Peek(k); v != k {
+			t.Errorf("key %d = %d", k, v)
+		}
+	}
+
+	d.Shards[1] = d.Shards[0]
+	if err := dst.Restore(d); !errors.Is(err, ErrDumpDuplicateKey) {
+		t.Errorf("keys dumped by two shards: err = %v, want ErrDumpDuplicateKey", err)
+	}
+}
+
+func TestShardedRestoreIsAllOrNothing(t *testing.T) {
+	var dst *ShardedLRUCache
+	var added atomic.Int64
+	dst, err := NewShardedLRUCache(64, 4, WithMaxCost(40), WithHasher(FixedHasher(1)),
+		// Each hook reads another shard, which a restore must have released.
+		WithOnAdd(func(key, value int) {
+			dst.Peek(key + 1)
+			added.Add(1)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	for k := range 8 {
+		dst.Put(k, k)
+	}
+	before := dst.Keys()
+	slices.Sort(before)
+
+	last := func(key int) bool { return dst.hasher.Hash(key)&dst.mask == dst.mask }
+	d := CacheDump{Version: dumpVersion, Capacity: 64, Items: map[int]int{}, Costs: map[int]int64{}}
+	for k := 100; k < 120; k++ {
+		if !last(k) {
+			d.Order = append(d.Order, k)
+			d.Items[k] = k
+		}
+	}
+	heavy := 200
+	for !last(heavy) {
+		heavy++
+	}
+	d.Order = append(d.Order, heavy)
+	d.Items[heavy] = heavy
+	d.Costs[heavy] = 11
+	d.Size = len(d.Order)
+
+	added.Store(0)
+	err = dst.Restore(ShardedDump{Capacity: 64, Size: d.Size, Shards: []CacheDump{d}})
+	if !errors.Is(err, ErrDumpOverCapacity) {
+		t.Fatalf("share over the last shard's budget: err = %v, want ErrDumpOverCapacity", err)
+	}
+	after := dst.Keys()
+	slices.Sort(after)
+	if !slices.Equal(after, before) {
+		t.Errorf("failed restore left keys %v, want %v", after, before)
+	}
+
+	d.Costs[heavy] = 10
+	if err := dst.Restore(ShardedDump{Capacity: 64, Size: d.Size, Shards: []CacheDump{d}}); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Size() != d.Size || added.Load() != int64(d.Size) {
+		t.Errorf("restored %d entries with %d OnAdd calls, want %d", dst.Size(), added.Load(), d.Size)
+	}
+}
+
+// BenchmarkShardedParallel runs the same mix of hits and writes from 32
+// goroutines per CPU on one cache and on 16 shards, which share no lock.
+func BenchmarkShardedParallel(b *testing.B) {
+	single, err := NewSecureLRUCache(4096)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer single.Close()
+	sharded, err := NewShardedLRUCache(4096, 16)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer sharded.Close()
+
+	for _, bc := range []struct {
+		name string
+		get  func(key int) (int, bool)
+		put  func(key, value int) error
+	}{
+		{"single", single.Get, single.Put},
+		{"sharded", sharded.Get, sharded.Put},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for k := range 4096 {
+				bc.put(k, k)
+			}
+			b.SetParallelism(32)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					k := r.Intn(8192)
+					if r.Intn(8) == 0 {
+						bc.put(k, k)
+					} else {
+						bc.get(k)
+					}
+				}
+			})
+		})
+	}
+}
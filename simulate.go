@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// PolicyFactory builds a fresh policy, as WithPolicyFunc takes.
+type PolicyFactory func() Policy
+
+// SimulationResult is what one capacity made of a trace.
+type SimulationResult struct {
+	Capacity  int
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+// HitRatio is the share of gets that hit, or zero for a trace without gets.
+func (r SimulationResult) HitRatio() float64 {
+	if r.Hits+r.Misses == 0 {
+		return 0
+	}
+	return float64(r.Hits) / float64(r.Hits+r.Misses)
+}
+
+// ghostCache tracks which keys a cache of one capacity would hold, without
+// their values, replaying operations the way SecureLRUCache applies them to
+// its policy.
+type ghostCache struct {
+	SimulationResult
+	nodes  map[int]*Node
+	policy Policy
+	keyed  KeyedVictimPolicy
+}
+
+// Simulate replays trace against a cache of each capacity under the policy
+// newPolicy builds, LRU if nil, and reports what each would have hit. Gets,
+// Puts and Removes act as on a SecureLRUCache without TTLs, admission or
+// cost limits, so a cache of that capacity replaying the trace scores the
+// same; the Hit recorded for each operation is ignored. Only keys are
+// kept, one policy node per key per capacity, so one pass covers every
+// capacity. With SampledLRU, whose eviction is random, the counts differ
+// from run to run.
+func Simulate(trace []TraceRecord, capacities []int, newPolicy PolicyFactory) ([]SimulationResult, error) {
+	if newPolicy == nil {
+		newPolicy = LRU
+	}
+	ghosts := make([]*ghostCache, len(capacities))
+	for i, capacity := range capacities {
+		if capacity < 1 {
+			return nil, fmt.Errorf("capacity must be at least 1, got %d", capacity)
+		}
+		g := &ghostCache{
+			SimulationResult: SimulationResult{Capacity: capacity},
+			nodes:            make(map[int]*Node),
+			policy:           newPolicy(),
+		}
+		if i > 0 && g.policy == ghosts[0].policy {
+			return nil, fmt.Errorf("policy factory must return a new policy on every call")
+		}
+		if p, ok := g.policy.(CapacityAwarePolicy); ok {
+			p.SetCapacity(capacity)
+		}
+		g.keyed, _ = g.policy.(KeyedVictimPolicy)
+		ghosts[i] = g
+	}
+
+	for i, rec := range trace {
+		for _, g := range ghosts {
+			if err := g.apply(rec); err != nil {
+				return nil, fmt.Errorf("trace record %d: %w", i, err)
+			}
+		}
+	}
+	results := make([]SimulationResult, len(ghosts))
+	for i, g := range ghosts {
+		results[i] = g.SimulationResult
+	}
+	return results, nil
+}
+
+func (g *ghostCache) apply(rec TraceRecord) error {
+	node, exists := g.nodes[rec.Key]
+	switch rec.Op {
+	case TraceGet:
+		if !exists {
+			g.Misses++
+			return nil
+		}
+		g.Hits++
+		g.policy.RecordAccess(node)
+	case TracePut:
+		if exists {
+			g.policy.RecordAccess(node)
+			return nil
+		}
+		for len(g.nodes) >= g.Capacity {
+			var victim *Node
+			if g.keyed != nil {
+				victim = g.keyed.VictimFor(rec.Key)
+			} else {
+				victim = g.policy.Victim()
+			}
+			if victim == nil {
+				return fmt.Errorf("cache is full and cannot evict")
+			}
+			g.policy.Remove(victim)
+			delete(g.nodes, victim.key)
+			g.Evictions++
+		}
+		node = &Node{key: rec.Key}
+		g.nodes[rec.Key] = node
+		g.policy.RecordInsert(node)
+	case TraceRemove:
+		if exists {
+			g.policy.Remove(node)
+			delete(g.nodes, rec.Key)
+		}
+	default:
+		return fmt.Errorf("unknown op %d", rec.Op)
+	}
+	return nil
+}
+
+// simulationPolicies are the policies the simulate subcommand knows by
+// name.
+var simulationPolicies = map[string]PolicyFactory{
+	"lru":     LRU,
+	"fifo":    FIFO,
+	"mru":     MRU,
+	"lfu":     LFU,
+	"slru":    SLRU,
+	"arc":     ARC,
+	"clock":   CLOCK,
+	"sieve":   Sieve,
+	"lru2":    func() Policy { return LRUK(2) },
+	"sampled": func() Policy { return SampledLRU(0) },
+}
+
+const simulateUsage = `usage: simulate --capacities n,n,... [--policy name] [--csv] <trace>
+
+Replays a trace written by WithTraceRecorder against ghost caches of each
+capacity and prints their hits, misses, evictions and hit ratio. Policies:
+`
+
+// runSimulate runs the simulate subcommand with args following "simulate"
+// and returns the exit code: 1 for an unreadable trace, 2 for bad usage.
+func runSimulate(args []string, stdout, stderr io.Writer) int {
+	names := slices.Sorted(maps.Keys(simulationPolicies))
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, simulateUsage+"  "+strings.Join(names, ", ")+"\n") }
+	list := fs.String("capacities", "", "comma-separated capacities to simulate")
+	policy := fs.String("policy", "lru", "eviction policy")
+	asCSV := fs.Bool("csv", false, "print CSV instead of a table")
+	operands, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(operands) != 1 || *list == "" {
+		fs.Usage()
+		return 2
+	}
+	newPolicy, ok := simulationPolicies[*policy]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown policy %q\n", *policy)
+		fs.Usage()
+		return 2
+	}
+	var capacities []int
+	for _, field := range strings.Split(*list, ",") {
+		capacity, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || capacity < 1 {
+			fmt.Fprintf(stderr, "capacity must be a positive integer: %q\n", field)
+			return 2
+		}
+		capacities = append(capacities, capacity)
+	}
+	sort.Ints(capacities)
+
+	f, err := os.Open(operands[0])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer f.Close()
+	trace, err := ReadTrace(f)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", operands[0], err)
+		return 1
+	}
+	results, err := Simulate(trace, capacities, newPolicy)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", operands[0], err)
+		return 1
+	}
+
+	if *asCSV {
+		w := csv.NewWriter(stdout)
+		w.Write([]string{"capacity", "hits", "misses", "evictions", "hit_ratio"})
+		for _, r := range results {
+			w.Write([]string{strconv.Itoa(r.Capacity), strconv.FormatInt(r.Hits, 10),
+				strconv.FormatInt(r.Misses, 10), strconv.FormatInt(r.Evictions, 10),
+				strconv.FormatFloat(r.HitRatio(), 'f', 4, 64)})
+		}
+		w.Flush()
+		return 0
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "capacity\thits\tmisses\tevictions\thit ratio\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%.2f%%\t\n", r.Capacity, r.Hits, r.Misses, r.Evictions, 100*r.HitRatio())
+	}
+	tw.Flush()
+	return 0
+}
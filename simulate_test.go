@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// zipfTrace is a skewed mix of gets, puts and removes over keys.
+func zipfTrace(n int, keys uint64, seed int64) []TraceRecord {
+	r := rand.New(rand.NewSource(seed))
+	zipf := rand.NewZipf(r, 1.1, 4, keys-1)
+	trace := make([]TraceRecord, n)
+	for i := range trace {
+		op := TraceGet
+		switch p := r.Intn(100); {
+		case p < 30:
+			op = TracePut
+		case p < 33:
+			op = TraceRemove
+		}
+		trace[i] = TraceRecord{Op: op, Key: int(zipf.Uint64())}
+	}
+	return trace
+}
+
+func replay(t *testing.T, trace []TraceRecord, capacity int, policy Policy) CacheStats {
+	t.Helper()
+	c, err := NewSecureLRUCache(capacity, WithPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, rec := range trace {
+		switch rec.Op {
+		case TraceGet:
+			c.Get(rec.Key)
+		case TracePut:
+			c.Put(rec.Key, rec.Key)
+		case TraceRemove:
+			c.Remove(rec.Key)
+		}
+	}
+	return c.Stats()
+}
+
+func TestSimulateMatchesReplay(t *testing.T) {
+	trace := zipfTrace(20000, 2000, 1)
+	capacities := []int{1, 10, 100, 500, 3000}
+	for name, newPolicy := range simulationPolicies {
+		if name == "sampled" {
+			continue // random eviction
+		}
+		t.Run(name, func(t *testing.T) {
+			results, err := Simulate(trace, capacities, newPolicy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, capacity := range capacities {
+				got := results[i]
+				st := replay(t, trace, capacity, newPolicy())
+				if got.Capacity != capacity || got.Hits != st.Hits || got.Misses != st.Misses || got.Evictions != st.Evictions {
+					t.Errorf("capacity %d: simulated %+v, replayed hits %d, misses %d, evictions %d",
+						capacity, got, st.Hits, st.Misses, st.Evictions)
+				}
+			}
+		})
+	}
+}
+
+func TestSimulateRecordedTrace(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := NewSecureLRUCache(50, WithTraceRecorder(&buf, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Few enough operations that none can be dropped from the trace queue.
+	for _, rec := range zipfTrace(2000, 400, 2) {
+		switch rec.Op {
+		case TraceGet:
+			if _, ok := c.Get(rec.Key); !ok {
+				c.Put(rec.Key, rec.Key)
+			}
+		case TraceRemove:
+			c.Remove(rec.Key)
+		}
+	}
+	want := c.Stats()
+	c.Close()
+	if want.DroppedTraceRecords != 0 {
+		t.Fatalf("%d trace records dropped", want.DroppedTraceRecords)
+	}
+
+	trace, err := ReadTrace(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := Simulate(trace, []int{50, 25}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Hits != want.Hits || results[0].Misses != want.Misses {
+		t.Errorf("simulated %+v, the cache saw %d hits and %d misses", results[0], want.Hits, want.Misses)
+	}
+	if results[1].Hits >= results[0].Hits {
+		t.Errorf("half the capacity hit as often: %d vs %d", results[1].Hits, results[0].Hits)
+	}
+}
+
+func TestSimulateRejectsBadInput(t *testing.T) {
+	if _, err := Simulate(nil, []int{10, 0}, nil); err == nil {
+		t.Error("capacity 0 accepted")
+	}
+	shared := LRU()
+	if _, err := Simulate(nil, []int{1, 2}, func() Policy { return shared }); err == nil {
+		t.Error("a factory returning one policy accepted")
+	}
+	if _, err := Simulate([]TraceRecord{{Op: 9}}, []int{1}, nil); err == nil {
+		t.Error("unknown op accepted")
+	}
+}
+
+func TestRunSimulate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.csv")
+	trace := "op,key,unix_nano,hit\nput,1,0,0\nget,1,0,1\nput,2,0,0\nget,1,0,1\nget,2,0,1\n"
+	if err := os.WriteFile(path, []byte(trace), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := runSimulate([]string{"--capacities", "2,1", "--csv", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	want := "capacity,hits,misses,evictions,hit_ratio\n1,2,1,1,0.6667\n2,3,0,0,1.0000\n"
+	if stdout.String() != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", stdout.String(), want)
+	}
+
+	stdout.Reset()
+	if code := runSimulate([]string{path, "--capacities", "2", "--policy", "fifo"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "hit ratio") || !strings.Contains(stdout.String(), "100.00%") {
+		t.Errorf("table =\n%s", stdout.String())
+	}
+
+	for _, args := range [][]string{
+		{path},
+		{"--capacities", "2"},
+		{"--capacities", "x", path},
+		{"--capacities", "2", "--policy", "nope", path},
+	} {
+		if code := runSimulate(args, &stdout, &stderr); code != 2 {
+			t.Errorf("%q: exit %d, want 2", args, code)
+		}
+	}
+	if code := runSimulate([]string{"--capacities", "2", path + ".missing"}, &stdout, &stderr); code != 1 {
+		t.Errorf("missing trace: exit %d, want 1", code)
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"time"
+)
+
+// The binary snapshot format: the magic, a version byte, then the capacity and
+// entry count as uvarints, then each entry in Dump order as a varint key, a
+// varint value, a flags byte, a uvarint LFU frequency (0 if none) and, from
+// version 2, a varint expiry in Unix nanoseconds (0 if none) and, from
+// version 4, a uvarint cost. From version 3 the snapshot ends with the
+// big-endian CRC-32C of everything before it.
+const snapshotMagic = "LRUC"
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrChecksumMismatch is matched by the error for a snapshot whose contents
+// do not match its checksum.
+var ErrChecksumMismatch = errors.New("snapshot checksum mismatch")
+
+// ChecksumError reports a snapshot that fails its checksum. It matches
+// ErrChecksumMismatch.
+type ChecksumError struct {
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("snapshot checksum is %08x, contents hash to %08x", e.Expected, e.Actual)
+}
+
+func (e *ChecksumError) Is(target error) bool { return target == ErrChecksumMismatch }
+
+// Entry flags. A removed entry was deleted while WriteTo streamed the
+// snapshot and is skipped when reading it.
+const (
+	entryTombstone byte = 1 << iota
+	entryRemoved
+)
+
+// ErrUnsupportedDumpVersion is matched by the error for a binary snapshot
+// written in a format version this build does not read.
+var ErrUnsupportedDumpVersion = errors.New("unsupported dump version")
+
+// DumpVersionError reports a binary snapshot's unknown format version. It
+// matches ErrUnsupportedDumpVersion.
+type DumpVersionError struct {
+	Version int
+}
+
+func (e *DumpVersionError) Error() string {
+	return fmt.Sprintf("dump format version %d is not supported (want 1 to %d)", e.Version, dumpVersion)
+}
+
+func (e *DumpVersionError) Is(target error) bool { return target == ErrUnsupportedDumpVersion }
+
+// MarshalBinary encodes the cache's Dump in a compact binary form, which also
+// makes the cache work with encoding/gob. Policy state beyond the order and
+// LFU frequencies is not kept.
+func (c *SecureLRUCache) MarshalBinary() ([]byte, error) {
+	if err := c.snapshotAllowed(); err != nil {
+		return nil, err
+	}
+	return c.Dump().appendBinary(nil), nil
+}
+
+// UnmarshalBinary restores a snapshot written by MarshalBinary, with the same
+// rules as UnmarshalJSON.
+func (c *SecureLRUCache) UnmarshalBinary(data []byte) error {
+	d, err := decodeBinaryDump(data)
+	if err != nil {
+		return err
+	}
+	return c.restoreDump(d)
+}
+
+func (d CacheDump) appendBinary(buf []byte) []byte {
+	start := len(buf)
+	buf = appendSnapshotHeader(buf, d.Capacity, len(d.Order))
+	for _, key := range d.Order {
+		value, live := d.Items[key]
+		var flags byte
+		if !live {
+			flags |= entryTombstone
+		}
+		cost, ok := d.Costs[key]
+		if !ok {
+			cost = 1
+		}
+		buf = appendSnapshotEntry(buf, key, value, flags, d.Frequencies[key], d.Expires[key], cost)
+	}
+	return binary.BigEndian.AppendUint32(buf, crc32.Checksum(buf[start:], crcTable))
+}
+
+func appendSnapshotHeader(buf []byte, capacity, count int) []byte {
+	buf = append(buf, snapshotMagic...)
+	buf = append(buf, dumpVersion)
+	buf = binary.AppendUvarint(buf, uint64(capacity))
+	return binary.AppendUvarint(buf, uint64(count))
+}
+
+func appendSnapshotEntry(buf []byte, key, value int, flags byte, freq int, expires time.Time, cost int64) []byte {
+	buf = binary.AppendVarint(buf, int64(key))
+	buf = binary.AppendVarint(buf, int64(value))
+	buf = append(buf, flags)
+	buf = binary.AppendUvarint(buf, uint64(freq))
+	var at int64
+	if !expires.IsZero() {
+		at = expires.UnixNano()
+	}
+	buf = binary.AppendVarint(buf, at)
+	return binary.AppendUvarint(buf, uint64(cost))
+}
+
+func decodeBinaryDump(data []byte) (CacheDump, error) {
+	return readBinaryDump(bytes.NewReader(data))
+}
+
+// readBinaryDump decodes a binary snapshot from src, which must end with it.
+func readBinaryDump(src io.ByteReader) (CacheDump, error) {
+	var d CacheDump
+	r := &crcReader{src: src}
+	var header [len(snapshotMagic) + 1]byte
+	for i := range header {
+		b, err := r.ReadByte()
+		if err != nil {
+			if i < len(snapshotMagic) {
+				return d, fmt.Errorf("not a binary cache dump")
+			}
+			return d, fmt.Errorf("read dump version: %w", err)
+		}
+		header[i] = b
+		if i < len(snapshotMagic) && b != snapshotMagic[i] {
+			return d, fmt.Errorf("not a binary cache dump")
+		}
+	}
+	d.Version = int(header[len(snapshotMagic)])
+	if d.Version < 1 || d.Version > dumpVersion {
+		return d, &DumpVersionError{Version: d.Version}
+	}
+
+	capacity, err := binary.ReadUvarint(r)
+	if err != nil {
+		return d, fmt.Errorf("read dump capacity: %w", err)
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return d, fmt.Errorf("read dump entry count: %w", err)
+	}
+	if capacity > uint64(math.MaxInt) || count > capacity {
+		return d, fmt.Errorf("%w: %d entries, capacity %d", ErrDumpOverCapacity, count, capacity)
+	}
+
+	// Don't let a lying count make us allocate up front.
+	n := int(min(count, 4096))
+	d.Capacity = int(capacity)
+	d.Items = make(map[int]int, n)
+	d.Order = make([]int, 0, n)
+	for i := uint64(0); i < count; i++ {
+		key, err := binary.ReadVarint(r)
+		if err != nil {
+			return d, fmt.Errorf("read dump entry %d: %w", i, err)
+		}
+		value, err := binary.ReadVarint(r)
+		if err != nil {
+			return d, fmt.Errorf("read dump entry %d: %w", i, err)
+		}
+		flags, err := r.ReadByte()
+		if err != nil {
+			return d, fmt.Errorf("read dump entry %d: %w", i, err)
+		}
+		freq, err := binary.ReadUvarint(r)
+		if err != nil {
+			return d, fmt.Errorf("read dump entry %d: %w", i, err)
+		}
+		var expires int64
+		if d.Version >= 2 {
+			if expires, err = binary.ReadVarint(r); err != nil {
+				return d, fmt.Errorf("read dump entry %d: %w", i, err)
+			}
+		}
+		cost := uint64(1)
+		if d.Version >= 4 {
+			if cost, err = binary.ReadUvarint(r); err != nil {
+				return d, fmt.Errorf("read dump entry %d: %w", i, err)
+			}
+		}
+		if flags&^(entryTombstone|entryRemoved) != 0 {
+			return d, fmt.Errorf("dump entry %d has unknown flags %#x", i, flags)
+		}
+		if int64(int(key)) != key || int64(int(value)) != value || freq > uint64(math.MaxInt) || cost > math.MaxInt64 {
+			return d, fmt.Errorf("dump entry %d does not fit in int", i)
+		}
+		if flags&entryRemoved != 0 {
+			continue
+		}
+
+		d.Order = append(d.Order, int(key))
+		if flags&entryTombstone != 0 {
+			d.Tombstones = append(d.Tombstones, int(key))
+		} else {
+			d.Items[int(key)] = int(value)
+		}
+		if expires != 0 {
+			if d.Expires == nil {
+				d.Expires = make(map[int]time.Time)
+			}
+			d.Expires[int(key)] = time.Unix(0, expires)
+		}
+		if freq > 0 {
+			if d.Frequencies == nil {
+				d.Frequencies = make(map[int]int)
+			}
+			d.Frequencies[int(key)] = int(freq)
+		}
+		if cost != 1 {
+			if d.Costs == nil {
+				d.Costs = make(map[int]int64)
+			}
+			d.Costs[int(key)] = int64(cost)
+		}
+	}
+	if d.Version >= 3 {
+		actual := r.sum()
+		var trailer [4]byte
+		for i := range trailer {
+			b, err := src.ReadByte()
+			if err != nil {
+				return d, fmt.Errorf("read dump checksum: %w", err)
+			}
+			trailer[i] = b
+		}
+		if expected := binary.BigEndian.Uint32(trailer[:]); expected != actual {
+			return d, &ChecksumError{Expected: expected, Actual: actual}
+		}
+	}
+	if _, err := src.ReadByte(); err == nil {
+		return d, fmt.Errorf("unexpected data after the last dump entry")
+	} else if err != io.EOF {
+		return d, err
+	}
+	d.Size = len(d.Order)
+	return d, nil
+}
+
+// snapshotChunk is how many entries WriteTo encodes per hold of the read lock.
+const snapshotChunk = 1024
+
+// WriteTo streams a binary snapshot of the cache to w, as MarshalBinary would
+// produce, without building it in memory. The order of the keys is taken in
+// one pass, costing a word per entry; their values are then read in chunks,
+// releasing the read lock while each chunk is written, so writers are never
+// held up for the whole encode. A value that changes mid-stream is written as
+// it is when its chunk is read, and an entry removed before then is skipped.
+func (c *SecureLRUCache) WriteTo(w io.Writer) (int64, error) {
+	if err := c.snapshotAllowed(); err != nil {
+		return 0, err
+	}
+	c.mu.RLock()
+	keys := make([]int, 0, len(c.cache))
+	c.policy.Each(func(node *Node) bool {
+		keys = append(keys, node.key)
+		return true
+	})
+	capacity := c.capacity
+	c.mu.RUnlock()
+
+	var written int64
+	var crc uint32
+	buf := appendSnapshotHeader(nil, capacity, len(keys))
+	for start := 0; start < len(keys); start += snapshotChunk {
+		chunk := keys[start:min(start+snapshotChunk, len(keys))]
+		c.mu.RLock()
+		for _, key := range chunk {
+			node, exists := c.cache[key]
+			switch {
+			case !exists:
+				buf = appendSnapshotEntry(buf, key, 0, entryRemoved, 0, time.Time{}, 1)
+			case node.tombstone:
+				buf = appendSnapshotEntry(buf, key, 0, entryTombstone, node.freq, node.expiresAt, node.cost)
+			case c.redacting():
+				buf = appendSnapshotEntry(buf, key, 0, 0, node.freq, node.expiresAt, node.cost)
+			default:
+				buf = appendSnapshotEntry(buf, key, node.value, 0, node.freq, node.expiresAt, node.cost)
+			}
+		}
+		c.mu.RUnlock()
+
+		crc = crc32.Update(crc, crcTable, buf)
+		n, err := w.Write(buf)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		buf = buf[:0]
+	}
+	crc = crc32.Update(crc, crcTable, buf)
+	n, err := w.Write(binary.BigEndian.AppendUint32(buf, crc))
+	return written + int64(n), err
+}
+
+// ReadFrom replaces the cache's contents with a binary snapshot read from r
+// until EOF, with the same rules as UnmarshalBinary. Snapshots written by
+// SaveCompressed are recognised by their gzip header and decompressed.
+// Truncated or corrupt input returns an error matching ErrCorruptSnapshot and
+// leaves the cache as it was.
+func (c *SecureLRUCache) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	d, err := readSnapshot(cr)
+	if err != nil {
+		return cr.n, err
+	}
+	return cr.n, c.restoreDump(d)
+}
+
+// readSnapshot decodes a binary snapshot, gzipped or not, from r.
+func readSnapshot(r io.Reader) (CacheDump, error) {
+	br := bufio.NewReader(r)
+	var src io.ByteReader = br
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return CacheDump{}, fmt.Errorf("%w: %w", ErrCorruptSnapshot, err)
+		}
+		defer zr.Close()
+		src = bufio.NewReader(zr)
+	}
+
+	d, err := readBinaryDump(src)
+	if err != nil {
+		var version *DumpVersionError
+		if !errors.As(err, &version) {
+			err = fmt.Errorf("%w: %w", ErrCorruptSnapshot, err)
+		}
+		return d, err
+	}
+	return d, nil
+}
+
+// ErrCorruptSnapshot is matched by the error ReadFrom returns for a snapshot
+// that is truncated, fails its gzip checksum or otherwise cannot be decoded.
+var ErrCorruptSnapshot = errors.New("corrupt snapshot")
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// SaveCompressed is WriteTo with the snapshot gzipped at the given level, from
+// gzip.HuffmanOnly to gzip.BestCompression. It returns the compressed size.
+// ReadFrom detects the compression, so there is no separate load.
+func (c *SecureLRUCache) SaveCompressed(w io.Writer, level int) (int64, error) {
+	cw := &countingWriter{w: w}
+	zw, err := gzip.NewWriterLevel(cw, level)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := c.WriteTo(zw); err != nil {
+		return cw.n, err
+	}
+	err = zw.Close()
+	return cw.n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// crcReader hashes the bytes read through it.
+type crcReader struct {
+	src     io.ByteReader
+	crc     uint32
+	pending []byte
+}
+
+func (r *crcReader) ReadByte() (byte, error) {
+	b, err := r.src.ReadByte()
+	if err == nil {
+		r.pending = append(r.pending, b)
+		if len(r.pending) == 4096 {
+			r.sum()
+		}
+	}
+	return b, err
+}
+
+// sum returns the checksum of everything read so far.
+func (r *crcReader) sum() uint32 {
+	r.crc = crc32.Update(r.crc, crcTable, r.pending)
+	r.pending = r.pending[:0]
+	return r.crc
+}
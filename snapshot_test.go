@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// snapshotSource is a cache of capacity 8 holding keys 1 to 5, with 2 read.
+func snapshotSource(t *testing.T) *SecureLRUCache {
+	t.Helper()
+	c := newTestCache(t, 8)
+	for k := 1; k <= 5; k++ {
+		c.Put(k, k*10)
+	}
+	c.Get(2)
+	return c
+}
+
+func TestGobRoundTrip(t *testing.T) {
+	src := snapshotSource(t)
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(src); err != nil {
+		t.Fatal(err)
+	}
+	dst := newTestCache(t, 2)
+	if err := gob.NewDecoder(&buf).Decode(dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dst.Dump(), src.Dump(); !reflect.DeepEqual(got, want) {
+		t.Errorf("gob round trip gave %+v, want %+v", got, want)
+	}
+}
+
+func TestSaveCompressedRoundTrip(t *testing.T) {
+	src := snapshotSource(t)
+	want := src.Dump()
+	var plain bytes.Buffer
+	if _, err := src.WriteTo(&plain); err != nil {
+		t.Fatal(err)
+	}
+	for _, level := range []int{gzip.HuffmanOnly, gzip.NoCompression, gzip.DefaultCompression, gzip.BestCompression} {
+		var buf bytes.Buffer
+		n, err := src.SaveCompressed(&buf, level)
+		if err != nil || n != int64(buf.Len()) {
+			t.Fatalf("level %d: wrote %d of %d bytes: %v", level, n, buf.Len(), err)
+		}
+		if !bytes.HasPrefix(buf.Bytes(), gzipMagic) {
+			t.Fatalf("level %d: output is not gzipped", level)
+		}
+		dst := newTestCache(t, 2)
+		if _, err := dst.ReadFrom(&buf); err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if got := dst.Dump(); !reflect.DeepEqual(got, want) {
+			t.Errorf("level %d: loaded %+v, want %+v", level, got, want)
+		}
+	}
+
+	// ReadFrom takes uncompressed snapshots as well.
+	dst := newTestCache(t, 2)
+	if _, err := dst.ReadFrom(bytes.NewReader(plain.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if got := dst.Dump(); !reflect.DeepEqual(got, want) {
+		t.Errorf("plain snapshot loaded as %+v, want %+v", got, want)
+	}
+
+	var buf bytes.Buffer
+	src.SaveCompressed(&buf, gzip.BestSpeed)
+	corrupt := buf.Bytes()
+	corrupt[len(corrupt)-5] ^= 0xff // inside gzip's CRC of the contents
+	if _, err := dst.ReadFrom(bytes.NewReader(corrupt)); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Errorf("corrupt gzip stream: err = %v, want ErrCorruptSnapshot", err)
+	}
+	if _, err := dst.ReadFrom(bytes.NewReader(corrupt[:len(corrupt)/2])); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Errorf("truncated gzip stream: err = %v, want ErrCorruptSnapshot", err)
+	}
+	if got := dst.Dump(); !reflect.DeepEqual(got, want) {
+		t.Errorf("a failed load changed the cache to %+v", got)
+	}
+}
+
+// TestHistoricalSnapshotsLoad loads the fixtures in testdata, a cache of
+// capacity 4 holding keys 3, 2 and 1 written in every format version. From
+// version 2 key 2 expires in 2100, and from version 4 key 3 costs 2.
+func TestHistoricalSnapshotsLoad(t *testing.T) {
+	clock := newFakeClock()
+	opts := []Option{WithClock(clock), WithDefaultTTL(time.Hour), WithDebugChecks()}
+	for v := 1; v <= dumpVersion; v++ {
+		load := map[string]func(data []byte) (*SecureLRUCache, error){
+			"json": func(data []byte) (*SecureLRUCache, error) { return FromJSON(string(data), opts...) },
+			"binary": func(data []byte) (*SecureLRUCache, error) {
+				c, err := NewSecureLRUCache(1, opts...)
+				if err != nil {
+					return nil, err
+				}
+				return c, c.UnmarshalBinary(data)
+			},
+		}
+		for format, file := range map[string]string{"json": "dump_v%d.json", "binary": "snapshot_v%d.bin"} {
+			t.Run(fmt.Sprintf("%s v%d", format, v), func(t *testing.T) {
+				data, err := os.ReadFile(filepath.Join("testdata", fmt.Sprintf(file, v)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				c, err := load[format](data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer c.Close()
+				d := c.Dump()
+				if d.Capacity != 4 || !slices.Equal(d.Order, []int{3, 2, 1}) || d.Items[3] != 30 || d.Version != dumpVersion {
+					t.Fatalf("loaded %+v", d)
+				}
+				wantExpires := map[int]time.Time{2: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)}
+				if v == 1 {
+					at := clock.Now().Add(time.Hour)
+					wantExpires = map[int]time.Time{1: at, 2: at, 3: at}
+				}
+				if len(d.Expires) != len(wantExpires) {
+					t.Errorf("expiries %v, want %v", d.Expires, wantExpires)
+				}
+				for key, at := range wantExpires {
+					if !d.Expires[key].Equal(at) {
+						t.Errorf("key %d expires at %v, want %v", key, d.Expires[key], at)
+					}
+				}
+				if wantCost := v >= 4; (d.Costs[3] == 2) != wantCost || len(d.Costs) > 1 {
+					t.Errorf("costs %v", d.Costs)
+				}
+			})
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join("testdata", fmt.Sprintf("snapshot_v%d.bin", dumpVersion)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(snapshotMagic)] = dumpVersion + 1
+	var version *DumpVersionError
+	if err := newTestCache(t, 4).UnmarshalBinary(data); !errors.As(err, &version) || version.Version != dumpVersion+1 {
+		t.Errorf("a newer version loaded with err = %v, want a DumpVersionError", err)
+	}
+}
+
+func TestSnapshotChecksum(t *testing.T) {
+	src := snapshotSource(t)
+	data, err := src.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := newTestCache(t, 4)
+	dst.Put(99, 99)
+	before := dst.Dump()
+
+	// Flip a bit of the last entry's value, which still decodes.
+	data[len(data)-4-5] ^= 0x02
+	var mismatch *ChecksumError
+	if err := dst.UnmarshalBinary(data); !errors.As(err, &mismatch) || !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("flipped byte: err = %v, want a ChecksumError", err)
+	}
+	if mismatch.Expected == mismatch.Actual {
+		t.Errorf("ChecksumError reports equal sums %08x", mismatch.Expected)
+	}
+	if _, err := dst.ReadFrom(bytes.NewReader(data)); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("flipped byte through ReadFrom: err = %v", err)
+	}
+
+	js, err := src.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.UnmarshalJSON([]byte(strings.Replace(js, "50", "51", 1))); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("edited JSON: err = %v, want ErrChecksumMismatch", err)
+	}
+
+	if _, err := dst.ReadFrom(bytes.NewReader(nil)); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Errorf("empty snapshot: err = %v, want ErrCorruptSnapshot", err)
+	}
+	if err := dst.UnmarshalBinary(nil); err == nil {
+		t.Error("empty snapshot accepted")
+	}
+	if got := dst.Dump(); !reflect.DeepEqual(got, before) {
+		t.Errorf("failed loads changed the cache to %+v", got)
+	}
+}
+
+func TestMsgpackCrossFormat(t *testing.T) {
+	clock := newFakeClock()
+	// Each cache needs a policy of its own.
+	opts := func() []Option { return []Option{WithPolicy(LFU()), WithClock(clock)} }
+	src := newTestCache(t, 8, opts()...)
+	for k := 1; k <= 4; k++ {
+		src.Put(k, -k*1000)
+	}
+	src.PutWithTTL(5, 5, time.Minute)
+	src.PutWithCost(6, 6, 3)
+	src.Get(2)
+	src.Get(2)
+
+	data, err := src.MarshalMsgpack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	viaMsgpack := newTestCache(t, 2, opts()...)
+	if err := viaMsgpack.UnmarshalMsgpack(data); err != nil {
+		t.Fatal(err)
+	}
+	js, err := viaMsgpack.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	viaJSON := newTestCache(t, 2, opts()...)
+	if err := viaJSON.UnmarshalJSON([]byte(js)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := src.Dump()
+	expiry := want.Expires[5]
+	if expiry.IsZero() || want.Costs[6] != 3 || want.Frequencies[2] != 3 {
+		t.Fatalf("the source dump lacks the metadata under test: %+v", want)
+	}
+	want.Expires = nil
+	for name, c := range map[string]*SecureLRUCache{"msgpack": viaMsgpack, "msgpack then JSON": viaJSON} {
+		got := c.Dump()
+		// Decoded times carry another location, so expiries compare by
+		// instant.
+		if at := got.Expires[5]; len(got.Expires) != 1 || !at.Equal(expiry) {
+			t.Errorf("%s: expiries %v, want key 5 at %v", name, got.Expires, expiry)
+		}
+		got.Expires = nil
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+// benchmarkSnapshots is the entry count of the caches the format benchmarks
+// encode and decode.
+const benchmarkSnapshots = 100000
+
+// BenchmarkSnapshotFormats encodes and decodes a full cache in each format,
+// reporting the encoded size.
+func BenchmarkSnapshotFormats(b *testing.B) {
+	src, err := NewSecureLRUCache(benchmarkSnapshots)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer src.Close()
+	for k := range benchmarkSnapshots {
+		src.Put(k, k*7)
+	}
+	for _, format := range []struct {
+		name   string
+		encode func() ([]byte, error)
+		decode func(*SecureLRUCache, []byte) error
+	}{
+		{"json", func() ([]byte, error) {
+			s, err := src.ToJSON()
+			return []byte(s), err
+		}, (*SecureLRUCache).UnmarshalJSON},
+		{"binary", src.MarshalBinary, (*SecureLRUCache).UnmarshalBinary},
+		{"msgpack", src.MarshalMsgpack, (*SecureLRUCache).UnmarshalMsgpack},
+	} {
+		b.Run(format.name, func(b *testing.B) {
+			dst, err := NewSecureLRUCache(benchmarkSnapshots)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer dst.Close()
+			var size int
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := format.encode()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := format.decode(dst, data); err != nil {
+					b.Fatal(err)
+				}
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "bytes/snapshot")
+		})
+	}
+}
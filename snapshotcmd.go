@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+const snapshotUsage = `usage: snapshot <command> [flags] <file>
+
+commands:
+  inspect <file>                  print the version, capacity, size and expiry summary
+  keys [--limit n] <file>         list keys from most to least valuable
+  get <file> <key>                print one entry
+  convert --to json|binary|msgpack [--out path] <file>
+                                  re-encode the snapshot, to stdout by default
+`
+
+// runSnapshot runs the snapshot subcommand with args following "snapshot"
+// and returns the exit code: 1 for a bad or missing snapshot, 2 for bad
+// usage. Snapshots in any format the library writes are read through the
+// same decoding and validation as Restore.
+func runSnapshot(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, snapshotUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("snapshot "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, snapshotUsage) }
+	limit := fs.Int("limit", 0, "list at most this many keys (0 for all)")
+	to := fs.String("to", "", "format to convert to: json, binary or msgpack")
+	out := fs.String("out", "", "file to write the converted snapshot to")
+	operands, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return 2
+	}
+
+	wantOperands := map[string]int{"inspect": 1, "keys": 1, "get": 2, "convert": 1}[args[0]]
+	if wantOperands == 0 {
+		fmt.Fprintf(stderr, "unknown snapshot command %q\n", args[0])
+		fs.Usage()
+		return 2
+	}
+	if len(operands) != wantOperands {
+		fs.Usage()
+		return 2
+	}
+	d, err := loadSnapshotFile(operands[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", operands[0], err)
+		return 1
+	}
+
+	switch args[0] {
+	case "inspect":
+		inspectSnapshot(stdout, d, time.Now())
+	case "keys":
+		for i, key := range d.Order {
+			if *limit > 0 && i == *limit {
+				break
+			}
+			fmt.Fprintln(stdout, key)
+		}
+	case "get":
+		key, err := strconv.Atoi(operands[1])
+		if err != nil {
+			fmt.Fprintf(stderr, "key must be an integer: %q\n", operands[1])
+			return 2
+		}
+		return printSnapshotEntry(stdout, stderr, d, key)
+	case "convert":
+		data, err := encodeSnapshot(d, *to)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		if *out == "" {
+			_, err = stdout.Write(data)
+		} else {
+			err = os.WriteFile(*out, data, 0o644)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseInterspersed parses flags wherever they appear among args and returns
+// the remaining operands in order.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var operands []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return operands, nil
+		}
+		operands = append(operands, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// loadSnapshotFile reads a JSON, MessagePack or binary snapshot, telling them
+// apart by their first byte, and validates it.
+func loadSnapshotFile(path string) (CacheDump, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return CacheDump{}, err
+	}
+
+	var d CacheDump
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	switch {
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		err = json.Unmarshal(data, &d)
+	case len(data) > 0 && (data[0]&0xf0 == 0x80 || data[0] == 0xde || data[0] == 0xdf):
+		d, err = decodeMsgpackDump(data)
+	default:
+		d, err = readSnapshot(bytes.NewReader(data))
+	}
+	if err != nil {
+		return d, err
+	}
+	return d, d.validate()
+}
+
+func inspectSnapshot(w io.Writer, d CacheDump, now time.Time) {
+	version := max(d.Version, 1)
+	fmt.Fprintf(w, "version:   %d\n", version)
+	fmt.Fprintf(w, "capacity:  %d\n", d.Capacity)
+	fmt.Fprintf(w, "entries:   %d (%d tombstones)\n", d.Size, len(d.Tombstones))
+	if len(d.Expires) == 0 {
+		fmt.Fprintln(w, "expiring:  none")
+		return
+	}
+
+	var earliest, latest time.Time
+	expired := 0
+	for _, at := range d.Expires {
+		if earliest.IsZero() || at.Before(earliest) {
+			earliest = at
+		}
+		if at.After(latest) {
+			latest = at
+		}
+		if !now.Before(at) {
+			expired++
+		}
+	}
+	fmt.Fprintf(w, "expiring:  %d, earliest %s, latest %s, %d already expired\n",
+		len(d.Expires), relative(earliest, now), relative(latest, now), expired)
+}
+
+func relative(at, now time.Time) string {
+	d := at.Sub(now).Round(time.Second)
+	if d < 0 {
+		return (-d).String() + " ago"
+	}
+	return "in " + d.String()
+}
+
+func printSnapshotEntry(stdout, stderr io.Writer, d CacheDump, key int) int {
+	value, live := d.Items[key]
+	tombstone := false
+	for _, k := range d.Tombstones {
+		tombstone = tombstone || k == key
+	}
+	if !live && !tombstone {
+		fmt.Fprintf(stderr, "key %d is not in the snapshot\n", key)
+		return 1
+	}
+
+	line := fmt.Sprintf("%d\t%d", key, value)
+	if tombstone {
+		line = fmt.Sprintf("%d\ttombstone", key)
+	}
+	if at, ok := d.Expires[key]; ok {
+		line += "\texpires " + at.Format(time.RFC3339)
+	}
+	if freq, ok := d.Frequencies[key]; ok {
+		line += "\tfrequency " + strconv.Itoa(freq)
+	}
+	fmt.Fprintln(stdout, line)
+	return 0
+}
+
+// encodeSnapshot writes d in the current version of the named format.
+func encodeSnapshot(d CacheDump, format string) ([]byte, error) {
+	d.Version = dumpVersion
+	switch format {
+	case "json":
+		summed, err := d.withChecksum()
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(summed, "", "  ")
+		return append(data, '\n'), err
+	case "binary":
+		return d.appendBinary(nil), nil
+	case "msgpack":
+		return d.appendMsgpack(nil), nil
+	}
+	return nil, fmt.Errorf("--to must be json, binary or msgpack, got %q", format)
+}
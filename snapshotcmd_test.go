@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeSnapshot saves a cache holding keys 1 to 3, 3 the most recent, as a
+// binary snapshot and returns its path.
+func writeSnapshot(t *testing.T) string {
+	t.Helper()
+	c := newTestCache(t, 8)
+	for k := 1; k <= 3; k++ {
+		c.Put(k, k*10)
+	}
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cache.snap")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runSnapshotForTest(args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = runSnapshot(args, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestSnapshotCommandOutput(t *testing.T) {
+	path := writeSnapshot(t)
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"inspect", path}, "version:   4\ncapacity:  8\nentries:   3 (0 tombstones)\nexpiring:  none\n"},
+		{[]string{"keys", path}, "3\n2\n1\n"},
+		{[]string{"keys", "--limit", "2", path}, "3\n2\n"},
+		{[]string{"keys", path, "--limit", "1"}, "3\n"},
+		{[]string{"get", path, "2"}, "2\t20\n"},
+	}
+	for _, tc := range cases {
+		code, stdout, stderr := runSnapshotForTest(tc.args...)
+		if code != 0 || stdout != tc.want {
+			t.Errorf("snapshot %s = %d, %q (stderr %q), want 0, %q",
+				strings.Join(tc.args[:len(tc.args)-1], " "), code, stdout, stderr, tc.want)
+		}
+	}
+}
+
+func TestSnapshotCommandErrors(t *testing.T) {
+	path := writeSnapshot(t)
+	corrupt := filepath.Join(t.TempDir(), "corrupt.snap")
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(corrupt, data, 0o644)
+
+	cases := []struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		{[]string{"get", path, "9"}, 1, "key 9 is not in the snapshot\n"},
+		{[]string{"get", path, "x"}, 2, "key must be an integer"},
+		{[]string{"inspect", corrupt}, 1, corrupt + ": "},
+		{[]string{"inspect", filepath.Join(t.TempDir(), "missing")}, 1, "no such file"},
+		{[]string{"convert", "--to", "yaml", path}, 2, "--to must be json, binary or msgpack"},
+		{[]string{"frobnicate", path}, 2, `unknown snapshot command "frobnicate"`},
+		{[]string{"inspect"}, 2, "usage: snapshot"},
+	}
+	for _, tc := range cases {
+		code, stdout, stderr := runSnapshotForTest(tc.args...)
+		if code != tc.code || stdout != "" || !strings.Contains(stderr, tc.stderr) {
+			t.Errorf("snapshot %v = %d, %q, %q; want %d and stderr containing %q",
+				tc.args, code, stdout, stderr, tc.code, tc.stderr)
+		}
+	}
+}
+
+func TestSnapshotCommandConverts(t *testing.T) {
+	path := writeSnapshot(t)
+	for _, format := range []string{"json", "msgpack", "binary"} {
+		out := filepath.Join(t.TempDir(), "converted")
+		if code, _, stderr := runSnapshotForTest("convert", "--to", format, "--out", out, path); code != 0 {
+			t.Fatalf("convert to %s: %d, %s", format, code, stderr)
+		}
+		code, stdout, stderr := runSnapshotForTest("keys", out)
+		if code != 0 || stdout != "3\n2\n1\n" {
+			t.Errorf("keys of the %s conversion = %d, %q, %q", format, code, stdout, stderr)
+		}
+	}
+}
+
+func TestInspectSummarisesExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := CacheDump{
+		Version:  4,
+		Capacity: 4,
+		Size:     3,
+		Expires: map[int]time.Time{
+			1: now.Add(-time.Minute),
+			2: now.Add(time.Hour),
+		},
+	}
+	var buf bytes.Buffer
+	inspectSnapshot(&buf, d, now)
+	want := "version:   4\ncapacity:  4\nentries:   3 (0 tombstones)\n" +
+		"expiring:  2, earliest 1m0s ago, latest in 1h0m0s, 1 already expired\n"
+	if buf.String() != want {
+		t.Errorf("inspect printed\n%s\nwant\n%s", buf.String(), want)
+	}
+}
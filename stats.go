@@ -0,0 +1,66 @@
+package main
+
+import "sync/atomic"
+
+// cacheCounters back Stats. They are atomics so that paths holding only the
+// read lock, or no lock at all, can count.
+type cacheCounters struct {
+	hits                atomic.Int64
+	misses              atomic.Int64
+	peekHits            atomic.Int64
+	peekMisses          atomic.Int64
+	puts                atomic.Int64
+	updates             atomic.Int64
+	evictions           atomic.Int64
+	removals            atomic.Int64
+	expirations         atomic.Int64
+	errorHits           atomic.Int64
+	staleHits           atomic.Int64
+	droppedEvents       atomic.Int64
+	admissionRejections atomic.Int64
+	oversizeRejections  atomic.Int64
+	forcedEvictions     atomic.Int64
+	preloadSkipped      atomic.Int64
+	droppedPromotions   atomic.Int64
+	droppedTraceRecords atomic.Int64
+	refreshes           atomic.Int64
+	refreshFailures     atomic.Int64
+	droppedAuditRecords atomic.Int64
+
+	// Residency times of entries leaving the cache, split so that a cache
+	// that is too small can be told apart from one dominated by its TTLs.
+	evictionAges ageTracker
+	removalAges  ageTracker
+	expiryAges   ageTracker
+}
+
+func (s *cacheCounters) reset() {
+	for _, n := range []*atomic.Int64{
+		&s.hits, &s.misses, &s.peekHits, &s.peekMisses, &s.puts, &s.updates,
+		&s.evictions, &s.removals, &s.expirations, &s.errorHits, &s.staleHits,
+		&s.droppedEvents, &s.admissionRejections, &s.oversizeRejections,
+		&s.forcedEvictions, &s.preloadSkipped, &s.droppedPromotions,
+		&s.droppedTraceRecords, &s.refreshes, &s.refreshFailures,
+		&s.droppedAuditRecords,
+	} {
+		n.Store(0)
+	}
+	s.evictionAges.reset()
+	s.removalAges.reset()
+	s.expiryAges.reset()
+}
+
+// HitRatio is the share of Get lookups that hit, or zero before any lookup.
+// Peek and Contains are not included.
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// ResetStats zeroes every counter reported by Stats.
+func (c *SecureLRUCache) ResetStats() {
+	c.stats.reset()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// syncMapLike is the part of sync.Map's method set that SyncMap reproduces.
+type syncMapLike interface {
+	Load(key any) (value any, ok bool)
+	Store(key, value any)
+	Delete(key any)
+	Range(f func(key, value any) bool)
+	LoadOrStore(key, value any) (actual any, loaded bool)
+}
+
+var (
+	_ syncMapLike = (*sync.Map)(nil)
+	_ syncMapLike = (*SyncMap)(nil)
+)
+
+// SyncMap is a SecureLRUCache behind sync.Map's Load, Store, Delete, Range
+// and LoadOrStore, for code that takes a map of that shape. Keys and values
+// must be ints: Load and Delete treat any other key as absent, and Store and
+// LoadOrStore panic on one. Unlike a sync.Map, it is bounded, so an entry
+// can disappear without a Delete when the cache evicts or expires it.
+// Errors from the cache, such as a failed write-through, are dropped; use
+// Cache for calls that report them.
+type SyncMap struct {
+	cache *SecureLRUCache
+}
+
+// NewSyncMap returns a SyncMap of capacity entries built with opts.
+func NewSyncMap(capacity int, opts ...Option) (*SyncMap, error) {
+	c, err := NewSecureLRUCache(capacity, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncMap{cache: c}, nil
+}
+
+// Cache returns the underlying cache.
+func (m *SyncMap) Cache() *SecureLRUCache {
+	return m.cache
+}
+
+func syncMapInt(what string, v any) int {
+	n, ok := v.(int)
+	if !ok {
+		panic(fmt.Sprintf("SyncMap %s must be an int, got %T", what, v))
+	}
+	return n
+}
+
+func (m *SyncMap) Load(key any) (value any, ok bool) {
+	k, isInt := key.(int)
+	if !isInt {
+		return nil, false
+	}
+	if v, ok := m.cache.Get(k); ok {
+		return v, true
+	}
+	return nil, false
+}
+
+func (m *SyncMap) Store(key, value any) {
+	m.cache.Put(syncMapInt("key", key), syncMapInt("value", value))
+}
+
+func (m *SyncMap) Delete(key any) {
+	if k, ok := key.(int); ok {
+		m.cache.Remove(k)
+	}
+}
+
+// Range calls f for each entry, most recent first, until f returns false.
+// As with sync.Map, entries stored or removed while Range runs may or may
+// not be seen.
+func (m *SyncMap) Range(f func(key, value any) bool) {
+	m.cache.Range(func(key, value int) bool {
+		return f(key, value)
+	})
+}
+
+func (m *SyncMap) LoadOrStore(key, value any) (actual any, loaded bool) {
+	v, loaded, _ := m.cache.GetOrPut(syncMapInt("key", key), syncMapInt("value", value))
+	return v, loaded
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// The tests below follow common sync.Map usage: a concurrent LoadOrStore
+// registry, Range with an early stop, and Delete.
+
+func newTestSyncMap(t *testing.T, capacity int) *SyncMap {
+	t.Helper()
+	m, err := NewSyncMap(capacity, WithDebugChecks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Cache().Close() })
+	return m
+}
+
+func TestSyncMapLoadStoreDelete(t *testing.T) {
+	m := newTestSyncMap(t, 8)
+	if v, ok := m.Load(1); ok || v != nil {
+		t.Errorf("Load on an empty map = %v, %v", v, ok)
+	}
+	m.Store(1, 10)
+	m.Store(1, 11)
+	if v, ok := m.Load(1); !ok || v != 11 {
+		t.Errorf("Load(1) = %v, %v, want 11", v, ok)
+	}
+	m.Delete(1)
+	m.Delete(2)
+	if _, ok := m.Load(1); ok {
+		t.Error("Load found a deleted key")
+	}
+	if _, ok := m.Load("1"); ok {
+		t.Error("Load found a string key")
+	}
+	m.Delete("1")
+
+	for _, bad := range []func(){
+		func() { m.Store("k", 1) },
+		func() { m.Store(1, 1.5) },
+		func() { m.LoadOrStore(nil, 1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("a non-int key or value did not panic")
+				}
+			}()
+			bad()
+		}()
+	}
+}
+
+func TestSyncMapLoadOrStore(t *testing.T) {
+	m := newTestSyncMap(t, 8)
+	if v, loaded := m.LoadOrStore(1, 10); loaded || v != 10 {
+		t.Errorf("first LoadOrStore = %v, %v, want 10, false", v, loaded)
+	}
+	if v, loaded := m.LoadOrStore(1, 20); !loaded || v != 10 {
+		t.Errorf("second LoadOrStore = %v, %v, want 10, true", v, loaded)
+	}
+
+	// Concurrent callers agree on the one value stored.
+	const callers = 16
+	var wg sync.WaitGroup
+	got := make([]any, callers)
+	stored := make([]bool, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, loaded := m.LoadOrStore(2, 100+i)
+			got[i], stored[i] = v, !loaded
+		}()
+	}
+	wg.Wait()
+	winners := 0
+	for i := range callers {
+		if got[i] != got[0] {
+			t.Errorf("caller %d got %v, caller 0 got %v", i, got[i], got[0])
+		}
+		if stored[i] {
+			winners++
+		}
+	}
+	if winners != 1 {
+		t.Errorf("%d callers stored a value, want 1", winners)
+	}
+}
+
+func TestSyncMapRange(t *testing.T) {
+	m := newTestSyncMap(t, 8)
+	for k := range 5 {
+		m.Store(k, k*10)
+	}
+	seen := make(map[any]any)
+	m.Range(func(key, value any) bool {
+		seen[key] = value
+		return true
+	})
+	if len(seen) != 5 || seen[3] != 30 {
+		t.Errorf("Range saw %v", seen)
+	}
+	calls := 0
+	m.Range(func(key, value any) bool {
+		calls++
+		return calls < 2
+	})
+	if calls != 2 {
+		t.Errorf("Range made %d calls after f returned false, want 2", calls)
+	}
+}
+
+// The one difference from sync.Map: a full map evicts.
+func TestSyncMapEvicts(t *testing.T) {
+	m := newTestSyncMap(t, 2)
+	m.Store(1, 1)
+	m.Store(2, 2)
+	m.Load(1)
+	m.Store(3, 3)
+	if _, ok := m.Load(2); ok {
+		t.Error("the least recently used key survived a store into a full map")
+	}
+	if v, loaded := m.LoadOrStore(2, 20); loaded || v != 20 {
+		t.Errorf("LoadOrStore of an evicted key = %v, %v, want 20, false", v, loaded)
+	}
+}
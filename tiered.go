@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+type Cache interface {
+	Get(key int) (int, bool)
+	Put(key, value int) error
+	PutEvicted(key, value int) (Entry, bool, error)
+	Remove(key int) bool
+	Contains(key int) bool
+	Size() int
+	Capacity() int
+}
+
+var (
+	_ Cache = (*SecureLRUCache)(nil)
+	_ Cache = (*TieredCache)(nil)
+)
+
+// TieredCache puts a small, hot L1 in front of a larger L2. A miss in L1 that
+// hits L2 moves the entry up into L1, and whatever L1 evicts to make room is
+// demoted into L2 rather than dropped. Operations are serialized by a single
+// lock so an entry is never lost or duplicated in transit between levels.
+type TieredCache struct {
+	mu        sync.Mutex
+	l1        Cache
+	l2        Cache
+	writeBoth bool
+
+	l1Hits     int64
+	l2Hits     int64
+	misses     int64
+	promotions int64
+	demotions  int64
+}
+
+type TieredOption func(*TieredCache)
+
+// WithTieredWriteBoth makes Put write to both levels instead of only L1, and
+// keeps entries in L2 when they are promoted.
+func WithTieredWriteBoth() TieredOption {
+	return func(t *TieredCache) {
+		t.writeBoth = true
+	}
+}
+
+func NewTieredCache(l1, l2 Cache, opts ...TieredOption) (*TieredCache, error) {
+	if l1 == nil || l2 == nil {
+		return nil, fmt.Errorf("both cache levels are required")
+	}
+	if l1 == l2 {
+		return nil, fmt.Errorf("cache levels must be distinct")
+	}
+
+	t := &TieredCache{l1: l1, l2: l2}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t, nil
+}
+
+func (t *TieredCache) Get(key int) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if value, found := t.l1.Get(key); found {
+		atomic.AddInt64(&t.l1Hits, 1)
+		return value, true
+	}
+
+	value, found := t.l2.Get(key)
+	if !found {
+		atomic.AddInt64(&t.misses, 1)
+		return 0, false
+	}
+	atomic.AddInt64(&t.l2Hits, 1)
+
+	if !t.writeBoth {
+		t.l2.Remove(key)
+	}
+	if _, _, err := t.putL1(key, value); err != nil {
+		if !t.writeBoth {
+			t.l2.Put(key, value)
+		}
+	} else {
+		atomic.AddInt64(&t.promotions, 1)
+	}
+	return value, true
+}
+
+func (t *TieredCache) Put(key, value int) error {
+	_, _, err := t.PutEvicted(key, value)
+	return err
+}
+
+// PutEvicted reports the entry, if any, that fell out of the bottom of the
+// hierarchy as a result of the write.
+func (t *TieredCache) PutEvicted(key, value int) (Entry, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.writeBoth {
+		if _, _, err := t.l2.PutEvicted(key, value); err != nil {
+			return Entry{}, false, err
+		}
+	} else {
+		t.l2.Remove(key)
+	}
+	return t.putL1(key, value)
+}
+
+// putL1 writes to L1 and demotes the L1 victim into L2, returning whatever L2
+// had to evict in turn.
+func (t *TieredCache) putL1(key, value int) (Entry, bool, error) {
+	demoted, wasEvicted, err := t.l1.PutEvicted(key, value)
+	if err != nil || !wasEvicted {
+		return Entry{}, false, err
+	}
+
+	atomic.AddInt64(&t.demotions, 1)
+	return t.l2.PutEvicted(demoted.Key, demoted.Value)
+}
+
+func (t *TieredCache) Remove(key int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	removedL1 := t.l1.Remove(key)
+	removedL2 := t.l2.Remove(key)
+	return removedL1 || removedL2
+}
+
+func (t *TieredCache) Contains(key int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.l1.Contains(key) || t.l2.Contains(key)
+}
+
+// Size is the number of entries held across both levels. With write-both
+// enabled an entry present in both levels is counted twice.
+func (t *TieredCache) Size() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.l1.Size() + t.l2.Size()
+}
+
+func (t *TieredCache) Capacity() int {
+	return t.l1.Capacity() + t.l2.Capacity()
+}
+
+type TieredStats struct {
+	L1Hits     int64 `json:"l1_hits"`
+	L2Hits     int64 `json:"l2_hits"`
+	Misses     int64 `json:"misses"`
+	Promotions int64 `json:"promotions"`
+	Demotions  int64 `json:"demotions"`
+	L1Size     int   `json:"l1_size"`
+	L2Size     int   `json:"l2_size"`
+}
+
+func (t *TieredCache) Stats() TieredStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return TieredStats{
+		L1Hits:     atomic.LoadInt64(&t.l1Hits),
+		L2Hits:     atomic.LoadInt64(&t.l2Hits),
+		Misses:     atomic.LoadInt64(&t.misses),
+		Promotions: atomic.LoadInt64(&t.promotions),
+		Demotions:  atomic.LoadInt64(&t.demotions),
+		L1Size:     t.l1.Size(),
+		L2Size:     t.l2.Size(),
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func newTestTiered(t *testing.T, l1Cap, l2Cap int, opts ...TieredOption) (*TieredCache, *SecureLRUCache, *SecureLRUCache) {
+	t.Helper()
+	l1, l2 := newTestCache(t, l1Cap), newTestCache(t, l2Cap)
+	tc, err := NewTieredCache(l1, l2, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tc, l1, l2
+}
+
+func TestTieredPromotesFromL2(t *testing.T) {
+	tc, l1, l2 := newTestTiered(t, 2, 4)
+	for k := 1; k <= 3; k++ {
+		tc.Put(k, k*10)
+	}
+	// Key 1 was demoted to make room for 3.
+	if l1.Contains(1) || !l2.Contains(1) {
+		t.Fatalf("key 1 in L1: %v, in L2: %v; want demoted", l1.Contains(1), l2.Contains(1))
+	}
+	if v, ok := tc.Get(1); !ok || v != 10 {
+		t.Fatalf("Get(1) = %d, %v", v, ok)
+	}
+	if !l1.Contains(1) || l2.Contains(1) || !l2.Contains(2) {
+		t.Errorf("after the L2 hit, L1 holds %v and L2 %v", l1.Keys(), l2.Keys())
+	}
+	s := tc.Stats()
+	if s.L2Hits != 1 || s.Promotions != 1 || s.Demotions != 2 {
+		t.Errorf("stats %+v, want one L2 hit and promotion, two demotions", s)
+	}
+	if _, ok := tc.Get(9); ok || tc.Stats().Misses != 1 {
+		t.Error("a key in neither level was found")
+	}
+}
+
+func TestTieredWriteBoth(t *testing.T) {
+	tc, l1, l2 := newTestTiered(t, 2, 4, WithTieredWriteBoth())
+	tc.Put(1, 10)
+	if v, ok := l2.Peek(1); !ok || v != 10 || !l1.Contains(1) {
+		t.Fatalf("write-through left L1 with %v and L2 with %v", l1.Keys(), l2.Keys())
+	}
+	tc.Put(2, 20)
+	tc.Put(3, 30)
+	if v, ok := tc.Get(1); !ok || v != 10 || !l2.Contains(1) {
+		t.Errorf("Get(1) = %d, %v; a promotion must keep the L2 copy", v, ok)
+	}
+}
+
+func TestTieredRemoveDropsBothLevels(t *testing.T) {
+	tc, l1, l2 := newTestTiered(t, 2, 4, WithTieredWriteBoth())
+	tc.Put(1, 10)
+	if !tc.Remove(1) || l1.Contains(1) || l2.Contains(1) || tc.Contains(1) {
+		t.Error("Remove left a copy behind")
+	}
+	if tc.Remove(1) {
+		t.Error("second Remove reported a removal")
+	}
+}
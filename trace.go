@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// traceQueue is how many trace records can wait for the writer before new
+// ones are dropped.
+const traceQueue = 4096
+
+// TraceOp is the operation a TraceRecord describes.
+type TraceOp int
+
+const (
+	// TraceGet is a lookup by Get or GetOrLoad; Hit reports whether it
+	// found the key.
+	TraceGet TraceOp = iota + 1
+	// TracePut is a write by Put or one of its variants, or a GetOrLoad
+	// installing what it loaded; Hit reports whether it overwrote a live
+	// entry.
+	TracePut
+	// TraceRemove is a Remove; Hit reports whether the key was cached.
+	TraceRemove
+)
+
+func (op TraceOp) String() string {
+	switch op {
+	case TraceGet:
+		return "get"
+	case TracePut:
+		return "put"
+	case TraceRemove:
+		return "remove"
+	default:
+		return "unknown"
+	}
+}
+
+func parseTraceOp(s string) (TraceOp, bool) {
+	for op := TraceGet; op <= TraceRemove; op++ {
+		if op.String() == s {
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+// TraceRecord is one operation captured by WithTraceRecorder.
+type TraceRecord struct {
+	Op   TraceOp
+	Key  int
+	Time time.Time
+	Hit  bool
+}
+
+// traceHeader opens every trace. A trace is CSV, one record per line after
+// the header: the op name (get, put or remove), the key in decimal, the time
+// by the cache's clock in nanoseconds since the Unix epoch, and 1 for a hit
+// or 0 otherwise, as in
+//
+//	get,42,1704067200000000000,1
+//
+// Readers should ignore columns after the fourth, which later versions may
+// add.
+const traceHeader = "op,key,unix_nano,hit"
+
+type traceRecorder struct {
+	w         *bufio.Writer
+	threshold uint64
+	all       bool
+	queue     chan TraceRecord
+	// err is the first write error, after which records are dropped. It is
+	// only touched by the writer goroutine until Close has waited for it.
+	err error
+}
+
+// WithTraceRecorder writes a trace of the cache's Gets, Puts and Removes to
+// w, for replaying with Simulate or an external tool; see traceHeader for the
+// format. sampleRate, above 0 and at most 1, is the share of keys traced:
+// sampling picks keys by hash rather than operations at random, so a sampled
+// trace keeps every operation on the keys it keeps and their reuse is not
+// distorted.
+//
+// Records are queued and written by a background goroutine, so the
+// operations never wait on w; when the queue is full records are dropped and
+// counted in Stats().DroppedTraceRecords. The trace is flushed whenever the
+// queue runs empty and by Close, which also returns the first error writing
+// it.
+func WithTraceRecorder(w io.Writer, sampleRate float64) Option {
+	return func(c *SecureLRUCache) error {
+		if w == nil {
+			return fmt.Errorf("trace writer must not be nil")
+		}
+		if !(sampleRate > 0 && sampleRate <= 1) {
+			return fmt.Errorf("trace sample rate must be above 0 and at most 1, got %v", sampleRate)
+		}
+		c.trace = &traceRecorder{
+			w:         bufio.NewWriter(w),
+			threshold: uint64(sampleRate * math.MaxUint64),
+			all:       sampleRate == 1,
+			queue:     make(chan TraceRecord, traceQueue),
+		}
+		return nil
+	}
+}
+
+// traceOp queues a record of op on key if the key is sampled.
+func (c *SecureLRUCache) traceOp(op TraceOp, key int, hit bool) {
+	t := c.trace
+	if t == nil || !t.all && spread(key) >= t.threshold {
+		return
+	}
+	select {
+	case t.queue <- TraceRecord{Op: op, Key: key, Time: c.clock.Now(), Hit: hit}:
+	default:
+		c.stats.droppedTraceRecords.Add(1)
+	}
+}
+
+func (c *SecureLRUCache) startTrace() {
+	t := c.trace
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		t.write(traceHeader + "\n")
+		for {
+			select {
+			case rec := <-t.queue:
+				t.writeRecord(rec)
+				if len(t.queue) == 0 {
+					t.flush()
+				}
+			case <-c.done:
+				for len(t.queue) > 0 {
+					t.writeRecord(<-t.queue)
+				}
+				t.flush()
+				return
+			}
+		}
+	}()
+}
+
+func (t *traceRecorder) writeRecord(rec TraceRecord) {
+	hit := "0"
+	if rec.Hit {
+		hit = "1"
+	}
+	t.write(rec.Op.String() + "," + strconv.Itoa(rec.Key) + "," + strconv.FormatInt(rec.Time.UnixNano(), 10) + "," + hit + "\n")
+}
+
+func (t *traceRecorder) write(s string) {
+	if t.err == nil {
+		_, t.err = t.w.WriteString(s)
+	}
+}
+
+func (t *traceRecorder) flush() {
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+}
+
+// ReadTrace parses a trace written by WithTraceRecorder.
+func ReadTrace(r io.Reader) ([]TraceRecord, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("trace has no header")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading trace: %w", err)
+	}
+	if len(header) < 4 || header[0] != "op" || header[1] != "key" || header[2] != "unix_nano" || header[3] != "hit" {
+		return nil, fmt.Errorf("trace header %q is not %q", header, traceHeader)
+	}
+
+	var records []TraceRecord
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading trace: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("trace line %d: %d fields, want 4", line, len(fields))
+		}
+		op, ok := parseTraceOp(fields[0])
+		if !ok {
+			return nil, fmt.Errorf("trace line %d: unknown op %q", line, fields[0])
+		}
+		key, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("trace line %d: bad key: %w", line, err)
+		}
+		nanos, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("trace line %d: bad time: %w", line, err)
+		}
+		if fields[3] != "0" && fields[3] != "1" {
+			return nil, fmt.Errorf("trace line %d: hit must be 0 or 1, got %q", line, fields[3])
+		}
+		records = append(records, TraceRecord{Op: op, Key: key, Time: time.Unix(0, nanos), Hit: fields[3] == "1"})
+	}
+}
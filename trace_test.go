@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTraceRecordsScriptedWorkload(t *testing.T) {
+	var buf bytes.Buffer
+	clock := newFakeClock()
+	start := clock.Now()
+	c, err := NewSecureLRUCache(2, WithClock(clock), WithTraceRecorder(&buf, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(1, 1)
+	clock.Advance(time.Second)
+	c.Get(1)
+	c.Get(2)
+	c.Put(1, 10)
+	c.Peek(1) // not traced
+	c.Remove(1)
+	c.Remove(1)
+	c.GetOrLoad(3, func(key int) (int, error) { return key, nil })
+	clock.Advance(time.Second)
+	c.GetOrLoad(3, func(key int) (int, error) { return key, nil })
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadTrace(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	want := []TraceRecord{
+		{TracePut, 1, at(0), false},
+		{TraceGet, 1, at(1), true},
+		{TraceGet, 2, at(1), false},
+		{TracePut, 1, at(1), true},
+		{TraceRemove, 1, at(1), true},
+		{TraceRemove, 1, at(1), false},
+		{TraceGet, 3, at(1), false},
+		{TracePut, 3, at(1), false},
+		{TraceGet, 3, at(2), true},
+	}
+	if !slices.EqualFunc(records, want, func(a, b TraceRecord) bool {
+		return a.Op == b.Op && a.Key == b.Key && a.Hit == b.Hit && a.Time.Equal(b.Time)
+	}) {
+		t.Errorf("trace =\n%v\nwant\n%v", records, want)
+	}
+}
+
+func TestTraceFormat(t *testing.T) {
+	var buf bytes.Buffer
+	clock := newFakeClock()
+	c, err := NewSecureLRUCache(2, WithClock(clock), WithTraceRecorder(&buf, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(-5, 1)
+	c.Get(-5)
+	c.Close()
+	want := "op,key,unix_nano,hit\n" +
+		"put,-5,1704067200000000000,0\n" +
+		"get,-5,1704067200000000000,1\n"
+	if buf.String() != want {
+		t.Errorf("trace =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestTraceSamplesByKey(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := NewSecureLRUCache(1000, WithTraceRecorder(&buf, 0.25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range 1000 {
+		c.Put(k, k)
+		c.Get(k)
+	}
+	c.Close()
+	records, err := ReadTrace(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := make(map[int]int)
+	for _, rec := range records {
+		ops[rec.Key]++
+	}
+	if n := len(ops); n < 150 || n > 350 {
+		t.Errorf("%d of 1000 keys traced at rate 0.25", n)
+	}
+	for key, n := range ops {
+		if n != 2 {
+			t.Errorf("key %d has %d of its 2 operations traced", key, n)
+		}
+	}
+}
+
+// blockingWriter holds every Write until released.
+type blockingWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	n       int
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	w.n += len(p)
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+func TestTraceDropsWhenQueueIsFull(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	c, err := NewSecureLRUCache(8, WithTraceRecorder(w, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for k := range 3 * traceQueue {
+			c.Get(k)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Get blocked on a stalled trace writer")
+	}
+	if c.Stats().DroppedTraceRecords == 0 {
+		t.Error("no records dropped with the writer stalled")
+	}
+	close(w.release)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestTraceWriteErrorReturnedByClose(t *testing.T) {
+	c, err := NewSecureLRUCache(8, WithTraceRecorder(failingWriter{}, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(1, 1)
+	if err := c.Close(); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("Close = %v", err)
+	}
+}
+
+func TestTraceOptionAndReaderErrors(t *testing.T) {
+	for _, rate := range []float64{0, -1, 1.5} {
+		if _, err := NewSecureLRUCache(8, WithTraceRecorder(&bytes.Buffer{}, rate)); err == nil {
+			t.Errorf("sample rate %v accepted", rate)
+		}
+	}
+	if _, err := NewSecureLRUCache(8, WithTraceRecorder(nil, 1)); err == nil {
+		t.Error("nil writer accepted")
+	}
+	for _, trace := range []string{
+		"",
+		"key,op\n",
+		"op,key,unix_nano,hit\nscan,1,0,0\n",
+		"op,key,unix_nano,hit\nget,x,0,0\n",
+		"op,key,unix_nano,hit\nget,1,0\n",
+		"op,key,unix_nano,hit\nget,1,0,yes\n",
+	} {
+		if _, err := ReadTrace(strings.NewReader(trace)); err == nil {
+			t.Errorf("ReadTrace(%q) accepted", trace)
+		}
+	}
+	records, err := ReadTrace(strings.NewReader("op,key,unix_nano,hit,extra\nget,1,5,1,x\n"))
+	if err != nil || len(records) != 1 || records[0].Time.UnixNano() != 5 {
+		t.Errorf("extra columns: %v, %v", records, err)
+	}
+}
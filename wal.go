@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	walMagic = "LRUW"
+
+	// DefaultWALFlushInterval and DefaultWALCompactBytes are the limits
+	// WithWAL uses unless WithWALLimits changes them.
+	DefaultWALFlushInterval       = time.Second
+	DefaultWALCompactBytes  int64 = 64 << 20
+)
+
+// WAL record operations.
+const (
+	walPut byte = iota + 1
+	walRemove
+	walClear
+	walResize
+)
+
+// writeAheadLog appends the cache's writes to a log file. Records are buffered
+// in memory under the cache's lock and written out by the flusher, so file
+// I/O never happens under the cache's lock except during compaction's brief
+// log rotation.
+//
+// A log starts with its magic and a uvarint generation. Snapshot generation
+// g holds the state the log of generation g-1 ended with, so on startup a log
+// is only replayed when its generation is at least the snapshot's. Each
+// record is a uvarint payload length, the payload, and the payload's
+// CRC-32C; replay stops at the first record that is cut short or fails its
+// checksum, and the log is truncated there.
+type writeAheadLog struct {
+	path      string
+	interval  time.Duration
+	compactAt int64
+
+	mu         sync.Mutex
+	buf        []byte
+	file       *os.File
+	size       int64
+	generation uint64
+	closed     bool
+
+	// compacting keeps the flusher and Sync from compacting at once. pending
+	// is a snapshot still to be written after the log was rotated.
+	compacting sync.Mutex
+	pending    *CacheDump
+}
+
+// WithWAL keeps the cache durable through a write-ahead log at path, with a
+// snapshot beside it at path+".snap". Every Put, Remove, Clear and Resize,
+// every entry a loader stores and every eviction and expiry is appended to
+// the log; records are
+// flushed every DefaultWALFlushInterval and by Sync and Close. When the cache
+// is built the snapshot and log are replayed, in place of any initial data,
+// so only writes made since the last flush can be lost in a crash. Once the
+// log outgrows DefaultWALCompactBytes it is folded into a fresh snapshot.
+//
+// Replay re-applies the records in order, so it restores the same entries,
+// but the recency order it rebuilds is that of the writes alone: reads since
+// the last snapshot are not recorded. Evictions are logged as removals,
+// which matters because the entry a replayed Put would evict is picked from
+// that order, not the live one. Tombstones from negative caching are not
+// persisted.
+func WithWAL(path string) Option {
+	return func(c *SecureLRUCache) error {
+		if path == "" {
+			return fmt.Errorf("wal path must not be empty")
+		}
+		c.wal = &writeAheadLog{path: path, interval: DefaultWALFlushInterval, compactAt: DefaultWALCompactBytes}
+		return nil
+	}
+}
+
+// WithWALLimits changes how often WithWAL flushes its log and how large the
+// log may grow before it is compacted into a snapshot. It must follow WithWAL.
+func WithWALLimits(flushInterval time.Duration, compactAt int64) Option {
+	return func(c *SecureLRUCache) error {
+		if c.wal == nil {
+			return fmt.Errorf("WithWALLimits requires WithWAL")
+		}
+		if flushInterval <= 0 {
+			return fmt.Errorf("wal flush interval must be positive")
+		}
+		if compactAt < 1 {
+			return fmt.Errorf("wal compaction size must be positive")
+		}
+		c.wal.interval = flushInterval
+		c.wal.compactAt = compactAt
+		return nil
+	}
+}
+
+// Sync writes every buffered log record to the log and syncs it to stable
+// storage. A Put that returned before Sync was called survives a crash once
+// Sync returns nil. It is a no-op without WithWAL.
+func (c *SecureLRUCache) Sync() error {
+	if c.wal == nil {
+		return nil
+	}
+	if err := c.wal.flush(true); err != nil {
+		return err
+	}
+	return c.compactIfNeeded()
+}
+
+// logWrite appends the record for ev, if it changes the cache's contents. The
+// caller holds the write lock.
+func (c *SecureLRUCache) logWrite(ev Event) {
+	var payload []byte
+	switch ev.Op {
+	case EventPut, EventUpdate:
+		node := c.cache[ev.Key]
+		if node == nil || node.tombstone {
+			return
+		}
+		var expires int64
+		if !node.expiresAt.IsZero() {
+			expires = node.expiresAt.UnixNano()
+		}
+		payload = append(payload, walPut)
+		payload = binary.AppendVarint(payload, int64(ev.Key))
+		payload = binary.AppendVarint(payload, int64(ev.Value))
+		payload = binary.AppendVarint(payload, node.cost)
+		payload = binary.AppendVarint(payload, expires)
+	case EventRemove, EventEvicted, EventExpired:
+		payload = append(payload, walRemove)
+		payload = binary.AppendVarint(payload, int64(ev.Key))
+	case EventClear:
+		payload = append(payload, walClear)
+	case EventResize:
+		payload = append(payload, walResize)
+		payload = binary.AppendUvarint(payload, uint64(ev.Value))
+	default:
+		return
+	}
+	c.wal.append(payload)
+}
+
+func (w *writeAheadLog) append(payload []byte) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(payload)))
+	w.buf = append(w.buf, payload...)
+	w.buf = binary.BigEndian.AppendUint32(w.buf, crc32.Checksum(payload, crcTable))
+	w.mu.Unlock()
+}
+
+// flush writes the buffered records to the log, syncing it if sync is set.
+func (w *writeAheadLog) flush(sync bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return fmt.Errorf("wal is closed")
+	}
+	if len(w.buf) > 0 {
+		n, err := w.file.Write(w.buf)
+		w.size += int64(n)
+		w.buf = w.buf[n:]
+		if err != nil {
+			return err
+		}
+		w.buf = w.buf[:0]
+	}
+	if sync {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+func (w *writeAheadLog) snapshotPath() string { return w.path + ".snap" }
+func (w *writeAheadLog) oldPath() string      { return w.path + ".old" }
+
+// compactIfNeeded folds the log into a fresh snapshot once it has outgrown
+// its limit. The log is rotated under the write lock, together with a dump of
+// the state it ends with; the snapshot is then written without the lock, and
+// the old log is only removed once the snapshot is safely in place. If that
+// fails, the same snapshot is retried before the log is rotated again.
+func (c *SecureLRUCache) compactIfNeeded() error {
+	w := c.wal
+	w.compacting.Lock()
+	defer w.compacting.Unlock()
+
+	if w.pending == nil {
+		w.mu.Lock()
+		size := w.size + int64(len(w.buf))
+		w.mu.Unlock()
+		if size < w.compactAt {
+			return nil
+		}
+
+		c.mu.Lock()
+		d := c.dump()
+		err := w.rotate()
+		c.unlock()
+		if err != nil {
+			return err
+		}
+		w.pending = &d
+	}
+
+	w.mu.Lock()
+	generation := w.generation
+	w.mu.Unlock()
+	if err := writeWALSnapshot(w.snapshotPath(), generation, *w.pending); err != nil {
+		return err
+	}
+	w.pending = nil
+	return os.Remove(w.oldPath())
+}
+
+// rotate moves the current log aside and starts the next generation. The
+// caller holds the cache's write lock, so no records arrive meanwhile.
+func (w *writeAheadLog) rotate() error {
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(w.path, w.oldPath()); err != nil {
+		return err
+	}
+	return w.create(w.generation + 1)
+}
+
+// create starts an empty log of the given generation. The caller holds w.mu
+// or has not yet shared w.
+func (w *writeAheadLog) create(generation uint64) error {
+	f, err := os.OpenFile(w.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	header := binary.AppendUvarint([]byte(walMagic), generation)
+	if _, err := f.Write(header); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size, w.generation = f, int64(len(header)), generation
+	return nil
+}
+
+// writeWALSnapshot atomically writes d as the snapshot of the given generation:
+// the generation in eight big-endian bytes, then the binary snapshot.
+func writeWALSnapshot(path string, generation uint64, d CacheDump) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	data := binary.BigEndian.AppendUint64(nil, generation)
+	data = d.appendBinary(data)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// openWAL restores the snapshot and replays the logs, then opens the log for
+// appending. It runs from the constructor, before anything else can use the
+// cache.
+func (c *SecureLRUCache) openWAL() error {
+	w := c.wal
+	// Nothing replayed may be logged again.
+	c.wal = nil
+	defer func() { c.wal = w }()
+
+	var snapshotGen uint64
+	if data, err := os.ReadFile(w.snapshotPath()); err == nil {
+		if len(data) < 8 {
+			return fmt.Errorf("wal snapshot %s: %w", w.snapshotPath(), ErrCorruptSnapshot)
+		}
+		snapshotGen = binary.BigEndian.Uint64(data)
+		if err := c.UnmarshalBinary(data[8:]); err != nil {
+			return fmt.Errorf("wal snapshot %s: %w", w.snapshotPath(), err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// A log left over from a compaction that never finished holds writes
+	// the snapshot lacks.
+	oldGen, _, err := c.replayWAL(w.oldPath(), snapshotGen)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	unfinished := err == nil && oldGen >= snapshotGen
+
+	gen, valid, err := c.replayWAL(w.path, snapshotGen)
+	if errors.Is(err, fs.ErrNotExist) {
+		gen, valid, err = snapshotGen, -1, nil
+	}
+	if err != nil {
+		return err
+	}
+	if unfinished || valid < 0 {
+		// Start over from a snapshot of everything replayed so the old
+		// log is no longer needed.
+		next := max(gen, snapshotGen) + 1
+		if unfinished {
+			if err := writeWALSnapshot(w.snapshotPath(), next, c.Dump()); err != nil {
+				return err
+			}
+		}
+		if err := w.create(next); err != nil {
+			return err
+		}
+		os.Remove(w.oldPath())
+		return nil
+	}
+	if oldGen < snapshotGen {
+		os.Remove(w.oldPath())
+	}
+
+	f, err := os.OpenFile(w.path, os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	// Drop a torn final record so new records follow the last good one.
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size, w.generation = f, valid, max(gen, snapshotGen)
+	return nil
+}
+
+// replayWAL applies the log at path if its generation is at least minGen, and
+// returns the generation and the length of its valid prefix.
+func (c *SecureLRUCache) replayWAL(path string, minGen uint64) (uint64, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	magic := make([]byte, len(walMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != walMagic {
+		return 0, 0, fmt.Errorf("%s is not a cache write-ahead log", path)
+	}
+	gen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s is not a cache write-ahead log", path)
+	}
+	valid := int64(len(walMagic) + len(binary.AppendUvarint(nil, gen)))
+	if gen < minGen {
+		return gen, valid, nil
+	}
+
+	for {
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > 64 {
+			return gen, valid, nil
+		}
+		record := make([]byte, n+4)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return gen, valid, nil
+		}
+		payload := record[:n]
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(record[n:]) {
+			return gen, valid, nil
+		}
+		if err := c.applyWALRecord(payload); err != nil {
+			return gen, valid, fmt.Errorf("replay %s: %w", path, err)
+		}
+		valid += int64(len(binary.AppendUvarint(nil, n))) + int64(n) + 4
+	}
+}
+
+func (c *SecureLRUCache) applyWALRecord(payload []byte) error {
+	op, rest := payload[0], payload[1:]
+	read := func() int64 {
+		v, n := binary.Varint(rest)
+		if n <= 0 {
+			rest = nil
+			return 0
+		}
+		rest = rest[n:]
+		return v
+	}
+
+	switch op {
+	case walPut:
+		key, value, cost, expires := int(read()), int(read()), read(), read()
+		c.mu.Lock()
+		var expiresAt time.Time
+		if expires != 0 {
+			expiresAt = time.Unix(0, expires)
+		}
+		if !expiresAt.IsZero() && !c.clock.Now().Before(expiresAt) {
+			// Expired since; the write still replaced any older value.
+			if node, exists := c.cache[key]; exists {
+				c.deleteNode(node)
+				c.releaseNode(node)
+			}
+		} else {
+			old, live := c.cache[key]
+			live = live && c.visible(old)
+			var oldValue int
+			if live {
+				oldValue = old.value
+			}
+			_, lru, err := c.set(key, value, max(cost, 1), expiresAt)
+			if err != nil && !errors.Is(err, errAdmissionRejected) && !errors.Is(err, ErrEntryTooLarge) {
+				c.unlock()
+				return err
+			}
+			if lru != nil {
+				c.releaseNode(lru)
+			}
+			if err == nil {
+				c.replayed(key, oldValue, value, live)
+			}
+		}
+		c.unlock()
+	case walRemove:
+		c.Remove(int(read()))
+	case walClear:
+		c.Clear()
+	case walResize:
+		n, size := binary.Uvarint(rest)
+		if size <= 0 || n < 1 {
+			return fmt.Errorf("bad resize record")
+		}
+		if err := c.Resize(int(n)); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown wal record %d", op)
+	}
+	return nil
+}
+
+func (c *SecureLRUCache) startWAL() {
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		ticker := time.NewTicker(c.wal.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := c.wal.flush(false)
+				if err == nil {
+					err = c.compactIfNeeded()
+				}
+				if err != nil && c.logger != nil {
+					c.logger.LogAttrs(context.Background(), slog.LevelError, "wal flush failed",
+						slog.String("path", c.wal.path), slog.Any("error", err))
+				}
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// closeWAL syncs and closes the log when the cache is closed. Writes made
+// after Close are no longer logged.
+func (c *SecureLRUCache) closeWAL() error {
+	err := c.wal.flush(true)
+	c.wal.mu.Lock()
+	defer c.wal.mu.Unlock()
+	c.wal.closed = true
+	c.wal.buf = nil
+	return errors.Join(err, c.wal.file.Close())
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func sortedKeys(c *SecureLRUCache) []int {
+	keys := c.Keys()
+	slices.Sort(keys)
+	return keys
+}
+
+func TestWALRecoversEvictions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.wal")
+	live := newTestCache(t, 2, WithWAL(path))
+	live.Put(1, 1)
+	live.Put(2, 2)
+	live.Get(1)
+	live.Put(3, 3) // evicts 2, not 1
+	if err := live.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered := newTestCache(t, 2, WithWAL(path))
+	live.Close()
+	if got, want := sortedKeys(recovered), sortedKeys(live); !slices.Equal(got, want) {
+		t.Fatalf("recovered keys %v, live cache held %v", got, want)
+	}
+}
+
+func TestWALRecoversRandomWorkload(t *testing.T) {
+	clock := newFakeClock()
+	path := filepath.Join(t.TempDir(), "cache.wal")
+	live := newTestCache(t, 8, WithWAL(path), WithClock(clock))
+
+	r := rand.New(rand.NewSource(1))
+	for range 2000 {
+		k := r.Intn(32)
+		switch r.Intn(10) {
+		case 0:
+			live.Remove(k)
+		case 1:
+			live.PutWithTTL(k, k, time.Duration(1+r.Intn(5))*time.Second)
+		case 2:
+			clock.Advance(time.Second)
+		case 3:
+			if r.Intn(20) == 0 {
+				live.Resize(4 + r.Intn(8))
+			}
+		case 4, 5, 6:
+			live.Get(k)
+		default:
+			live.Put(k, k)
+		}
+	}
+	if err := live.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered := newTestCache(t, live.Capacity(), WithWAL(path), WithClock(clock))
+	// Drop whatever has expired by now on both sides before comparing.
+	for k := range 32 {
+		live.Get(k)
+		recovered.Get(k)
+	}
+	if got, want := sortedKeys(recovered), sortedKeys(live); !slices.Equal(got, want) {
+		t.Fatalf("recovered keys %v, live cache held %v", got, want)
+	}
+	for _, k := range sortedKeys(live) {
+		if v, ok := recovered.Peek(k); !ok || v != k {
+			t.Fatalf("recovered Peek(%d) = %d, %v", k, v, ok)
+		}
+	}
+}
+
+func TestWALRecoversTouch(t *testing.T) {
+	clock := newFakeClock()
+	path := filepath.Join(t.TempDir(), "cache.wal")
+	live := newTestCache(t, 4, WithWAL(path), WithClock(clock))
+	live.PutWithTTL(1, 10, time.Second)
+	live.Touch(1, time.Hour)
+	if err := live.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	live.Close()
+
+	clock.Advance(time.Minute)
+	recovered := newTestCache(t, 4, WithWAL(path), WithClock(clock))
+	if v, ok := recovered.Get(1); !ok || v != 10 {
+		t.Errorf("Get(1) = %d, %v after recovery, want the touched entry", v, ok)
+	}
+}
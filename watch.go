@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+type EventOp int
+
+const (
+	EventPut EventOp = iota + 1
+	EventRemove
+	EventEvicted
+	EventExpired
+	// EventUpdate is an overwrite of a live key. Watch reports it as
+	// EventPut.
+	EventUpdate
+	// EventResize and EventClear are only delivered by Events; Watch sees
+	// a Clear as an EventRemove for its key.
+	EventResize
+	EventClear
+)
+
+func (op EventOp) String() string {
+	switch op {
+	case EventPut:
+		return "put"
+	case EventRemove:
+		return "remove"
+	case EventEvicted:
+		return "evicted"
+	case EventExpired:
+		return "expired"
+	case EventUpdate:
+		return "update"
+	case EventResize:
+		return "resize"
+	case EventClear:
+		return "clear"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a change to one key. Value is the value written by a Put
+// or the value the entry held when it left the cache, and Reason says why an
+// entry left.
+type Event struct {
+	Op     EventOp
+	Key    int
+	Value  int
+	Reason EvictReason
+}
+
+const watchBuffer = 16
+
+type watcher struct {
+	key int
+	ch  chan Event
+}
+
+type keyWaiters struct {
+	ready chan struct{}
+	value int
+	count int
+}
+
+// GetWait returns the value for key, waiting for it to be Put if it is not
+// cached yet. A waiter receives the value that was Put even if it is evicted
+// again before the waiter runs. If ctx is done first GetWait returns ctx.Err().
+func (c *SecureLRUCache) GetWait(ctx context.Context, key int) (int, error) {
+	c.mu.Lock()
+	if node, exists := c.lookup(key); exists && !node.tombstone {
+		c.access(node)
+		value := node.value
+		c.unlock()
+		c.stats.hits.Add(1)
+		return value, nil
+	}
+
+	w, exists := c.waiters[key]
+	if !exists {
+		w = &keyWaiters{ready: make(chan struct{})}
+		c.waiters[key] = w
+	}
+	w.count++
+	c.unlock()
+
+	select {
+	case <-w.ready:
+		return w.value, nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		w.count--
+		if w.count == 0 && c.waiters[key] == w {
+			delete(c.waiters, key)
+		}
+		c.unlock()
+		return 0, ctx.Err()
+	}
+}
+
+// wake releases everyone waiting in GetWait for key. The caller must hold the
+// write lock.
+func (c *SecureLRUCache) wake(key, value int) {
+	w, exists := c.waiters[key]
+	if !exists {
+		return
+	}
+	w.value = value
+	close(w.ready)
+	delete(c.waiters, key)
+}
+
+// Watch subscribes to changes of key. Events are delivered after the change
+// is made and the cache lock released; a subscriber whose buffer is full
+// misses the newest events, which are counted in Stats().DroppedEvents. The
+// returned func unsubscribes and closes the channel.
+func (c *SecureLRUCache) Watch(key int) (<-chan Event, func()) {
+	w := &watcher{key: key, ch: make(chan Event, watchBuffer)}
+
+	c.watchMu.Lock()
+	set, exists := c.watchers[key]
+	if !exists {
+		set = make(map[*watcher]struct{})
+		c.watchers[key] = set
+	}
+	set[w] = struct{}{}
+	c.watchMu.Unlock()
+	atomic.AddInt64(&c.watchCount, 1)
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			c.watchMu.Lock()
+			delete(set, w)
+			if len(set) == 0 {
+				delete(c.watchers, key)
+			}
+			close(w.ch)
+			c.watchMu.Unlock()
+			atomic.AddInt64(&c.watchCount, -1)
+		})
+	}
+	return w.ch, cancel
+}
+
+// record queues ev for delivery once the write lock is released. The caller
+// must hold the write lock.
+func (c *SecureLRUCache) record(ev Event) {
+	if c.wal != nil {
+		c.logWrite(ev)
+	}
+	if c.audit != nil {
+		c.auditEvent(ev)
+	}
+	if c.stream.active > 0 {
+		c.publish(ev)
+	}
+	switch ev.Op {
+	case EventEvicted, EventRemove, EventExpired:
+		c.evicted(ev)
+	}
+	if atomic.LoadInt64(&c.watchCount) == 0 || ev.Op == EventResize {
+		return
+	}
+	c.pending = append(c.pending, ev)
+}
+
+// unlock releases the write lock and then delivers the events, hook calls and
+// log records queued while it was held, so subscribers, hooks and log
+// handlers never run under the lock and may call back into the cache. Every
+// write lock is released here, so this holds for Put, Remove, Resize, Clear, expiry and the
+// background workers alike. The records of one operation are delivered in
+// the order they happened, evictions in eviction order, before the method
+// that made them returns. Records of concurrent operations may interleave.
+func (c *SecureLRUCache) unlock() {
+	c.release().deliver(c)
+}
+
+// queued is what a write lock holder left for delivery.
+type queued struct {
+	events []Event
+	logs   []logRecord
+	invs   []Invalidation
+	hooks  []hookCall
+}
+
+// release releases the write lock like unlock but leaves the delivery to the
+// caller, for one that must release several caches before anything queued
+// may call back into them.
+func (c *SecureLRUCache) release() queued {
+	if c.debugChecks {
+		if err := c.checkInvariants(); err != nil {
+			c.mu.Unlock()
+			panic(fmt.Sprintf("cache invariants violated: %v", err))
+		}
+	}
+	q := queued{events: c.pending, logs: c.logs, hooks: c.takeHookCalls()}
+	c.pending = nil
+	c.logs = nil
+	if c.bus != nil {
+		q.invs = c.bus.pending
+		c.bus.pending = nil
+	}
+	c.mu.Unlock()
+	return q
+}
+
+func (q queued) deliver(c *SecureLRUCache) {
+	if len(q.events) > 0 {
+		c.dispatch(q.events)
+	}
+	if len(q.hooks) > 0 {
+		c.runHooks(q.hooks)
+	}
+	if len(q.logs) > 0 {
+		c.flushLogs(q.logs)
+	}
+	if len(q.invs) > 0 {
+		c.publishInvalidations(q.invs)
+	}
+}
+
+func (c *SecureLRUCache) dispatch(events []Event) {
+	c.watchMu.RLock()
+	defer c.watchMu.RUnlock()
+
+	for _, ev := range events {
+		if ev.Op == EventUpdate {
+			ev.Op = EventPut
+		}
+		if ev.Op == EventClear {
+			for key, set := range c.watchers {
+				for w := range set {
+					c.send(w, Event{Op: EventRemove, Key: key})
+				}
+			}
+			continue
+		}
+		for w := range c.watchers[ev.Key] {
+			c.send(w, ev)
+		}
+	}
+}
+
+func (c *SecureLRUCache) send(w *watcher, ev Event) {
+	select {
+	case w.ch <- ev:
+	default:
+		c.stats.droppedEvents.Add(1)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetWaitWokenByPut(t *testing.T) {
+	c := newTestCache(t, 4)
+	got := make(chan int, 2)
+	for range 2 {
+		go func() {
+			v, err := c.GetWait(context.Background(), 1)
+			if err != nil {
+				t.Error(err)
+			}
+			got <- v
+		}()
+	}
+	// Both waiters are registered once the map holds them.
+	for {
+		c.mu.RLock()
+		w := c.waiters[1]
+		waiting := w != nil && w.count == 2
+		c.mu.RUnlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Put(1, 10)
+	for range 2 {
+		if v := <-got; v != 10 {
+			t.Errorf("waiter got %d, want 10", v)
+		}
+	}
+	if v, err := c.GetWait(context.Background(), 1); err != nil || v != 10 {
+		t.Errorf("GetWait on a cached key = %d, %v", v, err)
+	}
+}
+
+func TestGetWaitTimesOut(t *testing.T) {
+	c := newTestCache(t, 4)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetWait(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	c.mu.RLock()
+	n := len(c.waiters)
+	c.mu.RUnlock()
+	if n != 0 {
+		t.Errorf("%d keys still waited on after the timeout", n)
+	}
+}
+
+func TestWatchDeliversChangesToItsKey(t *testing.T) {
+	c := newTestCache(t, 4)
+	events, cancel := c.Watch(1)
+	defer cancel()
+	c.Put(1, 10)
+	c.Put(2, 20)
+	c.Put(1, 11)
+	c.Remove(1)
+	want := []Event{
+		{Op: EventPut, Key: 1, Value: 10},
+		{Op: EventPut, Key: 1, Value: 11},
+		{Op: EventRemove, Key: 1, Value: 11, Reason: ReasonRemoved},
+	}
+	for _, w := range want {
+		if ev := <-events; ev != w {
+			t.Errorf("event %+v, want %+v", ev, w)
+		}
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %+v", ev)
+	default:
+	}
+}
+
+func TestWatchUnsubscribe(t *testing.T) {
+	c := newTestCache(t, 4)
+	events, cancel := c.Watch(1)
+	cancel()
+	cancel()
+	c.Put(1, 10)
+	if ev, ok := <-events; ok {
+		t.Errorf("event %+v after unsubscribing", ev)
+	}
+	c.watchMu.RLock()
+	n := len(c.watchers)
+	c.watchMu.RUnlock()
+	if n != 0 {
+		t.Errorf("%d keys still watched", n)
+	}
+}
+
+func TestSlowWatcherDoesNotBlockWriters(t *testing.T) {
+	c := newTestCache(t, 4)
+	_, cancel := c.Watch(1)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 1000 {
+			c.Put(1, i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("writers blocked on a watcher that never reads")
+	}
+	if got := c.Stats().DroppedEvents; got != 1000-watchBuffer {
+		t.Errorf("DroppedEvents = %d, want %d", got, 1000-watchBuffer)
+	}
+}
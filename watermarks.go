@@ -0,0 +1,39 @@
+package main
+
+import "fmt"
+
+// WithWatermarks makes a full cache evict in batches rather than one entry
+// per Put: a Put of a new key that finds high×capacity entries evicts until,
+// with the new entry, low×capacity remain, so the next (high-low)×capacity
+// inserts evict nothing. Both marks are rounded down to whole entries,
+// and at least one. Size never exceeds high×capacity, and so never exceeds
+// the capacity; the cost and byte budgets still evict one entry at a time.
+// The default, high and low both 1, evicts exactly one entry per insert into
+// a full cache.
+func WithWatermarks(high, low float64) Option {
+	return func(c *SecureLRUCache) error {
+		if !(low > 0 && low <= high && high <= 1) {
+			return fmt.Errorf("watermarks must satisfy 0 < low <= high <= 1, got high %v and low %v", high, low)
+		}
+		c.highWater, c.lowWater = high, low
+		return nil
+	}
+}
+
+// watermark is the entry count a fraction of the capacity allows.
+func (c *SecureLRUCache) watermark(f float64) int {
+	// The epsilon keeps 0.29×100 from rounding down to 28.
+	return max(1, int(f*float64(c.capacity)+1e-9))
+}
+
+// evictBelow is the entry count set evicts under before inserting a new
+// key. The caller holds the write lock.
+func (c *SecureLRUCache) evictBelow() int {
+	if c.highWater == 0 {
+		return c.capacity
+	}
+	if high := c.watermark(c.highWater); len(c.cache) < high {
+		return high
+	}
+	return c.watermark(c.lowWater)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// evictionClumps Puts n new keys into c and returns the number of
+// evictions each Put that evicted made, and the largest Size seen.
+func evictionClumps(t *testing.T, c *SecureLRUCache, n int) (clumps []int64, maxSize int) {
+	t.Helper()
+	last := c.Stats().Evictions
+	for k := range n {
+		if err := c.Put(1000+k, k); err != nil {
+			t.Fatal(err)
+		}
+		maxSize = max(maxSize, c.Size())
+		if ev := c.Stats().Evictions; ev != last {
+			clumps = append(clumps, ev-last)
+			last = ev
+		}
+	}
+	return clumps, maxSize
+}
+
+func TestWatermarksEvictInBatches(t *testing.T) {
+	c := newTestCache(t, 100, WithWatermarks(1, 0.9))
+	clumps, maxSize := evictionClumps(t, c, 310)
+	// The first 100 inserts fill the cache. The next finds it full and
+	// evicts 11, down to 89, so that with it 90 remain; 10 inserts later the
+	// cache is full again, so every 11th insert evicts 11.
+	if want := slices.Repeat([]int64{11}, 20); !slices.Equal(clumps, want) {
+		t.Errorf("eviction clumps %v, want %v", clumps, want)
+	}
+	if maxSize != 100 {
+		t.Errorf("Size peaked at %d, want the high mark of 100", maxSize)
+	}
+	if c.Size() != 90 {
+		t.Errorf("Size = %d just after a batch, want 90", c.Size())
+	}
+	// The batch takes the least recently used.
+	if c.Contains(1000+219) || !c.Contains(1000+220) {
+		t.Error("the batch did not evict the oldest entries")
+	}
+}
+
+func TestWatermarksBelowCapacity(t *testing.T) {
+	c := newTestCache(t, 10, WithWatermarks(0.8, 0.5))
+	clumps, maxSize := evictionClumps(t, c, 50)
+	if maxSize != 8 {
+		t.Errorf("Size peaked at %d, want the high mark of 8", maxSize)
+	}
+	// 8 entries evict down to 4 before the insert that leaves 5.
+	for _, n := range clumps {
+		if n != 4 {
+			t.Fatalf("eviction clumps %v, want batches of 4", clumps)
+		}
+	}
+}
+
+func TestDefaultWatermarksEvictOneAtATime(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"default":  nil,
+		"explicit": {WithWatermarks(1, 1)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := newTestCache(t, 10, opts...)
+			clumps, maxSize := evictionClumps(t, c, 30)
+			if want := slices.Repeat([]int64{1}, 20); !slices.Equal(clumps, want) || maxSize != 10 {
+				t.Errorf("clumps %v, max size %d", clumps, maxSize)
+			}
+		})
+	}
+}
+
+func TestWatermarksUpdateDoesNotEvict(t *testing.T) {
+	c := newTestCache(t, 4, WithWatermarks(1, 0.5))
+	for k := range 4 {
+		c.Put(k, k)
+	}
+	c.Put(2, 20)
+	if c.Stats().Evictions != 0 || c.Size() != 4 {
+		t.Errorf("an overwrite of a full cache evicted: %+v", c.Stats())
+	}
+}
+
+func TestWatermarksRejectsBadMarks(t *testing.T) {
+	for _, marks := range [][2]float64{{1.1, 0.9}, {0.8, 0.9}, {1, 0}, {1, -1}} {
+		if _, err := NewSecureLRUCache(10, WithWatermarks(marks[0], marks[1])); err == nil {
+			t.Errorf("WithWatermarks(%v, %v) accepted", marks[0], marks[1])
+		}
+	}
+}
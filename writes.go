@@ -0,0 +1,341 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithWriteThrough makes Put and PutWithTTL persist every write through fn
+// before installing it, and leave the cache untouched if fn fails. fn runs
+// without the cache lock held, so concurrent writes to the same key can reach
+// fn in one order and the cache in another; the last write to be installed
+// wins.
+func WithWriteThrough(fn func(key, value int) error) Option {
+	return func(c *SecureLRUCache) error {
+		if fn == nil {
+			return fmt.Errorf("write-through function must not be nil")
+		}
+		c.writeThrough = fn
+		return nil
+	}
+}
+
+// writeCond limits which keys a write may install.
+type writeCond int
+
+const (
+	writeAlways writeCond = iota
+	// writeIfAbsent writes only a key with no live entry.
+	writeIfAbsent
+	// writeIfPresent writes only a key with a live entry.
+	writeIfPresent
+)
+
+func (c *SecureLRUCache) write(key, value int, cost int64, ttl time.Duration) (evicted Entry, ok bool, err error) {
+	evicted, ok, _, err = c.writeIf(key, value, cost, ttl, writeAlways)
+	return evicted, ok, err
+}
+
+// writeIf is write for keys that meet cond, reporting whether the write
+// went ahead. With write-through the condition is checked before the store
+// is written and again before the cache is; a writer that gets in between
+// leaves the store written and the cache not.
+func (c *SecureLRUCache) writeIf(key, value int, cost int64, ttl time.Duration, cond writeCond) (evicted Entry, ok, written bool, err error) {
+	return c.writeIfAs("", key, value, cost, ttl, cond)
+}
+
+// writeIfAs is writeIf made for actor, as WithAudit records it.
+func (c *SecureLRUCache) writeIfAs(actor string, key, value int, cost int64, ttl time.Duration, cond writeCond) (evicted Entry, ok, written bool, err error) {
+	if c.writeThrough != nil {
+		if cond != writeAlways {
+			c.mu.RLock()
+			node, exists := c.cache[key]
+			live := exists && c.visible(node)
+			c.mu.RUnlock()
+			if live != (cond == writeIfPresent) {
+				return Entry{}, false, false, nil
+			}
+		}
+		if err := c.writeThrough(key, value); err != nil {
+			return Entry{}, false, false, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+	defer c.actAs(actor)()
+
+	c.touch(key)
+	old, exists := c.cache[key]
+	update := exists && c.visible(old)
+	if cond != writeAlways && update != (cond == writeIfPresent) {
+		return Entry{}, false, false, nil
+	}
+	var oldValue int
+	if update {
+		oldValue = old.value
+	}
+	_, lru, err := c.set(key, value, cost, c.deadline(ttl))
+	if errors.Is(err, errAdmissionRejected) {
+		// The cache declined the entry, but the write itself still
+		// stands and must reach the store.
+		if c.writeBehind != nil {
+			c.writeBehind.enqueue(key, value)
+		}
+		c.invalidate(Invalidation{Key: key})
+		return Entry{}, false, true, nil
+	}
+	if err != nil {
+		return Entry{}, false, false, err
+	}
+	if lru != nil {
+		// Tombstones and expired entries pushed out are not reported.
+		if c.visible(lru) {
+			evicted, ok = Entry{Key: lru.key, Value: lru.value}, true
+		}
+		c.releaseNode(lru)
+	}
+	op := EventPut
+	if update {
+		op = EventUpdate
+		c.stats.updates.Add(1)
+	} else {
+		c.stats.puts.Add(1)
+	}
+	c.wake(key, value)
+	c.record(Event{Op: op, Key: key, Value: value})
+	if update {
+		c.updated(key, oldValue, value)
+	} else {
+		c.added(key, value)
+	}
+	c.traceOp(TracePut, key, update)
+	if c.writeBehind != nil {
+		c.writeBehind.enqueue(key, value)
+	}
+	c.invalidate(Invalidation{Key: key})
+	return evicted, ok, true, nil
+}
+
+// PutIfAbsent is Put for a key with no live entry, reporting whether it
+// stored value.
+func (c *SecureLRUCache) PutIfAbsent(key, value int) (bool, error) {
+	_, _, written, err := c.writeIf(key, value, 1, c.defaultTTL, writeIfAbsent)
+	return written, err
+}
+
+// GetOrPut returns the live value for key, read as Get would, or else
+// stores value as Put would, reporting whether the value returned was
+// already cached. A value that is stored and at once removed by another
+// caller is still returned, as it was stored first.
+func (c *SecureLRUCache) GetOrPut(key, value int) (actual int, loaded bool, err error) {
+	for {
+		if v, ok := c.Get(key); ok {
+			return v, true, nil
+		}
+		written, err := c.PutIfAbsent(key, value)
+		if err != nil || written {
+			return value, false, err
+		}
+		// Another caller stored key first; read its value.
+	}
+}
+
+// Replace is Put for a key that already has a live entry, reporting whether
+// it stored value. The entry takes the default TTL, as with Put.
+func (c *SecureLRUCache) Replace(key, value int) (bool, error) {
+	_, _, written, err := c.writeIf(key, value, 1, c.defaultTTL, writeIfPresent)
+	return written, err
+}
+
+// Touch gives the live entry for key a TTL of ttl from now, or no TTL if ttl
+// is not positive, without reading or changing its value. It reports whether
+// there was such an entry.
+func (c *SecureLRUCache) Touch(key int, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.unlock()
+
+	node, ok := c.lookup(key)
+	if !ok || !c.visible(node) {
+		return false
+	}
+	node.expiresAt = c.deadline(ttl)
+	c.record(Event{Op: EventUpdate, Key: key, Value: node.value})
+	return true
+}
+
+type Entry struct {
+	Key   int `json:"key"`
+	Value int `json:"value"`
+}
+
+type writeBehind struct {
+	flush    func([]Entry) error
+	interval time.Duration
+	maxBatch int
+	attempts int
+	backoff  time.Duration
+	onError  func(batch []Entry, err error)
+	kick     chan struct{}
+
+	// flushing serializes calls to flush; mu guards the queue.
+	flushing sync.Mutex
+	mu       sync.Mutex
+	pending  map[int]int
+	order    []int
+}
+
+// WithWriteBehind makes Put install entries immediately and queue them for
+// flush, which a background worker calls every interval or as soon as
+// maxBatch distinct keys are queued. Writes to a key that is still queued
+// coalesce to the latest value, and queued entries are flushed even if the
+// cache evicts them first. Close drains the queue.
+func WithWriteBehind(flush func([]Entry) error, interval time.Duration, maxBatch int) Option {
+	return func(c *SecureLRUCache) error {
+		if flush == nil {
+			return fmt.Errorf("write-behind flush function must not be nil")
+		}
+		if interval <= 0 {
+			return fmt.Errorf("write-behind interval must be positive")
+		}
+		if maxBatch < 1 {
+			return fmt.Errorf("write-behind batch size must be at least 1")
+		}
+		c.writeBehind = &writeBehind{
+			flush:    flush,
+			interval: interval,
+			maxBatch: maxBatch,
+			attempts: 1,
+			kick:     make(chan struct{}, 1),
+			pending:  make(map[int]int),
+		}
+		return nil
+	}
+}
+
+// WithWriteBehindRetry retries a failed write-behind batch up to attempts
+// times in total, sleeping backoff before the second attempt and doubling it
+// each time after. It must follow WithWriteBehind.
+func WithWriteBehindRetry(attempts int, backoff time.Duration) Option {
+	return func(c *SecureLRUCache) error {
+		if c.writeBehind == nil {
+			return fmt.Errorf("write-behind is not enabled")
+		}
+		if attempts < 1 {
+			return fmt.Errorf("write-behind attempts must be at least 1")
+		}
+		if backoff < 0 {
+			return fmt.Errorf("write-behind backoff must not be negative")
+		}
+		c.writeBehind.attempts = attempts
+		c.writeBehind.backoff = backoff
+		return nil
+	}
+}
+
+// WithWriteBehindErrorHandler receives each batch that is dropped because it
+// still failed after the last attempt. It must follow WithWriteBehind.
+func WithWriteBehindErrorHandler(fn func(batch []Entry, err error)) Option {
+	return func(c *SecureLRUCache) error {
+		if c.writeBehind == nil {
+			return fmt.Errorf("write-behind is not enabled")
+		}
+		c.writeBehind.onError = fn
+		return nil
+	}
+}
+
+func (w *writeBehind) enqueue(key, value int) {
+	w.mu.Lock()
+	if _, queued := w.pending[key]; !queued {
+		w.order = append(w.order, key)
+	}
+	w.pending[key] = value
+	full := len(w.order) >= w.maxBatch
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *writeBehind) next() []Entry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := min(len(w.order), w.maxBatch)
+	if n == 0 {
+		return nil
+	}
+	batch := make([]Entry, n)
+	for i, key := range w.order[:n] {
+		batch[i] = Entry{Key: key, Value: w.pending[key]}
+		delete(w.pending, key)
+	}
+	w.order = w.order[n:]
+	return batch
+}
+
+func (w *writeBehind) flushBatch(batch []Entry) error {
+	backoff := w.backoff
+	for attempt := 1; ; attempt++ {
+		err := w.flush(batch)
+		if err == nil {
+			return nil
+		}
+		if attempt >= w.attempts {
+			if w.onError != nil {
+				w.onError(batch, err)
+			}
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (c *SecureLRUCache) startWriteBehind() {
+	w := c.writeBehind
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-w.kick:
+			case <-c.done:
+				return
+			}
+			c.Flush()
+		}
+	}()
+}
+
+// Flush applies any buffered promotions, then synchronously writes out
+// everything queued for write-behind and returns the last error encountered.
+// Batches that fail are dropped after their final attempt.
+func (c *SecureLRUCache) Flush() error {
+	c.flushPromotions()
+	w := c.writeBehind
+	if w == nil {
+		return nil
+	}
+
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+
+	var err error
+	for batch := w.next(); batch != nil; batch = w.next() {
+		if batchErr := w.flushBatch(batch); batchErr != nil {
+			err = batchErr
+		}
+	}
+	return err
+}
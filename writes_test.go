@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchLog collects the batches a write-behind flush is handed.
+type batchLog struct {
+	mu      sync.Mutex
+	batches [][]Entry
+	flushed chan struct{}
+	err     error
+}
+
+func newBatchLog(err error) *batchLog {
+	return &batchLog{flushed: make(chan struct{}, 16), err: err}
+}
+
+func (l *batchLog) flush(batch []Entry) error {
+	l.mu.Lock()
+	l.batches = append(l.batches, slices.Clone(batch))
+	l.mu.Unlock()
+	l.flushed <- struct{}{}
+	return l.err
+}
+
+func (l *batchLog) all() [][]Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.batches)
+}
+
+func TestWriteBehindFlushesOnClose(t *testing.T) {
+	log := newBatchLog(nil)
+	c, err := NewSecureLRUCache(2, WithWriteBehind(log.flush, time.Hour, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(1, 1)
+	c.Put(2, 2)
+	c.Put(1, 10)
+	c.Put(3, 3) // evicts 2, which is still flushed
+	if got := log.all(); len(got) != 0 {
+		t.Fatalf("flushed %v before the interval or a full batch", got)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]Entry{{{Key: 1, Value: 10}, {Key: 2, Value: 2}, {Key: 3, Value: 3}}}
+	if got := log.all(); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("Close flushed %v, want %v", got, want)
+	}
+}
+
+func TestWriteBehindBatches(t *testing.T) {
+	log := newBatchLog(nil)
+	c := newTestCache(t, 8, WithWriteBehind(log.flush, time.Hour, 2))
+	c.Put(1, 1)
+	c.Put(2, 2)
+	select {
+	case <-log.flushed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("a full batch was not flushed")
+	}
+	c.Put(3, 3)
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]Entry{{{Key: 1, Value: 1}, {Key: 2, Value: 2}}, {{Key: 3, Value: 3}}}
+	if got := log.all(); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("flushed %v, want %v", got, want)
+	}
+}
+
+func TestWriteBehindFlushError(t *testing.T) {
+	down := errors.New("store down")
+	log := newBatchLog(down)
+	var dropped []Entry
+	c := newTestCache(t, 8,
+		WithWriteBehind(log.flush, time.Hour, 100),
+		WithWriteBehindRetry(3, 0),
+		WithWriteBehindErrorHandler(func(batch []Entry, err error) {
+			if !errors.Is(err, down) {
+				t.Errorf("error handler got %v", err)
+			}
+			dropped = batch
+		}))
+	c.Put(1, 1)
+	if err := c.Flush(); !errors.Is(err, down) {
+		t.Errorf("Flush err = %v, want %v", err, down)
+	}
+	if n := len(log.all()); n != 3 || !slices.Equal(dropped, []Entry{{Key: 1, Value: 1}}) {
+		t.Errorf("%d attempts, dropping %v; want 3 dropping key 1", n, dropped)
+	}
+	if err := c.Flush(); err != nil || len(log.all()) != 3 {
+		t.Errorf("the dropped batch was retried: %v", err)
+	}
+	if v, ok := c.Get(1); !ok || v != 1 {
+		t.Errorf("Get(1) = %d, %v; a failed flush must keep the entry", v, ok)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSnapshotRefused is returned by the snapshot methods of a cache built
+// with WithZeroize but not WithRedactedSnapshots.
+var ErrSnapshotRefused = errors.New("snapshots are refused under WithZeroize")
+
+// WithZeroize keeps values from outliving their entries in memory the cache
+// owns. Entries that are evicted, removed, expired or replaced already have
+// their nodes zeroed once their events are recorded; with WithZeroize so do
+// those Clear and Restore drop all at once, by a background worker that Close
+// waits for, even under WithDenseStorage, whose chunks otherwise just wait
+// for the collector. Snapshots, which would copy every value out, are refused with
+// ErrSnapshotRefused unless WithRedactedSnapshots is also given; Dump, which
+// cannot fail, redacts either way. Values handed out, in results and
+// events, are the caller's copies. WithPersistence and WithWAL, which keep
+// values on disk, cannot be combined with it.
+func WithZeroize() Option {
+	return func(c *SecureLRUCache) error {
+		c.zeroize = true
+		return nil
+	}
+}
+
+// WithRedactedSnapshots makes Dump and every snapshot format write each
+// value as 0, keeping keys, order, costs, expiries and policy state.
+func WithRedactedSnapshots() Option {
+	return func(c *SecureLRUCache) error {
+		c.redactDumps = true
+		return nil
+	}
+}
+
+func (c *SecureLRUCache) checkZeroize() error {
+	if c.persist != nil || c.wal != nil {
+		return fmt.Errorf("zeroize cannot be combined with persistence or a write-ahead log")
+	}
+	return nil
+}
+
+// snapshotAllowed returns ErrSnapshotRefused if snapshots must be refused.
+func (c *SecureLRUCache) snapshotAllowed() error {
+	if c.zeroize && !c.redactDumps {
+		return ErrSnapshotRefused
+	}
+	return nil
+}
+
+// redacting reports whether snapshots carry zero for every value.
+func (c *SecureLRUCache) redacting() bool {
+	return c.zeroize || c.redactDumps
+}
+
+// redact zeroes the values of d if snapshots are redacted.
+func (c *SecureLRUCache) redact(d *CacheDump) {
+	if c.redacting() {
+		for key := range d.Items {
+			d.Items[key] = 0
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// nodeFor returns the node holding key, to be checked once the cache has
+// dropped it.
+func nodeFor(t *testing.T, c *SecureLRUCache, key int) *Node {
+	t.Helper()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	node, ok := c.cache[key]
+	if !ok {
+		t.Fatalf("key %d not cached", key)
+	}
+	return node
+}
+
+func wiped(node *Node) bool {
+	return node.key == 0 && node.value == 0 && node.prev == nil && node.next == nil
+}
+
+func TestZeroizeWipesDroppedEntries(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(t, 4, WithZeroize(), WithClock(clock))
+	events, cancel := c.Events(16)
+	defer cancel()
+	secret := 0x5ec2e7
+
+	c.Put(1, secret)
+	removed := nodeFor(t, c, 1)
+	c.Remove(1)
+	if !wiped(removed) {
+		t.Errorf("removed node still holds %+v", removed)
+	}
+	// The event was recorded, value and all, before the node was wiped.
+	for e := range events {
+		if e.Op == EventRemove {
+			if e.Value != secret {
+				t.Errorf("removal event carries %d, want %d", e.Value, secret)
+			}
+			break
+		}
+	}
+	c.PutWithTTL(2, secret, time.Second)
+	expired := nodeFor(t, c, 2)
+	clock.Advance(2 * time.Second)
+	c.Get(2)
+	if !wiped(expired) {
+		t.Errorf("expired node still holds %+v", expired)
+	}
+	for k := 10; k < 14; k++ {
+		c.Put(k, secret)
+	}
+	evicted := nodeFor(t, c, 10)
+	c.Put(14, 0)
+	if !wiped(evicted) {
+		t.Errorf("evicted node still holds %+v", evicted)
+	}
+
+	var held []*Node
+	for _, k := range c.Keys() {
+		held = append(held, nodeFor(t, c, k))
+	}
+	d := c.Dump()
+	c.Clear()
+	c.drains.Wait()
+	for _, node := range held {
+		if !wiped(node) {
+			t.Errorf("node dropped by Clear still holds %+v", node)
+		}
+	}
+
+	c.Put(20, secret)
+	replaced := nodeFor(t, c, 20)
+	if err := c.Restore(d); err != nil {
+		t.Fatal(err)
+	}
+	c.drains.Wait()
+	if !wiped(replaced) {
+		t.Errorf("node dropped by Restore still holds %+v", replaced)
+	}
+}
+
+func TestZeroizeRefusesSnapshots(t *testing.T) {
+	c := newTestCache(t, 4, WithZeroize())
+	c.Put(1, 42)
+	snapshots := map[string]func() error{
+		"ToJSON":       func() error { _, err := c.ToJSON(); return err },
+		"ToJSONPretty": func() error { _, err := c.ToJSONPretty(); return err },
+		"MarshalJSON":  func() error { _, err := c.MarshalJSON(); return err },
+		"MarshalBinary": func() error {
+			_, err := c.MarshalBinary()
+			return err
+		},
+		"MarshalMsgpack": func() error { _, err := c.MarshalMsgpack(); return err },
+		"WriteTo":        func() error { _, err := c.WriteTo(&bytes.Buffer{}); return err },
+		"SaveCompressed": func() error { _, err := c.SaveCompressed(&bytes.Buffer{}, 1); return err },
+		"SaveEncrypted": func() error {
+			_, err := c.SaveEncrypted(&bytes.Buffer{}, snapshotKey)
+			return err
+		},
+		"SaveToFile": func() error { return c.SaveToFile(filepath.Join(t.TempDir(), "snap")) },
+		"DumpChunked": func() error {
+			return c.DumpChunked(10, func(CacheDump) bool { return true })
+		},
+	}
+	for name, snapshot := range snapshots {
+		if err := snapshot(); !errors.Is(err, ErrSnapshotRefused) {
+			t.Errorf("%s: %v, want ErrSnapshotRefused", name, err)
+		}
+	}
+	if d := c.Dump(); d.Items[1] != 0 || !slices.Equal(d.Order, []int{1}) {
+		t.Errorf("Dump = %+v, want key 1 with its value redacted", d)
+	}
+}
+
+func TestRedactedSnapshots(t *testing.T) {
+	c := newTestCache(t, 4, WithZeroize(), WithRedactedSnapshots())
+	c.Put(1, 42)
+	c.Put(2, 43)
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := c.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("WriteTo and MarshalBinary differ")
+	}
+	restored := newTestCache(t, 4)
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.Dump(); !slices.Equal(got.Order, []int{2, 1}) || got.Items[1] != 0 || got.Items[2] != 0 {
+		t.Errorf("restored %+v, want keys 2 and 1 with zero values", got)
+	}
+}
+
+func TestZeroizeRejectsDiskBackedOptions(t *testing.T) {
+	dir := t.TempDir()
+	for name, opt := range map[string]Option{
+		"persistence": WithPersistence(filepath.Join(dir, "snap"), 0),
+		"wal":         WithWAL(filepath.Join(dir, "wal")),
+	} {
+		if _, err := NewSecureLRUCache(4, WithZeroize(), opt); err == nil {
+			t.Errorf("WithZeroize accepted with %s", name)
+		}
+	}
+}